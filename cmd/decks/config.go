@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultURL    = "http://localhost:4000"
+	defaultOutput = outputTable
+)
+
+// Settings used by every command.
+// They come from flags, environment variables or a config file, in that order.
+type config struct {
+	URL    string `json:"url"`
+	APIKey string `json:"api_key"`
+	Output string `json:"output"`
+}
+
+// Flags shared by every command, so they can be given after the command name too.
+type globalFlags struct {
+	configPath string
+	url        string
+	apiKey     string
+	output     string
+}
+
+func addGlobalFlags(fs *flag.FlagSet, flags *globalFlags) {
+	fs.StringVar(&flags.configPath, "config", "", "path to the config file (env: DECKS_CONFIG)")
+	fs.StringVar(&flags.url, "url", "", "URL of the decks API (env: DECKS_API_URL, default: "+defaultURL+")")
+	fs.StringVar(&flags.apiKey, "api-key", "", "API key sent with requests (env: DECKS_API_KEY)")
+	fs.StringVar(&flags.output, "o", "", "output format: table, json or glyphs (env: DECKS_OUTPUT, default: table)")
+}
+
+// The config file is optional, unless one is explicitly given.
+// Without one, the decks/config.json file in the user config directory is used, if it exists.
+func loadConfig(flags *globalFlags, getenv func(string) string) (*config, error) {
+	c := &config{}
+
+	path := firstNonEmpty(flags.configPath, getenv("DECKS_CONFIG"))
+	explicit := path != ""
+	if !explicit {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "decks", "config.json")
+		}
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, c); err != nil {
+				return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("error reading config file: %v", err)
+		}
+	}
+
+	c.URL = firstNonEmpty(flags.url, getenv("DECKS_API_URL"), c.URL, defaultURL)
+	c.APIKey = firstNonEmpty(flags.apiKey, getenv("DECKS_API_KEY"), c.APIKey)
+	c.Output = firstNonEmpty(flags.output, getenv("DECKS_OUTPUT"), c.Output, defaultOutput)
+
+	switch c.Output {
+	case outputTable, outputJSON, outputGlyphs:
+	default:
+		return nil, fmt.Errorf("invalid output format '%s'", c.Output)
+	}
+
+	return c, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,251 @@
+// A command-line tool for the decks API.
+//
+//	decks create [--shuffled] [--cards AS,KH]
+//	decks open <deck-id>
+//	decks draw <deck-id> [-n 1] [--if-version N]
+//	decks watch <deck-id> [--after N]
+//
+// Every command also takes --url, --api-key, --config and -o.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/client"
+)
+
+const usage = `Usage: decks <command> [flags]
+
+Commands:
+  create               create a new deck
+  open <deck-id>       show a deck and its cards
+  draw <deck-id>       draw cards from a deck
+  watch <deck-id>      print the events of a deck as they happen
+
+Run 'decks <command> -h' to see the flags of a command.
+`
+
+// Usage errors exit with 2, like the flag package does.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr, os.Getenv))
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, getenv func(string) string) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	commands := map[string]func(context.Context, *command) error{
+		"create": createDeck,
+		"open":   openDeck,
+		"draw":   drawCards,
+		"watch":  watchDeck,
+	}
+
+	name := args[0]
+	handler, ok := commands[name]
+	if !ok {
+		if name == "-h" || name == "--help" || name == "help" {
+			fmt.Fprint(stdout, usage)
+			return 0
+		}
+
+		fmt.Fprintf(stderr, "decks: unknown command '%s'\n\n%s", name, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("decks "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cmd := &command{flags: fs, getenv: getenv, stdout: stdout}
+	addGlobalFlags(fs, &cmd.global)
+	cmd.args = args[1:]
+
+	err := handler(ctx, cmd)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(stderr, "decks %s: %v\n", name, err)
+		fs.Usage()
+		return 2
+	case errors.Is(err, context.Canceled) && ctx.Err() != nil:
+		// Interrupted by the user, usually to stop watching a deck.
+		return 0
+	default:
+		fmt.Fprintf(stderr, "decks %s: %v\n", name, err)
+		return 1
+	}
+}
+
+// The state of a single command invocation.
+// Commands register their own flags, and then call parse,
+// which also loads the config and creates the client.
+type command struct {
+	flags  *flag.FlagSet
+	global globalFlags
+	args   []string
+	getenv func(string) string
+	stdout io.Writer
+
+	client  *client.Client
+	printer *printer
+}
+
+// Flags can come before or after positional arguments,
+// like 'decks draw <deck-id> -n 3', which the flag package alone doesn't allow.
+func (c *command) parse(positional int) ([]string, error) {
+	values := []string{}
+	args := c.args
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		if c.flags.NArg() == 0 {
+			break
+		}
+
+		values = append(values, c.flags.Arg(0))
+		args = c.flags.Args()[1:]
+	}
+
+	if len(values) != positional {
+		return nil, fmt.Errorf("%w: expected %d argument(s), got %d", errUsage, positional, len(values))
+	}
+
+	config, err := loadConfig(&c.global, c.getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []client.Option{}
+	if config.APIKey != "" {
+		options = append(options, client.WithAPIKey(config.APIKey))
+	}
+
+	c.client = client.New(config.URL, options...)
+	c.printer = &printer{format: config.Output, out: c.stdout}
+	return values, nil
+}
+
+func parseDeckID(value string) (uuid.UUID, error) {
+	deckID, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: invalid deck ID '%s'", errUsage, value)
+	}
+
+	return deckID, nil
+}
+
+func createDeck(ctx context.Context, cmd *command) error {
+	shuffled := cmd.flags.Bool("shuffled", false, "shuffle the deck")
+	codes := cmd.flags.String("cards", "", "comma-separated card codes, like AS,KH (default: all 52 cards)")
+	if _, err := cmd.parse(0); err != nil {
+		return err
+	}
+
+	opts := client.CreateDeckOptions{Shuffled: *shuffled}
+	if *codes != "" {
+		list := strings.Split(*codes, ",")
+		for _, code := range list {
+			if strings.TrimSpace(code) == "" {
+				return fmt.Errorf("%w: card codes can't be empty", errUsage)
+			}
+		}
+
+		deckCards, err := cards.CodesToCardList(list)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errUsage, err)
+		}
+
+		opts.Cards = deckCards
+	}
+
+	deck, err := cmd.client.CreateDeck(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	return cmd.printer.printDeck(deck, false)
+}
+
+func openDeck(ctx context.Context, cmd *command) error {
+	args, err := cmd.parse(1)
+	if err != nil {
+		return err
+	}
+
+	deckID, err := parseDeckID(args[0])
+	if err != nil {
+		return err
+	}
+
+	deck, err := cmd.client.OpenDeck(ctx, deckID)
+	if err != nil {
+		return err
+	}
+
+	return cmd.printer.printDeck(deck, true)
+}
+
+func drawCards(ctx context.Context, cmd *command) error {
+	count := cmd.flags.Int("n", 1, "number of cards to draw")
+	ifVersion := cmd.flags.Int64("if-version", 0, "only draw if the deck is at this version")
+	args, err := cmd.parse(1)
+	if err != nil {
+		return err
+	}
+
+	deckID, err := parseDeckID(args[0])
+	if err != nil {
+		return err
+	}
+
+	if *count < 0 {
+		return fmt.Errorf("%w: -n must be positive", errUsage)
+	}
+
+	result, err := cmd.client.Draw(ctx, deckID, *count, client.DrawOptions{IfVersion: *ifVersion})
+	if err != nil {
+		return err
+	}
+
+	return cmd.printer.printDraw(result)
+}
+
+func watchDeck(ctx context.Context, cmd *command) error {
+	after := cmd.flags.Int64("after", -1, "also print the events after this version, instead of only new ones")
+	args, err := cmd.parse(1)
+	if err != nil {
+		return err
+	}
+
+	deckID, err := parseDeckID(args[0])
+	if err != nil {
+		return err
+	}
+
+	opts := client.WatchOptions{}
+	if *after >= 0 {
+		opts.AfterVersion = after
+	}
+
+	return cmd.client.Watch(ctx, deckID, opts, cmd.printer.printEvent)
+}
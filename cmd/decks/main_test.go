@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucaspin/decks-api/pkg/api"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__Commands(t *testing.T) {
+	server := httptest.NewServer(api.NewServer(storage.NewInMemoryStorage()).Handler())
+	t.Cleanup(server.Close)
+
+	// An empty config file, so the one in the user config directory is not used.
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{}`), 0600))
+	env := map[string]string{"DECKS_API_URL": server.URL, "DECKS_CONFIG": configPath}
+
+	t.Run("create, open and draw", func(t *testing.T) {
+		deck := deckJSON{}
+		stdout := runJSON(t, env, &deck, "create", "--cards", "AS,KD,AC", "-o", "json")
+		require.NotEmpty(t, deck.DeckID, stdout)
+		require.Equal(t, 3, deck.Remaining)
+		require.Equal(t, storage.InitialVersion, deck.Version)
+		require.Empty(t, deck.Cards)
+
+		draw := drawJSON{}
+		runJSON(t, env, &draw, "draw", deck.DeckID, "-n", "2", "-o", "json")
+		require.Equal(t, []string{"AS", "KD"}, draw.Cards)
+		require.Equal(t, int64(2), draw.Version)
+
+		opened := deckJSON{}
+		runJSON(t, env, &opened, "open", "-o", "json", deck.DeckID)
+		require.Equal(t, deck.DeckID, opened.DeckID)
+		require.Equal(t, 1, opened.Remaining)
+		require.Equal(t, []string{"AC"}, opened.Cards)
+	})
+
+	t.Run("table output", func(t *testing.T) {
+		deck := deckJSON{}
+		runJSON(t, env, &deck, "create", "--cards", "AS,10H", "-o", "json")
+
+		code, stdout, _ := runCommand(t, env, "open", deck.DeckID)
+		require.Equal(t, 0, code)
+		require.Contains(t, stdout, deck.DeckID)
+		require.Regexp(t, `AS\s+ACE\s+SPADES`, stdout)
+		require.Regexp(t, `10H\s+10\s+HEARTS`, stdout)
+	})
+
+	t.Run("glyph output", func(t *testing.T) {
+		deck := deckJSON{}
+		runJSON(t, env, &deck, "create", "--cards", "AS,10H,QD,KC", "-o", "json")
+
+		code, stdout, _ := runCommand(t, env, "draw", deck.DeckID, "-n", "4", "-o", "glyphs")
+		require.Equal(t, 0, code)
+		require.Equal(t, "\U0001F0A1 \U0001F0BA \U0001F0CD \U0001F0DE\n", stdout)
+	})
+
+	t.Run("watch prints events", func(t *testing.T) {
+		deck := deckJSON{}
+		runJSON(t, env, &deck, "create", "--cards", "AS,KD", "-o", "json")
+		runJSON(t, env, &drawJSON{}, "draw", deck.DeckID, "-o", "json")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		stdout := &bytes.Buffer{}
+		code := run(ctx, []string{"watch", deck.DeckID, "--after", "0", "-o", "json"}, stdout, &bytes.Buffer{}, getenv(env))
+		require.Equal(t, 1, code)
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		require.Len(t, lines, 2)
+		event := eventJSON{}
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+		require.Equal(t, "drawn", event.Type)
+		require.Equal(t, []string{"AS"}, event.Cards)
+	})
+
+	t.Run("API errors", func(t *testing.T) {
+		deck := deckJSON{}
+		runJSON(t, env, &deck, "create", "--cards", "AS", "-o", "json")
+		runJSON(t, env, &drawJSON{}, "draw", deck.DeckID, "-o", "json")
+
+		code, _, stderr := runCommand(t, env, "draw", deck.DeckID)
+		require.Equal(t, 1, code)
+		require.Contains(t, stderr, "deck has no more cards")
+	})
+
+	t.Run("usage errors", func(t *testing.T) {
+		code, _, _ := runCommand(t, env)
+		require.Equal(t, 2, code)
+
+		code, _, stderr := runCommand(t, env, "shuffle")
+		require.Equal(t, 2, code)
+		require.Contains(t, stderr, "unknown command 'shuffle'")
+
+		code, _, stderr = runCommand(t, env, "open")
+		require.Equal(t, 2, code)
+		require.Contains(t, stderr, "expected 1 argument(s), got 0")
+
+		code, _, stderr = runCommand(t, env, "open", "not-a-uuid")
+		require.Equal(t, 2, code)
+		require.Contains(t, stderr, "invalid deck ID")
+
+		code, _, _ = runCommand(t, env, "create", "--cards", "AS,,KD")
+		require.Equal(t, 2, code)
+
+		code, _, stderr = runCommand(t, env, "create", "-o", "yaml")
+		require.Equal(t, 1, code)
+		require.Contains(t, stderr, "invalid output format 'yaml'")
+	})
+}
+
+func Test__Config(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"url": "http://from-file", "api_key": "file-key", "output": "glyphs"}`), 0600))
+
+	t.Run("file is used when nothing else is given", func(t *testing.T) {
+		c, err := loadConfig(&globalFlags{configPath: path}, getenv(nil))
+		require.NoError(t, err)
+		require.Equal(t, &config{URL: "http://from-file", APIKey: "file-key", Output: outputGlyphs}, c)
+	})
+
+	t.Run("env overrides file, flags override env", func(t *testing.T) {
+		env := map[string]string{"DECKS_CONFIG": path, "DECKS_API_URL": "http://from-env", "DECKS_API_KEY": "env-key"}
+		c, err := loadConfig(&globalFlags{url: "http://from-flag"}, getenv(env))
+		require.NoError(t, err)
+		require.Equal(t, &config{URL: "http://from-flag", APIKey: "env-key", Output: outputGlyphs}, c)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		c, err := loadConfig(&globalFlags{}, getenv(map[string]string{"DECKS_CONFIG": ""}))
+		require.NoError(t, err)
+		require.Equal(t, defaultOutput, c.Output)
+	})
+
+	t.Run("config file given must exist", func(t *testing.T) {
+		_, err := loadConfig(&globalFlags{configPath: filepath.Join(t.TempDir(), "missing.json")}, getenv(nil))
+		require.ErrorContains(t, err, "error reading config file")
+	})
+}
+
+func runCommand(t *testing.T, env map[string]string, args ...string) (int, string, string) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	code := run(context.Background(), args, stdout, stderr, getenv(env))
+	return code, stdout.String(), stderr.String()
+}
+
+func runJSON(t *testing.T, env map[string]string, result interface{}, args ...string) string {
+	code, stdout, stderr := runCommand(t, env, args...)
+	require.Equal(t, 0, code, stderr)
+	require.NoError(t, json.Unmarshal([]byte(stdout), result), stdout)
+	return stdout
+}
+
+func getenv(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
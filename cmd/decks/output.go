@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/client"
+)
+
+const (
+	outputTable  = "table"
+	outputJSON   = "json"
+	outputGlyphs = "glyphs"
+)
+
+// In JSON, cards are only their codes, which is what scripts usually need,
+// and what the API takes when creating decks.
+type deckJSON struct {
+	DeckID    string   `json:"deck_id"`
+	Shuffled  bool     `json:"shuffled"`
+	Remaining int      `json:"remaining"`
+	Version   int64    `json:"version"`
+	Cards     []string `json:"cards,omitempty"`
+}
+
+type drawJSON struct {
+	Cards   []string `json:"cards"`
+	Version int64    `json:"version"`
+}
+
+type eventJSON struct {
+	Version   int64     `json:"version"`
+	Type      string    `json:"type"`
+	Cards     []string  `json:"cards"`
+	Shuffled  *bool     `json:"shuffled,omitempty"`
+	Reverts   []int64   `json:"reverts,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type printer struct {
+	format string
+	out    io.Writer
+}
+
+func (p *printer) printDeck(deck *client.Deck, withCards bool) error {
+	if p.format == outputJSON {
+		response := deckJSON{
+			DeckID:    deck.ID.String(),
+			Shuffled:  deck.Shuffled,
+			Remaining: deck.Remaining,
+			Version:   deck.Version,
+		}
+
+		if withCards {
+			response.Cards = cards.CardListToCodes(deck.Cards)
+		}
+
+		return p.printJSON(response)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "DECK ID\tSHUFFLED\tREMAINING\tVERSION")
+	fmt.Fprintf(w, "%s\t%t\t%d\t%d\n", deck.ID, deck.Shuffled, deck.Remaining, deck.Version)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !withCards {
+		return nil
+	}
+
+	fmt.Fprintln(p.out)
+	return p.printCards(deck.Cards)
+}
+
+func (p *printer) printDraw(result *client.DrawResult) error {
+	if p.format == outputJSON {
+		return p.printJSON(drawJSON{Cards: cards.CardListToCodes(result.Cards), Version: result.Version})
+	}
+
+	return p.printCards(result.Cards)
+}
+
+// Events are printed one per line, as they arrive,
+// so JSON output is a stream of objects, and tables aren't aligned.
+func (p *printer) printEvent(e client.Event) error {
+	switch p.format {
+	case outputJSON:
+		return p.printJSON(eventJSON{
+			Version:   e.Version,
+			Type:      e.Type,
+			Cards:     cards.CardListToCodes(e.Cards),
+			Shuffled:  e.Shuffled,
+			Reverts:   e.Reverts,
+			CreatedAt: e.CreatedAt,
+		})
+	case outputGlyphs:
+		_, err := fmt.Fprintf(p.out, "%d %s %s\n", e.Version, e.Type, glyphs(e.Cards))
+		return err
+	default:
+		_, err := fmt.Fprintf(p.out, "%d %s %s\n", e.Version, e.Type, strings.Join(cards.CardListToCodes(e.Cards), ","))
+		return err
+	}
+}
+
+func (p *printer) printCards(list []cards.Card) error {
+	if p.format == outputGlyphs {
+		_, err := fmt.Fprintln(p.out, glyphs(list))
+		return err
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CODE\tVALUE\tSUIT")
+	for _, c := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Code(), c.Rank.String(), c.Suit.String())
+	}
+
+	return w.Flush()
+}
+
+func (p *printer) printJSON(v interface{}) error {
+	return json.NewEncoder(p.out).Encode(v)
+}
+
+func glyphs(list []cards.Card) string {
+	result := make([]string, len(list))
+	for i, c := range list {
+		result[i] = string(glyph(c))
+	}
+
+	return strings.Join(result, " ")
+}
+
+// Playing cards in Unicode are in blocks of 16 per suit, starting at U+1F0A0 for spades.
+// Ranks are in order, with a knight between the jack and the queen, which we skip.
+var suitGlyphBlocks = map[cards.CardSuit]rune{
+	cards.CardSuitSpades:   0x1F0A0,
+	cards.CardSuitHearts:   0x1F0B0,
+	cards.CardSuitDiamonds: 0x1F0C0,
+	cards.CardSuitClubs:    0x1F0D0,
+}
+
+func glyph(c cards.Card) rune {
+	rank := rune(c.Rank)
+	if rank > 11 {
+		rank++
+	}
+
+	return suitGlyphBlocks[c.Suit] + rank
+}
@@ -0,0 +1,56 @@
+// Moves the decks kept in Redis by older versions of the server to the keys used now.
+// It takes the same configuration as the server, so it can be run with the same file,
+// environment variables or flags:
+//
+//	migrate-redis -config config.yaml
+//
+// Decks already moved are skipped, so it can be run again if it fails halfway.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/lucaspin/decks-api/pkg/config"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"github.com/lucaspin/decks-api/pkg/storage"
+)
+
+func main() {
+	slog.SetDefault(logging.New(os.Stdout))
+
+	c, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	if c.Storage.Type != storage.TypeRedis {
+		log.Fatalf("storage.type is '%s', but only the redis storage has keys to migrate", c.Storage.Type)
+	}
+
+	store, err := storage.NewRedisStorage(c.Storage.Redis.StorageConfig())
+	if err != nil {
+		log.Fatalf("error connecting to Redis: %v", err)
+	}
+
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := storage.MigrateRedisKeys(ctx, store.(*storage.RedisStorage).Client)
+	if err != nil {
+		log.Fatalf("error migrating decks: %v", err)
+	}
+
+	slog.Info("Migrated decks", "migrated", result.Migrated, "skipped", result.Skipped)
+}
@@ -1,41 +1,211 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
 
 	"github.com/lucaspin/decks-api/pkg/api"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/certs"
+	"github.com/lucaspin/decks-api/pkg/config"
+	"github.com/lucaspin/decks-api/pkg/grpcapi"
+	"github.com/lucaspin/decks-api/pkg/idempotency"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"github.com/lucaspin/decks-api/pkg/metrics"
+	"github.com/lucaspin/decks-api/pkg/ratelimit"
 	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/lucaspin/decks-api/pkg/tracing"
+	"github.com/lucaspin/decks-api/pkg/webhooks"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-const defaultPort = 4000
-
 func main() {
-	store, err := storage.NewStorage()
+	// Everything is logged as JSON, including what is still logged with the log package.
+	logger := logging.New(os.Stdout)
+	slog.SetDefault(logger)
+
+	c, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+
+	slog.Info("Loaded configuration", "config", c.Redacted())
+	store, err := storage.NewStorage(c.Storage.Type, c.Storage.Redis.StorageConfig(), c.Storage.Bolt.StorageConfig(), c.Storage.SQL.StorageConfig())
 	if err != nil {
 		log.Fatalf("error initializing storage: %v", err)
 	}
 
-	server := api.NewServer(store)
-	err = server.Serve("0.0.0.0", getPort())
+	tracerProvider, shutdownTracing, err := tracing.NewTracerProvider(context.Background(), c.Tracing.Exporter)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("error initializing tracing: %v", err)
+	}
+
+	if redisStorage, ok := store.(*storage.RedisStorage); ok {
+		tracing.TraceRedis(redisStorage.Client, tracerProvider)
+	}
+
+	// Both servers use the same storage and card generator,
+	// so decks created through one of them can be used through the other.
+	// The storage is instrumented once, so the metrics and traces include the operations of both.
+	m := metrics.New()
+	backend := storageBackend(store)
+	instrumented := tracing.NewTracedStorage(metrics.NewInstrumentedStorage(store, backend, m), backend, tracerProvider)
+	generator := cards.NewCardGenerator()
+	webhooksConfig := webhooks.DefaultConfig()
+	webhooksConfig.AllowPrivateAddresses = c.Webhooks.AllowPrivateAddresses
+	dispatcher := webhooks.NewDispatcher(newWebhookStore(store), webhooksConfig)
+
+	// Both servers also share the limits, the idempotency keys and the webhooks,
+	// so clients can't go around the limits by switching from one to the other.
+	limiter := newLimiter(store)
+	limits := ratelimit.Config{
+		Create:           ratelimit.Limit{Rate: c.Limits.Create.Rate, Burst: c.Limits.Create.Burst},
+		Draw:             ratelimit.Limit{Rate: c.Limits.Draw.Rate, Burst: c.Limits.Draw.Burst},
+		DailyCreateQuota: c.Limits.DailyCreateQuota,
+	}
+
+	idempotencyStore := newIdempotencyStore(store)
+	options := []api.ServerOption{
+		api.WithCardGenerator(generator),
+		api.WithMetrics(m),
+		api.WithTracerProvider(tracerProvider),
+		api.WithLogger(logger),
+		api.WithRateLimiter(limiter, limits),
+		api.WithIdempotencyStore(idempotencyStore, c.Limits.IdempotencyRetention),
+		api.WithWebhooks(dispatcher),
+		api.WithShutdownDelay(c.Server.ShutdownDelay),
+		api.WithTimeouts(api.TimeoutConfig{
+			Read:    c.Server.ReadTimeout,
+			Write:   c.Server.WriteTimeout,
+			Idle:    c.Server.IdleTimeout,
+			Request: c.Server.RequestTimeout,
+		}),
+		api.WithDeckDefaults(api.DeckDefaults{Shuffled: c.Decks.Shuffled}),
 	}
+
+	grpcOptions := []grpcapi.ServerOption{
+		grpcapi.WithRateLimiter(limiter, limits),
+		grpcapi.WithIdempotencyStore(idempotencyStore, c.Limits.IdempotencyRetention),
+		grpcapi.WithWebhooks(dispatcher),
+	}
+
+	if c.TLS.Enabled() {
+		// Both servers use the same certificate, reloaded when its files change.
+		reloader, err := certs.NewReloader(certs.Config{
+			CertFile:       c.TLS.CertFile,
+			KeyFile:        c.TLS.KeyFile,
+			ClientCAFile:   c.TLS.ClientCAFile,
+			ClientAuth:     c.TLS.ClientAuthType(),
+			ReloadInterval: c.TLS.ReloadInterval,
+		})
+
+		if err != nil {
+			log.Fatalf("error loading TLS certificate: %v", err)
+		}
+
+		options = append(options, api.WithTLS(reloader.ServerTLSConfig()))
+		grpcOptions = append(grpcOptions, grpcapi.WithGRPCOptions(grpc.Creds(credentials.NewTLS(reloader.ServerTLSConfig()))))
+	}
+
+	server := api.NewServer(instrumented, options...)
+	grpcServer := grpcapi.NewServer(instrumented, generator, grpcOptions...)
+
+	signals, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	// If one of the servers can't be started, the other one is shut down too.
+	errs := make(chan error, 2)
+	go func() {
+		errs <- grpcServer.Serve(c.Server.Host, c.Server.GRPCPort)
+	}()
+
+	go func() {
+		errs <- server.Serve(c.Server.Host, c.Server.Port)
+	}()
+
+	exitCode := 0
+	select {
+	case <-signals.Done():
+		slog.Info("Received signal, shutting down")
+	case err := <-errs:
+		slog.Error("Error serving", "error", err)
+		exitCode = 1
+	}
+
+	// A second signal kills the server right away.
+	stop()
+
+	// Everything is stopped in the reverse order it was started in.
+	// The storage goes last, since the rate limiter, the idempotency store and the webhooks may be using its client.
+	ctx, cancel := context.WithTimeout(context.Background(), c.Server.ShutdownDelay+c.Server.DrainTimeout)
+
+	shutdown(ctx, "HTTP server", server.Shutdown)
+	shutdown(ctx, "gRPC server", grpcServer.Shutdown)
+	dispatcher.Close()
+
+	// Spans are exported in batches, so the last ones would be lost without this.
+	shutdown(ctx, "tracing", shutdownTracing)
+	shutdown(ctx, "storage", func(context.Context) error { return store.Close() })
+	cancel()
+	os.Exit(exitCode)
 }
 
-func getPort() int {
-	fromEnv := os.Getenv("API_PORT")
-	if fromEnv == "" {
-		log.Printf("No API_PORT specified - using 4000")
-		return defaultPort
+func shutdown(ctx context.Context, name string, fn func(context.Context) error) {
+	if err := fn(ctx); err != nil {
+		slog.Error("Error shutting down "+name, "error", err)
 	}
+}
 
-	port, err := strconv.Atoi(fromEnv)
-	if err != nil {
-		log.Printf("invalid API_PORT '%s' specified: %v - using 4000", fromEnv, err)
-		return defaultPort
+// If decks are kept in Redis, the rate limit counters are kept there too,
+// so the limits hold across all the replicas of the server.
+func newLimiter(store storage.Storage) ratelimit.Limiter {
+	if redisStorage, ok := store.(*storage.RedisStorage); ok {
+		return ratelimit.NewRedisLimiter(redisStorage.Client)
 	}
 
-	return port
+	return ratelimit.NewInMemoryLimiter()
+}
+
+// Same as the rate limits, idempotency keys are kept in Redis, if decks are,
+// so retries can be handled by any replica of the server.
+func newIdempotencyStore(store storage.Storage) idempotency.Store {
+	if redisStorage, ok := store.(*storage.RedisStorage); ok {
+		return idempotency.NewRedisStore(redisStorage.Client)
+	}
+
+	return idempotency.NewInMemoryStore()
+}
+
+// Webhook subscriptions and deliveries are kept in Redis too, if decks are,
+// so every replica sends events to the same subscriptions.
+func newWebhookStore(store storage.Storage) webhooks.Store {
+	if redisStorage, ok := store.(*storage.RedisStorage); ok {
+		return webhooks.NewRedisStore(redisStorage.Client)
+	}
+
+	return webhooks.NewInMemoryStore()
+}
+
+// The name of the storage backend, used to label its metrics.
+func storageBackend(store storage.Storage) string {
+	switch store.(type) {
+	case *storage.RedisStorage:
+		return "redis"
+	case *storage.BoltStorage:
+		return "bolt"
+	case *storage.SQLStorage:
+		return "sql"
+	default:
+		return "in-memory"
+	}
 }
@@ -1,16 +1,89 @@
 package api
 
 import (
+	"context"
+	"net"
 	"net/http"
 )
 
+type clientContextKey struct{}
+type rateLimitClientContextKey struct{}
+
+// The header clients use to identify themselves.
+const apiKeyHeader = "X-API-Key"
+
 func authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// NOTE: this is where authentication would be implemented.
 		// There is no requirement about authentication on the task,
 		// so I'm not going to do any kind of authentication at all.
-
-		next.ServeHTTP(w, r)
+		//
+		// We still need to know who is calling us, to keep per-client state,
+		// like idempotency keys and webhooks. Clients with a certificate verified by the TLS server are identified by it.
+		// Otherwise, the API key is used, which is not verified in any way,
+		// and if none is given, the client is identified by its IP address.
+		ctx := context.WithValue(r.Context(), clientContextKey{}, clientFromRequest(r))
+		ctx = context.WithValue(ctx, rateLimitClientContextKey{}, rateLimitClientFromRequest(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func clientFromRequest(r *http.Request) string {
+	if identity := certificateIdentity(r); identity != "" {
+		return "cert:" + identity
+	}
+
+	if apiKey := r.Header.Get(apiKeyHeader); apiKey != "" {
+		return "key:" + apiKey
+	}
+
+	return "ip:" + remoteIP(r)
+}
+
+// Rate limits can't be keyed by the API key, since it is not verified,
+// and clients would get new limits just by sending a new one.
+// They are keyed by what clients can't choose instead: their verified certificate, or their IP address.
+func rateLimitClientFromRequest(r *http.Request) string {
+	if identity := certificateIdentity(r); identity != "" {
+		return "cert:" + identity
+	}
+
+	return "ip:" + remoteIP(r)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// The identity in the client certificate, if the TLS server verified one.
+// Certificates that were presented, but not verified, like when the server doesn't ask for them, are ignored.
+func certificateIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	certificate := r.TLS.VerifiedChains[0][0]
+	if certificate.Subject.CommonName != "" {
+		return certificate.Subject.CommonName
+	}
+
+	return certificate.Subject.String()
+}
+
+// Returns the client identified by authMiddleware.
+func clientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(clientContextKey{}).(string)
+	return client
+}
+
+// Returns the client the rate limits are kept for, as identified by authMiddleware.
+func rateLimitClientFromContext(ctx context.Context) string {
+	client, _ := ctx.Value(rateLimitClientContextKey{}).(string)
+	return client
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lucaspin/decks-api/pkg/storage"
+)
+
+var errInvalidETag = errors.New("invalid ETag")
+
+// The ETag of a deck is just its version, quoted.
+func formatETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// Parses the If-Match header into the version the deck is expected to be at.
+// '*' matches any version. Weak ETags are not accepted,
+// since If-Match requires a strong comparison.
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return storage.AnyVersion, nil
+	}
+
+	return parseETag(header)
+}
+
+// Checks if any of the ETags in the If-None-Match header matches the version.
+// Unlike If-Match, weak ETags are accepted here.
+func ifNoneMatch(header string, version int64) bool {
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+		if etag == "*" {
+			return true
+		}
+
+		v, err := parseETag(etag)
+		if err == nil && v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseETag(etag string) (int64, error) {
+	if len(etag) < 2 || !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		return 0, errInvalidETag
+	}
+
+	version, err := strconv.ParseInt(etag[1:len(etag)-1], 10, 64)
+	if err != nil || version < storage.InitialVersion {
+		return 0, errInvalidETag
+	}
+
+	return version, nil
+}
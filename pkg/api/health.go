@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lucaspin/decks-api/pkg/storage"
+)
+
+// How long a dependency has to respond to a readiness check.
+const dependencyCheckTimeout = 2 * time.Second
+
+const (
+	healthStatusOK           = "ok"
+	healthStatusUnavailable  = "unavailable"
+	healthStatusShuttingDown = "shutting_down"
+)
+
+type HealthResponse struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyHealth `json:"dependencies,omitempty"`
+}
+
+type DependencyHealth struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Something the server needs to handle requests, checked by the readiness probe.
+type dependency struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (s *Server) dependencies() []dependency {
+	return []dependency{
+		{name: "storage", check: func(ctx context.Context) error { return storage.Ping(ctx, s.storage) }},
+	}
+}
+
+// Tells Kubernetes liveness probes whether the server is running.
+// Dependencies are not checked, since restarting the server won't bring them back.
+func (s *Server) Liveness(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, &HealthResponse{Status: healthStatusOK})
+}
+
+// Tells load balancers, and Kubernetes readiness probes, whether the server should get new requests.
+// It fails if any of the dependencies can't be used, and as soon as the server starts shutting down,
+// so new requests go to other replicas while the ones in flight are drained.
+func (s *Server) Readiness(w http.ResponseWriter, r *http.Request) {
+	if !s.ready.Load() {
+		respondWithJSON(w, http.StatusServiceUnavailable, &HealthResponse{Status: healthStatusShuttingDown})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dependencyCheckTimeout)
+	defer cancel()
+
+	response := &HealthResponse{Status: healthStatusOK, Dependencies: checkDependencies(ctx, s.dependencies())}
+	for _, result := range response.Dependencies {
+		if result.Status != healthStatusOK {
+			response.Status = healthStatusUnavailable
+		}
+	}
+
+	if response.Status != healthStatusOK {
+		respondWithJSON(w, http.StatusServiceUnavailable, response)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// Dependencies are checked at the same time, so a slow one doesn't delay the others.
+func checkDependencies(ctx context.Context, dependencies []dependency) []DependencyHealth {
+	results := make([]DependencyHealth, len(dependencies))
+	wg := sync.WaitGroup{}
+	for i, d := range dependencies {
+		wg.Add(1)
+		go func(i int, d dependency) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := d.check(ctx)
+			results[i] = DependencyHealth{
+				Name:      d.name,
+				Status:    healthStatusOK,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+
+			if err != nil {
+				results[i].Status = healthStatusUnavailable
+				results[i].Error = err.Error()
+			}
+		}(i, d)
+	}
+
+	wg.Wait()
+	return results
+}
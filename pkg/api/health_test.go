@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__HealthProbes(t *testing.T) {
+	t.Run("liveness -> 200 without dependencies", func(t *testing.T) {
+		testServer := NewServer(&unhealthyStorage{Storage: storage.NewInMemoryStorage()})
+		response := execRequest(testServer, http.MethodGet, "/healthz", nil)
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+		require.JSONEq(t, `{"status":"ok"}`, response.Body.String())
+	})
+
+	t.Run("readiness with healthy storage -> 200 with storage status", func(t *testing.T) {
+		testServer := NewServer(storage.NewInMemoryStorage())
+		response := execRequest(testServer, http.MethodGet, "/readyz", nil)
+		require.Equal(t, http.StatusOK, response.Code)
+
+		health := HealthResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&health))
+		require.Equal(t, "ok", health.Status)
+		require.Len(t, health.Dependencies, 1)
+		require.Equal(t, "storage", health.Dependencies[0].Name)
+		require.Equal(t, "ok", health.Dependencies[0].Status)
+		require.Empty(t, health.Dependencies[0].Error)
+	})
+
+	t.Run("readiness with unhealthy storage -> 503 with storage error", func(t *testing.T) {
+		testServer := NewServer(&unhealthyStorage{Storage: storage.NewInMemoryStorage()})
+		response := execRequest(testServer, http.MethodGet, "/readyz", nil)
+		require.Equal(t, http.StatusServiceUnavailable, response.Code)
+
+		health := HealthResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&health))
+		require.Equal(t, "unavailable", health.Status)
+		require.Len(t, health.Dependencies, 1)
+		require.Equal(t, "storage", health.Dependencies[0].Name)
+		require.Equal(t, "unavailable", health.Dependencies[0].Status)
+		require.Equal(t, "connection refused", health.Dependencies[0].Error)
+	})
+
+	t.Run("readiness while shutting down -> 503 without checking dependencies", func(t *testing.T) {
+		store := &unhealthyStorage{Storage: storage.NewInMemoryStorage()}
+		testServer := NewServer(store)
+		require.NoError(t, testServer.Shutdown(context.Background()))
+
+		response := execRequest(testServer, http.MethodGet, "/readyz", nil)
+		require.Equal(t, http.StatusServiceUnavailable, response.Code)
+		require.JSONEq(t, `{"status":"shutting_down"}`, response.Body.String())
+		require.Zero(t, store.pings)
+	})
+}
+
+// A storage that can't be reached.
+type unhealthyStorage struct {
+	storage.Storage
+	pings int
+}
+
+func (s *unhealthyStorage) Ping(ctx context.Context) error {
+	s.pings++
+	return errors.New("connection refused")
+}
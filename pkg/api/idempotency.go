@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lucaspin/decks-api/pkg/idempotency"
+	"github.com/lucaspin/decks-api/pkg/logging"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// How long a key is reserved for while its first request is being handled.
+// If the server dies before finishing the request, the key becomes usable again after this.
+const idempotencyLockTTL = time.Minute
+
+const DefaultIdempotencyRetention = 24 * time.Hour
+
+// Only these headers, set by the handlers themselves, are stored and replayed.
+// Headers set by middlewares, like the rate limit ones, should reflect the retry, not the original request.
+var replayedHeaders = []string{"Content-Type", "ETag"}
+
+// Wraps a handler so requests carrying an Idempotency-Key header are only executed once.
+// Retries with the same key and the same request get the original response back,
+// and retries with the same key but a different request are rejected with 422.
+// If the server has no idempotency store configured, the handler is returned as is.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	if s.idempotencyStore == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+		if idempotencyKey == "" {
+			next(w, r)
+			return
+		}
+
+		if len(idempotencyKey) > 255 {
+			http.Error(w, "idempotency key must have at most 255 characters", http.StatusBadRequest)
+			return
+		}
+
+		fingerprint, err := requestFingerprint(r)
+		if err != nil {
+			http.Error(w, "error reading request body", http.StatusBadRequest)
+			return
+		}
+
+		// Keys are scoped to the client, so two clients can't see each other's responses.
+		key := clientFromContext(r.Context()) + ":" + idempotencyKey
+		existing, reserved, err := s.idempotencyStore.Reserve(r.Context(), key, fingerprint, idempotencyLockTTL)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error reserving idempotency key", "key", key, "error", err)
+			http.Error(w, "unknown error", http.StatusInternalServerError)
+			return
+		}
+
+		if !reserved {
+			replayResponse(w, existing, fingerprint)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next(recorder, r)
+
+		// Server errors and rate limited requests are not stored, so the client can retry them.
+		if recorder.statusCode >= 500 || recorder.statusCode == http.StatusTooManyRequests {
+			if err := s.idempotencyStore.Release(r.Context(), key, fingerprint); err != nil {
+				logging.FromContext(r.Context()).Error("Error releasing idempotency key", "key", key, "error", err)
+			}
+
+			return
+		}
+
+		response := &idempotency.Response{
+			StatusCode:  recorder.statusCode,
+			Header:      map[string]string{},
+			Body:        recorder.body.Bytes(),
+			CompletedAt: time.Now(),
+		}
+
+		for _, name := range replayedHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				response.Header[name] = value
+			}
+		}
+
+		if err := s.idempotencyStore.Complete(r.Context(), key, fingerprint, response, s.idempotencyRetention); err != nil {
+			logging.FromContext(r.Context()).Error("Error storing response for idempotency key", "key", key, "error", err)
+		}
+	}
+}
+
+func replayResponse(w http.ResponseWriter, existing *idempotency.Record, fingerprint string) {
+	if existing.Fingerprint != fingerprint {
+		http.Error(w, "idempotency key was already used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if existing.InProgress() {
+		http.Error(w, "a request with this idempotency key is still in progress", http.StatusConflict)
+		return
+	}
+
+	for name, value := range existing.Response.Header {
+		w.Header().Set(name, value)
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(existing.Response.StatusCode)
+	w.Write(existing.Response.Body)
+}
+
+// Identifies a request by its method, path, query parameters, preconditions and body.
+// The body is read, and then put back in place, so the handler can still read it.
+func requestFingerprint(r *http.Request) (string, error) {
+	body := []byte{}
+	if r.Body != nil {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+
+		body = b
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + "\n" + r.URL.Path + "\n" + r.URL.Query().Encode() + "\n"))
+	hash.Write([]byte(r.Header.Get("If-Match") + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Captures the status code and body written by a handler,
+// while still writing them to the underlying response writer.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Serves the API on a listener that is already open, until Shutdown is called.
+// If the server was created with WithTLS, connections are expected to use TLS.
+func (s *Server) ServeListener(listener net.Listener) error {
+	var err error
+	if s.tlsConfig != nil {
+		// The certificate comes from the config, not from files.
+		err = s.httpServer.ServeTLS(listener, "", "")
+	} else {
+		err = s.httpServer.Serve(listener)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Stops the server, without interrupting the requests in flight:
+//  1. The server is marked as not ready, so load balancers stop sending requests to it. See Readiness.
+//  2. After the shutdown delay, so load balancers have time to notice, the server stops accepting connections.
+//  3. Streams, like Server-Sent Events and WebSocket rooms, are closed, so their clients can reconnect to another replica.
+//  4. Requests in flight are drained.
+//
+// If the context is done before the requests are drained, the context error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.ready.Store(false)
+	s.logger.Info("Shutting down server", "delay", s.shutdownDelay.String())
+
+	select {
+	case <-time.After(s.shutdownDelay):
+	case <-ctx.Done():
+	}
+
+	s.closeStreams()
+	err := s.httpServer.Shutdown(ctx)
+
+	// WebSockets are hijacked from the HTTP server, so it doesn't wait for them.
+	streamsClosed := make(chan struct{})
+	go func() {
+		s.streams.Wait()
+		close(streamsClosed)
+	}()
+
+	select {
+	case <-streamsClosed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return err
+}
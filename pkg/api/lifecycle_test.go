@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__Shutdown(t *testing.T) {
+	t.Run("requests in flight are drained, and new ones are rejected", func(t *testing.T) {
+		store := &blockingDrawStorage{
+			Storage: storage.NewInMemoryStorage(),
+			entered: make(chan struct{}),
+			release: make(chan struct{}),
+		}
+
+		testServer := NewServer(store)
+		deckID := createDeck(t, testServer)
+		url, served := serveOnRandomPort(t, testServer)
+
+		drawn := make(chan int)
+		go func() {
+			response, err := http.Post(url+"/api/v1/decks/"+deckID+"/draw?count=1", "", nil)
+			if err != nil {
+				drawn <- 0
+				return
+			}
+
+			response.Body.Close()
+			drawn <- response.StatusCode
+		}()
+
+		<-store.entered
+		shutdown := make(chan error)
+		go func() {
+			shutdown <- testServer.Shutdown(context.Background())
+		}()
+
+		// The server is marked as not ready before it starts draining.
+		require.Eventually(t, func() bool {
+			return execRequest(testServer, http.MethodGet, "/readyz", nil).Code == http.StatusServiceUnavailable
+		}, time.Second, 10*time.Millisecond)
+
+		// New connections are not accepted while draining.
+		require.Eventually(t, func() bool {
+			_, err := http.Get(url + "/")
+			return err != nil
+		}, time.Second, 10*time.Millisecond)
+
+		// The shutdown waits for the draw in flight.
+		select {
+		case <-shutdown:
+			require.FailNow(t, "shutdown returned before the request in flight was done")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(store.release)
+		require.Equal(t, http.StatusOK, <-drawn)
+		require.NoError(t, <-shutdown)
+		require.NoError(t, <-served)
+	})
+
+	t.Run("requests that don't finish in time -> context error", func(t *testing.T) {
+		store := &blockingDrawStorage{
+			Storage: storage.NewInMemoryStorage(),
+			entered: make(chan struct{}),
+			release: make(chan struct{}),
+		}
+
+		defer close(store.release)
+
+		testServer := NewServer(store)
+		deckID := createDeck(t, testServer)
+		url, _ := serveOnRandomPort(t, testServer)
+
+		go http.Post(url+"/api/v1/decks/"+deckID+"/draw?count=1", "", nil)
+		<-store.entered
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, testServer.Shutdown(ctx), context.DeadlineExceeded)
+	})
+
+	t.Run("event streams are closed", func(t *testing.T) {
+		testServer := NewServer(storage.NewInMemoryStorage())
+		deckID := createDeck(t, testServer)
+		url, served := serveOnRandomPort(t, testServer)
+
+		response, err := http.Get(url + "/api/v1/decks/" + deckID + "/events/stream")
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, testServer.Shutdown(ctx))
+		require.NoError(t, <-served)
+
+		// The stream ends, instead of hanging.
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			require.True(t, strings.HasPrefix(scanner.Text(), ":") || scanner.Text() == "")
+		}
+	})
+
+	t.Run("shutdown delay keeps accepting requests after the server is marked as not ready", func(t *testing.T) {
+		testServer := NewServer(storage.NewInMemoryStorage(), WithShutdownDelay(200*time.Millisecond))
+		url, served := serveOnRandomPort(t, testServer)
+
+		shutdown := make(chan error)
+		go func() {
+			shutdown <- testServer.Shutdown(context.Background())
+		}()
+
+		require.Eventually(t, func() bool {
+			response, err := http.Get(url + "/readyz")
+			if err != nil {
+				return false
+			}
+
+			response.Body.Close()
+			return response.StatusCode == http.StatusServiceUnavailable
+		}, time.Second, 10*time.Millisecond)
+
+		require.NoError(t, <-shutdown)
+		require.NoError(t, <-served)
+	})
+}
+
+func serveOnRandomPort(t *testing.T, server *Server) (string, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ServeListener(listener)
+	}()
+
+	return fmt.Sprintf("http://%s", listener.Addr().String()), served
+}
+
+// Blocks draws until released, so there is a request in flight when the server shuts down.
+type blockingDrawStorage struct {
+	storage.Storage
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingDrawStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*storage.DrawResult, error) {
+	close(s.entered)
+	<-s.release
+	return s.Storage.Draw(ctx, deckID, count, ifVersion)
+}
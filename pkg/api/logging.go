@@ -0,0 +1,58 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lucaspin/decks-api/pkg/logging"
+)
+
+// The header used to correlate the logs of a request.
+// Clients can send their own, or one is generated for them.
+// Either way, it is sent back in the response.
+const requestIDHeader = "X-Request-ID"
+
+// Request IDs longer than this are replaced by one we generate.
+const maxRequestIDLength = 128
+
+// Gives every request a logger carrying its ID, its route, and the deck it is for, if any,
+// and logs a line for it when it is done, with its status and how long it took.
+// The route is found here, instead of in a router middleware,
+// so requests that don't match any route are logged too.
+func (s *Server) logged(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+		attributes := []any{
+			slog.String("request_id", requestID),
+			slog.String("method", r.Method),
+		}
+
+		match := mux.RouteMatch{}
+		if s.router.Match(r, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				attributes = append(attributes, slog.String("route", template))
+			}
+
+			if deckID, ok := match.Vars["deck_id"]; ok {
+				attributes = append(attributes, slog.String("deck_id", deckID))
+			}
+		}
+
+		logger := s.logger.With(attributes...)
+		captured := httpsnoop.CaptureMetrics(handler, w, r.WithContext(logging.WithLogger(r.Context(), logger)))
+		logger.Info("request handled",
+			slog.String("path", r.URL.Path),
+			slog.Int("status", captured.Code),
+			slog.Int64("bytes", captured.Written),
+			slog.Float64("latency_ms", float64(captured.Duration.Microseconds())/1000),
+		)
+	})
+}
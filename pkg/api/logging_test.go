@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__RequestLogging(t *testing.T) {
+	output := &bytes.Buffer{}
+	testServer := NewServer(&failingDrawStorage{Storage: storage.NewInMemoryStorage()}, WithLogger(logging.New(output)))
+	deckID := createDeck(t, testServer)
+
+	t.Run("request ID is taken from the request, and echoed in the response", func(t *testing.T) {
+		output.Reset()
+		response := execHandlerRequest(testServer, http.MethodGet, "/api/v1/decks/"+deckID, map[string]string{"X-Request-ID": "abc-123"})
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Equal(t, "abc-123", response.Header().Get("X-Request-ID"))
+
+		lines := logLines(t, output)
+		require.Len(t, lines, 1)
+		require.Equal(t, "request handled", lines[0]["msg"])
+		require.Equal(t, "abc-123", lines[0]["request_id"])
+		require.Equal(t, "/api/v1/decks/{deck_id}", lines[0]["route"])
+		require.Equal(t, deckID, lines[0]["deck_id"])
+		require.Equal(t, float64(http.StatusOK), lines[0]["status"])
+		require.Contains(t, lines[0], "latency_ms")
+	})
+
+	t.Run("request ID is generated, if not given", func(t *testing.T) {
+		output.Reset()
+		response := execHandlerRequest(testServer, http.MethodGet, "/api/v1/decks/"+deckID, nil)
+		_, err := uuid.Parse(response.Header().Get("X-Request-ID"))
+		require.NoError(t, err)
+
+		lines := logLines(t, output)
+		require.Len(t, lines, 1)
+		require.Equal(t, response.Header().Get("X-Request-ID"), lines[0]["request_id"])
+	})
+
+	t.Run("logs made while handling the request carry its attributes", func(t *testing.T) {
+		output.Reset()
+		response := execHandlerRequest(testServer, http.MethodPost, "/api/v1/decks/"+deckID+"/draw?count=1", map[string]string{"X-Request-ID": "abc-456"})
+		require.Equal(t, http.StatusInternalServerError, response.Code)
+
+		lines := logLines(t, output)
+		require.Len(t, lines, 2)
+		require.Equal(t, "Unknown error drawing cards", lines[0]["msg"])
+		require.Equal(t, "abc-456", lines[0]["request_id"])
+		require.Equal(t, deckID, lines[0]["deck_id"])
+		require.Equal(t, "/api/v1/decks/{deck_id}/draw", lines[0]["route"])
+	})
+
+	t.Run("requests not matching any route are logged too", func(t *testing.T) {
+		output.Reset()
+		response := execHandlerRequest(testServer, http.MethodGet, "/nope", nil)
+		require.Equal(t, http.StatusNotFound, response.Code)
+
+		lines := logLines(t, output)
+		require.Len(t, lines, 1)
+		require.Equal(t, float64(http.StatusNotFound), lines[0]["status"])
+		require.NotContains(t, lines[0], "route")
+	})
+}
+
+func execHandlerRequest(server *Server, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, nil)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response := httptest.NewRecorder()
+	server.Handler().ServeHTTP(response, request)
+	return response
+}
+
+func logLines(t *testing.T, output *bytes.Buffer) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+type failingDrawStorage struct {
+	storage.Storage
+}
+
+func (s *failingDrawStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*storage.DrawResult, error) {
+	return nil, errors.New("connection refused")
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"net/http"
+)
+
+// Every version has its own OpenAPI document, in the openapi directory.
+// They are written by hand, and the contract tests check that they match the handlers,
+// so they need to be updated whenever a route or response changes.
+func (s *Server) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(versionFromContext(r.Context()).spec)
+}
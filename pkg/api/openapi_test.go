@@ -0,0 +1,438 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lucaspin/decks-api/pkg/idempotency"
+	"github.com/lucaspin/decks-api/pkg/ratelimit"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/lucaspin/decks-api/pkg/webhooks"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__OpenAPISpecIsServed(t *testing.T) {
+	testServer := NewServer(storage.NewInMemoryStorage())
+	for _, version := range apiVersions {
+		response := execRequest(testServer, http.MethodGet, version.basePath()+"/openapi.json", nil)
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+		require.JSONEq(t, string(version.spec), response.Body.String())
+
+		document := loadOpenAPISpec(t, version.spec).document
+		require.Equal(t, version.name, document["info"].(map[string]interface{})["version"])
+	}
+}
+
+// Every route registered in InitRouter must be in the spec of its version,
+// and every path in the specs must be a route.
+func Test__OpenAPISpecCoversAllRoutes(t *testing.T) {
+	testServer := newContractTestServer(t)
+	operations := map[string]bool{}
+	for _, version := range apiVersions {
+		for _, operation := range loadOpenAPISpec(t, version.spec).operations() {
+			operations[operation] = true
+		}
+	}
+
+	documented := []string{}
+	for operation := range operations {
+		documented = append(documented, operation)
+	}
+
+	routes := []string{}
+	err := testServer.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+
+		for _, method := range methods {
+			routes = append(routes, method+" "+path)
+		}
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	require.ElementsMatch(t, documented, routes)
+}
+
+// Checks that the responses the handlers actually send are the ones described in the spec of each version.
+// Every operation in the specs needs to be checked at least once.
+func Test__OpenAPIContract(t *testing.T) {
+	for _, version := range apiVersions {
+		t.Run(version.name, func(t *testing.T) {
+			testContract(t, version)
+		})
+	}
+}
+
+func testContract(t *testing.T, version *apiVersion) {
+	spec := loadOpenAPISpec(t, version.spec)
+	testServer := newContractTestServer(t)
+	checked := map[string]bool{}
+	base := version.basePath()
+
+	check := func(t *testing.T, method, template, path string, headers map[string]string, body interface{}) *httptest.ResponseRecorder {
+		response := execRequestWithHeaders(testServer, method, path, body, headers)
+		for _, problem := range spec.check(method, template, response) {
+			t.Errorf("%s %s -> %d: %s", method, path, response.Code, problem)
+		}
+
+		checked[method+" "+template] = true
+		return response
+	}
+
+	var (
+		decksPath    = base + "/decks"
+		deckPath     = base + "/decks/{deck_id}"
+		drawPath     = base + "/decks/{deck_id}/draw"
+		eventsPath   = base + "/decks/{deck_id}/events"
+		streamPath   = base + "/decks/{deck_id}/events/stream"
+		shufflePath  = base + "/decks/{deck_id}/shuffle"
+		undoPath     = base + "/decks/{deck_id}/undo"
+		webhooksPath = base + "/webhooks"
+	)
+
+	t.Run("meta", func(t *testing.T) {
+		check(t, http.MethodGet, "/", "/", nil, nil)
+		check(t, http.MethodGet, "/healthz", "/healthz", nil, nil)
+		check(t, http.MethodGet, "/readyz", "/readyz", nil, nil)
+		check(t, http.MethodGet, base+"/openapi.json", base+"/openapi.json", nil, nil)
+	})
+
+	t.Run("decks", func(t *testing.T) {
+		response := check(t, http.MethodPost, decksPath, decksPath+"?shuffled=true&cards=AS,KD,AC", nil, nil)
+		created := CreateDeckResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&created))
+		deckID := created.DeckID.String()
+		deckURL := strings.Replace(deckPath, "{deck_id}", deckID, 1)
+
+		check(t, http.MethodPost, decksPath, decksPath+"?cards=XX", nil, nil)
+
+		response = check(t, http.MethodGet, deckPath, deckURL, nil, nil)
+		check(t, http.MethodGet, deckPath, deckURL, map[string]string{"If-None-Match": response.Header().Get("ETag")}, nil)
+		check(t, http.MethodGet, deckPath, base+"/decks/not-a-uuid", nil, nil)
+		check(t, http.MethodGet, deckPath, base+"/decks/"+uuid.NewString(), nil, nil)
+
+		check(t, http.MethodPost, drawPath, deckURL+"/draw?count=2", nil, nil)
+		check(t, http.MethodPost, drawPath, deckURL+"/draw", nil, nil)
+		check(t, http.MethodPost, drawPath, deckURL+"/draw?count=1", map[string]string{"If-Match": `"1"`}, nil)
+		check(t, http.MethodPost, drawPath, base+"/decks/"+uuid.NewString()+"/draw?count=1", nil, nil)
+
+		check(t, http.MethodPost, undoPath, deckURL+"/undo", nil, nil)
+		check(t, http.MethodPost, undoPath, deckURL+"/undo?count=0", nil, nil)
+		check(t, http.MethodPost, undoPath, deckURL+"/undo", map[string]string{"If-Match": `"1"`}, nil)
+		check(t, http.MethodPost, undoPath, deckURL+"/undo?count=5", nil, nil)
+
+		check(t, http.MethodPost, shufflePath, deckURL+"/shuffle", nil, nil)
+		check(t, http.MethodPost, shufflePath, deckURL+"/shuffle", map[string]string{"If-Match": `"1"`}, nil)
+		check(t, http.MethodPost, shufflePath, base+"/decks/not-a-uuid/shuffle", nil, nil)
+		check(t, http.MethodPost, shufflePath, base+"/decks/"+uuid.NewString()+"/shuffle", nil, nil)
+
+		check(t, http.MethodPost, drawPath, deckURL+"/draw?count=3", nil, nil)
+		check(t, http.MethodPost, drawPath, deckURL+"/draw?count=1", nil, nil)
+
+		check(t, http.MethodGet, eventsPath, deckURL+"/events", nil, nil)
+		check(t, http.MethodGet, eventsPath, deckURL+"/events?after=-1", nil, nil)
+		check(t, http.MethodGet, eventsPath, base+"/decks/"+uuid.NewString()+"/events", nil, nil)
+
+		// A successful stream never ends, so only errors are checked.
+		check(t, http.MethodGet, streamPath, deckURL+"/events/stream", map[string]string{"Last-Event-ID": "invalid"}, nil)
+		check(t, http.MethodGet, streamPath, base+"/decks/"+uuid.NewString()+"/events/stream", nil, nil)
+
+		// The upgrade to a WebSocket is checked in Test__Rooms.
+		check(t, http.MethodGet, base+"/rooms/{room}/ws", base+"/rooms/not-a-room/ws", nil, nil)
+	})
+
+	t.Run("idempotency", func(t *testing.T) {
+		key := map[string]string{"Idempotency-Key": uuid.NewString(), apiKeyHeader: uuid.NewString()}
+		check(t, http.MethodPost, decksPath, decksPath, key, nil)
+		check(t, http.MethodPost, decksPath, decksPath+"?shuffled=true", key, nil)
+	})
+
+	t.Run("webhooks", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Cleanup(receiver.Close)
+
+		owner := map[string]string{apiKeyHeader: uuid.NewString()}
+		check(t, http.MethodPost, webhooksPath, webhooksPath, nil, &CreateWebhookRequest{URL: receiver.URL, Events: webhooks.AllEventTypes()})
+		check(t, http.MethodPost, webhooksPath, webhooksPath, owner, &CreateWebhookRequest{URL: receiver.URL})
+		response := check(t, http.MethodPost, webhooksPath, webhooksPath, owner, &CreateWebhookRequest{URL: receiver.URL, Events: webhooks.AllEventTypes()})
+		webhook := WebhookResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&webhook))
+
+		check(t, http.MethodGet, webhooksPath, webhooksPath, owner, nil)
+		check(t, http.MethodGet, webhooksPath, webhooksPath, nil, nil)
+
+		// Creating a deck sends a delivery, which succeeds, so it can't be replayed.
+		execRequestWithHeaders(testServer, http.MethodPost, decksPath+"?cards=AS", nil, owner)
+		require.Eventually(t, func() bool {
+			deliveries, err := testServer.webhooks.Store().ListDeliveries(context.Background(), "key:"+owner[apiKeyHeader], webhooks.DeliverySucceeded)
+			return err == nil && len(deliveries) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		response = check(t, http.MethodGet, webhooksPath+"/deliveries", webhooksPath+"/deliveries", owner, nil)
+		deliveries := ListDeliveriesResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&deliveries))
+		require.Len(t, deliveries.Deliveries, 1)
+
+		check(t, http.MethodGet, webhooksPath+"/deliveries", webhooksPath+"/deliveries?status=failed", owner, nil)
+		check(t, http.MethodGet, webhooksPath+"/deliveries", webhooksPath+"/deliveries?status=invalid", owner, nil)
+
+		replayPath := webhooksPath + "/deliveries/{delivery_id}/replay"
+		check(t, http.MethodPost, replayPath, webhooksPath+"/deliveries/"+deliveries.Deliveries[0].ID+"/replay", owner, nil)
+		check(t, http.MethodPost, replayPath, webhooksPath+"/deliveries/"+uuid.NewString()+"/replay", owner, nil)
+		check(t, http.MethodPost, webhooksPath+"/deliveries/replay", webhooksPath+"/deliveries/replay", owner, nil)
+
+		check(t, http.MethodDelete, webhooksPath+"/{webhook_id}", webhooksPath+"/"+webhook.ID, owner, nil)
+		check(t, http.MethodDelete, webhooksPath+"/{webhook_id}", webhooksPath+"/"+webhook.ID, owner, nil)
+	})
+
+	// Every request comes from the same address, so this runs last,
+	// and uses up whatever the other checks left of the limits.
+	t.Run("rate limits", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			if check(t, http.MethodPost, decksPath, decksPath, nil, nil).Code == http.StatusTooManyRequests {
+				return
+			}
+		}
+
+		t.Fatal("deck creation was never limited")
+	})
+
+	for _, operation := range spec.operations() {
+		require.True(t, checked[operation], "%s was not checked against the spec", operation)
+	}
+}
+
+func newContractTestServer(t *testing.T) *Server {
+	// The receiver runs on a loopback address.
+	config := webhooks.DefaultConfig()
+	config.AllowPrivateAddresses = true
+	dispatcher := webhooks.NewDispatcher(webhooks.NewInMemoryStore(), config)
+	t.Cleanup(dispatcher.Close)
+
+	limits := DefaultRateLimitConfig()
+	limits.Create = ratelimit.Limit{Rate: 0.001, Burst: 5}
+	return NewServer(
+		storage.NewInMemoryStorage(),
+		WithRateLimiter(ratelimit.NewInMemoryLimiter(), limits),
+		WithIdempotencyStore(idempotency.NewInMemoryStore(), time.Hour),
+		WithWebhooks(dispatcher),
+	)
+}
+
+// Just enough of OpenAPI 3.0 to check our own responses against the spec.
+type openAPISpecDocument struct {
+	document map[string]interface{}
+}
+
+func loadOpenAPISpec(t *testing.T, spec []byte) *openAPISpecDocument {
+	document := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(spec, &document))
+	return &openAPISpecDocument{document: document}
+}
+
+func (s *openAPISpecDocument) operations() []string {
+	operations := []string{}
+	for path, item := range s.document["paths"].(map[string]interface{}) {
+		for method := range item.(map[string]interface{}) {
+			operations = append(operations, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	sort.Strings(operations)
+	return operations
+}
+
+// Follows $refs, which are always local in our spec.
+func (s *openAPISpecDocument) resolve(object map[string]interface{}) map[string]interface{} {
+	ref, ok := object["$ref"].(string)
+	if !ok {
+		return object
+	}
+
+	var current interface{} = s.document
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		current = current.(map[string]interface{})[part]
+	}
+
+	return s.resolve(current.(map[string]interface{}))
+}
+
+// Returns everything in the response that doesn't match the spec.
+func (s *openAPISpecDocument) check(method, template string, response *httptest.ResponseRecorder) []string {
+	item, ok := s.document["paths"].(map[string]interface{})[template].(map[string]interface{})
+	if !ok {
+		return []string{"path is not in the spec"}
+	}
+
+	operation, ok := item[strings.ToLower(method)].(map[string]interface{})
+	if !ok {
+		return []string{"method is not in the spec"}
+	}
+
+	documented, ok := operation["responses"].(map[string]interface{})[fmt.Sprintf("%d", response.Code)].(map[string]interface{})
+	if !ok {
+		return []string{"status code is not in the spec"}
+	}
+
+	documented = s.resolve(documented)
+	problems := []string{}
+	if headers, ok := documented["headers"].(map[string]interface{}); ok {
+		for name, header := range headers {
+			if required, _ := s.resolve(header.(map[string]interface{}))["required"].(bool); required && response.Header().Get(name) == "" {
+				problems = append(problems, "missing required header "+name)
+			}
+		}
+	}
+
+	content, ok := documented["content"].(map[string]interface{})
+	if !ok {
+		if response.Body.Len() > 0 {
+			problems = append(problems, "response has a body, but none is in the spec")
+		}
+
+		return problems
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header().Get("Content-Type"))
+	media, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		return append(problems, fmt.Sprintf("content type '%s' is not in the spec", mediaType))
+	}
+
+	var body interface{} = response.Body.String()
+	if mediaType == "application/json" {
+		if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+			return append(problems, "invalid JSON body: "+err.Error())
+		}
+	}
+
+	return append(problems, s.validate(media["schema"].(map[string]interface{}), body, "body")...)
+}
+
+func (s *openAPISpecDocument) validate(schema map[string]interface{}, value interface{}, at string) []string {
+	schema = s.resolve(schema)
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+
+		return []string{at + " is null"}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			found = found || option == value
+		}
+
+		if !found {
+			return []string{fmt.Sprintf("%s is %v, which is not one of %v", at, value, enum)}
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		return s.validateObject(schema, value, at)
+
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return []string{at + " is not an array"}
+		}
+
+		problems := []string{}
+		for i, item := range list {
+			problems = append(problems, s.validate(schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+
+		return problems
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{at + " is not a string"}
+		}
+
+		return validateFormat(schema["format"], str, at)
+
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			return []string{at + " is not an integer"}
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{at + " is not a boolean"}
+		}
+	}
+
+	return nil
+}
+
+func (s *openAPISpecDocument) validateObject(schema map[string]interface{}, value interface{}, at string) []string {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return []string{at + " is not an object"}
+	}
+
+	problems := []string{}
+	properties, _ := schema["properties"].(map[string]interface{})
+	required, _ := schema["required"].([]interface{})
+	for _, name := range required {
+		if _, ok := object[name.(string)]; !ok {
+			problems = append(problems, fmt.Sprintf("%s.%s is required, but missing", at, name))
+		}
+	}
+
+	for name, propertyValue := range object {
+		property, ok := properties[name].(map[string]interface{})
+		if !ok {
+			if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				problems = append(problems, fmt.Sprintf("%s.%s is not in the spec", at, name))
+			}
+
+			continue
+		}
+
+		problems = append(problems, s.validate(property, propertyValue, at+"."+name)...)
+	}
+
+	return problems
+}
+
+func validateFormat(format interface{}, value, at string) []string {
+	switch format {
+	case "uuid":
+		if _, err := uuid.Parse(value); err != nil {
+			return []string{at + " is not a UUID"}
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			return []string{at + " is not a date-time"}
+		}
+	}
+
+	return nil
+}
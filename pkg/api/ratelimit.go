@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"github.com/lucaspin/decks-api/pkg/ratelimit"
+	"github.com/lucaspin/decks-api/pkg/rooms"
+)
+
+// The same limits are used by the gRPC server, so they live in the ratelimit package.
+type RateLimitConfig = ratelimit.Config
+
+func DefaultRateLimitConfig() RateLimitConfig {
+	return ratelimit.DefaultConfig()
+}
+
+// Wraps a handler with a token bucket limit, and optionally a daily quota,
+// both keyed by the client identified by authMiddleware.
+// If the server has no limiter configured, the handler is returned as is.
+func (s *Server) rateLimited(name string, limit ratelimit.Limit, quota int, next http.HandlerFunc) http.HandlerFunc {
+	if s.limiter == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, allowed := s.checkLimits(r.Context(), name, limit, quota)
+		if result != nil {
+			setRateLimitHeaders(w, result)
+		}
+
+		if !allowed {
+			tooManyRequests(w, result)
+			return
+		}
+
+		// Requests that fail don't create anything, so they don't use the daily quota.
+		// A nil result means the limits couldn't be checked, and nothing was counted.
+		if quota <= 0 || result == nil {
+			next(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next(sw, r)
+		if sw.statusCode >= http.StatusBadRequest {
+			s.refundQuota(r.Context(), name)
+		}
+	}
+}
+
+func (s *Server) refundQuota(ctx context.Context, name string) {
+	key := name + ":" + rateLimitClientFromContext(ctx)
+	if err := s.limiter.RefundQuota(ctx, key); err != nil {
+		logging.FromContext(ctx).Error("Error refunding quota", "key", key, "error", err)
+	}
+}
+
+// Keeps the status code written to the response, so we know if the request failed.
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.statusCode = statusCode
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Takes a token from the bucket of the client for name, and, if quota is set, counts against its daily quota.
+// The result returned is the one rejecting the request, if any, or the one from the bucket,
+// and is nil if the limits couldn't be checked, in which case nothing was counted against the quota.
+func (s *Server) checkLimits(ctx context.Context, name string, limit ratelimit.Limit, quota int) (*ratelimit.Result, bool) {
+	key := name + ":" + rateLimitClientFromContext(ctx)
+	result, err := ratelimit.AllowWithQuota(ctx, s.limiter, key, limit, quota)
+
+	// If we can't check the limits, we let the request through.
+	// Rejecting every request because the limiter is unavailable is worse.
+	if err != nil {
+		logging.FromContext(ctx).Error("Error checking rate limit", "key", key, "error", err)
+		return nil, true
+	}
+
+	return result, result.Allowed
+}
+
+// Rooms create and draw from decks like the API does, so they share the limits of its clients.
+func (s *Server) limitRoomAction(ctx context.Context, action rooms.Action) error {
+	if s.limiter == nil {
+		return nil
+	}
+
+	limits := s.rateLimitConfig
+	var allowed bool
+	switch action {
+	case rooms.ActionCreate:
+		_, allowed = s.checkLimits(ctx, "create", limits.Create, limits.DailyCreateQuota)
+	case rooms.ActionDraw:
+		_, allowed = s.checkLimits(ctx, "draw", limits.Draw, 0)
+	default:
+		return nil
+	}
+
+	if !allowed {
+		return rooms.ErrRateLimited
+	}
+
+	return nil
+}
+
+// Decks that rooms fail to create don't use the daily quota, same as with the API.
+func (s *Server) refundRoomAction(ctx context.Context, action rooms.Action) {
+	if s.limiter != nil && action == rooms.ActionCreate && s.rateLimitConfig.DailyCreateQuota > 0 {
+		s.refundQuota(ctx, "create")
+	}
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, result *ratelimit.Result) {
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", ratelimit.CeilSeconds(result.ResetAfter)))
+}
+
+func tooManyRequests(w http.ResponseWriter, result *ratelimit.Result) {
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", ratelimit.CeilSeconds(result.RetryAfter)))
+	http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/lucaspin/decks-api/pkg/cards"
 	"github.com/lucaspin/decks-api/pkg/storage"
@@ -31,6 +33,32 @@ type DrawCardsResponse struct {
 	Cards []Card `json:"cards"`
 }
 
+type ShuffleDeckResponse struct {
+	DeckID    *uuid.UUID `json:"deck_id"`
+	Shuffled  bool       `json:"shuffled"`
+	Remaining int        `json:"remaining"`
+}
+
+type ListEventsResponse struct {
+	DeckID *uuid.UUID `json:"deck_id"`
+	Events []Event    `json:"events"`
+}
+
+type Event struct {
+	Version   int64     `json:"version"`
+	Type      string    `json:"type"`
+	Cards     []Card    `json:"cards"`
+	Shuffled  *bool     `json:"shuffled,omitempty"`
+	Reverts   []int64   `json:"reverts,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UndoResponse struct {
+	DeckID    *uuid.UUID `json:"deck_id"`
+	Remaining int        `json:"remaining"`
+	Cards     []Card     `json:"cards"`
+}
+
 type Card struct {
 	Value string
 	Suit  string
@@ -38,24 +66,54 @@ type Card struct {
 }
 
 func newOpenDeckResponse(deck *storage.Deck) OpenDeckResponse {
-	cards := make([]Card, len(deck.Cards))
-	for i, c := range deck.Cards {
-		cards[i] = Card{
-			Value: c.Rank.String(),
-			Suit:  c.Suit.String(),
-			Code:  c.Code(),
-		}
-	}
-
 	return OpenDeckResponse{
 		DeckID:    deck.DeckID,
 		Shuffled:  deck.Shuffled,
 		Remaining: deck.Remaining(),
-		Cards:     cards,
+		Cards:     newCardList(deck.Cards),
 	}
 }
 
 func newDrawCardsResponse(deckCards []cards.Card) DrawCardsResponse {
+	return DrawCardsResponse{Cards: newCardList(deckCards)}
+}
+
+func newListEventsResponse(deckID *uuid.UUID, deckEvents []storage.Event) ListEventsResponse {
+	events := make([]Event, len(deckEvents))
+	for i, e := range deckEvents {
+		events[i] = newEvent(e)
+	}
+
+	return ListEventsResponse{DeckID: deckID, Events: events}
+}
+
+func newEvent(e storage.Event) Event {
+	event := Event{
+		Version:   e.Version,
+		Type:      string(e.Type),
+		Cards:     newCardList(e.Cards),
+		Reverts:   e.Reverts,
+		CreatedAt: e.CreatedAt,
+	}
+
+	// Only deck creation tells us if the deck is shuffled or not.
+	if e.Type == storage.EventTypeCreated {
+		shuffled := e.Shuffled
+		event.Shuffled = &shuffled
+	}
+
+	return event
+}
+
+func newUndoResponse(deckID *uuid.UUID, result *storage.UndoResult) UndoResponse {
+	return UndoResponse{
+		DeckID:    deckID,
+		Remaining: result.Remaining,
+		Cards:     newCardList(result.Cards),
+	}
+}
+
+func newCardList(deckCards []cards.Card) []Card {
 	cards := make([]Card, len(deckCards))
 	for i, c := range deckCards {
 		cards[i] = Card{
@@ -65,5 +123,46 @@ func newDrawCardsResponse(deckCards []cards.Card) DrawCardsResponse {
 		}
 	}
 
-	return DrawCardsResponse{Cards: cards}
+	return cards
+}
+
+// The responses of v1alpha, which is deprecated.
+// Cards have no JSON tags here, so their fields are capitalized, unlike everything else.
+type v1alphaPresenter struct{}
+
+func (v1alphaPresenter) createDeck(deck *storage.Deck) interface{} {
+	response := newCreateDeckResponse(deck)
+	return &response
+}
+
+func (v1alphaPresenter) openDeck(deck *storage.Deck) interface{} {
+	response := newOpenDeckResponse(deck)
+	return &response
+}
+
+func (v1alphaPresenter) drawCards(deckID *uuid.UUID, result *storage.DrawResult) interface{} {
+	response := newDrawCardsResponse(result.Cards)
+	return &response
+}
+
+func (v1alphaPresenter) shuffleDeck(deck *storage.Deck) interface{} {
+	return &ShuffleDeckResponse{
+		DeckID:    deck.DeckID,
+		Shuffled:  deck.Shuffled,
+		Remaining: deck.Remaining(),
+	}
+}
+
+func (v1alphaPresenter) listEvents(deckID *uuid.UUID, events []storage.Event) interface{} {
+	response := newListEventsResponse(deckID, events)
+	return &response
+}
+
+func (v1alphaPresenter) undo(deckID *uuid.UUID, result *storage.UndoResult) interface{} {
+	response := newUndoResponse(deckID, result)
+	return &response
+}
+
+func (v1alphaPresenter) event(e storage.Event) interface{} {
+	return newEvent(e)
 }
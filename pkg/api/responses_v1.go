@@ -0,0 +1,155 @@
+package api
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/storage"
+)
+
+// Every v1 response changing a deck, or returning it, includes its version,
+// which is the same as the one in the ETag header.
+
+type CreateDeckResponseV1 struct {
+	DeckID    *uuid.UUID `json:"deck_id"`
+	Shuffled  bool       `json:"shuffled"`
+	Remaining int        `json:"remaining"`
+	Version   int64      `json:"version"`
+}
+
+type OpenDeckResponseV1 struct {
+	DeckID    *uuid.UUID `json:"deck_id"`
+	Shuffled  bool       `json:"shuffled"`
+	Remaining int        `json:"remaining"`
+	Version   int64      `json:"version"`
+	Cards     []CardV1   `json:"cards"`
+}
+
+type DrawCardsResponseV1 struct {
+	DeckID    *uuid.UUID `json:"deck_id"`
+	Remaining int        `json:"remaining"`
+	Version   int64      `json:"version"`
+	Cards     []CardV1   `json:"cards"`
+}
+
+type ShuffleDeckResponseV1 struct {
+	DeckID    *uuid.UUID `json:"deck_id"`
+	Shuffled  bool       `json:"shuffled"`
+	Remaining int        `json:"remaining"`
+	Version   int64      `json:"version"`
+}
+
+type ListEventsResponseV1 struct {
+	DeckID *uuid.UUID `json:"deck_id"`
+	Events []EventV1  `json:"events"`
+}
+
+type EventV1 struct {
+	Version   int64     `json:"version"`
+	Type      string    `json:"type"`
+	Cards     []CardV1  `json:"cards"`
+	Shuffled  *bool     `json:"shuffled,omitempty"`
+	Reverts   []int64   `json:"reverts,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UndoResponseV1 struct {
+	DeckID    *uuid.UUID `json:"deck_id"`
+	Remaining int        `json:"remaining"`
+	Version   int64      `json:"version"`
+	Cards     []CardV1   `json:"cards"`
+}
+
+type CardV1 struct {
+	Value string `json:"value"`
+	Suit  string `json:"suit"`
+	Code  string `json:"code"`
+}
+
+type v1Presenter struct{}
+
+func (v1Presenter) createDeck(deck *storage.Deck) interface{} {
+	return &CreateDeckResponseV1{
+		DeckID:    deck.DeckID,
+		Shuffled:  deck.Shuffled,
+		Remaining: deck.Remaining(),
+		Version:   deck.Version,
+	}
+}
+
+func (v1Presenter) openDeck(deck *storage.Deck) interface{} {
+	return &OpenDeckResponseV1{
+		DeckID:    deck.DeckID,
+		Shuffled:  deck.Shuffled,
+		Remaining: deck.Remaining(),
+		Version:   deck.Version,
+		Cards:     newCardListV1(deck.Cards),
+	}
+}
+
+func (v1Presenter) drawCards(deckID *uuid.UUID, result *storage.DrawResult) interface{} {
+	return &DrawCardsResponseV1{
+		DeckID:    deckID,
+		Remaining: result.Remaining,
+		Version:   result.Version,
+		Cards:     newCardListV1(result.Cards),
+	}
+}
+
+func (v1Presenter) shuffleDeck(deck *storage.Deck) interface{} {
+	return &ShuffleDeckResponseV1{
+		DeckID:    deck.DeckID,
+		Shuffled:  deck.Shuffled,
+		Remaining: deck.Remaining(),
+		Version:   deck.Version,
+	}
+}
+
+func (v1Presenter) listEvents(deckID *uuid.UUID, deckEvents []storage.Event) interface{} {
+	events := make([]EventV1, len(deckEvents))
+	for i, e := range deckEvents {
+		events[i] = newEventV1(e)
+	}
+
+	return &ListEventsResponseV1{DeckID: deckID, Events: events}
+}
+
+func (v1Presenter) undo(deckID *uuid.UUID, result *storage.UndoResult) interface{} {
+	return &UndoResponseV1{
+		DeckID:    deckID,
+		Remaining: result.Remaining,
+		Version:   result.Version,
+		Cards:     newCardListV1(result.Cards),
+	}
+}
+
+func (v1Presenter) event(e storage.Event) interface{} {
+	return newEventV1(e)
+}
+
+// Same as v1alpha events, except for the cards.
+func newEventV1(e storage.Event) EventV1 {
+	event := newEvent(e)
+	return EventV1{
+		Version:   event.Version,
+		Type:      event.Type,
+		Cards:     newCardListV1(e.Cards),
+		Shuffled:  event.Shuffled,
+		Reverts:   event.Reverts,
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+func newCardListV1(deckCards []cards.Card) []CardV1 {
+	list := make([]CardV1, len(deckCards))
+	for i, c := range deckCards {
+		list[i] = CardV1{
+			Value: c.Rank.String(),
+			Suit:  c.Suit.String(),
+			Code:  c.Code(),
+		}
+	}
+
+	return list
+}
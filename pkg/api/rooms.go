@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"github.com/lucaspin/decks-api/pkg/rooms"
+)
+
+const joinRoomRoute = "join-room"
+
+const (
+	// Commands are small, so anything bigger than this is not one.
+	maxCommandSize = 4096
+
+	// Players that can't keep up with the room get disconnected,
+	// and can resume their session once they reconnect.
+	roomSendBufferSize = 64
+
+	roomWriteTimeout = 10 * time.Second
+	roomPongTimeout  = 60 * time.Second
+	roomPingInterval = roomPongTimeout * 9 / 10
+)
+
+var roomNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Connects a player to a room over a WebSocket.
+// The first command sent must be a join, and every command after that is handled by the room.
+// See the rooms package for the protocol.
+func (s *Server) JoinRoom(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["room"]
+	if !roomNameRegex.MatchString(name) {
+		http.Error(w, "invalid room name", http.StatusBadRequest)
+		return
+	}
+
+	// The upgrader already responds with an error if the upgrade fails.
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s.streams.Add(1)
+	defer s.streams.Done()
+
+	client := newSocketClient(conn, logging.FromContext(r.Context()))
+	go client.writeLoop()
+	defer client.Close()
+
+	// When the server shuts down, players are told it is going away, instead of just losing the connection.
+	stop := context.AfterFunc(s.closing, func() {
+		client.closeWith(websocket.CloseGoingAway)
+	})
+
+	defer stop()
+
+	conn.SetReadLimit(maxCommandSize)
+	conn.SetReadDeadline(time.Now().Add(roomPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(roomPongTimeout))
+	})
+
+	command, ok := client.readCommand()
+	if !ok {
+		return
+	}
+
+	session, err := s.rooms.Join(r.Context(), name, command, client)
+	if err != nil {
+		client.Send(rooms.ErrorMessage(r.Context(), command, err, "room", name))
+		return
+	}
+
+	defer session.Leave()
+
+	for {
+		command, ok := client.readCommand()
+		if !ok {
+			return
+		}
+
+		session.Handle(r.Context(), command)
+	}
+}
+
+// A rooms.Client writing messages to a WebSocket.
+// The room sends messages while holding its lock, so they are queued here,
+// and written by a separate goroutine.
+type socketClient struct {
+	conn      *websocket.Conn
+	send      chan *rooms.Message
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+	logger    *slog.Logger
+}
+
+func newSocketClient(conn *websocket.Conn, logger *slog.Logger) *socketClient {
+	return &socketClient{
+		conn:   conn,
+		logger: logger,
+		send:   make(chan *rooms.Message, roomSendBufferSize),
+		done:   make(chan struct{}),
+	}
+}
+
+func (c *socketClient) Send(message *rooms.Message) {
+	select {
+	case c.send <- message:
+	case <-c.done:
+	default:
+		c.logger.Warn("Disconnecting room client that is not keeping up")
+		c.Close()
+	}
+}
+
+func (c *socketClient) Close() {
+	c.closeWith(websocket.CloseNormalClosure)
+}
+
+// The code is sent to the client in the close message.
+func (c *socketClient) closeWith(code int) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		close(c.done)
+	})
+}
+
+// Reads the next command from the socket.
+// Commands that can't be parsed get an error back, and are skipped.
+func (c *socketClient) readCommand() (*rooms.Command, bool) {
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return nil, false
+		}
+
+		command := rooms.Command{}
+		if err := json.Unmarshal(data, &command); err != nil {
+			c.Send(&rooms.Message{Type: rooms.MessageError, Error: "invalid command"})
+			continue
+		}
+
+		return &command, true
+	}
+}
+
+func (c *socketClient) writeLoop() {
+	ping := time.NewTicker(roomPingInterval)
+	defer func() {
+		ping.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message := <-c.send:
+			if err := c.write(message); err != nil {
+				c.Close()
+				return
+			}
+
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(roomWriteTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Close()
+				return
+			}
+
+		case <-c.done:
+			c.flush()
+			return
+		}
+	}
+}
+
+// Writes whatever is still queued, like an error explaining why the connection is being closed,
+// before saying goodbye.
+func (c *socketClient) flush() {
+	for {
+		select {
+		case message := <-c.send:
+			if err := c.write(message); err != nil {
+				return
+			}
+		default:
+			c.conn.SetWriteDeadline(time.Now().Add(roomWriteTimeout))
+			c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, ""))
+			return
+		}
+	}
+}
+
+func (c *socketClient) write(message *rooms.Message) error {
+	c.conn.SetWriteDeadline(time.Now().Add(roomWriteTimeout))
+	return c.conn.WriteJSON(message)
+}
@@ -1,55 +1,268 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
-	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/idempotency"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"github.com/lucaspin/decks-api/pkg/metrics"
+	"github.com/lucaspin/decks-api/pkg/ratelimit"
+	"github.com/lucaspin/decks-api/pkg/rooms"
 	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/lucaspin/decks-api/pkg/webhooks"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Timeouts for the HTTP server.
+// Streaming routes, like Server-Sent Events and WebSockets, are exempt from the write and request timeouts.
+type TimeoutConfig struct {
+	// How long reading a request, including its body, can take.
+	Read time.Duration
+
+	// How long writing a response can take.
+	Write time.Duration
+
+	// How long a keep-alive connection can wait for the next request.
+	Idle time.Duration
+
+	// How long handling a request can take. Should be shorter than the write timeout,
+	// so the client gets an error, instead of the connection being cut.
+	Request time.Duration
+}
+
+func DefaultTimeoutConfig() TimeoutConfig {
+	return TimeoutConfig{
+		Read:    5 * time.Second,
+		Write:   30 * time.Second,
+		Idle:    60 * time.Second,
+		Request: 15 * time.Second,
+	}
+}
+
+// Used when creating a deck without saying otherwise.
+type DeckDefaults struct {
+	// Used when the shuffled query parameter is not given.
+	Shuffled bool
+}
+
 type Server struct {
-	router     *mux.Router
-	httpServer *http.Server
-	storage    storage.Storage
-	generator  *cards.CardGenerator
+	router               *mux.Router
+	httpServer           *http.Server
+	storage              storage.Storage
+	generator            *cards.CardGenerator
+	rooms                *rooms.Hub
+	limiter              ratelimit.Limiter
+	rateLimitConfig      RateLimitConfig
+	idempotencyStore     idempotency.Store
+	idempotencyRetention time.Duration
+	webhooks             *webhooks.Dispatcher
+	metrics              *metrics.Metrics
+	tracerProvider       trace.TracerProvider
+	logger               *slog.Logger
+	timeouts             TimeoutConfig
+	deckDefaults         DeckDefaults
+	tlsConfig            *tls.Config
+
+	// See Shutdown.
+	ready         atomic.Bool
+	shutdownDelay time.Duration
+	closing       context.Context
+	closeStreams  context.CancelFunc
+	streams       sync.WaitGroup
+}
+
+type ServerOption func(*Server)
+
+// Enables per-client rate limiting for creating decks and drawing cards.
+func WithRateLimiter(limiter ratelimit.Limiter, config RateLimitConfig) ServerOption {
+	return func(s *Server) {
+		s.limiter = limiter
+		s.rateLimitConfig = config
+	}
+}
+
+// Enables Idempotency-Key support for creating decks and drawing cards.
+// Responses are kept in the store for the retention period.
+func WithIdempotencyStore(store idempotency.Store, retention time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idempotencyStore = store
+		s.idempotencyRetention = retention
+	}
+}
+
+// Enables webhooks, sent by the dispatcher, and the endpoints to manage them.
+func WithWebhooks(dispatcher *webhooks.Dispatcher) ServerOption {
+	return func(s *Server) {
+		s.webhooks = dispatcher
+	}
+}
+
+// Records metrics for every request, and serves them at /metrics.
+// The storage is not instrumented by this option, see metrics.NewInstrumentedStorage.
+func WithMetrics(m *metrics.Metrics) ServerOption {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// Creates a span for every request, continuing the trace from the traceparent header, if there is one.
+// The storage is not traced by this option, see tracing.NewTracedStorage.
+func WithTracerProvider(provider trace.TracerProvider) ServerOption {
+	return func(s *Server) {
+		s.tracerProvider = provider
+	}
+}
+
+// Logs requests through the given logger, instead of the default one.
+// Handlers, and the storage, get a logger derived from it through logging.FromContext.
+func WithLogger(logger *slog.Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// How long the server waits, after it is marked as not ready, to stop accepting connections.
+// See Shutdown.
+func WithShutdownDelay(delay time.Duration) ServerOption {
+	return func(s *Server) {
+		s.shutdownDelay = delay
+	}
+}
+
+// Uses the given timeouts, instead of the ones from DefaultTimeoutConfig.
+func WithTimeouts(timeouts TimeoutConfig) ServerOption {
+	return func(s *Server) {
+		s.timeouts = timeouts
+	}
+}
+
+// Serves the API over HTTPS, with the given config, like the one from certs.Reloader.
+// If the config verifies client certificates, clients are identified by them. See authMiddleware.
+func WithTLS(config *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+// Creates decks with the given defaults, for the settings clients don't give.
+func WithDeckDefaults(defaults DeckDefaults) ServerOption {
+	return func(s *Server) {
+		s.deckDefaults = defaults
+	}
+}
+
+// Uses the given card generator, instead of a new one,
+// so it can be shared with other servers using the same storage.
+func WithCardGenerator(generator *cards.CardGenerator) ServerOption {
+	return func(s *Server) {
+		s.generator = generator
+	}
 }
 
-func NewServer(storage storage.Storage) *Server {
+func NewServer(storage storage.Storage, options ...ServerOption) *Server {
 	server := &Server{
 		storage:   storage,
 		generator: cards.NewCardGenerator(),
+		logger:    slog.Default(),
+		timeouts:  DefaultTimeoutConfig(),
+	}
+
+	for _, option := range options {
+		option(server)
 	}
 
+	server.rooms = rooms.NewHub(storage, server.generator, rooms.WithLimit(server.limitRoomAction, server.refundRoomAction))
+	server.closing, server.closeStreams = context.WithCancel(context.Background())
 	server.InitRouter()
+
+	// Streaming routes clear the write deadline for their own responses,
+	// so the write timeout only applies to everything else.
+	server.httpServer = &http.Server{
+		ReadTimeout:  server.timeouts.Read,
+		WriteTimeout: server.timeouts.Write,
+		IdleTimeout:  server.timeouts.Idle,
+		TLSConfig:    server.tlsConfig,
+		Handler:      server.Handler(),
+	}
+
+	server.ready.Store(true)
 	return server
 }
 
 func (s *Server) InitRouter() {
-	basePath := "/api/v1alpha"
 	s.router = mux.NewRouter().StrictSlash(true)
-	s.router.HandleFunc(basePath+"/decks", s.CreateDeck).Methods(http.MethodPost)
-	s.router.HandleFunc(basePath+"/decks/{deck_id}", s.OpenDeck).Methods(http.MethodGet)
-	s.router.HandleFunc(basePath+"/decks/{deck_id}/draw", s.DrawCards).Methods(http.MethodPost)
+	for _, version := range apiVersions {
+		s.registerRoutes(version)
+	}
+
 	s.router.HandleFunc("/", s.HealthCheck).Methods(http.MethodGet)
+	s.router.HandleFunc("/healthz", s.Liveness).Methods(http.MethodGet)
+	s.router.HandleFunc("/readyz", s.Readiness).Methods(http.MethodGet)
 	s.router.Use(authMiddleware)
+	if s.metrics != nil {
+		s.router.Handle("/metrics", s.metrics.Handler()).Methods(http.MethodGet)
+		s.router.Use(s.metrics.Middleware)
+	}
+
+	if s.tracerProvider != nil {
+		s.router.Use(nameSpanAfterRoute)
+	}
+}
+
+// Registers the routes of a version under its base path.
+// Handlers find out which version they are serving through versionFromContext.
+func (s *Server) registerRoutes(version *apiVersion) {
+	basePath := version.basePath()
+	handle := func(path string, handler http.HandlerFunc) *mux.Route {
+		return s.router.Handle(basePath+path, version.middleware(handler))
+	}
+
+	// Replays are answered before the limits are checked, so retrying a request doesn't use them up.
+	limits := s.rateLimitConfig
+	handle("/openapi.json", s.OpenAPISpec).Methods(http.MethodGet)
+	handle("/decks", s.idempotent(s.rateLimited("create", limits.Create, limits.DailyCreateQuota, s.CreateDeck))).Methods(http.MethodPost)
+	handle("/decks/{deck_id}", s.OpenDeck).Methods(http.MethodGet)
+	handle("/decks/{deck_id}/draw", s.idempotent(s.rateLimited("draw", limits.Draw, 0, s.DrawCards))).Methods(http.MethodPost)
+	handle("/decks/{deck_id}/events", s.ListEvents).Methods(http.MethodGet)
+	handle("/decks/{deck_id}/events/stream", s.StreamDeckEvents).Methods(http.MethodGet).Name(streamDeckEventsRoute)
+	handle("/decks/{deck_id}/shuffle", s.idempotent(s.rateLimited("shuffle", limits.Draw, 0, s.ShuffleDeck))).Methods(http.MethodPost)
+	handle("/decks/{deck_id}/undo", s.idempotent(s.rateLimited("undo", limits.Draw, 0, s.Undo))).Methods(http.MethodPost)
+	handle("/rooms/{room}/ws", s.JoinRoom).Methods(http.MethodGet).Name(joinRoomRoute)
+	if s.webhooks != nil {
+		handle("/webhooks", s.CreateWebhook).Methods(http.MethodPost)
+		handle("/webhooks", s.ListWebhooks).Methods(http.MethodGet)
+		handle("/webhooks/deliveries", s.ListWebhookDeliveries).Methods(http.MethodGet)
+		handle("/webhooks/deliveries/replay", s.ReplayFailedWebhookDeliveries).Methods(http.MethodPost)
+		handle("/webhooks/deliveries/{delivery_id}/replay", s.ReplayWebhookDelivery).Methods(http.MethodPost)
+		handle("/webhooks/{webhook_id}", s.DeleteWebhook).Methods(http.MethodDelete)
+	}
 }
 
 func (s *Server) CreateDeck(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
-	shuffled := queryParams.Get("shuffled") == "true"
+	shuffled := s.deckDefaults.Shuffled
+	if fromQuery := queryParams.Get("shuffled"); fromQuery != "" {
+		shuffled = fromQuery == "true"
+	}
+
+	codes := queryParams.Get("cards")
 	list, err := s.generator.NewListWithConfig(cards.GeneratorConfig{
 		Shuffled: shuffled,
-		Codes:    queryParams.Get("cards"),
+		Codes:    codes,
 	})
 
 	if err != nil {
@@ -57,14 +270,30 @@ func (s *Server) CreateDeck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deck, err := s.storage.Create(r.Context(), list, shuffled)
+	deckType := storage.DeckTypeFull
+	if codes != "" {
+		deckType = storage.DeckTypePartial
+	}
+
+	deck, err := s.storage.Create(r.Context(), list, storage.CreateOptions{
+		Shuffled: shuffled,
+		Owner:    clientFromContext(r.Context()),
+		Type:     deckType,
+	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	response := newCreateDeckResponse(deck)
-	respondWithJSON(w, http.StatusCreated, &response)
+	response := presenterFromContext(r.Context()).createDeck(deck)
+	s.dispatchWebhook(r.Context(), webhooks.EventDeckCreated, &DeckWebhookData{
+		DeckID:    deck.DeckID,
+		Shuffled:  &deck.Shuffled,
+		Remaining: deck.Remaining(),
+	})
+
+	w.Header().Set("ETag", formatETag(deck.Version))
+	respondWithJSON(w, http.StatusCreated, response)
 }
 
 func (s *Server) OpenDeck(w http.ResponseWriter, r *http.Request) {
@@ -76,8 +305,13 @@ func (s *Server) OpenDeck(w http.ResponseWriter, r *http.Request) {
 
 	deck, err := s.storage.Get(r.Context(), &deckID)
 	if err == nil {
-		response := newOpenDeckResponse(deck)
-		respondWithJSON(w, http.StatusOK, &response)
+		w.Header().Set("ETag", formatETag(deck.Version))
+		if ifNoneMatch(r.Header.Get("If-None-Match"), deck.Version) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, presenterFromContext(r.Context()).openDeck(deck))
 		return
 	}
 
@@ -114,10 +348,23 @@ func (s *Server) DrawCards(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cards, err := s.storage.Draw(r.Context(), &deckID, count)
+	// If the client tells us which version of the deck it expects,
+	// cards are only drawn if the deck didn't change since then.
+	ifVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		http.Error(w, "deck version does not match", http.StatusPreconditionFailed)
+		return
+	}
+
+	result, err := s.storage.Draw(r.Context(), &deckID, count, ifVersion)
 	if err == nil {
-		response := newDrawCardsResponse(cards)
-		respondWithJSON(w, http.StatusOK, &response)
+		// The next draw from this deck fails with ErrEmptyDeck.
+		if result.Remaining == 0 {
+			s.dispatchWebhook(r.Context(), webhooks.EventDeckEmptied, &DeckWebhookData{DeckID: &deckID})
+		}
+
+		w.Header().Set("ETag", formatETag(result.Version))
+		respondWithJSON(w, http.StatusOK, presenterFromContext(r.Context()).drawCards(&deckID, result))
 		return
 	}
 
@@ -131,33 +378,176 @@ func (s *Server) DrawCards(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Unknown error drawing cards: %v", err)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	logging.FromContext(r.Context()).Error("Unknown error drawing cards", "error", err)
+	http.Error(w, "unknown error", http.StatusInternalServerError)
+}
+
+func (s *Server) ListEvents(w http.ResponseWriter, r *http.Request) {
+	deckID, err := uuid.Parse(mux.Vars(r)["deck_id"])
+	if err != nil {
+		http.Error(w, "invalid deck ID", http.StatusBadRequest)
+		return
+	}
+
+	afterVersion := int64(0)
+	if after := r.URL.Query().Get("after"); after != "" {
+		afterVersion, err = strconv.ParseInt(after, 10, 64)
+		if err != nil || afterVersion < 0 {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := s.storage.Events(r.Context(), &deckID, afterVersion)
+	if err == nil {
+		respondWithJSON(w, http.StatusOK, presenterFromContext(r.Context()).listEvents(&deckID, events))
+		return
+	}
+
+	if errors.Is(err, storage.ErrDeckNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	logging.FromContext(r.Context()).Error("Unknown error listing events", "error", err)
+	http.Error(w, "unknown error", http.StatusInternalServerError)
+}
+
+// Shuffles the cards left in the deck. The cards already drawn stay out of it.
+func (s *Server) ShuffleDeck(w http.ResponseWriter, r *http.Request) {
+	deckID, err := uuid.Parse(mux.Vars(r)["deck_id"])
+	if err != nil {
+		http.Error(w, "invalid deck ID", http.StatusBadRequest)
+		return
+	}
+
+	ifVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		http.Error(w, "deck version does not match", http.StatusPreconditionFailed)
+		return
+	}
+
+	deck, err := s.storage.Shuffle(r.Context(), &deckID, s.generator.Shuffle, ifVersion)
+	if err == nil {
+		w.Header().Set("ETag", formatETag(deck.Version))
+		respondWithJSON(w, http.StatusOK, presenterFromContext(r.Context()).shuffleDeck(deck))
+		return
+	}
+
+	if errors.Is(err, storage.ErrDeckNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	logging.FromContext(r.Context()).Error("Unknown error shuffling deck", "error", err)
+	http.Error(w, "unknown error", http.StatusInternalServerError)
+}
+
+func (s *Server) Undo(w http.ResponseWriter, r *http.Request) {
+	deckID, err := uuid.Parse(mux.Vars(r)["deck_id"])
+	if err != nil {
+		http.Error(w, "invalid deck ID", http.StatusBadRequest)
+		return
+	}
+
+	count := 1
+	if countFromQuery := r.URL.Query().Get("count"); countFromQuery != "" {
+		count, err = strconv.Atoi(countFromQuery)
+		if err != nil {
+			http.Error(w, "invalid count", http.StatusBadRequest)
+			return
+		}
+
+		if count <= 0 {
+			http.Error(w, "count must be positive", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ifVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		http.Error(w, "deck version does not match", http.StatusPreconditionFailed)
+		return
+	}
+
+	result, err := s.storage.Undo(r.Context(), &deckID, count, ifVersion)
+	if err == nil {
+		w.Header().Set("ETag", formatETag(result.Version))
+		respondWithJSON(w, http.StatusOK, presenterFromContext(r.Context()).undo(&deckID, result))
+		return
+	}
+
+	if errors.Is(err, storage.ErrDeckNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, storage.ErrNothingToUndo) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	logging.FromContext(r.Context()).Error("Unknown error undoing events", "error", err)
 	http.Error(w, "unknown error", http.StatusInternalServerError)
 }
 
 // An endpoint used to check if the server is running.
-// Mostly used for Kubernetes probes or Docker health checks.
+// Kept for the Docker health checks using it. New probes should use /healthz and /readyz.
 func (s *Server) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(http.StatusText(http.StatusOK)))
 }
 
+// Serves the API until Shutdown is called.
+// Returns nil if the server was shut down, and an error if it couldn't be started.
 func (s *Server) Serve(host string, port int) error {
-	log.Printf("Starting server on %s:%d\n", host, port)
+	s.logger.Info("Starting server", "host", host, "port", port)
 
-	s.httpServer = &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", host, port),
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
-		Handler: http.TimeoutHandler(
-			handlers.LoggingHandler(os.Stdout, s.router),
-			15*time.Second,
-			"request timed out",
-		),
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return err
 	}
 
-	return s.httpServer.ListenAndServe()
+	return s.ServeListener(listener)
+}
+
+// The same handler used by Serve,
+// so the API can be mounted on other HTTP servers, like the ones from httptest.
+// Requests are logged outside of the timeouts, so the ones that time out are logged too.
+func (s *Server) Handler() http.Handler {
+	return s.logged(s.handlerWithTimeouts(s.traced(s.router), s.timeouts.Request))
+}
+
+// http.TimeoutHandler buffers the whole response, and cuts it after the timeout,
+// which doesn't work for streaming routes, so they skip it.
+func (s *Server) handlerWithTimeouts(handler http.Handler, timeout time.Duration) http.Handler {
+	withTimeout := http.TimeoutHandler(handler, timeout, "request timed out")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		match := mux.RouteMatch{}
+		if s.router.Match(r, &match) && match.Route != nil && streamingRoutes[match.Route.GetName()] {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		withTimeout.ServeHTTP(w, r)
+	})
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) error {
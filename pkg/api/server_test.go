@@ -1,14 +1,28 @@
 package api
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/idempotency"
+	"github.com/lucaspin/decks-api/pkg/metrics"
+	"github.com/lucaspin/decks-api/pkg/ratelimit"
+	"github.com/lucaspin/decks-api/pkg/rooms"
 	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/lucaspin/decks-api/pkg/webhooks"
 	"github.com/stretchr/testify/require"
 )
 
@@ -18,6 +32,24 @@ func Test__HealthCheckEndpointRespondsWith200(t *testing.T) {
 	require.Equal(t, response.Code, 200)
 }
 
+func Test__MetricsEndpoint(t *testing.T) {
+	t.Run("not served without metrics", func(t *testing.T) {
+		testServer := NewServer(storage.NewInMemoryStorage())
+		response := execRequest(testServer, http.MethodGet, "/metrics", nil)
+		require.Equal(t, http.StatusNotFound, response.Code)
+	})
+
+	t.Run("requests are recorded by route", func(t *testing.T) {
+		testServer := NewServer(storage.NewInMemoryStorage(), WithMetrics(metrics.New()))
+		response := execRequest(testServer, http.MethodGet, "/api/v1/decks/"+uuid.NewString(), nil)
+		require.Equal(t, http.StatusNotFound, response.Code)
+
+		response = execRequest(testServer, http.MethodGet, "/metrics", nil)
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Contains(t, response.Body.String(), `decks_http_requests_total{method="GET",route="/api/v1/decks/{deck_id}",status="404"} 1`)
+	})
+}
+
 func Test__CreateDeck(t *testing.T) {
 	testServer := NewServer(storage.NewInMemoryStorage())
 
@@ -64,6 +96,22 @@ func Test__CreateDeck(t *testing.T) {
 		require.Equal(t, response.Code, 400)
 		require.Equal(t, response.Body.String(), "invalid rank code '14'\n")
 	})
+
+	t.Run("deck created with server defaults, unless the client says otherwise", func(t *testing.T) {
+		testServer := NewServer(storage.NewInMemoryStorage(), WithDeckDefaults(DeckDefaults{Shuffled: true}))
+
+		response := execRequest(testServer, http.MethodPost, "/api/v1/decks", nil)
+		require.Equal(t, http.StatusCreated, response.Code)
+		r := &CreateDeckResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&r))
+		require.True(t, r.Shuffled)
+
+		response = execRequest(testServer, http.MethodPost, "/api/v1/decks?shuffled=false", nil)
+		require.Equal(t, http.StatusCreated, response.Code)
+		r = &CreateDeckResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&r))
+		require.False(t, r.Shuffled)
+	})
 }
 
 func Test__OpenDeck(t *testing.T) {
@@ -152,6 +200,954 @@ func Test__DrawCards(t *testing.T) {
 	})
 }
 
+func Test__ListEvents(t *testing.T) {
+	testServer := NewServer(storage.NewInMemoryStorage())
+
+	t.Run("invalid deck ID -> 400", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/not-a-valid-uuid/events", nil)
+		require.Equal(t, response.Code, 400)
+		require.Equal(t, response.Body.String(), "invalid deck ID\n")
+	})
+
+	t.Run("deck that does not exist -> 404", func(t *testing.T) {
+		ID := uuid.New()
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+ID.String()+"/events", nil)
+		require.Equal(t, response.Code, 404)
+	})
+
+	t.Run("deck that exists -> 200 with events", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks?cards=AS,KD,AC", nil)
+		require.Equal(t, response.Code, 201)
+		createResponse := &CreateDeckResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&createResponse))
+		deckID := createResponse.DeckID.String()
+
+		response = execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=2", nil)
+		require.Equal(t, response.Code, 200)
+
+		response = execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID+"/events", nil)
+		require.Equal(t, response.Code, 200)
+		eventsResponse := &ListEventsResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&eventsResponse))
+		require.Len(t, eventsResponse.Events, 2)
+		require.Equal(t, "created", eventsResponse.Events[0].Type)
+		require.Equal(t, int64(1), eventsResponse.Events[0].Version)
+		require.False(t, *eventsResponse.Events[0].Shuffled)
+		require.Len(t, eventsResponse.Events[0].Cards, 3)
+		require.Equal(t, "drawn", eventsResponse.Events[1].Type)
+		require.Equal(t, int64(2), eventsResponse.Events[1].Version)
+		require.Equal(t, []Card{
+			{Value: "ACE", Suit: "SPADES", Code: "AS"},
+			{Value: "KING", Suit: "DIAMONDS", Code: "KD"},
+		}, eventsResponse.Events[1].Cards)
+
+		response = execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID+"/events?after=1", nil)
+		require.Equal(t, response.Code, 200)
+		eventsResponse = &ListEventsResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&eventsResponse))
+		require.Len(t, eventsResponse.Events, 1)
+	})
+
+	t.Run("invalid after -> 400", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID+"/events?after=abc", nil)
+		require.Equal(t, response.Code, 400)
+		require.Equal(t, response.Body.String(), "invalid after\n")
+	})
+}
+
+func Test__Undo(t *testing.T) {
+	testServer := NewServer(storage.NewInMemoryStorage())
+
+	t.Run("invalid deck ID -> 400", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/not-a-valid-uuid/undo", nil)
+		require.Equal(t, response.Code, 400)
+		require.Equal(t, response.Body.String(), "invalid deck ID\n")
+	})
+
+	t.Run("deck that does not exist -> 404", func(t *testing.T) {
+		ID := uuid.New()
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+ID.String()+"/undo", nil)
+		require.Equal(t, response.Code, 404)
+	})
+
+	t.Run("invalid count -> 400", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/undo?count=0", nil)
+		require.Equal(t, response.Code, 400)
+		require.Equal(t, response.Body.String(), "count must be positive\n")
+	})
+
+	t.Run("nothing to undo -> 400", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/undo", nil)
+		require.Equal(t, response.Code, 400)
+		require.Equal(t, response.Body.String(), "not enough events to undo\n")
+	})
+
+	t.Run("undo last draw -> cards are back in the deck", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=3", nil)
+		require.Equal(t, response.Code, 200)
+
+		response = execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/undo", nil)
+		require.Equal(t, response.Code, 200)
+		require.Equal(t, `"3"`, response.Header().Get("ETag"))
+		undoResponse := &UndoResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&undoResponse))
+		require.Equal(t, 52, undoResponse.Remaining)
+		require.Len(t, undoResponse.Cards, 3)
+
+		response = execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID, nil)
+		openResponse := &OpenDeckResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&openResponse))
+		requireFullUnshuffledDeck(t, openResponse.Cards)
+	})
+
+	t.Run("undo with stale If-Match -> 412", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil)
+		require.Equal(t, response.Code, 200)
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/undo", nil, map[string]string{"If-Match": `"1"`})
+		require.Equal(t, response.Code, 412)
+	})
+}
+
+func Test__ShuffleDeck(t *testing.T) {
+	testServer := NewServer(storage.NewInMemoryStorage())
+
+	t.Run("invalid deck ID -> 400", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodPost, "/api/v1/decks/not-a-valid-uuid/shuffle", nil)
+		require.Equal(t, response.Code, 400)
+		require.Equal(t, response.Body.String(), "invalid deck ID\n")
+	})
+
+	t.Run("deck that does not exist -> 404", func(t *testing.T) {
+		ID := uuid.New()
+		response := execRequest(testServer, http.MethodPost, "/api/v1/decks/"+ID.String()+"/shuffle", nil)
+		require.Equal(t, response.Code, 404)
+	})
+
+	t.Run("shuffle -> remaining cards are shuffled, and drawn cards stay out", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodPost, "/api/v1/decks/"+deckID+"/draw?count=2", nil)
+		require.Equal(t, response.Code, 200)
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1/decks/"+deckID+"/shuffle", nil, map[string]string{"If-Match": `"2"`})
+		require.Equal(t, response.Code, 200)
+		require.Equal(t, `"3"`, response.Header().Get("ETag"))
+		shuffleResponse := &ShuffleDeckResponseV1{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&shuffleResponse))
+		require.True(t, shuffleResponse.Shuffled)
+		require.Equal(t, 50, shuffleResponse.Remaining)
+		require.Equal(t, int64(3), shuffleResponse.Version)
+
+		response = execRequest(testServer, http.MethodGet, "/api/v1/decks/"+deckID, nil)
+		openResponse := &OpenDeckResponseV1{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&openResponse))
+		require.True(t, openResponse.Shuffled)
+		require.Len(t, openResponse.Cards, 50)
+		for _, card := range openResponse.Cards {
+			require.NotContains(t, []string{"AS", "2S"}, card.Code)
+		}
+	})
+
+	t.Run("shuffle with stale If-Match -> 412", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodPost, "/api/v1/decks/"+deckID+"/draw?count=1", nil)
+		require.Equal(t, response.Code, 200)
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1/decks/"+deckID+"/shuffle", nil, map[string]string{"If-Match": `"1"`})
+		require.Equal(t, response.Code, 412)
+	})
+}
+
+func Test__StreamDeckEvents(t *testing.T) {
+	testServer := NewServer(storage.NewInMemoryStorage())
+	httpServer := httptest.NewServer(testServer.handlerWithTimeouts(testServer.router, time.Second))
+	defer httpServer.Close()
+
+	t.Run("invalid deck ID -> 400", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/not-a-valid-uuid/events/stream", nil)
+		require.Equal(t, response.Code, 400)
+	})
+
+	t.Run("deck that does not exist -> 404", func(t *testing.T) {
+		ID := uuid.New()
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+ID.String()+"/events/stream", nil)
+		require.Equal(t, response.Code, 404)
+	})
+
+	t.Run("invalid Last-Event-ID -> 400", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequestWithHeaders(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID+"/events/stream", nil, map[string]string{"Last-Event-ID": "abc"})
+		require.Equal(t, response.Code, 400)
+	})
+
+	t.Run("new events are streamed, and not subject to timeouts", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		stream := openStream(t, httpServer.URL+"/api/v1alpha/decks/"+deckID+"/events/stream", "")
+		defer stream.Close()
+
+		// longer than the timeout
+		time.Sleep(1500 * time.Millisecond)
+
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=2", nil)
+		require.Equal(t, response.Code, 200)
+
+		id, eventType, data := readServerSentEvent(t, stream)
+		require.Equal(t, "2", id)
+		require.Equal(t, "drawn", eventType)
+
+		event := &Event{}
+		require.NoError(t, json.Unmarshal([]byte(data), event))
+		require.Equal(t, int64(2), event.Version)
+		require.Len(t, event.Cards, 2)
+	})
+
+	t.Run("stream resumes after Last-Event-ID", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil)
+		require.Equal(t, response.Code, 200)
+		response = execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil)
+		require.Equal(t, response.Code, 200)
+
+		stream := openStream(t, httpServer.URL+"/api/v1alpha/decks/"+deckID+"/events/stream", "1")
+		defer stream.Close()
+
+		id, _, _ := readServerSentEvent(t, stream)
+		require.Equal(t, "2", id)
+		id, _, _ = readServerSentEvent(t, stream)
+		require.Equal(t, "3", id)
+	})
+}
+
+type eventStream struct {
+	*bufio.Reader
+	io.Closer
+}
+
+func openStream(t *testing.T, url, lastEventID string) *eventStream {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, 200, response.StatusCode)
+	require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	return &eventStream{Reader: bufio.NewReader(response.Body), Closer: response.Body}
+}
+
+func readServerSentEvent(t *testing.T, stream *eventStream) (string, string, string) {
+	id, eventType, data := "", "", ""
+	for {
+		line, err := stream.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && id != "":
+			return id, eventType, data
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func Test__Rooms(t *testing.T) {
+	testServer := NewServer(storage.NewInMemoryStorage())
+	httpServer := httptest.NewServer(testServer.handlerWithTimeouts(testServer.router, time.Second))
+	defer httpServer.Close()
+	baseURL := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/api/v1alpha/rooms/"
+
+	t.Run("invalid room name -> 400", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/rooms/not.valid/ws", nil)
+		require.Equal(t, response.Code, 400)
+	})
+
+	t.Run("first command must be a join", func(t *testing.T) {
+		conn := dialRoom(t, baseURL+"no-join/ws")
+		defer conn.Close()
+
+		require.NoError(t, conn.WriteJSON(&rooms.Command{RequestID: "1", Type: rooms.CommandDraw}))
+		message := readRoomMessage(t, conn)
+		require.Equal(t, &rooms.Message{Type: rooms.MessageError, RequestID: "1", Error: rooms.ErrNotJoined.Error()}, message)
+
+		_, _, err := conn.ReadMessage()
+		require.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure))
+	})
+
+	t.Run("invalid command", func(t *testing.T) {
+		conn := dialRoom(t, baseURL+"invalid/ws")
+		defer conn.Close()
+
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+		require.Equal(t, "invalid command", readRoomMessage(t, conn).Error)
+	})
+
+	t.Run("players play, are not subject to timeouts, and can resume", func(t *testing.T) {
+		alice := dialRoom(t, baseURL+"game/ws")
+		defer alice.Close()
+		require.NoError(t, alice.WriteJSON(&rooms.Command{Type: rooms.CommandJoin, Name: "alice"}))
+		welcome := readRoomMessage(t, alice)
+		require.Equal(t, rooms.MessageWelcome, welcome.Type)
+		require.Equal(t, 52, welcome.State.Deck.Remaining)
+
+		bob := dialRoom(t, baseURL+"game/ws")
+		require.NoError(t, bob.WriteJSON(&rooms.Command{Type: rooms.CommandJoin, Name: "bob"}))
+		bobWelcome := readRoomMessage(t, bob)
+		require.Equal(t, rooms.ChangePlayerJoined, readRoomMessage(t, alice).Changes[0].Kind)
+
+		// longer than the timeout
+		time.Sleep(1500 * time.Millisecond)
+
+		require.NoError(t, bob.WriteJSON(&rooms.Command{Type: rooms.CommandDraw, Count: 2}))
+		require.Len(t, readRoomMessage(t, bob).Changes[0].Added, 2)
+		forAlice := readRoomMessage(t, alice)
+		require.Empty(t, forAlice.Changes[0].Added)
+		require.Equal(t, 2, forAlice.Changes[0].AddedCount)
+
+		// the deck is a regular deck, so it can also be seen through the API
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+welcome.State.DeckID, nil)
+		require.Equal(t, response.Code, 200)
+		require.Equal(t, formatETag(2), response.Header().Get("ETag"))
+
+		bob.Close()
+		require.Equal(t, rooms.ChangePlayerDisconnected, readRoomMessage(t, alice).Changes[0].Kind)
+
+		bob = dialRoom(t, baseURL+"game/ws")
+		defer bob.Close()
+		require.NoError(t, bob.WriteJSON(&rooms.Command{Type: rooms.CommandJoin, ResumeToken: bobWelcome.ResumeToken}))
+		resumed := readRoomMessage(t, bob)
+		require.Equal(t, bobWelcome.PlayerID, resumed.PlayerID)
+		require.Len(t, resumed.State.Players[1].Hand, 2)
+		require.Equal(t, rooms.ChangePlayerConnected, readRoomMessage(t, alice).Changes[0].Kind)
+	})
+}
+
+func dialRoom(t *testing.T, url string) *websocket.Conn {
+	conn, response, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, response.StatusCode)
+	return conn
+}
+
+func readRoomMessage(t *testing.T, conn *websocket.Conn) *rooms.Message {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	message := &rooms.Message{}
+	require.NoError(t, conn.ReadJSON(message))
+	return message
+}
+
+func Test__APIVersions(t *testing.T) {
+	testServer := NewServer(storage.NewInMemoryStorage())
+
+	t.Run("v1alpha responses have deprecation headers", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID, nil)
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Equal(t, "@1792368000", response.Header().Get("Deprecation"))
+		require.Equal(t, "Mon, 19 Apr 2027 00:00:00 GMT", response.Header().Get("Sunset"))
+		require.Equal(t, `</api/v1/decks/`+deckID+`>; rel="successor-version"`, response.Header().Get("Link"))
+
+		// errors have them too
+		response = execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+uuid.NewString(), nil)
+		require.Equal(t, http.StatusNotFound, response.Code)
+		require.NotEmpty(t, response.Header().Get("Deprecation"))
+	})
+
+	t.Run("v1 responses have no deprecation headers", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodPost, "/api/v1/decks", nil)
+		require.Equal(t, http.StatusCreated, response.Code)
+		require.Empty(t, response.Header().Get("Deprecation"))
+		require.Empty(t, response.Header().Get("Sunset"))
+		require.Empty(t, response.Header().Get("Link"))
+	})
+
+	t.Run("decks are shared between versions", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodPost, "/api/v1/decks?cards=AS,KD,AC", nil)
+		require.Equal(t, http.StatusCreated, response.Code)
+		created := CreateDeckResponseV1{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&created))
+		require.Equal(t, storage.InitialVersion, created.Version)
+
+		response = execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+created.DeckID.String()+"/draw?count=1", nil)
+		require.Equal(t, http.StatusOK, response.Code)
+		require.JSONEq(t, `{"cards": [{"Value": "ACE", "Suit": "SPADES", "Code": "AS"}]}`, response.Body.String())
+
+		response = execRequest(testServer, http.MethodPost, "/api/v1/decks/"+created.DeckID.String()+"/draw?count=1", nil)
+		require.Equal(t, http.StatusOK, response.Code)
+		require.JSONEq(t, `{
+			"deck_id": "`+created.DeckID.String()+`",
+			"remaining": 1,
+			"version": 3,
+			"cards": [{"value": "KING", "suit": "DIAMONDS", "code": "KD"}]
+		}`, response.Body.String())
+
+		response = execRequest(testServer, http.MethodGet, "/api/v1/decks/"+created.DeckID.String(), nil)
+		require.Equal(t, http.StatusOK, response.Code)
+		require.JSONEq(t, `{
+			"deck_id": "`+created.DeckID.String()+`",
+			"shuffled": false,
+			"remaining": 1,
+			"version": 3,
+			"cards": [{"value": "ACE", "suit": "CLUBS", "code": "AC"}]
+		}`, response.Body.String())
+	})
+}
+
+func Test__ETags(t *testing.T) {
+	testServer := NewServer(storage.NewInMemoryStorage())
+
+	t.Run("created deck has initial ETag", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks", nil)
+		require.Equal(t, response.Code, 201)
+		require.Equal(t, `"1"`, response.Header().Get("ETag"))
+	})
+
+	t.Run("open deck returns ETag, and draw changes it", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID, nil)
+		require.Equal(t, response.Code, 200)
+		require.Equal(t, `"1"`, response.Header().Get("ETag"))
+
+		response = execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil)
+		require.Equal(t, response.Code, 200)
+		require.Equal(t, `"2"`, response.Header().Get("ETag"))
+
+		response = execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID, nil)
+		require.Equal(t, response.Code, 200)
+		require.Equal(t, `"2"`, response.Header().Get("ETag"))
+	})
+
+	t.Run("open deck with matching If-None-Match -> 304", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequestWithHeaders(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID, nil, map[string]string{"If-None-Match": `"1"`})
+		require.Equal(t, response.Code, 304)
+		require.Empty(t, response.Body.String())
+	})
+
+	t.Run("open deck with stale If-None-Match -> 200", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil)
+
+		response := execRequestWithHeaders(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID, nil, map[string]string{"If-None-Match": `"1"`})
+		require.Equal(t, response.Code, 200)
+		require.Equal(t, `"2"`, response.Header().Get("ETag"))
+	})
+
+	t.Run("draw with matching If-Match -> 200", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil, map[string]string{"If-Match": `"1"`})
+		require.Equal(t, response.Code, 200)
+		require.Equal(t, `"2"`, response.Header().Get("ETag"))
+	})
+
+	t.Run("draw with stale If-Match -> 412", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil, map[string]string{"If-Match": `"1"`})
+		require.Equal(t, response.Code, 200)
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil, map[string]string{"If-Match": `"1"`})
+		require.Equal(t, response.Code, 412)
+	})
+
+	t.Run("draw with invalid If-Match -> 412", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil, map[string]string{"If-Match": `W/"1"`})
+		require.Equal(t, response.Code, 412)
+	})
+}
+
+func Test__RateLimiting(t *testing.T) {
+	newTestServer := func() *Server {
+		return NewServer(storage.NewInMemoryStorage(), WithRateLimiter(ratelimit.NewInMemoryLimiter(), RateLimitConfig{
+			Create:           ratelimit.Limit{Rate: 0.001, Burst: 2},
+			Draw:             ratelimit.Limit{Rate: 0.001, Burst: 1},
+			DailyCreateQuota: 3,
+		}))
+	}
+
+	t.Run("requests within limit include rate limit headers", func(t *testing.T) {
+		testServer := newTestServer()
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks", nil)
+		require.Equal(t, response.Code, 201)
+		require.Equal(t, "2", response.Header().Get("X-RateLimit-Limit"))
+		require.Equal(t, "1", response.Header().Get("X-RateLimit-Remaining"))
+		require.NotEmpty(t, response.Header().Get("X-RateLimit-Reset"))
+	})
+
+	t.Run("requests over limit -> 429", func(t *testing.T) {
+		testServer := newTestServer()
+		createDeck(t, testServer)
+		createDeck(t, testServer)
+
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks", nil)
+		require.Equal(t, response.Code, 429)
+		require.Equal(t, "0", response.Header().Get("X-RateLimit-Remaining"))
+		require.NotEmpty(t, response.Header().Get("Retry-After"))
+	})
+
+	t.Run("create and draw have separate limits", func(t *testing.T) {
+		testServer := newTestServer()
+		deckID := createDeck(t, testServer)
+		createDeck(t, testServer)
+
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil)
+		require.Equal(t, response.Code, 200)
+
+		response = execRequest(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil)
+		require.Equal(t, response.Code, 429)
+	})
+
+	t.Run("new API keys don't get new limits", func(t *testing.T) {
+		testServer := newTestServer()
+		createDeck(t, testServer)
+		createDeck(t, testServer)
+
+		response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", nil, map[string]string{"X-API-Key": "another-client"})
+		require.Equal(t, response.Code, 429)
+	})
+
+	t.Run("limits are per IP address", func(t *testing.T) {
+		testServer := newTestServer()
+		createDeck(t, testServer)
+		createDeck(t, testServer)
+
+		request, _ := http.NewRequest(http.MethodPost, "/api/v1alpha/decks", nil)
+		request.RemoteAddr = "198.51.100.1:1234"
+		response := httptest.NewRecorder()
+		testServer.router.ServeHTTP(response, request)
+		require.Equal(t, response.Code, 201)
+	})
+
+	t.Run("daily quota on deck creation -> 429", func(t *testing.T) {
+		testServer := NewServer(storage.NewInMemoryStorage(), WithRateLimiter(ratelimit.NewInMemoryLimiter(), RateLimitConfig{
+			Create:           ratelimit.Limit{Rate: 1000, Burst: 1000},
+			Draw:             ratelimit.Limit{Rate: 1000, Burst: 1000},
+			DailyCreateQuota: 2,
+		}))
+
+		createDeck(t, testServer)
+		createDeck(t, testServer)
+
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks", nil)
+		require.Equal(t, response.Code, 429)
+		require.Equal(t, "2", response.Header().Get("X-RateLimit-Limit"))
+		require.Equal(t, "0", response.Header().Get("X-RateLimit-Remaining"))
+		require.NotEmpty(t, response.Header().Get("Retry-After"))
+	})
+
+	t.Run("failed deck creation does not use the daily quota", func(t *testing.T) {
+		testServer := NewServer(storage.NewInMemoryStorage(), WithRateLimiter(ratelimit.NewInMemoryLimiter(), RateLimitConfig{
+			Create:           ratelimit.Limit{Rate: 1000, Burst: 1000},
+			Draw:             ratelimit.Limit{Rate: 1000, Burst: 1000},
+			DailyCreateQuota: 1,
+		}))
+
+		response := execRequest(testServer, http.MethodPost, "/api/v1alpha/decks?cards=NOPE", nil)
+		require.Equal(t, response.Code, 400)
+
+		createDeck(t, testServer)
+		response = execRequest(testServer, http.MethodPost, "/api/v1alpha/decks", nil)
+		require.Equal(t, response.Code, 429)
+	})
+
+	t.Run("rooms share the limits of the API", func(t *testing.T) {
+		testServer := newTestServer()
+		httpServer := httptest.NewServer(testServer.router)
+		defer httpServer.Close()
+		baseURL := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/api/v1alpha/rooms/"
+
+		// every room gets a deck, so the first two use all the creates allowed
+		for _, room := range []string{"first", "second"} {
+			conn := dialRoom(t, baseURL+room+"/ws")
+			require.NoError(t, conn.WriteJSON(&rooms.Command{Type: rooms.CommandJoin, Name: "alice"}))
+			require.Equal(t, rooms.MessageWelcome, readRoomMessage(t, conn).Type)
+			conn.Close()
+		}
+
+		bob := dialRoom(t, baseURL+"third/ws")
+		defer bob.Close()
+		require.NoError(t, bob.WriteJSON(&rooms.Command{Type: rooms.CommandJoin, Name: "bob"}))
+		require.Equal(t, rooms.ErrRateLimited.Error(), readRoomMessage(t, bob).Error)
+
+		alice := dialRoom(t, baseURL+"first/ws")
+		defer alice.Close()
+		require.NoError(t, alice.WriteJSON(&rooms.Command{Type: rooms.CommandJoin, Name: "alice"}))
+		require.Equal(t, rooms.MessageWelcome, readRoomMessage(t, alice).Type)
+
+		require.NoError(t, alice.WriteJSON(&rooms.Command{Type: rooms.CommandDraw, Count: 1}))
+		require.Equal(t, rooms.MessageDiff, readRoomMessage(t, alice).Type)
+		require.NoError(t, alice.WriteJSON(&rooms.Command{Type: rooms.CommandDeal, Count: 1}))
+		require.Equal(t, rooms.ErrRateLimited.Error(), readRoomMessage(t, alice).Error)
+	})
+
+	t.Run("rooms that fail to create their deck don't use the daily quota", func(t *testing.T) {
+		testServer := NewServer(&failingFirstCreateStorage{Storage: storage.NewInMemoryStorage()}, WithRateLimiter(ratelimit.NewInMemoryLimiter(), RateLimitConfig{
+			Create:           ratelimit.Limit{Rate: 1000, Burst: 1000},
+			Draw:             ratelimit.Limit{Rate: 1000, Burst: 1000},
+			DailyCreateQuota: 1,
+		}))
+
+		httpServer := httptest.NewServer(testServer.router)
+		defer httpServer.Close()
+		baseURL := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/api/v1alpha/rooms/"
+
+		first := dialRoom(t, baseURL+"first/ws")
+		defer first.Close()
+		require.NoError(t, first.WriteJSON(&rooms.Command{Type: rooms.CommandJoin, Name: "alice"}))
+		require.Equal(t, "unknown error", readRoomMessage(t, first).Error)
+
+		second := dialRoom(t, baseURL+"second/ws")
+		defer second.Close()
+		require.NoError(t, second.WriteJSON(&rooms.Command{Type: rooms.CommandJoin, Name: "alice"}))
+		require.Equal(t, rooms.MessageWelcome, readRoomMessage(t, second).Type)
+	})
+}
+
+type failingFirstCreateStorage struct {
+	storage.Storage
+	failed atomic.Bool
+}
+
+func (s *failingFirstCreateStorage) Create(ctx context.Context, list []cards.Card, options storage.CreateOptions) (*storage.Deck, error) {
+	if s.failed.CompareAndSwap(false, true) {
+		return nil, errors.New("connection refused")
+	}
+
+	return s.Storage.Create(ctx, list, options)
+}
+
+func Test__Idempotency(t *testing.T) {
+	testServer := NewServer(storage.NewInMemoryStorage(), WithIdempotencyStore(idempotency.NewInMemoryStore(), time.Hour))
+
+	t.Run("create retried with same key -> same deck", func(t *testing.T) {
+		headers := map[string]string{"Idempotency-Key": uuid.NewString()}
+		first := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks?cards=AS,KD", nil, headers)
+		require.Equal(t, first.Code, 201)
+		require.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+		second := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks?cards=AS,KD", nil, headers)
+		require.Equal(t, second.Code, 201)
+		require.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+		require.Equal(t, "application/json", second.Header().Get("Content-Type"))
+		require.Equal(t, first.Body.String(), second.Body.String())
+	})
+
+	t.Run("draw retried with same key -> cards are drawn once", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		headers := map[string]string{"Idempotency-Key": uuid.NewString()}
+
+		first := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=2", nil, headers)
+		require.Equal(t, first.Code, 200)
+		second := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=2", nil, headers)
+		require.Equal(t, second.Code, 200)
+		require.Equal(t, first.Body.String(), second.Body.String())
+
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID, nil)
+		openResponse := &OpenDeckResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&openResponse))
+		require.Equal(t, 50, openResponse.Remaining)
+	})
+
+	t.Run("draw with different keys -> cards are drawn twice", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+
+		for i := 0; i < 2; i++ {
+			headers := map[string]string{"Idempotency-Key": uuid.NewString()}
+			response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=2", nil, headers)
+			require.Equal(t, response.Code, 200)
+		}
+
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/decks/"+deckID, nil)
+		openResponse := &OpenDeckResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&openResponse))
+		require.Equal(t, 48, openResponse.Remaining)
+	})
+
+	t.Run("key reused with different params -> 422", func(t *testing.T) {
+		deckID := createDeck(t, testServer)
+		headers := map[string]string{"Idempotency-Key": uuid.NewString()}
+
+		response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil, headers)
+		require.Equal(t, response.Code, 200)
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=2", nil, headers)
+		require.Equal(t, response.Code, 422)
+	})
+
+	t.Run("key reused with different body -> 422", func(t *testing.T) {
+		headers := map[string]string{"Idempotency-Key": uuid.NewString()}
+
+		response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", map[string]string{"a": "b"}, headers)
+		require.Equal(t, response.Code, 201)
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", map[string]string{"a": "c"}, headers)
+		require.Equal(t, response.Code, 422)
+	})
+
+	t.Run("same key from different clients -> not replayed", func(t *testing.T) {
+		key := uuid.NewString()
+
+		first := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", nil, map[string]string{"Idempotency-Key": key, "X-API-Key": "a"})
+		require.Equal(t, first.Code, 201)
+
+		second := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", nil, map[string]string{"Idempotency-Key": key, "X-API-Key": "b"})
+		require.Equal(t, second.Code, 201)
+		require.Empty(t, second.Header().Get("Idempotent-Replayed"))
+		require.NotEqual(t, first.Body.String(), second.Body.String())
+	})
+
+	t.Run("create retried with same key -> replayed, without using up the limits", func(t *testing.T) {
+		testServer := newLimitedIdempotentServer()
+		headers := map[string]string{"Idempotency-Key": uuid.NewString()}
+		first := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", nil, headers)
+		require.Equal(t, first.Code, 201)
+
+		// the only create left is used by another deck, so the retry would be limited, if it was not replayed
+		createDeck(t, testServer)
+
+		second := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", nil, headers)
+		require.Equal(t, second.Code, 201)
+		require.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+		require.Equal(t, first.Body.String(), second.Body.String())
+	})
+
+	t.Run("rate limited requests are not stored, so they can be retried", func(t *testing.T) {
+		testServer := newLimitedIdempotentServer()
+		createDeck(t, testServer)
+		createDeck(t, testServer)
+
+		headers := map[string]string{"Idempotency-Key": uuid.NewString()}
+		response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", nil, headers)
+		require.Equal(t, response.Code, 429)
+
+		// a different request with the same key is not rejected, since the key was released
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks?shuffled=true", nil, headers)
+		require.Equal(t, response.Code, 429)
+		require.Empty(t, response.Header().Get("Idempotent-Replayed"))
+	})
+}
+
+func newLimitedIdempotentServer() *Server {
+	return NewServer(storage.NewInMemoryStorage(),
+		WithIdempotencyStore(idempotency.NewInMemoryStore(), time.Hour),
+		WithRateLimiter(ratelimit.NewInMemoryLimiter(), RateLimitConfig{
+			Create: ratelimit.Limit{Rate: 0.001, Burst: 2},
+			Draw:   ratelimit.Limit{Rate: 1000, Burst: 1000},
+		}),
+	)
+}
+
+func Test__Webhooks(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusOK
+	received := []*http.Request{}
+	bodies := [][]byte{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	waitForWebhooks := func(count int) ([]*http.Request, [][]byte) {
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(received) >= count
+		}, 2*time.Second, 5*time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*http.Request{}, received...), append([][]byte{}, bodies...)
+	}
+
+	dispatcher := webhooks.NewDispatcher(webhooks.NewInMemoryStore(), webhooks.Config{
+		MaxAttempts:    2,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		Timeout:        time.Second,
+
+		// The receiver runs on a loopback address.
+		AllowPrivateAddresses: true,
+	})
+
+	defer dispatcher.Close()
+	testServer := NewServer(storage.NewInMemoryStorage(), WithWebhooks(dispatcher))
+	headers := map[string]string{apiKeyHeader: "webhooks"}
+
+	t.Run("no API key -> 401", func(t *testing.T) {
+		response := execRequest(testServer, http.MethodGet, "/api/v1alpha/webhooks", nil)
+		require.Equal(t, response.Code, 401)
+	})
+
+	t.Run("invalid subscriptions -> 400", func(t *testing.T) {
+		requests := []CreateWebhookRequest{
+			{URL: "not-a-url", Events: []webhooks.EventType{webhooks.EventDeckCreated}},
+			{URL: "ftp://localhost", Events: []webhooks.EventType{webhooks.EventDeckCreated}},
+			{URL: receiver.URL},
+			{URL: receiver.URL, Events: []webhooks.EventType{"deck.shuffled"}},
+		}
+
+		for _, request := range requests {
+			response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/webhooks", request, headers)
+			require.Equal(t, response.Code, 400)
+		}
+	})
+
+	t.Run("subscriptions to private addresses -> 400", func(t *testing.T) {
+		strict := webhooks.NewDispatcher(webhooks.NewInMemoryStore(), webhooks.DefaultConfig())
+		defer strict.Close()
+
+		strictServer := NewServer(storage.NewInMemoryStorage(), WithWebhooks(strict))
+		for _, u := range []string{receiver.URL, "http://localhost/hooks", "http://169.254.169.254/latest/meta-data", "http://10.0.0.1/hooks"} {
+			request := &CreateWebhookRequest{URL: u, Events: []webhooks.EventType{webhooks.EventDeckCreated}}
+			response := execRequestWithHeaders(strictServer, http.MethodPost, "/api/v1alpha/webhooks", request, headers)
+			require.Equal(t, 400, response.Code, u)
+			require.Contains(t, response.Body.String(), webhooks.ErrForbiddenAddress.Error())
+		}
+	})
+
+	t.Run("created and emptied decks are sent to subscriptions", func(t *testing.T) {
+		response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/webhooks", &CreateWebhookRequest{
+			URL:    receiver.URL,
+			Events: []webhooks.EventType{webhooks.EventDeckCreated, webhooks.EventDeckEmptied},
+		}, headers)
+
+		require.Equal(t, response.Code, 201)
+		webhook := &WebhookResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(webhook))
+		require.True(t, strings.HasPrefix(webhook.Secret, "whsec_"))
+
+		// the secret is only shown once
+		response = execRequestWithHeaders(testServer, http.MethodGet, "/api/v1alpha/webhooks", nil, headers)
+		require.Equal(t, response.Code, 200)
+		list := &ListWebhooksResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(list))
+		require.Len(t, list.Webhooks, 1)
+		require.Equal(t, webhook.ID, list.Webhooks[0].ID)
+		require.Empty(t, list.Webhooks[0].Secret)
+
+		// decks created by other clients are not sent
+		createDeck(t, testServer)
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks?cards=AS,KD", nil, headers)
+		require.Equal(t, response.Code, 201)
+		createResponse := &CreateDeckResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(createResponse))
+		deckID := createResponse.DeckID.String()
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil, headers)
+		require.Equal(t, response.Code, 200)
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks/"+deckID+"/draw?count=1", nil, headers)
+		require.Equal(t, response.Code, 200)
+
+		// deliveries are sent concurrently, so they can arrive in any order
+		requests, bodies := waitForWebhooks(2)
+		require.Len(t, requests, 2)
+		payloads := map[webhooks.EventType]*webhooks.Payload{}
+		for i, body := range bodies {
+			require.NoError(t, webhooks.Verify(webhook.Secret, requests[i].Header.Get(webhooks.SignatureHeader), body, time.Minute))
+
+			payload := &webhooks.Payload{}
+			require.NoError(t, json.Unmarshal(body, payload))
+			require.Equal(t, string(payload.Type), requests[i].Header.Get(webhooks.EventHeader))
+			payloads[payload.Type] = payload
+		}
+
+		require.Equal(t, map[string]interface{}{"deck_id": deckID, "shuffled": false, "remaining": float64(2)}, payloads[webhooks.EventDeckCreated].Data)
+		require.Equal(t, map[string]interface{}{"deck_id": deckID, "remaining": float64(0)}, payloads[webhooks.EventDeckEmptied].Data)
+	})
+
+	t.Run("failed deliveries are listed and can be replayed", func(t *testing.T) {
+		mu.Lock()
+		status = http.StatusInternalServerError
+		received, bodies = nil, nil
+		mu.Unlock()
+
+		response := execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", nil, headers)
+		require.Equal(t, response.Code, 201)
+		waitForWebhooks(2)
+
+		var failed []webhooks.Delivery
+		require.Eventually(t, func() bool {
+			response := execRequestWithHeaders(testServer, http.MethodGet, "/api/v1alpha/webhooks/deliveries?status=failed", nil, headers)
+			list := &ListDeliveriesResponse{}
+			require.NoError(t, json.NewDecoder(response.Body).Decode(list))
+			failed = list.Deliveries
+			return len(failed) == 1
+		}, 2*time.Second, 10*time.Millisecond)
+
+		require.Equal(t, 2, failed[0].Attempts)
+		require.Equal(t, http.StatusInternalServerError, failed[0].LastStatusCode)
+
+		mu.Lock()
+		status = http.StatusOK
+		mu.Unlock()
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/webhooks/deliveries/"+failed[0].ID+"/replay", nil, headers)
+		require.Equal(t, response.Code, 202)
+		waitForWebhooks(3)
+
+		require.Eventually(t, func() bool {
+			response := execRequestWithHeaders(testServer, http.MethodGet, "/api/v1alpha/webhooks/deliveries?status=failed", nil, headers)
+			list := &ListDeliveriesResponse{}
+			require.NoError(t, json.NewDecoder(response.Body).Decode(list))
+			return len(list.Deliveries) == 0
+		}, 2*time.Second, 10*time.Millisecond)
+
+		// not failed anymore
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/webhooks/deliveries/"+failed[0].ID+"/replay", nil, headers)
+		require.Equal(t, response.Code, 409)
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/webhooks/deliveries/"+failed[0].ID+"/replay", nil, map[string]string{apiKeyHeader: "someone-else"})
+		require.Equal(t, response.Code, 404)
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/webhooks/deliveries/replay", nil, headers)
+		require.Equal(t, response.Code, 202)
+	})
+
+	t.Run("deleted subscriptions are not sent anything", func(t *testing.T) {
+		response := execRequestWithHeaders(testServer, http.MethodGet, "/api/v1alpha/webhooks", nil, headers)
+		list := &ListWebhooksResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(list))
+
+		response = execRequestWithHeaders(testServer, http.MethodDelete, "/api/v1alpha/webhooks/"+list.Webhooks[0].ID, nil, map[string]string{apiKeyHeader: "someone-else"})
+		require.Equal(t, response.Code, 404)
+		response = execRequestWithHeaders(testServer, http.MethodDelete, "/api/v1alpha/webhooks/"+list.Webhooks[0].ID, nil, headers)
+		require.Equal(t, response.Code, 204)
+
+		mu.Lock()
+		before := len(received)
+		mu.Unlock()
+
+		response = execRequestWithHeaders(testServer, http.MethodPost, "/api/v1alpha/decks", nil, headers)
+		require.Equal(t, response.Code, 201)
+
+		response = execRequestWithHeaders(testServer, http.MethodGet, "/api/v1alpha/webhooks/deliveries?status=pending", nil, headers)
+		pending := &ListDeliveriesResponse{}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(pending))
+		require.Empty(t, pending.Deliveries)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, received, before)
+	})
+}
+
 func requireFullUnshuffledDeck(t *testing.T, list []Card) {
 	codes := make([]string, len(list))
 	for i, card := range list {
@@ -167,6 +1163,10 @@ func requireFullUnshuffledDeck(t *testing.T, list []Card) {
 }
 
 func execRequest(server *Server, method, path string, body interface{}) *httptest.ResponseRecorder {
+	return execRequestWithHeaders(server, method, path, body, nil)
+}
+
+func execRequestWithHeaders(server *Server, method, path string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
 	stringBody := ""
 
 	if body != nil {
@@ -182,6 +1182,10 @@ func execRequest(server *Server, method, path string, body interface{}) *httptes
 
 	bodyReader := strings.NewReader(stringBody)
 	req, _ := http.NewRequest(method, path, bodyReader)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
 	rr := httptest.NewRecorder()
 	server.router.ServeHTTP(rr, req)
 	return rr
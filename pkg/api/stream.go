@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"github.com/lucaspin/decks-api/pkg/storage"
+)
+
+// How often a comment is sent to clients of streaming endpoints when nothing is happening,
+// so proxies and load balancers don't close the connection for being idle.
+const streamKeepAliveInterval = 15 * time.Second
+
+// Streaming routes, like this one and the WebSocket rooms,
+// are long-lived, so they can't be subject to the server timeouts.
+// See Server.Serve.
+const streamDeckEventsRoute = "stream-deck-events"
+
+var errInvalidLastEventID = errors.New("invalid Last-Event-ID")
+
+var streamingRoutes = map[string]bool{
+	streamDeckEventsRoute: true,
+	joinRoomRoute:         true,
+}
+
+// Streams the changes made to a deck as Server-Sent Events.
+// The ID of each event is the deck version, so a client that gets disconnected
+// can reconnect with a Last-Event-ID header, and not miss anything.
+// Clients connecting for the first time only get the changes made from then on.
+func (s *Server) StreamDeckEvents(w http.ResponseWriter, r *http.Request) {
+	deckID, err := uuid.Parse(mux.Vars(r)["deck_id"])
+	if err != nil {
+		http.Error(w, "invalid deck ID", http.StatusBadRequest)
+		return
+	}
+
+	afterVersion, err := s.streamStartVersion(r, &deckID)
+	if errors.Is(err, errInvalidLastEventID) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, storage.ErrDeckNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Unknown error finding deck", "error", err)
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := s.storage.Watch(r.Context(), &deckID, afterVersion)
+	if errors.Is(err, storage.ErrDeckNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Unknown error watching deck", "error", err)
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	// The stream lives for as long as the client wants it to,
+	// so the server write timeout can't apply here.
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logging.FromContext(r.Context()).Error("Error disabling write deadline for stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	s.streams.Add(1)
+	defer s.streams.Done()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		// The client reconnects, with the Last-Event-ID, to another replica.
+		case <-s.closing.Done():
+			return
+
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if err := writeServerSentEvent(w, presenterFromContext(r.Context()), event); err != nil {
+				return
+			}
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Clients resuming a stream tell us the last event they saw.
+// Otherwise, we start from the current version of the deck.
+func (s *Server) streamStartVersion(r *http.Request, deckID *uuid.UUID) (int64, error) {
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		version, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || version < 0 {
+			return 0, errInvalidLastEventID
+		}
+
+		return version, nil
+	}
+
+	deck, err := s.storage.Get(r.Context(), deckID)
+	if err != nil {
+		return 0, err
+	}
+
+	return deck.Version, nil
+}
+
+func writeServerSentEvent(w http.ResponseWriter, presenter presenter, event storage.Event) error {
+	data, err := json.Marshal(presenter.event(event))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Version, event.Type, data)
+	return err
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lucaspin/decks-api/pkg/certs"
+	"github.com/lucaspin/decks-api/pkg/certs/certstest"
+	"github.com/lucaspin/decks-api/pkg/ratelimit"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__TLS(t *testing.T) {
+	ca := certstest.NewCA(t)
+	serverCert := ca.Issue(t, t.TempDir(), "localhost")
+	clientCert := ca.Issue(t, t.TempDir(), "alice")
+	reloader, err := certs.NewReloader(certs.Config{
+		CertFile:     serverCert.CertFile,
+		KeyFile:      serverCert.KeyFile,
+		ClientCAFile: ca.CertFile,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+
+	require.NoError(t, err)
+
+	// Only one deck can be created per client, so requests from the same client are rejected.
+	testServer := NewServer(
+		storage.NewInMemoryStorage(),
+		WithTLS(reloader.ServerTLSConfig()),
+		WithRateLimiter(ratelimit.NewInMemoryLimiter(), RateLimitConfig{
+			Create: ratelimit.Limit{Rate: 0.001, Burst: 1},
+			Draw:   ratelimit.Limit{Rate: 1, Burst: 1},
+		}),
+	)
+
+	url, served := serveOnRandomPort(t, testServer)
+	url = strings.Replace(url, "http://", "https://", 1)
+	defer func() {
+		require.NoError(t, testServer.httpServer.Close())
+		require.NoError(t, <-served)
+	}()
+
+	createDeck := func(certificate *tls.Certificate, apiKey string) int {
+		config := &tls.Config{RootCAs: ca.Pool()}
+		if certificate != nil {
+			config.Certificates = []tls.Certificate{*certificate}
+		}
+
+		request, err := http.NewRequest(http.MethodPost, url+"/api/v1/decks", nil)
+		require.NoError(t, err)
+		request.Header.Set(apiKeyHeader, apiKey)
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		response, err := client.Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	t.Run("clients without certificate are limited by their IP address, whatever API key they send", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, createDeck(nil, "a"))
+		require.Equal(t, http.StatusTooManyRequests, createDeck(nil, "a"))
+		require.Equal(t, http.StatusTooManyRequests, createDeck(nil, "b"))
+	})
+
+	t.Run("clients with certificate are identified by it, even with different API keys", func(t *testing.T) {
+		certificate := clientCert.Load(t)
+		require.Equal(t, http.StatusCreated, createDeck(&certificate, "c"))
+		require.Equal(t, http.StatusTooManyRequests, createDeck(&certificate, "d"))
+	})
+}
+
+func Test__ClientIdentity(t *testing.T) {
+	ca := certstest.NewCA(t)
+	loaded := ca.Issue(t, t.TempDir(), "alice").Load(t)
+	certificate, err := x509.ParseCertificate(loaded.Certificate[0])
+	require.NoError(t, err)
+
+	t.Run("verified certificate -> identified by its common name", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(apiKeyHeader, "key")
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}, VerifiedChains: [][]*x509.Certificate{{certificate, ca.Certificate}}}
+		require.Equal(t, "cert:alice", clientFromRequest(r))
+	})
+
+	t.Run("certificate that was not verified -> ignored", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(apiKeyHeader, "key")
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}}
+		require.Equal(t, "key:key", clientFromRequest(r))
+	})
+
+	t.Run("rate limits -> keyed by the verified certificate, or the IP address, never the API key", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "198.51.100.1:1234"
+		r.Header.Set(apiKeyHeader, "key")
+		require.Equal(t, "ip:198.51.100.1", rateLimitClientFromRequest(r))
+
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}, VerifiedChains: [][]*x509.Certificate{{certificate, ca.Certificate}}}
+		require.Equal(t, "cert:alice", rateLimitClientFromRequest(r))
+	})
+}
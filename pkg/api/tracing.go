@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/lucaspin/decks-api/pkg/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Starts a span for every request, before it is routed.
+// If the server has no tracer provider configured, the handler is returned as is.
+func (s *Server) traced(handler http.Handler) http.Handler {
+	if s.tracerProvider == nil {
+		return handler
+	}
+
+	return otelhttp.NewHandler(handler, "http.request",
+		otelhttp.WithTracerProvider(s.tracerProvider),
+		otelhttp.WithPropagators(tracing.Propagator),
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return "HTTP " + r.Method
+		}),
+	)
+}
+
+// Spans are started before we know which route the request is for,
+// so once the router finds it, the span is renamed after it, like 'GET /api/v1/decks/{deck_id}'.
+// Using the path template, instead of the path, keeps every deck from having a span name of its own.
+func nameSpanAfterRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := mux.CurrentRoute(r); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + template)
+				span.SetAttributes(semconv.HTTPRoute(template))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
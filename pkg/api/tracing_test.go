@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/lucaspin/decks-api/pkg/tracing"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test__Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	store := tracing.NewTracedStorage(storage.NewInMemoryStorage(), "in-memory", provider)
+	testServer := NewServer(store, WithTracerProvider(provider))
+	deckID := createDeck(t, testServer)
+
+	t.Run("request spans continue the trace from traceparent, and storage spans are their children", func(t *testing.T) {
+		exporter.Reset()
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/decks/"+deckID+"/draw?count=2", nil)
+		request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		response := httptest.NewRecorder()
+		testServer.Handler().ServeHTTP(response, request)
+		require.Equal(t, http.StatusOK, response.Code)
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 2)
+
+		requestSpan := findSpan(t, spans, "POST /api/v1/decks/{deck_id}/draw")
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", requestSpan.SpanContext.TraceID().String())
+		require.Equal(t, "00f067aa0ba902b7", requestSpan.Parent.SpanID().String())
+		require.True(t, requestSpan.Parent.IsRemote())
+
+		draw := findSpan(t, spans, "storage.draw")
+		require.Equal(t, requestSpan.SpanContext.SpanID(), draw.Parent.SpanID())
+	})
+
+	t.Run("requests without traceparent start a new trace", func(t *testing.T) {
+		exporter.Reset()
+		response := httptest.NewRecorder()
+		testServer.Handler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/decks/"+deckID, nil))
+		require.Equal(t, http.StatusOK, response.Code)
+
+		requestSpan := findSpan(t, exporter.GetSpans(), "GET /api/v1/decks/{deck_id}")
+		require.False(t, requestSpan.Parent.IsValid())
+	})
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+
+	require.FailNow(t, "span not found", name)
+	return tracetest.SpanStub{}
+}
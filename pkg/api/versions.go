@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/storage"
+)
+
+// Every version of the API has the same routes, handled by the same handlers.
+// Versions only differ in the shape of their responses, given by their presenters,
+// so a change to how decks work is made once, and reaches every version.
+type apiVersion struct {
+	name      string
+	presenter presenter
+
+	// The OpenAPI document of the version. See openapi.go.
+	spec []byte
+
+	// Deprecated versions are still served, but their responses tell clients
+	// when they were deprecated, when they will stop being served, and what replaces them.
+	deprecatedAt time.Time
+	sunsetAt     time.Time
+	successor    *apiVersion
+}
+
+// Builds the response bodies of a version.
+type presenter interface {
+	createDeck(deck *storage.Deck) interface{}
+	openDeck(deck *storage.Deck) interface{}
+	drawCards(deckID *uuid.UUID, result *storage.DrawResult) interface{}
+	shuffleDeck(deck *storage.Deck) interface{}
+	listEvents(deckID *uuid.UUID, events []storage.Event) interface{}
+	undo(deckID *uuid.UUID, result *storage.UndoResult) interface{}
+
+	// The data of each Server-Sent Event.
+	event(e storage.Event) interface{}
+}
+
+//go:embed openapi/v1.json
+var openAPIV1Spec []byte
+
+//go:embed openapi/v1alpha.json
+var openAPIV1alphaSpec []byte
+
+var (
+	apiV1 = &apiVersion{
+		name:      "v1",
+		presenter: v1Presenter{},
+		spec:      openAPIV1Spec,
+	}
+
+	apiV1alpha = &apiVersion{
+		name:         "v1alpha",
+		presenter:    v1alphaPresenter{},
+		spec:         openAPIV1alphaSpec,
+		deprecatedAt: time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+		sunsetAt:     time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC),
+		successor:    apiV1,
+	}
+
+	apiVersions = []*apiVersion{apiV1alpha, apiV1}
+)
+
+func (v *apiVersion) basePath() string {
+	return "/api/" + v.name
+}
+
+func (v *apiVersion) deprecated() bool {
+	return !v.deprecatedAt.IsZero()
+}
+
+type versionContextKey struct{}
+
+// Makes the version available to the handlers, and adds the deprecation headers, if needed.
+// The Deprecation header follows RFC 9745, and the Sunset one, RFC 8594.
+func (v *apiVersion) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v.deprecated() {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", v.deprecatedAt.Unix()))
+			w.Header().Set("Sunset", v.sunsetAt.UTC().Format(http.TimeFormat))
+			if v.successor != nil {
+				successorPath := v.successor.basePath() + strings.TrimPrefix(r.URL.Path, v.basePath())
+				w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successorPath))
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), versionContextKey{}, v)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Handlers are always called through the router, which sets the version,
+// but if that is not the case, the oldest version is used.
+func versionFromContext(ctx context.Context) *apiVersion {
+	if version, ok := ctx.Value(versionContextKey{}).(*apiVersion); ok {
+		return version
+	}
+
+	return apiVersions[0]
+}
+
+func presenterFromContext(ctx context.Context) presenter {
+	return versionFromContext(ctx).presenter
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"github.com/lucaspin/decks-api/pkg/webhooks"
+)
+
+const maxWebhookRequestSize = 16 * 1024
+
+type CreateWebhookRequest struct {
+	URL    string               `json:"url"`
+	Events []webhooks.EventType `json:"events"`
+	Secret string               `json:"secret"`
+}
+
+// The secret is only returned when the subscription is created.
+type WebhookResponse struct {
+	ID        string               `json:"id"`
+	URL       string               `json:"url"`
+	Events    []webhooks.EventType `json:"events"`
+	Secret    string               `json:"secret,omitempty"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []WebhookResponse `json:"webhooks"`
+}
+
+type ListDeliveriesResponse struct {
+	Deliveries []webhooks.Delivery `json:"deliveries"`
+}
+
+// What is sent as the data of deck events.
+type DeckWebhookData = webhooks.DeckData
+
+func newWebhookResponse(subscription *webhooks.Subscription) WebhookResponse {
+	return WebhookResponse{
+		ID:        subscription.ID,
+		URL:       subscription.URL,
+		Events:    subscription.Events,
+		CreatedAt: subscription.CreatedAt,
+	}
+}
+
+// Webhooks are sent to the client that caused the events,
+// so only clients with an API key can manage them.
+func webhookOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	owner := clientFromContext(r.Context())
+	if !strings.HasPrefix(owner, "key:") {
+		http.Error(w, "an API key is required to manage webhooks", http.StatusUnauthorized)
+		return "", false
+	}
+
+	return owner, true
+}
+
+func (s *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	request := CreateWebhookRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookRequestSize)).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if u, err := url.Parse(request.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "url must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.webhooks.CheckURL(r.Context(), request.URL); err != nil {
+		if errors.Is(err, webhooks.ErrForbiddenAddress) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		http.Error(w, "the host of the url can't be resolved", http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Events) == 0 {
+		http.Error(w, "at least one event is required", http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range request.Events {
+		if !event.Valid() {
+			http.Error(w, "unknown event '"+string(event)+"'", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Clients not giving us a secret get one generated for them.
+	if request.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error generating webhook secret", "error", err)
+			http.Error(w, "unknown error", http.StatusInternalServerError)
+			return
+		}
+
+		request.Secret = secret
+	}
+
+	subscription := &webhooks.Subscription{
+		ID:        uuid.New().String(),
+		Owner:     owner,
+		URL:       request.URL,
+		Events:    request.Events,
+		Secret:    request.Secret,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := s.webhooks.Store().CreateSubscription(r.Context(), subscription); err != nil {
+		logging.FromContext(r.Context()).Error("Error creating webhook", "error", err)
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	response := newWebhookResponse(subscription)
+	response.Secret = subscription.Secret
+	respondWithJSON(w, http.StatusCreated, &response)
+}
+
+func (s *Server) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	subscriptions, err := s.webhooks.Store().ListSubscriptions(r.Context(), owner)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error listing webhooks", "error", err)
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	response := ListWebhooksResponse{Webhooks: []WebhookResponse{}}
+	for _, subscription := range subscriptions {
+		response.Webhooks = append(response.Webhooks, newWebhookResponse(&subscription))
+	}
+
+	respondWithJSON(w, http.StatusOK, &response)
+}
+
+func (s *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.webhooks.Store().DeleteSubscription(r.Context(), owner, mux.Vars(r)["webhook_id"])
+	if err == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if errors.Is(err, webhooks.ErrSubscriptionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	logging.FromContext(r.Context()).Error("Error deleting webhook", "error", err)
+	http.Error(w, "unknown error", http.StatusInternalServerError)
+}
+
+func (s *Server) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	status := webhooks.DeliveryStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", webhooks.DeliveryPending, webhooks.DeliverySucceeded, webhooks.DeliveryFailed:
+	default:
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := s.webhooks.Store().ListDeliveries(r.Context(), owner, status)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error listing webhook deliveries", "error", err)
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, &ListDeliveriesResponse{Deliveries: deliveries})
+}
+
+func (s *Server) ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := s.webhooks.Replay(r.Context(), owner, mux.Vars(r)["delivery_id"])
+	if err == nil {
+		respondWithJSON(w, http.StatusAccepted, delivery)
+		return
+	}
+
+	if errors.Is(err, webhooks.ErrDeliveryNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, webhooks.ErrNotReplayable) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	logging.FromContext(r.Context()).Error("Error replaying webhook delivery", "error", err)
+	http.Error(w, "unknown error", http.StatusInternalServerError)
+}
+
+func (s *Server) ReplayFailedWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := s.webhooks.ReplayFailed(r.Context(), owner)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error replaying webhook deliveries", "error", err)
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, &ListDeliveriesResponse{Deliveries: deliveries})
+}
+
+// Sends an event to the webhooks of the client making the request, if any.
+// Failing to do so doesn't fail the request, since the change to the deck already happened.
+func (s *Server) dispatchWebhook(ctx context.Context, event webhooks.EventType, data *DeckWebhookData) {
+	if s.webhooks == nil {
+		return
+	}
+
+	if err := s.webhooks.Dispatch(ctx, clientFromContext(ctx), event, data); err != nil {
+		logging.FromContext(ctx).Error("Error dispatching webhook", "event", event, "error", err)
+	}
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
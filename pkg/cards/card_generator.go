@@ -3,10 +3,14 @@ package cards
 import (
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 )
 
+// A rand.Rand is not safe for concurrent use,
+// and the same generator is used to handle many requests at once, so we guard it.
 type CardGenerator struct {
+	mu   sync.Mutex
 	rand *rand.Rand
 }
 
@@ -53,6 +57,9 @@ func (g *CardGenerator) FullCardList() []Card {
 }
 
 func (g *CardGenerator) Shuffle(list []Card) []Card {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	for i := range list {
 		j := g.rand.Intn(i + 1)
 		list[i], list[j] = list[j], list[i]
@@ -0,0 +1,133 @@
+package cards
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Cards can be packed compactly, so storages keep decks in less memory, and read them faster, than lists of codes:
+// each card is a single byte, with the suit in the high four bits and the rank in the low four.
+//
+// A packed deck starts with the version of the encoding, so the encoding can change
+// without breaking the decks packed before, followed by its cards, from the top of the deck to the bottom.
+// Drawing cards doesn't change the packed deck: it is kept together with how many cards were drawn from the top,
+// so drawing only needs to move that pointer forward.
+const PackedVersion1 byte = 1
+
+// The version Pack uses.
+const PackedVersion = PackedVersion1
+
+var ErrInvalidPackedDeck = errors.New("invalid packed deck")
+
+type PackedDeck struct {
+	// The version of the encoding, followed by the cards, one byte each.
+	Data []byte
+
+	// How many cards were drawn from the top of the deck.
+	Drawn int
+}
+
+func Pack(list []Card) *PackedDeck {
+	data := make([]byte, 1, len(list)+1)
+	data[0] = PackedVersion
+	return &PackedDeck{Data: AppendPacked(data, list)}
+}
+
+// Checks the data is a packed deck, and that drawn is within it.
+// The data is not copied, so it must not change while the deck is used.
+func Unpack(data []byte, drawn int) (*PackedDeck, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: no data", ErrInvalidPackedDeck)
+	}
+
+	if data[0] != PackedVersion1 {
+		return nil, fmt.Errorf("%w: unknown version %d", ErrInvalidPackedDeck, data[0])
+	}
+
+	for _, b := range data[1:] {
+		if _, err := UnpackCard(b); err != nil {
+			return nil, err
+		}
+	}
+
+	if drawn < 0 || drawn > len(data)-1 {
+		return nil, fmt.Errorf("%w: %d cards drawn from a deck of %d", ErrInvalidPackedDeck, drawn, len(data)-1)
+	}
+
+	return &PackedDeck{Data: data, Drawn: drawn}, nil
+}
+
+func (d *PackedDeck) Remaining() int {
+	return len(d.Data) - 1 - d.Drawn
+}
+
+// The cards not drawn yet, from the top of the deck.
+func (d *PackedDeck) Cards() []Card {
+	return unpackValid(d.Data[1+d.Drawn:])
+}
+
+// Draws cards from the top of the deck, or all of them, if there are not that many.
+func (d *PackedDeck) Draw(count int) []Card {
+	if count > d.Remaining() {
+		count = d.Remaining()
+	}
+
+	if count <= 0 {
+		return []Card{}
+	}
+
+	start := 1 + d.Drawn
+	d.Drawn += count
+	return unpackValid(d.Data[start : start+count])
+}
+
+func PackCard(card Card) byte {
+	return byte(card.Suit)<<4 | byte(card.Rank)
+}
+
+func UnpackCard(b byte) (Card, error) {
+	card := unpackCard(b)
+	if card.Suit < CardSuitClubs || card.Suit >= CardSuitUnknown || card.Rank < 1 || card.Rank > 13 {
+		return Card{}, fmt.Errorf("%w: invalid card 0x%02x", ErrInvalidPackedDeck, b)
+	}
+
+	return card, nil
+}
+
+// Appends the cards, one byte each, without a version, for formats that keep their own.
+func AppendPacked(data []byte, list []Card) []byte {
+	for _, card := range list {
+		data = append(data, PackCard(card))
+	}
+
+	return data
+}
+
+// Unpacks cards appended with AppendPacked.
+func UnpackCards(data []byte) ([]Card, error) {
+	list := make([]Card, len(data))
+	for i, b := range data {
+		card, err := UnpackCard(b)
+		if err != nil {
+			return nil, err
+		}
+
+		list[i] = card
+	}
+
+	return list, nil
+}
+
+// For cards already checked by Unpack.
+func unpackValid(data []byte) []Card {
+	list := make([]Card, len(data))
+	for i, b := range data {
+		list[i] = unpackCard(b)
+	}
+
+	return list
+}
+
+func unpackCard(b byte) Card {
+	return Card{Suit: CardSuit(b >> 4), Rank: CardRank(b & 0x0f)}
+}
@@ -0,0 +1,151 @@
+package cards
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test__Codec(t *testing.T) {
+	generator := NewCardGenerator()
+
+	t.Run("every card packs into a byte and back", func(t *testing.T) {
+		for _, card := range generator.FullCardList() {
+			unpacked, err := UnpackCard(PackCard(card))
+			require.NoError(t, err)
+			require.Equal(t, card, unpacked)
+		}
+	})
+
+	t.Run("invalid bytes are not cards", func(t *testing.T) {
+		for _, b := range []byte{0x00, 0x0e, 0x0f, 0x40, 0x41, 0xf1} {
+			_, err := UnpackCard(b)
+			require.ErrorIs(t, err, ErrInvalidPackedDeck)
+		}
+	})
+
+	t.Run("pack and unpack deck", func(t *testing.T) {
+		list := generator.Shuffle(generator.FullCardList())
+		packed := Pack(list)
+		require.Len(t, packed.Data, 53)
+		require.Equal(t, PackedVersion, packed.Data[0])
+		require.Equal(t, 52, packed.Remaining())
+
+		unpacked, err := Unpack(packed.Data, 0)
+		require.NoError(t, err)
+		require.Equal(t, list, unpacked.Cards())
+	})
+
+	t.Run("drawing moves the pointer", func(t *testing.T) {
+		list := generator.FullCardList()
+		packed := Pack(list)
+		require.Equal(t, list[:5], packed.Draw(5))
+		require.Equal(t, 5, packed.Drawn)
+		require.Equal(t, 47, packed.Remaining())
+		require.Equal(t, list[5:], packed.Cards())
+
+		unpacked, err := Unpack(packed.Data, packed.Drawn)
+		require.NoError(t, err)
+		require.Equal(t, list[5:], unpacked.Cards())
+	})
+
+	t.Run("drawing more than remaining draws everything left", func(t *testing.T) {
+		list := generator.FullCardList()[:3]
+		packed := Pack(list)
+		require.Equal(t, list, packed.Draw(10))
+		require.Equal(t, 0, packed.Remaining())
+		require.Equal(t, []Card{}, packed.Draw(1))
+		require.Equal(t, []Card{}, packed.Cards())
+	})
+
+	t.Run("empty deck", func(t *testing.T) {
+		packed := Pack([]Card{})
+		require.Equal(t, []byte{PackedVersion}, packed.Data)
+
+		unpacked, err := Unpack(packed.Data, 0)
+		require.NoError(t, err)
+		require.Equal(t, 0, unpacked.Remaining())
+	})
+
+	t.Run("invalid packed decks", func(t *testing.T) {
+		valid := Pack(generator.FullCardList()[:2]).Data
+		for _, tc := range []struct {
+			data    []byte
+			drawn   int
+			message string
+		}{
+			{data: nil, message: "no data"},
+			{data: []byte{2, 0x01}, message: "unknown version 2"},
+			{data: []byte{PackedVersion, 0x01, 0x4f}, message: "invalid card 0x4f"},
+			{data: valid, drawn: 3, message: "3 cards drawn from a deck of 2"},
+			{data: valid, drawn: -1, message: "-1 cards drawn from a deck of 2"},
+		} {
+			_, err := Unpack(tc.data, tc.drawn)
+			require.ErrorIs(t, err, ErrInvalidPackedDeck)
+			require.ErrorContains(t, err, tc.message)
+		}
+	})
+}
+
+// The benchmarks compare the packed encoding against the list of codes storages kept before.
+// Run them with: go test ./pkg/cards -bench . -benchmem
+
+func BenchmarkGet(b *testing.B) {
+	generator := NewCardGenerator()
+	list := generator.Shuffle(generator.FullCardList())
+
+	b.Run("codes", func(b *testing.B) {
+		codes := CardListToCodes(list)
+		for i := 0; i < b.N; i++ {
+			if _, err := CodesToCardList(codes); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.ReportMetric(float64(len(strings.Join(codes, ""))), "bytes/deck")
+	})
+
+	b.Run("packed", func(b *testing.B) {
+		data := Pack(list).Data
+		for i := 0; i < b.N; i++ {
+			deck, err := Unpack(data, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			deck.Cards()
+		}
+
+		b.ReportMetric(float64(len(data)), "bytes/deck")
+	})
+}
+
+func BenchmarkDraw(b *testing.B) {
+	generator := NewCardGenerator()
+	list := generator.Shuffle(generator.FullCardList())
+
+	b.Run("codes", func(b *testing.B) {
+		codes := CardListToCodes(list)
+		for i := 0; i < b.N; i++ {
+			remaining := codes
+			for len(remaining) > 0 {
+				if _, err := CodesToCardList(remaining[:4]); err != nil {
+					b.Fatal(err)
+				}
+
+				remaining = remaining[4:]
+			}
+		}
+	})
+
+	b.Run("packed", func(b *testing.B) {
+		data := Pack(list).Data
+		for i := 0; i < b.N; i++ {
+			deck := &PackedDeck{Data: data}
+			for deck.Remaining() > 0 {
+				deck.Draw(4)
+			}
+		}
+	})
+}
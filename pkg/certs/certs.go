@@ -0,0 +1,169 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// The certificate the server presents, and its key.
+	CertFile string
+	KeyFile  string
+
+	// If given, clients are asked for a certificate signed by one of the CAs in this file.
+	ClientCAFile string
+
+	// Whether clients must present a certificate, or only have it verified if they do.
+	// Only used if ClientCAFile is given.
+	ClientAuth tls.ClientAuthType
+
+	// How often the files are checked for changes. Zero means on every handshake.
+	ReloadInterval time.Duration
+}
+
+// Keeps the certificate, and the client CAs, loaded from files,
+// and reloads them when the files change, so certificates can be renewed without restarting the server.
+//
+// The files are only checked during handshakes, at most once per reload interval,
+// so there's nothing to stop when the server is done with it.
+// If the files can't be loaded, like when only one of them was replaced so far,
+// the ones loaded before keep being used, until they can.
+type Reloader struct {
+	config Config
+
+	mu        sync.Mutex
+	current   *tls.Config
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+// Loads the files right away, so a server with invalid files fails to start.
+func NewReloader(config Config) (*Reloader, error) {
+	r := &Reloader{config: config}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// The config to give to servers, like http.Server and gRPC's credentials.NewTLS.
+func (r *Reloader) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+
+		// http.Server.ServeTLS requires a certificate in the config itself,
+		// even though the one from GetConfigForClient is used instead.
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.currentConfig().Certificates[0], nil
+		},
+
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.currentConfig(), nil
+		},
+	}
+}
+
+// Returns the config for the files as they are now, reloading them if they changed.
+func (r *Reloader) currentConfig() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) < r.config.ReloadInterval {
+		return r.current
+	}
+
+	r.lastCheck = time.Now()
+	if !r.changed() {
+		return r.current
+	}
+
+	if err := r.load(); err != nil {
+		slog.Error("Error reloading TLS certificate, using the previous one", "error", err)
+		return r.current
+	}
+
+	slog.Info("Reloaded TLS certificate", "cert_file", r.config.CertFile)
+	return r.current
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCAFile != "" {
+		files = append(files, r.config.ClientCAFile)
+	}
+
+	return files
+}
+
+func (r *Reloader) changed() bool {
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Only replaces the current config if every file could be loaded.
+func (r *Reloader) load() error {
+	modTimes := map[string]time.Time{}
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+
+		modTimes[file] = info.ModTime()
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("error loading certificate: %v", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+
+		// Both HTTP/2, which gRPC needs, and HTTP/1.1, which WebSockets need.
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if r.config.ClientCAFile != "" {
+		pool, err := LoadCertPool(r.config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = r.config.ClientAuth
+	}
+
+	r.current = config
+	r.modTimes = modTimes
+	return nil
+}
+
+// Loads the PEM encoded certificates in the file, like the ones of a CA.
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading CA: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("error loading CA: no certificates found in " + file)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,139 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lucaspin/decks-api/pkg/certs/certstest"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__Reloader(t *testing.T) {
+	t.Run("certificate is reloaded when the files change", func(t *testing.T) {
+		ca := certstest.NewCA(t)
+		dir := t.TempDir()
+		first := ca.Issue(t, dir, "first")
+
+		reloader, err := NewReloader(Config{CertFile: first.CertFile, KeyFile: first.KeyFile})
+		require.NoError(t, err)
+		url := serveTLS(t, reloader)
+		require.Equal(t, first.Serial, servedCertificate(t, url, ca.Pool()).SerialNumber)
+
+		second := ca.Issue(t, dir, "second")
+		touch(t, second.CertFile, second.KeyFile)
+		require.Equal(t, second.Serial, servedCertificate(t, url, ca.Pool()).SerialNumber)
+	})
+
+	t.Run("files are only checked once per reload interval", func(t *testing.T) {
+		ca := certstest.NewCA(t)
+		dir := t.TempDir()
+		first := ca.Issue(t, dir, "first")
+
+		reloader, err := NewReloader(Config{CertFile: first.CertFile, KeyFile: first.KeyFile, ReloadInterval: time.Hour})
+		require.NoError(t, err)
+		url := serveTLS(t, reloader)
+		require.Equal(t, first.Serial, servedCertificate(t, url, ca.Pool()).SerialNumber)
+
+		second := ca.Issue(t, dir, "second")
+		touch(t, second.CertFile, second.KeyFile)
+		require.Equal(t, first.Serial, servedCertificate(t, url, ca.Pool()).SerialNumber)
+	})
+
+	t.Run("invalid files -> previous certificate is kept", func(t *testing.T) {
+		ca := certstest.NewCA(t)
+		cert := ca.Issue(t, t.TempDir(), "server")
+
+		reloader, err := NewReloader(Config{CertFile: cert.CertFile, KeyFile: cert.KeyFile})
+		require.NoError(t, err)
+		url := serveTLS(t, reloader)
+
+		require.NoError(t, os.WriteFile(cert.KeyFile, []byte("not a key"), 0600))
+		touch(t, cert.KeyFile)
+		require.Equal(t, cert.Serial, servedCertificate(t, url, ca.Pool()).SerialNumber)
+	})
+
+	t.Run("invalid files -> error creating reloader", func(t *testing.T) {
+		_, err := NewReloader(Config{CertFile: "missing.crt", KeyFile: "missing.key"})
+		require.Error(t, err)
+	})
+
+	t.Run("client CA -> clients need a certificate signed by it", func(t *testing.T) {
+		ca := certstest.NewCA(t)
+		cert := ca.Issue(t, t.TempDir(), "server")
+		client := ca.Issue(t, t.TempDir(), "client")
+		otherCA := certstest.NewCA(t)
+		otherClient := otherCA.Issue(t, t.TempDir(), "other")
+
+		reloader, err := NewReloader(Config{
+			CertFile:     cert.CertFile,
+			KeyFile:      cert.KeyFile,
+			ClientCAFile: ca.CertFile,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})
+
+		require.NoError(t, err)
+		url := serveTLS(t, reloader)
+
+		_, err = get(url, ca.Pool(), nil)
+		require.Error(t, err)
+
+		clientCertificate := otherClient.Load(t)
+		_, err = get(url, ca.Pool(), &clientCertificate)
+		require.Error(t, err)
+
+		clientCertificate = client.Load(t)
+		response, err := get(url, ca.Pool(), &clientCertificate)
+		require.NoError(t, err)
+		require.Equal(t, "client", response.Header.Get("X-Client"))
+	})
+}
+
+// Serves, over TLS, a handler that responds with the common name of the client certificate, if any.
+func serveTLS(t *testing.T, reloader *Reloader) string {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Header().Set("X-Client", r.TLS.PeerCertificates[0].Subject.CommonName)
+		}
+	}))
+
+	server.TLS = reloader.ServerTLSConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func get(url string, roots *x509.CertPool, certificate *tls.Certificate) (*http.Response, error) {
+	config := &tls.Config{RootCAs: roots}
+	if certificate != nil {
+		config.Certificates = []tls.Certificate{*certificate}
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	response.Body.Close()
+	return response, nil
+}
+
+func servedCertificate(t *testing.T, url string, roots *x509.CertPool) *x509.Certificate {
+	response, err := get(url, roots, nil)
+	require.NoError(t, err)
+	return response.TLS.PeerCertificates[0]
+}
+
+// Files written in quick succession can have the same modification time,
+// so it is moved forward to make sure the change is noticed.
+func touch(t *testing.T, files ...string) {
+	later := time.Now().Add(time.Minute)
+	for _, file := range files {
+		require.NoError(t, os.Chtimes(file, later, later))
+	}
+}
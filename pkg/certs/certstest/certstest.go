@@ -0,0 +1,137 @@
+package certstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A certificate authority, kept in memory, that issues certificates for tests.
+type CA struct {
+	Certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+
+	// The CA certificate, PEM encoded, so clients and servers can trust it.
+	CertFile string
+}
+
+// The files of a certificate issued by a CA.
+type Cert struct {
+	CertFile string
+	KeyFile  string
+	Serial   *big.Int
+}
+
+func NewCA(t *testing.T) *CA {
+	key := newKey(t)
+	template := newTemplate("Test CA")
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	template.BasicConstraintsValid = true
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating CA: %v", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing CA: %v", err)
+	}
+
+	dir := t.TempDir()
+	return &CA{
+		Certificate: certificate,
+		key:         key,
+		CertFile:    writePEM(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", der),
+	}
+}
+
+// Issues a certificate, valid for both servers and clients, for the given name and localhost.
+// Its files are written to dir, replacing the ones already there.
+func (ca *CA) Issue(t *testing.T, dir, commonName string) *Cert {
+	key := newKey(t)
+	template := newTemplate(commonName)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	template.DNSNames = []string{"localhost"}
+	template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("error issuing certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("error encoding key: %v", err)
+	}
+
+	return &Cert{
+		CertFile: writePEM(t, filepath.Join(dir, "tls.crt"), "CERTIFICATE", der),
+		KeyFile:  writePEM(t, filepath.Join(dir, "tls.key"), "EC PRIVATE KEY", keyDER),
+		Serial:   template.SerialNumber,
+	}
+}
+
+// A pool with only the CA in it, for clients or servers to trust.
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate)
+	return pool
+}
+
+// Loads the certificate, so a client can present it.
+func (c *Cert) Load(t *testing.T) tls.Certificate {
+	certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		t.Fatalf("error loading certificate: %v", err)
+	}
+
+	return certificate
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+
+	return key
+}
+
+func newTemplate(commonName string) *x509.Certificate {
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+}
+
+// Writes to a temporary file first, and renames it,
+// so a server reloading the file never reads it half written.
+func writePEM(t *testing.T, path, blockType string, der []byte) string {
+	temporary := path + ".tmp"
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(temporary, data, 0600); err != nil {
+		t.Fatalf("error writing %s: %v", path, err)
+	}
+
+	if err := os.Rename(temporary, path); err != nil {
+		t.Fatalf("error writing %s: %v", path, err)
+	}
+
+	return path
+}
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+)
+
+const basePath = "/api/v1"
+
+// Error messages are small, so we don't need to read whole bodies for them.
+const maxErrorMessageSize = 4 * 1024
+
+// A client for the decks API.
+//
+// Failed requests are retried, if the failure is temporary.
+// Requests creating decks or drawing cards send an Idempotency-Key,
+// the same one on every retry, so retrying them doesn't create
+// more than one deck, or draw more cards than asked for,
+// as long as the server has idempotency keys enabled.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	maxRetries int
+	backoff    time.Duration
+}
+
+type Option func(*Client)
+
+// Uses the given HTTP client, instead of http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// Identifies the client with an API key, sent in the X-API-Key header.
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) {
+		c.apiKey = apiKey
+	}
+}
+
+// Retries failed requests up to maxRetries times, doubling the backoff between each of them.
+// If the server tells us when to retry with Retry-After, that is used instead.
+// Zero disables retries.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// Creates a client for the API running on baseURL, like http://localhost:4000.
+func New(baseURL string, options ...Option) *Client {
+	client := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		maxRetries: 3,
+		backoff:    100 * time.Millisecond,
+	}
+
+	for _, option := range options {
+		option(client)
+	}
+
+	return client
+}
+
+type CreateDeckOptions struct {
+	Shuffled bool
+
+	// The cards in the deck. If empty, the deck has all 52 cards.
+	Cards []cards.Card
+}
+
+type Deck struct {
+	ID        uuid.UUID
+	Shuffled  bool
+	Remaining int
+
+	// Only available when opening decks.
+	Cards []cards.Card
+
+	// The version of the deck, which can be given to Draw,
+	// to only draw cards if the deck didn't change since then.
+	Version int64
+}
+
+type DrawOptions struct {
+	// If not zero, cards are only drawn if the deck is at this version.
+	// Otherwise, the error returned matches deckerrors.ErrVersionMismatch.
+	IfVersion int64
+}
+
+type DrawResult struct {
+	Cards []cards.Card
+
+	// The version of the deck after the cards were drawn.
+	Version int64
+}
+
+// These are the same as the v1 ones in the api package,
+// but only with what is needed to build the cards.Card ones.
+type createDeckResponse struct {
+	DeckID    uuid.UUID `json:"deck_id"`
+	Shuffled  bool      `json:"shuffled"`
+	Remaining int       `json:"remaining"`
+}
+
+type openDeckResponse struct {
+	DeckID    uuid.UUID `json:"deck_id"`
+	Shuffled  bool      `json:"shuffled"`
+	Remaining int       `json:"remaining"`
+	Cards     []card    `json:"cards"`
+}
+
+type drawCardsResponse struct {
+	Cards []card `json:"cards"`
+}
+
+type card struct {
+	Code string `json:"code"`
+}
+
+func (c *Client) CreateDeck(ctx context.Context, opts CreateDeckOptions) (*Deck, error) {
+	query := url.Values{}
+	if opts.Shuffled {
+		query.Set("shuffled", "true")
+	}
+
+	if len(opts.Cards) > 0 {
+		query.Set("cards", strings.Join(cards.CardListToCodes(opts.Cards), ","))
+	}
+
+	response := createDeckResponse{}
+	header, err := c.do(ctx, http.MethodPost, "/decks", query, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Deck{
+		ID:        response.DeckID,
+		Shuffled:  response.Shuffled,
+		Remaining: response.Remaining,
+		Version:   versionFromETag(header),
+	}, nil
+}
+
+func (c *Client) OpenDeck(ctx context.Context, deckID uuid.UUID) (*Deck, error) {
+	response := openDeckResponse{}
+	header, err := c.do(ctx, http.MethodGet, "/decks/"+deckID.String(), nil, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := toCardList(response.Cards)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Deck{
+		ID:        response.DeckID,
+		Shuffled:  response.Shuffled,
+		Remaining: response.Remaining,
+		Cards:     list,
+		Version:   versionFromETag(header),
+	}, nil
+}
+
+func (c *Client) Draw(ctx context.Context, deckID uuid.UUID, count int, opts DrawOptions) (*DrawResult, error) {
+	query := url.Values{}
+	query.Set("count", strconv.Itoa(count))
+
+	header := http.Header{}
+	if opts.IfVersion != 0 {
+		header.Set("If-Match", fmt.Sprintf(`"%d"`, opts.IfVersion))
+	}
+
+	response := drawCardsResponse{}
+	responseHeader, err := c.do(ctx, http.MethodPost, "/decks/"+deckID.String()+"/draw", query, header, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := toCardList(response.Cards)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DrawResult{Cards: list, Version: versionFromETag(responseHeader)}, nil
+}
+
+// Sends the request, retrying it if needed, and decodes the response into result.
+// The headers of the response are returned, for the ETag.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, header http.Header, result interface{}) (http.Header, error) {
+	u := c.baseURL + basePath + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	if header == nil {
+		header = http.Header{}
+	}
+
+	if c.apiKey != "" {
+		header.Set("X-API-Key", c.apiKey)
+	}
+
+	if method == http.MethodPost {
+		header.Set("Idempotency-Key", uuid.NewString())
+	}
+
+	for attempt := 0; ; attempt++ {
+		responseHeader, err := c.doOnce(ctx, method, u, header, result)
+		if err == nil {
+			return responseHeader, nil
+		}
+
+		if attempt >= c.maxRetries || !retryable(ctx, err) {
+			return nil, err
+		}
+
+		wait := c.backoff << attempt
+		if retryAfter, ok := retryAfterFrom(responseHeader); ok {
+			wait = retryAfter
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// The response headers are also returned on errors, for Retry-After.
+func (c *Client) doOnce(ctx context.Context, method, u string, header http.Header, result interface{}) (http.Header, error) {
+	request, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header = header.Clone()
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorMessageSize))
+		return response.Header, &Error{
+			StatusCode: response.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+		}
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %v", err)
+	}
+
+	return response.Header, nil
+}
+
+// Errors from the API are retried depending on their status code.
+// Everything else is a failure to reach the API, which is retried,
+// unless it happened because the context is done.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiError *Error
+	if errors.As(err, &apiError) {
+		return apiError.retryable()
+	}
+
+	return true
+}
+
+func retryAfterFrom(header http.Header) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// The ETag of a deck is its version, quoted.
+func versionFromETag(header http.Header) int64 {
+	version, _ := strconv.ParseInt(strings.Trim(header.Get("ETag"), `"`), 10, 64)
+	return version
+}
+
+func toCardList(list []card) ([]cards.Card, error) {
+	codes := make([]string, len(list))
+	for i, c := range list {
+		codes[i] = c.Code
+	}
+
+	return cards.CodesToCardList(codes)
+}
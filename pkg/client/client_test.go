@@ -0,0 +1,336 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/api"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/deckerrors"
+	"github.com/lucaspin/decks-api/pkg/idempotency"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__CreateDeck(t *testing.T) {
+	client := New(newTestServer(t, nil).URL)
+
+	t.Run("default deck", func(t *testing.T) {
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{})
+		require.NoError(t, err)
+		require.NotEqual(t, uuid.Nil, deck.ID)
+		require.False(t, deck.Shuffled)
+		require.Equal(t, 52, deck.Remaining)
+		require.Equal(t, storage.InitialVersion, deck.Version)
+	})
+
+	t.Run("shuffled deck with specific cards", func(t *testing.T) {
+		list := mustCards(t, "AS", "KD", "AC")
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{Shuffled: true, Cards: list})
+		require.NoError(t, err)
+		require.True(t, deck.Shuffled)
+		require.Equal(t, 3, deck.Remaining)
+
+		opened, err := client.OpenDeck(context.Background(), deck.ID)
+		require.NoError(t, err)
+		require.ElementsMatch(t, list, opened.Cards)
+	})
+}
+
+func Test__OpenDeck(t *testing.T) {
+	client := New(newTestServer(t, nil).URL)
+
+	t.Run("deck is opened", func(t *testing.T) {
+		list := mustCards(t, "AS", "KD", "AC")
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{Cards: list})
+		require.NoError(t, err)
+
+		opened, err := client.OpenDeck(context.Background(), deck.ID)
+		require.NoError(t, err)
+		require.Equal(t, deck.ID, opened.ID)
+		require.False(t, opened.Shuffled)
+		require.Equal(t, 3, opened.Remaining)
+		require.Equal(t, list, opened.Cards)
+		require.Equal(t, deck.Version, opened.Version)
+	})
+
+	t.Run("deck that does not exist -> ErrDeckNotFound", func(t *testing.T) {
+		_, err := client.OpenDeck(context.Background(), uuid.New())
+		require.ErrorIs(t, err, deckerrors.ErrDeckNotFound)
+
+		var apiError *Error
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, http.StatusNotFound, apiError.StatusCode)
+	})
+}
+
+func Test__Draw(t *testing.T) {
+	client := New(newTestServer(t, nil).URL)
+
+	t.Run("cards are drawn from the top", func(t *testing.T) {
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{Cards: mustCards(t, "AS", "KD", "AC")})
+		require.NoError(t, err)
+
+		result, err := client.Draw(context.Background(), deck.ID, 2, DrawOptions{})
+		require.NoError(t, err)
+		require.Equal(t, mustCards(t, "AS", "KD"), result.Cards)
+		require.Equal(t, deck.Version+1, result.Version)
+	})
+
+	t.Run("empty deck -> ErrEmptyDeck", func(t *testing.T) {
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{Cards: mustCards(t, "AS")})
+		require.NoError(t, err)
+		_, err = client.Draw(context.Background(), deck.ID, 1, DrawOptions{})
+		require.NoError(t, err)
+
+		_, err = client.Draw(context.Background(), deck.ID, 1, DrawOptions{})
+		require.ErrorIs(t, err, deckerrors.ErrEmptyDeck)
+		require.NotErrorIs(t, err, deckerrors.ErrDeckNotFound)
+	})
+
+	t.Run("stale version -> ErrVersionMismatch", func(t *testing.T) {
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{Cards: mustCards(t, "AS", "KD")})
+		require.NoError(t, err)
+
+		_, err = client.Draw(context.Background(), deck.ID, 1, DrawOptions{IfVersion: deck.Version})
+		require.NoError(t, err)
+
+		_, err = client.Draw(context.Background(), deck.ID, 1, DrawOptions{IfVersion: deck.Version})
+		require.ErrorIs(t, err, deckerrors.ErrVersionMismatch)
+	})
+
+	t.Run("deck that does not exist -> ErrDeckNotFound", func(t *testing.T) {
+		_, err := client.Draw(context.Background(), uuid.New(), 1, DrawOptions{})
+		require.ErrorIs(t, err, deckerrors.ErrDeckNotFound)
+	})
+
+	t.Run("invalid count is not a storage error", func(t *testing.T) {
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{})
+		require.NoError(t, err)
+
+		_, err = client.Draw(context.Background(), deck.ID, -1, DrawOptions{})
+		require.Error(t, err)
+		require.NotErrorIs(t, err, deckerrors.ErrEmptyDeck)
+
+		var apiError *Error
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, http.StatusBadRequest, apiError.StatusCode)
+		require.Equal(t, "count must be positive", apiError.Message)
+	})
+}
+
+func Test__Retries(t *testing.T) {
+	t.Run("temporary failures are retried", func(t *testing.T) {
+		failures := &failingHandler{failures: 2, status: http.StatusServiceUnavailable}
+		client := New(newTestServer(t, failures).URL, WithRetries(3, time.Millisecond))
+
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{})
+		require.NoError(t, err)
+		require.Equal(t, 52, deck.Remaining)
+		require.Equal(t, 3, failures.requestCount())
+	})
+
+	t.Run("Retry-After is respected", func(t *testing.T) {
+		failures := &failingHandler{failures: 1, status: http.StatusTooManyRequests, retryAfter: "1"}
+		client := New(newTestServer(t, failures).URL, WithRetries(1, time.Millisecond))
+
+		start := time.Now()
+		_, err := client.CreateDeck(context.Background(), CreateDeckOptions{})
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		failures := &failingHandler{failures: 10, status: http.StatusBadGateway}
+		client := New(newTestServer(t, failures).URL, WithRetries(2, time.Millisecond))
+
+		_, err := client.OpenDeck(context.Background(), uuid.New())
+		var apiError *Error
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, http.StatusBadGateway, apiError.StatusCode)
+		require.Equal(t, 3, failures.requestCount())
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		failures := &failingHandler{}
+		client := New(newTestServer(t, failures).URL, WithRetries(3, time.Millisecond))
+
+		_, err := client.OpenDeck(context.Background(), uuid.New())
+		require.ErrorIs(t, err, deckerrors.ErrDeckNotFound)
+		require.Equal(t, 1, failures.requestCount())
+	})
+
+	t.Run("retries stop when the context deadline is reached", func(t *testing.T) {
+		failures := &failingHandler{failures: 10, status: http.StatusServiceUnavailable}
+		client := New(newTestServer(t, failures).URL, WithRetries(5, time.Minute))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := client.CreateDeck(ctx, CreateDeckOptions{})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("retries use the same idempotency key", func(t *testing.T) {
+		// The first request reaches the API, but its response is lost,
+		// so the retry should get the same deck, instead of a new one.
+		failures := &failingHandler{failures: 1, status: http.StatusBadGateway, failAfterHandling: true}
+		client := New(newTestServer(t, failures).URL, WithRetries(1, time.Millisecond))
+
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{})
+		require.NoError(t, err)
+		require.Len(t, failures.keys, 2)
+		require.Equal(t, failures.keys[0], failures.keys[1])
+		require.Equal(t, failures.firstDeckID, deck.ID.String())
+	})
+}
+
+func Test__Watch(t *testing.T) {
+	t.Run("events are received from the given version", func(t *testing.T) {
+		client := New(newTestServer(t, nil).URL)
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{Cards: mustCards(t, "AS", "KD")})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		events := []Event{}
+		afterVersion := int64(0)
+		err = client.Watch(ctx, deck.ID, WatchOptions{AfterVersion: &afterVersion}, func(e Event) error {
+			events = append(events, e)
+			if len(events) == 1 {
+				_, err := client.Draw(context.Background(), deck.ID, 1, DrawOptions{})
+				return err
+			}
+
+			return errStop
+		})
+
+		require.ErrorIs(t, err, errStop)
+		require.Len(t, events, 2)
+		require.Equal(t, "created", events[0].Type)
+		require.NotNil(t, events[0].Shuffled)
+		require.Equal(t, mustCards(t, "AS", "KD"), events[0].Cards)
+		require.Equal(t, "drawn", events[1].Type)
+		require.Equal(t, int64(2), events[1].Version)
+		require.Equal(t, mustCards(t, "AS"), events[1].Cards)
+	})
+
+	t.Run("stream is resumed after reconnecting", func(t *testing.T) {
+		server := newTestServer(t, nil)
+		client := New(server.URL, WithRetries(3, time.Millisecond))
+		deck, err := client.CreateDeck(context.Background(), CreateDeckOptions{Cards: mustCards(t, "AS", "KD")})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		versions := []int64{}
+		afterVersion := int64(0)
+		err = client.Watch(ctx, deck.ID, WatchOptions{AfterVersion: &afterVersion}, func(e Event) error {
+			versions = append(versions, e.Version)
+			if len(versions) == 1 {
+				server.CloseClientConnections()
+				_, err := client.Draw(context.Background(), deck.ID, 1, DrawOptions{})
+				return err
+			}
+
+			return errStop
+		})
+
+		require.ErrorIs(t, err, errStop)
+		require.Equal(t, []int64{1, 2}, versions)
+	})
+
+	t.Run("deck that does not exist -> ErrDeckNotFound", func(t *testing.T) {
+		client := New(newTestServer(t, nil).URL)
+		err := client.Watch(context.Background(), uuid.New(), WatchOptions{}, func(e Event) error { return nil })
+		require.ErrorIs(t, err, deckerrors.ErrDeckNotFound)
+	})
+}
+
+var errStop = errors.New("stop")
+
+// Fails the first requests with the given status, before passing them to the API,
+// or after, if failAfterHandling is set.
+type failingHandler struct {
+	failures          int
+	status            int
+	retryAfter        string
+	failAfterHandling bool
+
+	lock        sync.Mutex
+	requests    int
+	keys        []string
+	firstDeckID string
+}
+
+func (f *failingHandler) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.lock.Lock()
+		f.requests++
+		f.keys = append(f.keys, r.Header.Get("Idempotency-Key"))
+		fail := f.requests <= f.failures
+		f.lock.Unlock()
+
+		if !fail {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if f.failAfterHandling {
+			recorder := httptest.NewRecorder()
+			next.ServeHTTP(recorder, r)
+
+			response := createDeckResponse{}
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err == nil {
+				f.lock.Lock()
+				f.firstDeckID = response.DeckID.String()
+				f.lock.Unlock()
+			}
+		}
+
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+
+		http.Error(w, http.StatusText(f.status), f.status)
+	})
+}
+
+func (f *failingHandler) requestCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.requests
+}
+
+func newTestServer(t *testing.T, failures *failingHandler) *httptest.Server {
+	apiServer := api.NewServer(
+		storage.NewInMemoryStorage(),
+		api.WithIdempotencyStore(idempotency.NewInMemoryStore(), time.Hour),
+	)
+
+	handler := apiServer.Handler()
+	if failures != nil {
+		handler = failures.wrap(handler)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func mustCards(t *testing.T, codes ...string) []cards.Card {
+	list, err := cards.CodesToCardList(codes)
+	require.NoError(t, err)
+	return list
+}
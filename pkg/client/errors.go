@@ -0,0 +1,43 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lucaspin/decks-api/pkg/deckerrors"
+)
+
+// Returned when the API responds with an error.
+// Errors the API gets from the storage can be checked with errors.Is,
+// like errors.Is(err, deckerrors.ErrDeckNotFound).
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("decks-api responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// The API only sends us the message of the storage errors,
+// so we use it, together with the status code, to find which one it was.
+// 404s for routes that don't exist have a different message, so they don't match.
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound && e.Message == deckerrors.ErrDeckNotFound.Error():
+		return deckerrors.ErrDeckNotFound
+	case e.StatusCode == http.StatusBadRequest && e.Message == deckerrors.ErrEmptyDeck.Error():
+		return deckerrors.ErrEmptyDeck
+	case e.StatusCode == http.StatusPreconditionFailed:
+		return deckerrors.ErrVersionMismatch
+	default:
+		return nil
+	}
+}
+
+// Rate limited requests, and errors on the server side, are worth retrying.
+// 501 is the only 5xx that will keep happening, no matter how many times we try.
+func (e *Error) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		(e.StatusCode >= 500 && e.StatusCode != http.StatusNotImplemented)
+}
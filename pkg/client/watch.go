@@ -0,0 +1,193 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+)
+
+// A change made to a deck, as streamed by the API.
+type Event struct {
+	Version int64
+	Type    string
+	Cards   []cards.Card
+
+	// Only set for the event of the deck creation.
+	Shuffled *bool
+
+	// The versions reverted by undo events.
+	Reverts   []int64
+	CreatedAt time.Time
+}
+
+type WatchOptions struct {
+	// If set, the events after this version are received first,
+	// instead of only the ones happening from now on.
+	AfterVersion *int64
+}
+
+type event struct {
+	Version   int64     `json:"version"`
+	Type      string    `json:"type"`
+	Cards     []card    `json:"cards"`
+	Shuffled  *bool     `json:"shuffled,omitempty"`
+	Reverts   []int64   `json:"reverts,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Calls handle with every event of the deck, until the context is done,
+// or handle returns an error, which is then returned by Watch.
+//
+// If the stream is interrupted, Watch reconnects, resuming it from the last event received,
+// so no events are missed. Reconnections use the same retry configuration as other requests,
+// and the retries are reset every time a stream is established.
+func (c *Client) Watch(ctx context.Context, deckID uuid.UUID, opts WatchOptions, handle func(Event) error) error {
+	lastVersion := opts.AfterVersion
+	for attempt := 0; ; {
+		connected, err := c.watchOnce(ctx, deckID, lastVersion, func(e Event) error {
+			version := e.Version
+			lastVersion = &version
+			return handle(e)
+		})
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var handlerError *watchHandlerError
+		if errors.As(err, &handlerError) {
+			return handlerError.err
+		}
+
+		if connected {
+			attempt = 0
+		}
+
+		if err != nil && (attempt >= c.maxRetries || !retryable(ctx, err)) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.backoff << attempt):
+		}
+
+		attempt++
+	}
+}
+
+// Errors from the handler are wrapped, so they are not confused with errors from the stream.
+type watchHandlerError struct {
+	err error
+}
+
+func (e *watchHandlerError) Error() string {
+	return e.err.Error()
+}
+
+// Reads events from a single stream, until it ends.
+// Returns whether the stream was established, for Watch to reset its retries.
+func (c *Client) watchOnce(ctx context.Context, deckID uuid.UUID, afterVersion *int64, handle func(Event) error) (bool, error) {
+	u := c.baseURL + basePath + "/decks/" + deckID.String() + "/events/stream"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+
+	request.Header.Set("Accept", "text/event-stream")
+	if c.apiKey != "" {
+		request.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	if afterVersion != nil {
+		request.Header.Set("Last-Event-ID", strconv.FormatInt(*afterVersion, 10))
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return false, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorMessageSize))
+		return false, &Error{
+			StatusCode: response.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+		}
+	}
+
+	return true, readServerSentEvents(response.Body, handle)
+}
+
+// Only the data of the events is used, since it has everything the ID and type have.
+// Comments, like the keep-alive ones, are ignored.
+func readServerSentEvents(body io.Reader, handle func(Event) error) error {
+	scanner := bufio.NewScanner(body)
+	data := strings.Builder{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+
+			e, err := parseEvent(data.String())
+			if err != nil {
+				return err
+			}
+
+			data.Reset()
+			if err := handle(*e); err != nil {
+				return &watchHandlerError{err: err}
+			}
+
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteString("\n")
+			}
+
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return io.ErrUnexpectedEOF
+}
+
+func parseEvent(data string) (*Event, error) {
+	e := event{}
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return nil, fmt.Errorf("error decoding event: %v", err)
+	}
+
+	list, err := toCardList(e.Cards)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		Version:   e.Version,
+		Type:      e.Type,
+		Cards:     list,
+		Shuffled:  e.Shuffled,
+		Reverts:   e.Reverts,
+		CreatedAt: e.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,533 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/lucaspin/decks-api/pkg/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// Replaces the value of secrets, like passwords, in Redacted.
+const redacted = "REDACTED"
+
+// Everything the server can be configured with.
+// Every setting comes from, in order of precedence: a flag, an environment variable, the config file, or its default.
+type Config struct {
+	Server   Server   `yaml:"server" toml:"server"`
+	TLS      TLS      `yaml:"tls" toml:"tls"`
+	Storage  Storage  `yaml:"storage" toml:"storage"`
+	Limits   Limits   `yaml:"limits" toml:"limits"`
+	Decks    Decks    `yaml:"decks" toml:"decks"`
+	Webhooks Webhooks `yaml:"webhooks" toml:"webhooks"`
+	Tracing  Tracing  `yaml:"tracing" toml:"tracing"`
+}
+
+type Server struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     int    `yaml:"port" toml:"port"`
+	GRPCPort int    `yaml:"grpc_port" toml:"grpc_port"`
+
+	// Timeouts for the HTTP server. See api.TimeoutConfig.
+	ReadTimeout    time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout   time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout    time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	RequestTimeout time.Duration `yaml:"request_timeout" toml:"request_timeout"`
+
+	// How long to wait, after the server is marked as not ready, to stop accepting connections,
+	// and how long requests in flight have to finish after that.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" toml:"shutdown_delay"`
+	DrainTimeout  time.Duration `yaml:"drain_timeout" toml:"drain_timeout"`
+}
+
+// The ways clients with certificates can be handled, for mutual TLS.
+const (
+	// Clients must present a certificate signed by the client CA.
+	ClientAuthRequire = "require"
+
+	// Clients without a certificate are accepted too, but the ones with one must have it signed by the client CA.
+	ClientAuthVerifyIfGiven = "verify_if_given"
+)
+
+// Both the HTTP and the gRPC servers use TLS if a certificate and its key are given.
+type TLS struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+
+	// If given, clients can identify themselves with a certificate signed by this CA. See ClientAuth.
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"`
+	ClientAuth   string `yaml:"client_auth" toml:"client_auth"`
+
+	// How often the files are checked for changes, so renewed certificates are used without restarting.
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval"`
+}
+
+func (t *TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// The tls.ClientAuthType for ClientAuth.
+func (t *TLS) ClientAuthType() tls.ClientAuthType {
+	if t.ClientAuth == ClientAuthVerifyIfGiven {
+		return tls.VerifyClientCertIfGiven
+	}
+
+	return tls.RequireAndVerifyClientCert
+}
+
+type Storage struct {
+	Type  string `yaml:"type" toml:"type"`
+	Redis Redis  `yaml:"redis" toml:"redis"`
+	Bolt  Bolt   `yaml:"bolt" toml:"bolt"`
+	SQL   SQL    `yaml:"sql" toml:"sql"`
+}
+
+// Only used if the storage type is bolt.
+type Bolt struct {
+	// The file decks are kept in. It is created if it doesn't exist, but its directory must exist.
+	Path string `yaml:"path" toml:"path"`
+}
+
+func (b *Bolt) StorageConfig() *storage.BoltConfig {
+	return &storage.BoltConfig{Path: b.Path}
+}
+
+// Only used if the storage type is sql.
+type SQL struct {
+	// sqlite or postgres.
+	Driver string `yaml:"driver" toml:"driver"`
+
+	// For SQLite, the path to the database file. For PostgreSQL, a connection string, which might have a password.
+	DSN string `yaml:"dsn" toml:"dsn"`
+}
+
+func (s *SQL) StorageConfig() *storage.SQLConfig {
+	return &storage.SQLConfig{Driver: s.Driver, DSN: s.DSN}
+}
+
+// Only used if the storage type is redis.
+type Redis struct {
+	// standalone, sentinel or cluster. See storage.RedisConfig.
+	Mode string `yaml:"mode" toml:"mode"`
+
+	// Only used in standalone mode.
+	Host string `yaml:"host" toml:"host"`
+	Port int    `yaml:"port" toml:"port"`
+
+	Sentinel RedisSentinel `yaml:"sentinel" toml:"sentinel"`
+	Cluster  RedisCluster  `yaml:"cluster" toml:"cluster"`
+
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	DB       int    `yaml:"db" toml:"db"`
+
+	// Connections kept open for each Redis server. Zero means the defaults of go-redis.
+	PoolSize     int `yaml:"pool_size" toml:"pool_size"`
+	MinIdleConns int `yaml:"min_idle_conns" toml:"min_idle_conns"`
+
+	TLS RedisTLS `yaml:"tls" toml:"tls"`
+}
+
+// Only used in sentinel mode.
+type RedisSentinel struct {
+	MasterName string   `yaml:"master_name" toml:"master_name"`
+	Addresses  []string `yaml:"addresses" toml:"addresses"`
+
+	// For the Sentinels themselves, which might be different from the one of the master.
+	Password string `yaml:"password" toml:"password"`
+}
+
+// Only used in cluster mode.
+type RedisCluster struct {
+	// Some of the nodes of the cluster. The others are discovered from them.
+	Addresses []string `yaml:"addresses" toml:"addresses"`
+}
+
+// The config for storage.NewRedisStorage, shared by the server and the tools using the same Redis.
+func (r *Redis) StorageConfig() *storage.RedisConfig {
+	config := &storage.RedisConfig{
+		Mode:               r.Mode,
+		Host:               r.Host,
+		Port:               strconv.Itoa(r.Port),
+		SentinelMasterName: r.Sentinel.MasterName,
+		SentinelAddrs:      r.Sentinel.Addresses,
+		SentinelPassword:   r.Sentinel.Password,
+		ClusterAddrs:       r.Cluster.Addresses,
+		Username:           r.Username,
+		Password:           r.Password,
+		DB:                 r.DB,
+		PoolSize:           r.PoolSize,
+		MinIdleConns:       r.MinIdleConns,
+	}
+
+	if r.TLS.Enabled {
+		config.TLS = &storage.RedisTLSConfig{
+			CAFile:     r.TLS.CAFile,
+			CertFile:   r.TLS.CertFile,
+			KeyFile:    r.TLS.KeyFile,
+			ServerName: r.TLS.ServerName,
+		}
+	}
+
+	return config
+}
+
+// Most managed Redis services require TLS.
+type RedisTLS struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+
+	// The CA to verify the Redis server with, instead of the ones of the system.
+	CAFile string `yaml:"ca_file" toml:"ca_file"`
+
+	// A certificate for the Redis servers that require one, and its key.
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+
+	// The name the certificate of the Redis server is verified for, if it is not the host.
+	ServerName string `yaml:"server_name" toml:"server_name"`
+}
+
+type Limits struct {
+	// Token buckets for creating decks and drawing cards, per client. See ratelimit.Config.
+	Create RateLimit `yaml:"create" toml:"create"`
+	Draw   RateLimit `yaml:"draw" toml:"draw"`
+
+	// How many decks a client can create per day. Zero means no quota.
+	DailyCreateQuota int `yaml:"daily_create_quota" toml:"daily_create_quota"`
+
+	// How long responses are kept for Idempotency-Key retries.
+	IdempotencyRetention time.Duration `yaml:"idempotency_retention" toml:"idempotency_retention"`
+}
+
+type RateLimit struct {
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
+}
+
+// Used when creating a deck through the HTTP API without saying otherwise.
+type Decks struct {
+	Shuffled bool `yaml:"shuffled" toml:"shuffled"`
+}
+
+type Webhooks struct {
+	// For receivers in the same network as the server. See webhooks.ErrForbiddenAddress.
+	AllowPrivateAddresses bool `yaml:"allow_private_addresses" toml:"allow_private_addresses"`
+}
+
+type Tracing struct {
+	// Where spans are sent to: otlp, stdout, or none. See tracing.NewTracerProvider.
+	Exporter string `yaml:"exporter" toml:"exporter"`
+}
+
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Host:           "0.0.0.0",
+			Port:           4000,
+			GRPCPort:       4001,
+			ReadTimeout:    5 * time.Second,
+			WriteTimeout:   30 * time.Second,
+			IdleTimeout:    60 * time.Second,
+			RequestTimeout: 15 * time.Second,
+			DrainTimeout:   20 * time.Second,
+		},
+		TLS: TLS{
+			ClientAuth:     ClientAuthRequire,
+			ReloadInterval: 30 * time.Second,
+		},
+		Storage: Storage{
+			Type: storage.TypeInMemory,
+			Redis: Redis{
+				Mode: storage.RedisModeStandalone,
+				Port: 6379,
+			},
+			Bolt: Bolt{
+				Path: "decks.db",
+			},
+			SQL: SQL{
+				Driver: storage.SQLDriverSQLite,
+				DSN:    "decks.sqlite",
+			},
+		},
+		Limits: Limits{
+			Create:               RateLimit{Rate: 5, Burst: 20},
+			Draw:                 RateLimit{Rate: 20, Burst: 50},
+			DailyCreateQuota:     10000,
+			IdempotencyRetention: 24 * time.Hour,
+		},
+		Tracing: Tracing{
+			Exporter: tracing.ExporterNone,
+		},
+	}
+}
+
+// A setting that can also be given as a flag or an environment variable.
+// The flag has the same name as the key of the setting in the config file.
+type setting struct {
+	key    string
+	env    string
+	value  value
+	usage  string
+	secret bool
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "server.host", env: "API_HOST", value: (*stringValue)(&c.Server.Host), usage: "host the HTTP and gRPC servers listen on"},
+		{key: "server.port", env: "API_PORT", value: (*intValue)(&c.Server.Port), usage: "port of the HTTP server"},
+		{key: "server.grpc_port", env: "GRPC_PORT", value: (*intValue)(&c.Server.GRPCPort), usage: "port of the gRPC server"},
+		{key: "server.read_timeout", env: "API_READ_TIMEOUT", value: (*durationValue)(&c.Server.ReadTimeout), usage: "how long reading a request can take"},
+		{key: "server.write_timeout", env: "API_WRITE_TIMEOUT", value: (*durationValue)(&c.Server.WriteTimeout), usage: "how long writing a response can take, except for streams"},
+		{key: "server.idle_timeout", env: "API_IDLE_TIMEOUT", value: (*durationValue)(&c.Server.IdleTimeout), usage: "how long idle connections are kept open"},
+		{key: "server.request_timeout", env: "API_REQUEST_TIMEOUT", value: (*durationValue)(&c.Server.RequestTimeout), usage: "how long handling a request can take, except for streams"},
+		{key: "server.shutdown_delay", env: "SHUTDOWN_DELAY", value: (*durationValue)(&c.Server.ShutdownDelay), usage: "how long to wait, when shutting down, before refusing connections"},
+		{key: "server.drain_timeout", env: "DRAIN_TIMEOUT", value: (*durationValue)(&c.Server.DrainTimeout), usage: "how long requests in flight have to finish when shutting down"},
+		{key: "tls.cert_file", env: "TLS_CERT_FILE", value: (*stringValue)(&c.TLS.CertFile), usage: "path to the TLS certificate"},
+		{key: "tls.key_file", env: "TLS_KEY_FILE", value: (*stringValue)(&c.TLS.KeyFile), usage: "path to the key of the TLS certificate"},
+		{key: "tls.client_ca_file", env: "TLS_CLIENT_CA_FILE", value: (*stringValue)(&c.TLS.ClientCAFile), usage: "path to the CA that signs client certificates, for mutual TLS"},
+		{key: "tls.client_auth", env: "TLS_CLIENT_AUTH", value: (*stringValue)(&c.TLS.ClientAuth), usage: "whether clients need a certificate: require or verify_if_given"},
+		{key: "tls.reload_interval", env: "TLS_RELOAD_INTERVAL", value: (*durationValue)(&c.TLS.ReloadInterval), usage: "how often the TLS files are checked for changes"},
+		{key: "storage.type", env: "DECK_STORAGE_TYPE", value: (*stringValue)(&c.Storage.Type), usage: "where decks are kept: in-memory, redis, bolt or sql"},
+		{key: "storage.redis.mode", env: "REDIS_MODE", value: (*stringValue)(&c.Storage.Redis.Mode), usage: "how to connect to Redis: standalone, sentinel or cluster"},
+		{key: "storage.redis.host", env: "REDIS_HOST", value: (*stringValue)(&c.Storage.Redis.Host), usage: "host of the Redis server"},
+		{key: "storage.redis.port", env: "REDIS_PORT", value: (*intValue)(&c.Storage.Redis.Port), usage: "port of the Redis server"},
+		{key: "storage.redis.sentinel.master_name", env: "REDIS_SENTINEL_MASTER", value: (*stringValue)(&c.Storage.Redis.Sentinel.MasterName), usage: "name of the master the Redis Sentinels monitor"},
+		{key: "storage.redis.sentinel.addresses", env: "REDIS_SENTINEL_ADDRESSES", value: (*stringListValue)(&c.Storage.Redis.Sentinel.Addresses), usage: "comma-separated host:port of the Redis Sentinels"},
+		{key: "storage.redis.sentinel.password", env: "REDIS_SENTINEL_PASSWORD", value: (*stringValue)(&c.Storage.Redis.Sentinel.Password), usage: "password for the Redis Sentinels", secret: true},
+		{key: "storage.redis.cluster.addresses", env: "REDIS_CLUSTER_ADDRESSES", value: (*stringListValue)(&c.Storage.Redis.Cluster.Addresses), usage: "comma-separated host:port of some of the Redis Cluster nodes"},
+		{key: "storage.redis.username", env: "REDIS_USERNAME", value: (*stringValue)(&c.Storage.Redis.Username), usage: "username for the Redis server"},
+		{key: "storage.redis.password", env: "REDIS_PASSWORD", value: (*stringValue)(&c.Storage.Redis.Password), usage: "password for the Redis server", secret: true},
+		{key: "storage.redis.db", env: "REDIS_DB", value: (*intValue)(&c.Storage.Redis.DB), usage: "Redis database number"},
+		{key: "storage.redis.pool_size", env: "REDIS_POOL_SIZE", value: (*intValue)(&c.Storage.Redis.PoolSize), usage: "maximum connections to each Redis server, 0 for the default"},
+		{key: "storage.redis.min_idle_conns", env: "REDIS_MIN_IDLE_CONNS", value: (*intValue)(&c.Storage.Redis.MinIdleConns), usage: "idle connections kept open to each Redis server"},
+		{key: "storage.redis.tls.enabled", env: "REDIS_TLS_ENABLED", value: (*boolValue)(&c.Storage.Redis.TLS.Enabled), usage: "whether to connect to Redis with TLS"},
+		{key: "storage.redis.tls.ca_file", env: "REDIS_TLS_CA_FILE", value: (*stringValue)(&c.Storage.Redis.TLS.CAFile), usage: "path to the CA of the Redis server, if not one of the system"},
+		{key: "storage.redis.tls.cert_file", env: "REDIS_TLS_CERT_FILE", value: (*stringValue)(&c.Storage.Redis.TLS.CertFile), usage: "path to the client certificate for Redis"},
+		{key: "storage.redis.tls.key_file", env: "REDIS_TLS_KEY_FILE", value: (*stringValue)(&c.Storage.Redis.TLS.KeyFile), usage: "path to the key of the client certificate for Redis"},
+		{key: "storage.redis.tls.server_name", env: "REDIS_TLS_SERVER_NAME", value: (*stringValue)(&c.Storage.Redis.TLS.ServerName), usage: "name in the certificate of the Redis server, if not its host"},
+		{key: "storage.bolt.path", env: "BOLT_PATH", value: (*stringValue)(&c.Storage.Bolt.Path), usage: "file decks are kept in, for the bolt storage"},
+		{key: "storage.sql.driver", env: "SQL_DRIVER", value: (*stringValue)(&c.Storage.SQL.Driver), usage: "database of the sql storage: sqlite or postgres"},
+		{key: "storage.sql.dsn", env: "SQL_DSN", value: (*stringValue)(&c.Storage.SQL.DSN), usage: "SQLite file, or PostgreSQL connection string, of the sql storage", secret: true},
+		{key: "limits.create.rate", env: "RATE_LIMIT_CREATE_RATE", value: (*floatValue)(&c.Limits.Create.Rate), usage: "decks a client can create per second"},
+		{key: "limits.create.burst", env: "RATE_LIMIT_CREATE_BURST", value: (*intValue)(&c.Limits.Create.Burst), usage: "decks a client can create at once"},
+		{key: "limits.draw.rate", env: "RATE_LIMIT_DRAW_RATE", value: (*floatValue)(&c.Limits.Draw.Rate), usage: "draws a client can make per second"},
+		{key: "limits.draw.burst", env: "RATE_LIMIT_DRAW_BURST", value: (*intValue)(&c.Limits.Draw.Burst), usage: "draws a client can make at once"},
+		{key: "limits.daily_create_quota", env: "DAILY_CREATE_QUOTA", value: (*intValue)(&c.Limits.DailyCreateQuota), usage: "decks a client can create per day, 0 for no quota"},
+		{key: "limits.idempotency_retention", env: "IDEMPOTENCY_RETENTION", value: (*durationValue)(&c.Limits.IdempotencyRetention), usage: "how long responses are kept for Idempotency-Key retries"},
+		{key: "decks.shuffled", env: "DECK_DEFAULT_SHUFFLED", value: (*boolValue)(&c.Decks.Shuffled), usage: "whether decks are shuffled when the client doesn't say"},
+		{key: "webhooks.allow_private_addresses", env: "WEBHOOKS_ALLOW_PRIVATE_ADDRESSES", value: (*boolValue)(&c.Webhooks.AllowPrivateAddresses), usage: "whether webhooks can be sent to loopback, private and link-local addresses"},
+		{key: "tracing.exporter", env: "TRACES_EXPORTER", value: (*stringValue)(&c.Tracing.Exporter), usage: "where traces are sent to: otlp, stdout or none"},
+	}
+}
+
+// Loads the config from the file given with the -config flag, or the CONFIG_FILE environment variable, if any,
+// then applies the environment variables, then the flags, and validates the result.
+// The format of the file, YAML or TOML, is taken from its extension.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	c := Default()
+	settings := c.settings()
+
+	fs := flag.NewFlagSet("decks-api", flag.ContinueOnError)
+	path := fs.String("config", "", "path to a YAML or TOML config file (env: CONFIG_FILE)")
+
+	// Flags are only applied after the file and the environment variables,
+	// so they are kept as given until then.
+	fromFlags := map[string]string{}
+	for _, s := range settings {
+		key := s.key
+		usage := fmt.Sprintf("%s (env: %s, default: %s)", s.usage, s.env, s.value.String())
+		fs.Func(key, usage, func(value string) error {
+			fromFlags[key] = value
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path == "" {
+		*path = getenv("CONFIG_FILE")
+	}
+
+	if *path != "" {
+		if err := c.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if fromEnv := getenv(s.env); fromEnv != "" {
+			if err := s.value.Set(fromEnv); err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %v", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if fromFlag, ok := fromFlags[s.key]; ok {
+			if err := s.value.Set(fromFlag); err != nil {
+				return nil, fmt.Errorf("invalid value for -%s: %v", s.key, err)
+			}
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Settings in the file that the server doesn't know about are errors,
+// so typos don't go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+	case ".toml":
+		metadata, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("invalid config file %s: unknown setting '%s'", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("invalid config file %s: only .yaml, .yml and .toml files are supported", path)
+	}
+
+	return nil
+}
+
+// Returns every problem with the config, instead of only the first one,
+// so they can all be fixed at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	// Files are only checked to exist here. They are loaded by the ones using them.
+	checkFiles := func(prefix string, files ...string) {
+		for _, file := range files {
+			if file != "" {
+				_, err := os.Stat(file)
+				check(err == nil, "%s: %v", prefix, err)
+			}
+		}
+	}
+
+	check(validPort(c.Server.Port), "server.port must be between 1 and 65535")
+	check(validPort(c.Server.GRPCPort), "server.grpc_port must be between 1 and 65535")
+	check(c.Server.Port != c.Server.GRPCPort, "server.port and server.grpc_port must be different")
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.RequestTimeout > 0, "server.request_timeout must be positive")
+
+	// Otherwise, responses that take longer than the write timeout are cut, instead of timing out.
+	check(c.Server.RequestTimeout <= c.Server.WriteTimeout, "server.request_timeout can't be longer than server.write_timeout")
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay can't be negative")
+	check(c.Server.DrainTimeout > 0, "server.drain_timeout must be positive")
+
+	if c.TLS.Enabled() {
+		check(c.TLS.CertFile != "" && c.TLS.KeyFile != "", "tls.cert_file and tls.key_file must be given together")
+		checkFiles("tls", c.TLS.CertFile, c.TLS.KeyFile, c.TLS.ClientCAFile)
+	} else {
+		check(c.TLS.ClientCAFile == "", "tls.client_ca_file requires tls.cert_file and tls.key_file")
+	}
+
+	check(c.TLS.ClientAuth == ClientAuthRequire || c.TLS.ClientAuth == ClientAuthVerifyIfGiven, "tls.client_auth must be %s or %s, not '%s'", ClientAuthRequire, ClientAuthVerifyIfGiven, c.TLS.ClientAuth)
+	check(c.TLS.ReloadInterval >= 0, "tls.reload_interval can't be negative")
+
+	switch c.Storage.Type {
+	case storage.TypeInMemory:
+	case storage.TypeRedis:
+		redis := c.Storage.Redis
+		switch redis.Mode {
+		case storage.RedisModeStandalone:
+			check(redis.Host != "", "storage.redis.host is required for the redis storage")
+			check(validPort(redis.Port), "storage.redis.port must be between 1 and 65535")
+		case storage.RedisModeSentinel:
+			check(redis.Sentinel.MasterName != "", "storage.redis.sentinel.master_name is required in sentinel mode")
+			check(len(redis.Sentinel.Addresses) > 0, "storage.redis.sentinel.addresses is required in sentinel mode")
+		case storage.RedisModeCluster:
+			check(len(redis.Cluster.Addresses) > 0, "storage.redis.cluster.addresses is required in cluster mode")
+			check(redis.DB == 0, "storage.redis.db must be 0 in cluster mode, which only has database 0")
+		default:
+			check(false, "storage.redis.mode must be %s, %s or %s, not '%s'", storage.RedisModeStandalone, storage.RedisModeSentinel, storage.RedisModeCluster, redis.Mode)
+		}
+
+		check(redis.DB >= 0, "storage.redis.db can't be negative")
+		check(redis.PoolSize >= 0, "storage.redis.pool_size can't be negative")
+		check(redis.MinIdleConns >= 0, "storage.redis.min_idle_conns can't be negative")
+		if redisTLS := c.Storage.Redis.TLS; redisTLS.Enabled {
+			check((redisTLS.CertFile == "") == (redisTLS.KeyFile == ""), "storage.redis.tls.cert_file and storage.redis.tls.key_file must be given together")
+			checkFiles("storage.redis.tls", redisTLS.CAFile, redisTLS.CertFile, redisTLS.KeyFile)
+		}
+	case storage.TypeBolt:
+		check(c.Storage.Bolt.Path != "", "storage.bolt.path is required for the bolt storage")
+		if c.Storage.Bolt.Path != "" {
+			checkFiles("storage.bolt.path", filepath.Dir(c.Storage.Bolt.Path))
+		}
+	case storage.TypeSQL:
+		driver := c.Storage.SQL.Driver
+		check(driver == storage.SQLDriverSQLite || driver == storage.SQLDriverPostgres, "storage.sql.driver must be %s or %s, not '%s'", storage.SQLDriverSQLite, storage.SQLDriverPostgres, driver)
+		check(c.Storage.SQL.DSN != "", "storage.sql.dsn is required for the sql storage")
+	default:
+		check(false, "storage.type must be %s, %s, %s or %s, not '%s'", storage.TypeInMemory, storage.TypeRedis, storage.TypeBolt, storage.TypeSQL, c.Storage.Type)
+	}
+
+	check(c.Limits.Create.Rate > 0, "limits.create.rate must be positive")
+	check(c.Limits.Create.Burst > 0, "limits.create.burst must be positive")
+	check(c.Limits.Draw.Rate > 0, "limits.draw.rate must be positive")
+	check(c.Limits.Draw.Burst > 0, "limits.draw.burst must be positive")
+	check(c.Limits.DailyCreateQuota >= 0, "limits.daily_create_quota can't be negative")
+	check(c.Limits.IdempotencyRetention > 0, "limits.idempotency_retention must be positive")
+
+	exporter := c.Tracing.Exporter
+	check(exporter == tracing.ExporterOTLP || exporter == tracing.ExporterStdout || exporter == tracing.ExporterNone, "tracing.exporter must be %s, %s or %s, not '%s'", tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterNone, exporter)
+
+	return errors.Join(errs...)
+}
+
+// Returns every setting, by its key, with the value of secrets replaced,
+// so the effective config can be logged.
+func (c *Config) Redacted() map[string]string {
+	values := map[string]string{}
+	for _, s := range c.settings() {
+		values[s.key] = s.value.String()
+		if s.secret && values[s.key] != "" {
+			values[s.key] = redacted
+		}
+	}
+
+	return values
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
@@ -0,0 +1,12 @@
+package deckerrors
+
+import "errors"
+
+// The errors a deck can fail with, no matter where it is kept.
+// They live here, with no dependencies, so the client can tell them apart without importing the storages.
+// The storage package re-exports them, so both storage.ErrDeckNotFound and deckerrors.ErrDeckNotFound match them.
+var (
+	ErrDeckNotFound    = errors.New("deck not found")
+	ErrEmptyDeck       = errors.New("deck has no more cards")
+	ErrVersionMismatch = errors.New("deck version does not match")
+)
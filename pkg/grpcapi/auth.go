@@ -0,0 +1,74 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// The metadata clients use to identify themselves, same as the X-API-Key header of the REST API.
+const apiKeyMetadata = "x-api-key"
+
+// Identifies the client the same way the REST API does, so both share the same per-client state,
+// like idempotency keys and webhooks: by the certificate verified by the TLS server,
+// by the API key, which is not verified in any way, or by the IP address.
+func clientFromContext(ctx context.Context) string {
+	if identity := certificateIdentity(ctx); identity != "" {
+		return "cert:" + identity
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(apiKeyMetadata); len(values) > 0 && values[0] != "" {
+			return "key:" + values[0]
+		}
+	}
+
+	return "ip:" + peerIP(ctx)
+}
+
+// Identifies the client the rate limits are kept for, the same way the REST API does.
+// The API key is not used, since clients would get new limits just by sending a new one.
+func rateLimitClientFromContext(ctx context.Context) string {
+	if identity := certificateIdentity(ctx); identity != "" {
+		return "cert:" + identity
+	}
+
+	return "ip:" + peerIP(ctx)
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+// The identity in the client certificate, if the TLS server verified one.
+func certificateIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	certificate := info.State.VerifiedChains[0][0]
+	if certificate.Subject.CommonName != "" {
+		return certificate.Subject.CommonName
+	}
+
+	return certificate.Subject.String()
+}
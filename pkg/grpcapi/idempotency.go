@@ -0,0 +1,143 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/lucaspin/decks-api/pkg/idempotency"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	decksv1alpha "github.com/lucaspin/decks-api/pkg/protos/decks/v1alpha"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// The metadata clients use to make calls idempotent, same as the Idempotency-Key header of the REST API.
+const idempotencyKeyMetadata = "idempotency-key"
+
+// How long a key is reserved for while its first call is being handled, same as in the REST API.
+const idempotencyLockTTL = time.Minute
+
+// The calls that can be made idempotent, with the responses they replay.
+var idempotentMethods = map[string]func() proto.Message{
+	decksv1alpha.DeckService_CreateDeck_FullMethodName: func() proto.Message { return &decksv1alpha.CreateDeckResponse{} },
+	decksv1alpha.DeckService_DrawCards_FullMethodName:  func() proto.Message { return &decksv1alpha.DrawCardsResponse{} },
+}
+
+// Only these codes are answers to the call itself, and are stored and replayed.
+// Any other, like ResourceExhausted or Internal, releases the key, so the call can be retried.
+var replayedCodes = map[codes.Code]bool{
+	codes.OK:                 true,
+	codes.InvalidArgument:    true,
+	codes.NotFound:           true,
+	codes.FailedPrecondition: true,
+	codes.Aborted:            true,
+}
+
+// Calls carrying an idempotency-key metadata are only executed once, with keys shared with the REST API.
+// Retries with the same key and the same request get the original response back, with an idempotent-replayed metadata,
+// and retries with the same key but a different request fail with InvalidArgument.
+func (s *Server) idempotent(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	newResponse, ok := idempotentMethods[info.FullMethod]
+	if s.idempotencyStore == nil || !ok {
+		return handler(ctx, request)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(idempotencyKeyMetadata)
+	if len(values) == 0 || values[0] == "" {
+		return handler(ctx, request)
+	}
+
+	idempotencyKey := values[0]
+	if len(idempotencyKey) > 255 {
+		return nil, status.Error(codes.InvalidArgument, "idempotency key must have at most 255 characters")
+	}
+
+	fingerprint, err := requestFingerprint(info.FullMethod, request.(proto.Message))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid request")
+	}
+
+	// Keys are scoped to the client, so two clients can't see each other's responses.
+	key := clientFromContext(ctx) + ":" + idempotencyKey
+	existing, reserved, err := s.idempotencyStore.Reserve(ctx, key, fingerprint, idempotencyLockTTL)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error reserving idempotency key", "key", key, "error", err)
+		return nil, status.Error(codes.Internal, "unknown error")
+	}
+
+	if !reserved {
+		return replayResponse(ctx, existing, fingerprint, newResponse())
+	}
+
+	response, handlerErr := handler(ctx, request)
+	code := status.Code(handlerErr)
+	if !replayedCodes[code] {
+		if err := s.idempotencyStore.Release(ctx, key, fingerprint); err != nil {
+			logging.FromContext(ctx).Error("Error releasing idempotency key", "key", key, "error", err)
+		}
+
+		return response, handlerErr
+	}
+
+	stored := &idempotency.Response{
+		StatusCode:  int(code),
+		Header:      map[string]string{},
+		CompletedAt: time.Now(),
+	}
+
+	if handlerErr != nil {
+		stored.Body = []byte(status.Convert(handlerErr).Message())
+	} else if stored.Body, err = proto.Marshal(response.(proto.Message)); err != nil {
+		logging.FromContext(ctx).Error("Error encoding response for idempotency key", "key", key, "error", err)
+		return response, handlerErr
+	}
+
+	if err := s.idempotencyStore.Complete(ctx, key, fingerprint, stored, s.idempotencyRetention); err != nil {
+		logging.FromContext(ctx).Error("Error storing response for idempotency key", "key", key, "error", err)
+	}
+
+	return response, handlerErr
+}
+
+func replayResponse(ctx context.Context, existing *idempotency.Record, fingerprint string, response proto.Message) (interface{}, error) {
+	if existing.Fingerprint != fingerprint {
+		return nil, status.Error(codes.InvalidArgument, "idempotency key was already used for a different request")
+	}
+
+	if existing.InProgress() {
+		return nil, status.Error(codes.Aborted, "a request with this idempotency key is still in progress")
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs("idempotent-replayed", "true"))
+	code := codes.Code(existing.Response.StatusCode)
+	if code != codes.OK {
+		return nil, status.Error(code, string(existing.Response.Body))
+	}
+
+	if err := proto.Unmarshal(existing.Response.Body, response); err != nil {
+		logging.FromContext(ctx).Error("Error decoding replayed response", "error", err)
+		return nil, status.Error(codes.Internal, "unknown error")
+	}
+
+	return response, nil
+}
+
+// Calls are the same if they are for the same method, with the same request.
+// Requests are encoded deterministically, so the same request always has the same fingerprint.
+func requestFingerprint(method string, request proto.Message) (string, error) {
+	encoded, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(method + "\n"))
+	hash.Write(encoded)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,64 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// The metadata used to correlate the logs of a call, same as the X-Request-ID header of the REST API.
+// Clients can send their own, or one is generated for them.
+// Either way, it is sent back in the response headers.
+const requestIDMetadata = "x-request-id"
+
+// Request IDs longer than this are replaced by one we generate.
+const maxRequestIDLength = 128
+
+// Gives every call a logger carrying its ID and its method,
+// so errors logged while handling it can be traced back to it.
+func (s *Server) logged(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, requestID := withRequestLogger(ctx, info.FullMethod)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, requestID))
+	return handler(ctx, request)
+}
+
+// Same as logged, for streaming calls.
+func (s *Server) loggedStream(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, requestID := withRequestLogger(stream.Context(), info.FullMethod)
+	stream.SetHeader(metadata.Pairs(requestIDMetadata, requestID))
+	return handler(server, &loggedServerStream{ServerStream: stream, ctx: ctx})
+}
+
+func withRequestLogger(ctx context.Context, method string) (context.Context, string) {
+	var requestID string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(requestIDMetadata); len(values) > 0 {
+		requestID = values[0]
+	}
+
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		requestID = uuid.NewString()
+	}
+
+	logger := logging.FromContext(ctx).With(
+		slog.String("request_id", requestID),
+		slog.String("method", method),
+	)
+
+	return logging.WithLogger(ctx, logger), requestID
+}
+
+// Streams only expose their context through Context(),
+// so the one carrying the logger needs a wrapper to reach the handler.
+type loggedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedServerStream) Context() context.Context {
+	return s.ctx
+}
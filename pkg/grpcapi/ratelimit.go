@@ -0,0 +1,67 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lucaspin/decks-api/pkg/logging"
+	decksv1alpha "github.com/lucaspin/decks-api/pkg/protos/decks/v1alpha"
+	"github.com/lucaspin/decks-api/pkg/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Limits the calls creating decks and drawing cards, with the same buckets, and the same daily quota, as the REST API,
+// keyed by the client, as rateLimitClientFromContext identifies it. Calls over the limits fail with ResourceExhausted, and a retry-after metadata with how many seconds to wait.
+func (s *Server) rateLimited(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if s.limiter == nil {
+		return handler(ctx, request)
+	}
+
+	var name string
+	var limit ratelimit.Limit
+	var quota int
+	switch info.FullMethod {
+	case decksv1alpha.DeckService_CreateDeck_FullMethodName:
+		name, limit, quota = "create", s.rateLimitConfig.Create, s.rateLimitConfig.DailyCreateQuota
+	case decksv1alpha.DeckService_DrawCards_FullMethodName:
+		name, limit = "draw", s.rateLimitConfig.Draw
+	default:
+		return handler(ctx, request)
+	}
+
+	key := name + ":" + rateLimitClientFromContext(ctx)
+	result, err := ratelimit.AllowWithQuota(ctx, s.limiter, key, limit, quota)
+
+	// If we can't check the limits, we let the call through, same as the REST API.
+	if err != nil {
+		logging.FromContext(ctx).Error("Error checking rate limit", "key", key, "error", err)
+		return handler(ctx, request)
+	}
+
+	md := metadata.Pairs(
+		"x-ratelimit-limit", fmt.Sprintf("%d", result.Limit),
+		"x-ratelimit-remaining", fmt.Sprintf("%d", result.Remaining),
+		"x-ratelimit-reset", fmt.Sprintf("%d", ratelimit.CeilSeconds(result.ResetAfter)),
+	)
+
+	if !result.Allowed {
+		md.Set("retry-after", fmt.Sprintf("%d", ratelimit.CeilSeconds(result.RetryAfter)))
+		grpc.SetHeader(ctx, md)
+		return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+
+	grpc.SetHeader(ctx, md)
+	response, err := handler(ctx, request)
+
+	// Calls that fail don't create anything, so they don't use the daily quota.
+	if err != nil && quota > 0 {
+		if refundErr := s.limiter.RefundQuota(ctx, key); refundErr != nil {
+			logging.FromContext(ctx).Error("Error refunding quota", "key", key, "error", refundErr)
+		}
+	}
+
+	return response, err
+}
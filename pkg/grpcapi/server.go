@@ -0,0 +1,359 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/idempotency"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	decksv1alpha "github.com/lucaspin/decks-api/pkg/protos/decks/v1alpha"
+	"github.com/lucaspin/decks-api/pkg/ratelimit"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/lucaspin/decks-api/pkg/webhooks"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The gRPC counterpart of api.Server.
+// Both are meant to be used with the same storage and card generator,
+// so decks created through one of them can be used through the other.
+// They should also share the same limiter, idempotency store and webhook dispatcher,
+// so clients get the same limits, and the same webhooks, no matter which one they call.
+type Server struct {
+	decksv1alpha.UnimplementedDeckServiceServer
+
+	storage              storage.Storage
+	generator            *cards.CardGenerator
+	grpcOptions          []grpc.ServerOption
+	grpcServer           *grpc.Server
+	limiter              ratelimit.Limiter
+	rateLimitConfig      ratelimit.Config
+	idempotencyStore     idempotency.Store
+	idempotencyRetention time.Duration
+	webhooks             *webhooks.Dispatcher
+}
+
+type ServerOption func(*Server)
+
+// Passed to the underlying gRPC server, like grpc.Creds, to serve over TLS.
+func WithGRPCOptions(options ...grpc.ServerOption) ServerOption {
+	return func(s *Server) {
+		s.grpcOptions = append(s.grpcOptions, options...)
+	}
+}
+
+// Limits creating decks and drawing cards per client, same as api.WithRateLimiter.
+// With the same limiter, the limits are shared with the REST API.
+func WithRateLimiter(limiter ratelimit.Limiter, config ratelimit.Config) ServerOption {
+	return func(s *Server) {
+		s.limiter = limiter
+		s.rateLimitConfig = config
+	}
+}
+
+// Makes calls carrying an idempotency-key metadata execute only once, same as api.WithIdempotencyStore.
+func WithIdempotencyStore(store idempotency.Store, retention time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idempotencyStore = store
+		s.idempotencyRetention = retention
+	}
+}
+
+// Sends webhooks for decks created and emptied through this server, same as api.WithWebhooks.
+// Subscriptions are managed through the REST API.
+func WithWebhooks(dispatcher *webhooks.Dispatcher) ServerOption {
+	return func(s *Server) {
+		s.webhooks = dispatcher
+	}
+}
+
+func NewServer(storage storage.Storage, generator *cards.CardGenerator, options ...ServerOption) *Server {
+	server := &Server{
+		storage:   storage,
+		generator: generator,
+	}
+
+	for _, option := range options {
+		option(server)
+	}
+
+	grpcOptions := append(server.grpcOptions,
+		grpc.ChainUnaryInterceptor(server.Interceptors()...),
+		grpc.ChainStreamInterceptor(server.StreamInterceptors()...),
+	)
+	server.grpcServer = grpc.NewServer(grpcOptions...)
+	server.Register(server.grpcServer)
+	return server
+}
+
+// Registers the service on a gRPC server other than the one created by NewServer.
+// That server needs the interceptors from Interceptors and StreamInterceptors,
+// or calls skip the limits and idempotency keys, and their logs carry no request ID.
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	decksv1alpha.RegisterDeckServiceServer(registrar, s)
+}
+
+// Idempotency keys are checked before the limits, so replaying a call doesn't count against them.
+func (s *Server) Interceptors() []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{s.logged, s.idempotent, s.rateLimited}
+}
+
+func (s *Server) StreamInterceptors() []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{s.loggedStream}
+}
+
+func (s *Server) Serve(host string, port int) error {
+	slog.Info("Starting gRPC server", "host", host, "port", port)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return err
+	}
+
+	return s.grpcServer.Serve(listener)
+}
+
+// Stops accepting new calls, and waits for the ones in flight to finish.
+// If the context is done before that, the calls still in flight are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) CreateDeck(ctx context.Context, request *decksv1alpha.CreateDeckRequest) (*decksv1alpha.CreateDeckResponse, error) {
+	for _, code := range request.Cards {
+		if strings.TrimSpace(code) == "" {
+			return nil, status.Error(codes.InvalidArgument, "card codes can't be empty")
+		}
+	}
+
+	list, err := s.generator.NewListWithConfig(cards.GeneratorConfig{
+		Shuffled: request.Shuffled,
+		Codes:    strings.Join(request.Cards, ","),
+	})
+
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	deckType := storage.DeckTypeFull
+	if len(request.Cards) > 0 {
+		deckType = storage.DeckTypePartial
+	}
+
+	deck, err := s.storage.Create(ctx, list, storage.CreateOptions{
+		Shuffled: request.Shuffled,
+		Owner:    clientFromContext(ctx),
+		Type:     deckType,
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err, "creating deck")
+	}
+
+	s.dispatchWebhook(ctx, webhooks.EventDeckCreated, &webhooks.DeckData{
+		DeckID:    deck.DeckID,
+		Shuffled:  &deck.Shuffled,
+		Remaining: deck.Remaining(),
+	})
+
+	return &decksv1alpha.CreateDeckResponse{
+		DeckId:    deck.DeckID.String(),
+		Shuffled:  deck.Shuffled,
+		Remaining: int32(deck.Remaining()),
+		Version:   deck.Version,
+	}, nil
+}
+
+func (s *Server) OpenDeck(ctx context.Context, request *decksv1alpha.OpenDeckRequest) (*decksv1alpha.OpenDeckResponse, error) {
+	deckID, err := parseDeckID(request.DeckId)
+	if err != nil {
+		return nil, err
+	}
+
+	deck, err := s.storage.Get(ctx, deckID)
+	if err != nil {
+		return nil, toStatus(ctx, err, "opening deck")
+	}
+
+	return &decksv1alpha.OpenDeckResponse{
+		DeckId:    deck.DeckID.String(),
+		Shuffled:  deck.Shuffled,
+		Remaining: int32(deck.Remaining()),
+		Cards:     newCardList(deck.Cards),
+		Version:   deck.Version,
+	}, nil
+}
+
+func (s *Server) DrawCards(ctx context.Context, request *decksv1alpha.DrawCardsRequest) (*decksv1alpha.DrawCardsResponse, error) {
+	deckID, err := parseDeckID(request.DeckId)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Count < 0 {
+		return nil, status.Error(codes.InvalidArgument, "count must be positive")
+	}
+
+	if request.IfVersion < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid if_version")
+	}
+
+	result, err := s.storage.Draw(ctx, deckID, int(request.Count), request.IfVersion)
+	if err != nil {
+		return nil, toStatus(ctx, err, "drawing cards")
+	}
+
+	// The next draw from this deck fails with ErrEmptyDeck.
+	if result.Remaining == 0 {
+		s.dispatchWebhook(ctx, webhooks.EventDeckEmptied, &webhooks.DeckData{DeckID: deckID})
+	}
+
+	return &decksv1alpha.DrawCardsResponse{
+		Cards:     newCardList(result.Cards),
+		Remaining: int32(result.Remaining),
+		Version:   result.Version,
+	}, nil
+}
+
+// Same as the Server-Sent Events endpoint of the REST API,
+// clients that get disconnected can resume the stream from the last event they received.
+func (s *Server) WatchDeck(request *decksv1alpha.WatchDeckRequest, stream decksv1alpha.DeckService_WatchDeckServer) error {
+	deckID, err := parseDeckID(request.DeckId)
+	if err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	var afterVersion int64
+	if request.AfterVersion != nil {
+		afterVersion = request.GetAfterVersion()
+		if afterVersion < 0 {
+			return status.Error(codes.InvalidArgument, "invalid after_version")
+		}
+	} else {
+		deck, err := s.storage.Get(ctx, deckID)
+		if err != nil {
+			return toStatus(ctx, err, "finding deck")
+		}
+
+		afterVersion = deck.Version
+	}
+
+	events, err := s.storage.Watch(ctx, deckID, afterVersion)
+	if err != nil {
+		return toStatus(ctx, err, "watching deck")
+	}
+
+	// Headers are only sent once we are watching the deck,
+	// so clients can wait for them to know no changes will be missed from then on.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			if err := stream.Send(&decksv1alpha.WatchDeckResponse{Event: newDeckEvent(event)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) dispatchWebhook(ctx context.Context, event webhooks.EventType, data *webhooks.DeckData) {
+	if s.webhooks == nil {
+		return
+	}
+
+	if err := s.webhooks.Dispatch(ctx, clientFromContext(ctx), event, data); err != nil {
+		logging.FromContext(ctx).Error("Error dispatching webhook", "event", event, "error", err)
+	}
+}
+
+func parseDeckID(ID string) (*uuid.UUID, error) {
+	deckID, err := uuid.Parse(ID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid deck ID")
+	}
+
+	return &deckID, nil
+}
+
+// Maps storage errors to gRPC status codes.
+// Unknown errors are logged, and not returned to clients.
+func toStatus(ctx context.Context, err error, action string) error {
+	switch {
+	case errors.Is(err, storage.ErrDeckNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, storage.ErrEmptyDeck):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, storage.ErrVersionMismatch):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		logging.FromContext(ctx).Error("Unknown error "+action, "error", err)
+		return status.Error(codes.Internal, "unknown error")
+	}
+}
+
+var eventTypes = map[storage.EventType]decksv1alpha.EventType{
+	storage.EventTypeCreated:  decksv1alpha.EventType_EVENT_TYPE_CREATED,
+	storage.EventTypeDrawn:    decksv1alpha.EventType_EVENT_TYPE_DRAWN,
+	storage.EventTypeShuffled: decksv1alpha.EventType_EVENT_TYPE_SHUFFLED,
+	storage.EventTypeUndone:   decksv1alpha.EventType_EVENT_TYPE_UNDONE,
+}
+
+func newDeckEvent(e storage.Event) *decksv1alpha.DeckEvent {
+	return &decksv1alpha.DeckEvent{
+		Version:   e.Version,
+		Type:      eventTypes[e.Type],
+		Cards:     newCardList(e.Cards),
+		Shuffled:  e.Type == storage.EventTypeCreated && e.Shuffled,
+		Reverts:   e.Reverts,
+		CreatedAt: timestamppb.New(e.CreatedAt),
+	}
+}
+
+func newCardList(deckCards []cards.Card) []*decksv1alpha.Card {
+	list := make([]*decksv1alpha.Card, len(deckCards))
+	for i, c := range deckCards {
+		list[i] = &decksv1alpha.Card{
+			Value: c.Rank.String(),
+			Suit:  c.Suit.String(),
+			Code:  c.Code(),
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,492 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/certs"
+	"github.com/lucaspin/decks-api/pkg/certs/certstest"
+	"github.com/lucaspin/decks-api/pkg/idempotency"
+	decksv1alpha "github.com/lucaspin/decks-api/pkg/protos/decks/v1alpha"
+	"github.com/lucaspin/decks-api/pkg/ratelimit"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/lucaspin/decks-api/pkg/webhooks"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+func Test__CreateDeck(t *testing.T) {
+	client := newTestClient(t)
+
+	t.Run("default deck created", func(t *testing.T) {
+		response, err := client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{})
+		require.NoError(t, err)
+		require.NotEmpty(t, response.DeckId)
+		require.False(t, response.Shuffled)
+		require.Equal(t, int32(52), response.Remaining)
+		require.Equal(t, storage.InitialVersion, response.Version)
+	})
+
+	t.Run("deck can be created with specific cards", func(t *testing.T) {
+		response, err := client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{Cards: []string{"AS", "KD", "AC", "7H"}})
+		require.NoError(t, err)
+		require.Equal(t, int32(4), response.Remaining)
+
+		deck, err := client.OpenDeck(context.Background(), &decksv1alpha.OpenDeckRequest{DeckId: response.DeckId})
+		require.NoError(t, err)
+		require.Equal(t, []string{"AS", "KD", "AC", "7H"}, cardCodes(deck.Cards))
+		require.Equal(t, &decksv1alpha.Card{Value: "ACE", Suit: "SPADES", Code: "AS"}, deck.Cards[0])
+	})
+
+	t.Run("shuffled deck", func(t *testing.T) {
+		response, err := client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{Shuffled: true})
+		require.NoError(t, err)
+		require.True(t, response.Shuffled)
+		require.Equal(t, int32(52), response.Remaining)
+	})
+
+	t.Run("invalid cards -> InvalidArgument", func(t *testing.T) {
+		_, err := client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{Cards: []string{"AS", "14H"}})
+		requireCode(t, codes.InvalidArgument, err)
+
+		_, err = client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{Cards: []string{"AS", ""}})
+		requireCode(t, codes.InvalidArgument, err)
+	})
+}
+
+func Test__OpenDeck(t *testing.T) {
+	client := newTestClient(t)
+
+	t.Run("invalid deck ID -> InvalidArgument", func(t *testing.T) {
+		_, err := client.OpenDeck(context.Background(), &decksv1alpha.OpenDeckRequest{DeckId: "not-a-valid-uuid"})
+		requireCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("deck that does not exist -> NotFound", func(t *testing.T) {
+		_, err := client.OpenDeck(context.Background(), &decksv1alpha.OpenDeckRequest{DeckId: uuid.NewString()})
+		requireCode(t, codes.NotFound, err)
+	})
+}
+
+func Test__DrawCards(t *testing.T) {
+	client := newTestClient(t)
+
+	t.Run("cards are drawn from the top", func(t *testing.T) {
+		deckID := createDeck(t, client, "AS", "KD", "AC")
+		response, err := client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 2})
+		require.NoError(t, err)
+		require.Equal(t, []string{"AS", "KD"}, cardCodes(response.Cards))
+		require.Equal(t, int32(1), response.Remaining)
+		require.Equal(t, int64(2), response.Version)
+	})
+
+	t.Run("empty deck -> FailedPrecondition", func(t *testing.T) {
+		deckID := createDeck(t, client, "AS")
+		_, err := client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1})
+		require.NoError(t, err)
+
+		_, err = client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1})
+		requireCode(t, codes.FailedPrecondition, err)
+	})
+
+	t.Run("stale version -> Aborted", func(t *testing.T) {
+		deckID := createDeck(t, client, "AS", "KD")
+		_, err := client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1, IfVersion: 1})
+		require.NoError(t, err)
+
+		_, err = client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1, IfVersion: 1})
+		requireCode(t, codes.Aborted, err)
+	})
+
+	t.Run("invalid requests -> InvalidArgument", func(t *testing.T) {
+		_, err := client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: "not-a-valid-uuid", Count: 1})
+		requireCode(t, codes.InvalidArgument, err)
+
+		_, err = client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: createDeck(t, client, "AS"), Count: -1})
+		requireCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("deck that does not exist -> NotFound", func(t *testing.T) {
+		_, err := client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: uuid.NewString(), Count: 1})
+		requireCode(t, codes.NotFound, err)
+	})
+}
+
+func Test__WatchDeck(t *testing.T) {
+	client := newTestClient(t)
+
+	t.Run("deck that does not exist -> NotFound", func(t *testing.T) {
+		stream, err := client.WatchDeck(context.Background(), &decksv1alpha.WatchDeckRequest{DeckId: uuid.NewString()})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		requireCode(t, codes.NotFound, err)
+	})
+
+	t.Run("new events are streamed", func(t *testing.T) {
+		deckID := createDeck(t, client, "AS", "KD")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		stream, err := client.WatchDeck(ctx, &decksv1alpha.WatchDeckRequest{DeckId: deckID})
+		require.NoError(t, err)
+
+		// headers are only sent once the deck is being watched
+		_, err = stream.Header()
+		require.NoError(t, err)
+
+		_, err = client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1})
+		require.NoError(t, err)
+
+		response, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, decksv1alpha.EventType_EVENT_TYPE_DRAWN, response.Event.Type)
+		require.Equal(t, []string{"AS"}, cardCodes(response.Event.Cards))
+	})
+
+	t.Run("stream resumes after version", func(t *testing.T) {
+		deckID := createDeck(t, client, "AS", "KD")
+		_, err := client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		stream, err := client.WatchDeck(ctx, &decksv1alpha.WatchDeckRequest{DeckId: deckID, AfterVersion: proto.Int64(0)})
+		require.NoError(t, err)
+
+		response, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, int64(1), response.Event.Version)
+		require.Equal(t, decksv1alpha.EventType_EVENT_TYPE_CREATED, response.Event.Type)
+		require.Equal(t, []string{"AS", "KD"}, cardCodes(response.Event.Cards))
+
+		response, err = stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, int64(2), response.Event.Version)
+		require.Equal(t, decksv1alpha.EventType_EVENT_TYPE_DRAWN, response.Event.Type)
+	})
+}
+
+func Test__TLS(t *testing.T) {
+	ca := certstest.NewCA(t)
+	serverCert := ca.Issue(t, t.TempDir(), "localhost")
+	reloader, err := certs.NewReloader(certs.Config{CertFile: serverCert.CertFile, KeyFile: serverCert.KeyFile})
+	require.NoError(t, err)
+
+	server := NewServer(storage.NewInMemoryStorage(), cards.NewCardGenerator(), WithGRPCOptions(grpc.Creds(credentials.NewTLS(reloader.ServerTLSConfig()))))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.grpcServer.Serve(listener)
+	t.Cleanup(server.grpcServer.Stop)
+
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: ca.Pool()})))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	createDeck(t, decksv1alpha.NewDeckServiceClient(conn), "AS")
+}
+
+func Test__RateLimiting(t *testing.T) {
+	limits := ratelimit.Config{
+		Create:           ratelimit.Limit{Rate: 0.001, Burst: 2},
+		Draw:             ratelimit.Limit{Rate: 0.001, Burst: 1},
+		DailyCreateQuota: 3,
+	}
+
+	t.Run("calls over limit -> ResourceExhausted, with retry-after", func(t *testing.T) {
+		client := newTestClient(t, WithRateLimiter(ratelimit.NewInMemoryLimiter(), limits))
+		createDeck(t, client)
+
+		var header metadata.MD
+		_, err := client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{}, grpc.Header(&header))
+		require.NoError(t, err)
+		require.Equal(t, []string{"2"}, header.Get("x-ratelimit-limit"))
+		require.Equal(t, []string{"0"}, header.Get("x-ratelimit-remaining"))
+
+		_, err = client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{}, grpc.Header(&header))
+		requireCode(t, codes.ResourceExhausted, err)
+		require.NotEmpty(t, header.Get("retry-after"))
+	})
+
+	t.Run("create and draw have separate limits", func(t *testing.T) {
+		client := newTestClient(t, WithRateLimiter(ratelimit.NewInMemoryLimiter(), limits))
+		deckID := createDeck(t, client)
+
+		_, err := client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1})
+		require.NoError(t, err)
+		_, err = client.DrawCards(context.Background(), &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1})
+		requireCode(t, codes.ResourceExhausted, err)
+
+		// opening decks is not limited
+		_, err = client.OpenDeck(context.Background(), &decksv1alpha.OpenDeckRequest{DeckId: deckID})
+		require.NoError(t, err)
+	})
+
+	t.Run("new API keys don't get new limits", func(t *testing.T) {
+		client := newTestClient(t, WithRateLimiter(ratelimit.NewInMemoryLimiter(), limits))
+		createDeckWith(t, withAPIKey("a"), client)
+		createDeckWith(t, withAPIKey("a"), client)
+
+		_, err := client.CreateDeck(withAPIKey("b"), &decksv1alpha.CreateDeckRequest{})
+		requireCode(t, codes.ResourceExhausted, err)
+	})
+
+	t.Run("limits are shared with the REST API, through the same keys", func(t *testing.T) {
+		limiter := ratelimit.NewInMemoryLimiter()
+		client := newTestClient(t, WithRateLimiter(limiter, limits))
+		createDeck(t, client)
+		createDeck(t, client)
+
+		// in-memory connections have no IP address, so they are identified by the name of their network
+		result, err := limiter.Allow(context.Background(), "create:ip:bufconn", limits.Create)
+		require.NoError(t, err)
+		require.False(t, result.Allowed)
+	})
+
+	t.Run("daily quota on deck creation -> ResourceExhausted", func(t *testing.T) {
+		client := newTestClient(t, WithRateLimiter(ratelimit.NewInMemoryLimiter(), ratelimit.Config{
+			Create:           ratelimit.Limit{Rate: 1000, Burst: 1000},
+			Draw:             ratelimit.Limit{Rate: 1000, Burst: 1000},
+			DailyCreateQuota: 2,
+		}))
+
+		createDeck(t, client)
+		createDeck(t, client)
+
+		_, err := client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{})
+		requireCode(t, codes.ResourceExhausted, err)
+	})
+
+	t.Run("failed deck creation does not use the daily quota", func(t *testing.T) {
+		client := newTestClient(t, WithRateLimiter(ratelimit.NewInMemoryLimiter(), ratelimit.Config{
+			Create:           ratelimit.Limit{Rate: 1000, Burst: 1000},
+			Draw:             ratelimit.Limit{Rate: 1000, Burst: 1000},
+			DailyCreateQuota: 1,
+		}))
+
+		_, err := client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{Cards: []string{"NOPE"}})
+		requireCode(t, codes.InvalidArgument, err)
+
+		createDeck(t, client)
+		_, err = client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{})
+		requireCode(t, codes.ResourceExhausted, err)
+	})
+}
+
+func Test__Idempotency(t *testing.T) {
+	newClient := func(t *testing.T) decksv1alpha.DeckServiceClient {
+		return newTestClient(t,
+			WithIdempotencyStore(idempotency.NewInMemoryStore(), time.Hour),
+			WithRateLimiter(ratelimit.NewInMemoryLimiter(), ratelimit.Config{
+				Create: ratelimit.Limit{Rate: 0.001, Burst: 2},
+				Draw:   ratelimit.Limit{Rate: 1000, Burst: 1000},
+			}),
+		)
+	}
+
+	t.Run("create retried with same key -> same deck, not limited", func(t *testing.T) {
+		client := newClient(t)
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", uuid.NewString())
+		first, err := client.CreateDeck(ctx, &decksv1alpha.CreateDeckRequest{Cards: []string{"AS", "KD"}})
+		require.NoError(t, err)
+
+		// the only create left is used by another deck, so the retry would be limited, if it was not replayed
+		createDeck(t, client)
+
+		var header metadata.MD
+		second, err := client.CreateDeck(ctx, &decksv1alpha.CreateDeckRequest{Cards: []string{"AS", "KD"}}, grpc.Header(&header))
+		require.NoError(t, err)
+		require.True(t, proto.Equal(first, second))
+		require.Equal(t, []string{"true"}, header.Get("idempotent-replayed"))
+	})
+
+	t.Run("draw retried with same key -> cards are drawn once", func(t *testing.T) {
+		client := newClient(t)
+		deckID := createDeck(t, client, "AS", "KD", "AC")
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", uuid.NewString())
+		for i := 0; i < 2; i++ {
+			response, err := client.DrawCards(ctx, &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 2})
+			require.NoError(t, err)
+			require.Equal(t, []string{"AS", "KD"}, cardCodes(response.Cards))
+		}
+
+		deck, err := client.OpenDeck(context.Background(), &decksv1alpha.OpenDeckRequest{DeckId: deckID})
+		require.NoError(t, err)
+		require.Equal(t, int32(1), deck.Remaining)
+	})
+
+	t.Run("errors answering the call are replayed", func(t *testing.T) {
+		client := newClient(t)
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", uuid.NewString())
+		request := &decksv1alpha.DrawCardsRequest{DeckId: uuid.NewString(), Count: 1}
+		for i := 0; i < 2; i++ {
+			_, err := client.DrawCards(ctx, request)
+			requireCode(t, codes.NotFound, err)
+		}
+	})
+
+	t.Run("same key with a different request -> InvalidArgument", func(t *testing.T) {
+		client := newClient(t)
+		deckID := createDeck(t, client, "AS", "KD", "AC")
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", uuid.NewString())
+		_, err := client.DrawCards(ctx, &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1})
+		require.NoError(t, err)
+
+		_, err = client.DrawCards(ctx, &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 2})
+		requireCode(t, codes.InvalidArgument, err)
+	})
+
+	t.Run("rate limited calls are not stored, so they can be retried", func(t *testing.T) {
+		client := newClient(t)
+		createDeck(t, client)
+		createDeck(t, client)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", uuid.NewString())
+		_, err := client.CreateDeck(ctx, &decksv1alpha.CreateDeckRequest{})
+		requireCode(t, codes.ResourceExhausted, err)
+
+		// a different request with the same key is not rejected, since the key was released
+		_, err = client.CreateDeck(ctx, &decksv1alpha.CreateDeckRequest{Shuffled: true})
+		requireCode(t, codes.ResourceExhausted, err)
+	})
+}
+
+func Test__Webhooks(t *testing.T) {
+	store := webhooks.NewInMemoryStore()
+	dispatcher := webhooks.NewDispatcher(store, webhooks.Config{
+		Timeout:               time.Second,
+		MaxAttempts:           1,
+		AllowPrivateAddresses: true,
+	})
+
+	t.Cleanup(dispatcher.Close)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(receiver.Close)
+
+	require.NoError(t, store.CreateSubscription(context.Background(), &webhooks.Subscription{
+		ID:        uuid.NewString(),
+		Owner:     "key:hooks",
+		URL:       receiver.URL,
+		Events:    webhooks.AllEventTypes(),
+		Secret:    "secret",
+		CreatedAt: time.Now(),
+	}))
+
+	client := newTestClient(t, WithWebhooks(dispatcher))
+
+	t.Run("decks created and emptied are sent to the subscriptions of the client", func(t *testing.T) {
+		ctx := withAPIKey("hooks")
+		deckID := createDeckWith(t, ctx, client, "AS")
+		_, err := client.DrawCards(ctx, &decksv1alpha.DrawCardsRequest{DeckId: deckID, Count: 1})
+		require.NoError(t, err)
+
+		// decks from other clients are not sent
+		createDeck(t, client, "AS")
+
+		deliveries, err := store.ListDeliveries(context.Background(), "key:hooks", "")
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+
+		events := []webhooks.EventType{}
+		for _, delivery := range deliveries {
+			events = append(events, delivery.Event)
+			require.Contains(t, string(delivery.Payload), deckID)
+		}
+
+		require.ElementsMatch(t, []webhooks.EventType{webhooks.EventDeckCreated, webhooks.EventDeckEmptied}, events)
+	})
+}
+
+func Test__RequestID(t *testing.T) {
+	client := newTestClient(t)
+
+	t.Run("no request ID -> one is generated", func(t *testing.T) {
+		var header metadata.MD
+		_, err := client.CreateDeck(context.Background(), &decksv1alpha.CreateDeckRequest{}, grpc.Header(&header))
+		require.NoError(t, err)
+		require.Len(t, header.Get(requestIDMetadata), 1)
+		_, err = uuid.Parse(header.Get(requestIDMetadata)[0])
+		require.NoError(t, err)
+	})
+
+	t.Run("request ID sent -> same one is sent back", func(t *testing.T) {
+		var header metadata.MD
+		ctx := metadata.AppendToOutgoingContext(context.Background(), requestIDMetadata, "my-request")
+		_, err := client.CreateDeck(ctx, &decksv1alpha.CreateDeckRequest{}, grpc.Header(&header))
+		require.NoError(t, err)
+		require.Equal(t, []string{"my-request"}, header.Get(requestIDMetadata))
+	})
+
+	t.Run("streaming calls -> request ID is sent back", func(t *testing.T) {
+		deckID := createDeck(t, client, "AS")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadata, "my-stream")
+		stream, err := client.WatchDeck(ctx, &decksv1alpha.WatchDeckRequest{DeckId: deckID})
+		require.NoError(t, err)
+		header, err := stream.Header()
+		require.NoError(t, err)
+		require.Equal(t, []string{"my-stream"}, header.Get(requestIDMetadata))
+	})
+}
+
+func newTestClient(t *testing.T, options ...ServerOption) decksv1alpha.DeckServiceClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewServer(storage.NewInMemoryStorage(), cards.NewCardGenerator(), options...)
+	go server.grpcServer.Serve(listener)
+	t.Cleanup(server.grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return decksv1alpha.NewDeckServiceClient(conn)
+}
+
+func createDeck(t *testing.T, client decksv1alpha.DeckServiceClient, list ...string) string {
+	return createDeckWith(t, context.Background(), client, list...)
+}
+
+func createDeckWith(t *testing.T, ctx context.Context, client decksv1alpha.DeckServiceClient, list ...string) string {
+	response, err := client.CreateDeck(ctx, &decksv1alpha.CreateDeckRequest{Cards: list})
+	require.NoError(t, err)
+	return response.DeckId
+}
+
+func withAPIKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+}
+
+func requireCode(t *testing.T, code codes.Code, err error) {
+	require.Error(t, err)
+	require.Equal(t, code, status.Code(err), err.Error())
+}
+
+func cardCodes(list []*decksv1alpha.Card) []string {
+	result := make([]string, len(list))
+	for i, card := range list {
+		result[i] = card.Code
+	}
+
+	return result
+}
@@ -0,0 +1,48 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotReserved = errors.New("idempotency key is not reserved")
+
+// The response originally given to a request,
+// replayed when the same request is retried with the same idempotency key.
+type Response struct {
+	StatusCode  int               `json:"status_code"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body"`
+	CompletedAt time.Time         `json:"completed_at"`
+}
+
+// What is kept for each idempotency key.
+// The fingerprint identifies the request that used the key first,
+// so we can tell if the key is being reused for a different request.
+// The response is only set once that first request completes.
+type Record struct {
+	Fingerprint string    `json:"fingerprint"`
+	Response    *Response `json:"response,omitempty"`
+}
+
+func (r *Record) InProgress() bool {
+	return r.Response == nil
+}
+
+type Store interface {
+	// Reserves the key for the request with the given fingerprint.
+	// The reservation expires after lockTTL, in case the request never completes.
+	// If the key is already in use, the reservation fails, and the existing record is returned.
+	Reserve(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Record, bool, error)
+
+	// Stores the response for a key previously reserved for the request with the given fingerprint,
+	// keeping it for the retention period. If the reservation expired, or the key is now used
+	// by another request, nothing is stored, and ErrNotReserved is returned.
+	Complete(ctx context.Context, key, fingerprint string, response *Response, retention time.Duration) error
+
+	// Releases a key previously reserved for the request with the given fingerprint, without storing any response.
+	// Used when the request fails in a way that makes sense to retry it.
+	// Keys no longer reserved for that request are left alone.
+	Release(ctx context.Context, key, fingerprint string) error
+}
@@ -0,0 +1,121 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/lucaspin/decks-api/pkg/redistest"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__Store(t *testing.T) {
+	runTestForAllImplementations(t, func(name string, store Store) {
+		t.Run(fmt.Sprintf("%s - unused key is reserved", name), func(t *testing.T) {
+			existing, reserved, err := store.Reserve(context.Background(), "unused", "fp", time.Minute)
+			require.NoError(t, err)
+			require.True(t, reserved)
+			require.Nil(t, existing)
+		})
+
+		t.Run(fmt.Sprintf("%s - reserved key returns in progress record", name), func(t *testing.T) {
+			_, reserved, err := store.Reserve(context.Background(), "in-progress", "fp", time.Minute)
+			require.NoError(t, err)
+			require.True(t, reserved)
+
+			existing, reserved, err := store.Reserve(context.Background(), "in-progress", "another-fp", time.Minute)
+			require.NoError(t, err)
+			require.False(t, reserved)
+			require.Equal(t, "fp", existing.Fingerprint)
+			require.True(t, existing.InProgress())
+		})
+
+		t.Run(fmt.Sprintf("%s - completed key returns response", name), func(t *testing.T) {
+			_, _, err := store.Reserve(context.Background(), "completed", "fp", time.Minute)
+			require.NoError(t, err)
+
+			response := &Response{
+				StatusCode:  201,
+				Header:      map[string]string{"Content-Type": "application/json"},
+				Body:        []byte(`{"remaining":52}`),
+				CompletedAt: time.Now().UTC().Truncate(time.Second),
+			}
+
+			require.NoError(t, store.Complete(context.Background(), "completed", "fp", response, time.Hour))
+
+			existing, reserved, err := store.Reserve(context.Background(), "completed", "fp", time.Minute)
+			require.NoError(t, err)
+			require.False(t, reserved)
+			require.False(t, existing.InProgress())
+			require.Equal(t, response, existing.Response)
+		})
+
+		t.Run(fmt.Sprintf("%s - released key can be reserved again", name), func(t *testing.T) {
+			_, _, err := store.Reserve(context.Background(), "released", "fp", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, store.Release(context.Background(), "released", "fp"))
+
+			_, reserved, err := store.Reserve(context.Background(), "released", "fp", time.Minute)
+			require.NoError(t, err)
+			require.True(t, reserved)
+		})
+
+		t.Run(fmt.Sprintf("%s - completing key not reserved -> error", name), func(t *testing.T) {
+			err := store.Complete(context.Background(), "not-reserved", "fp", &Response{StatusCode: 200}, time.Hour)
+			require.ErrorIs(t, err, ErrNotReserved)
+		})
+
+		t.Run(fmt.Sprintf("%s - completing key reserved by another request -> error, and record is kept", name), func(t *testing.T) {
+			_, _, err := store.Reserve(context.Background(), "taken", "fp", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, store.Release(context.Background(), "taken", "fp"))
+			_, _, err = store.Reserve(context.Background(), "taken", "another-fp", time.Minute)
+			require.NoError(t, err)
+
+			err = store.Complete(context.Background(), "taken", "fp", &Response{StatusCode: 200}, time.Hour)
+			require.ErrorIs(t, err, ErrNotReserved)
+
+			existing, reserved, err := store.Reserve(context.Background(), "taken", "fp", time.Minute)
+			require.NoError(t, err)
+			require.False(t, reserved)
+			require.Equal(t, "another-fp", existing.Fingerprint)
+			require.True(t, existing.InProgress())
+		})
+
+		t.Run(fmt.Sprintf("%s - completing key twice -> error, and first response is kept", name), func(t *testing.T) {
+			_, _, err := store.Reserve(context.Background(), "twice", "fp", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, store.Complete(context.Background(), "twice", "fp", &Response{StatusCode: 201}, time.Hour))
+
+			err = store.Complete(context.Background(), "twice", "fp", &Response{StatusCode: 500}, time.Hour)
+			require.ErrorIs(t, err, ErrNotReserved)
+
+			existing, _, err := store.Reserve(context.Background(), "twice", "fp", time.Minute)
+			require.NoError(t, err)
+			require.Equal(t, 201, existing.Response.StatusCode)
+		})
+
+		t.Run(fmt.Sprintf("%s - releasing key reserved by another request -> record is kept", name), func(t *testing.T) {
+			_, _, err := store.Reserve(context.Background(), "kept", "fp", time.Minute)
+			require.NoError(t, err)
+			require.NoError(t, store.Release(context.Background(), "kept", "another-fp"))
+
+			existing, reserved, err := store.Reserve(context.Background(), "kept", "fp", time.Minute)
+			require.NoError(t, err)
+			require.False(t, reserved)
+			require.Equal(t, "fp", existing.Fingerprint)
+		})
+	})
+}
+
+func runTestForAllImplementations(t *testing.T, test func(string, Store)) {
+	test("in-memory", NewInMemoryStore())
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	redistest.CheckSlots(t, client)
+	test("redis", NewRedisStore(client))
+}
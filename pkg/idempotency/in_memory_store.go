@@ -0,0 +1,96 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// An implementation of the Store interface that keeps all records in memory.
+// Retries need to reach the same server for this to work,
+// so if multiple replicas of the server are running, use the Redis implementation instead.
+type InMemoryStore struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	lastSweep time.Time
+	records   map[string]*inMemoryRecord
+}
+
+// How often expired records are removed from memory.
+const sweepInterval = time.Minute
+
+type inMemoryRecord struct {
+	record    Record
+	expiresAt time.Time
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		now:     time.Now,
+		records: map[string]*inMemoryRecord{},
+	}
+}
+
+func (s *InMemoryStore) Reserve(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if existing, ok := s.records[key]; ok && !now.After(existing.expiresAt) {
+		record := existing.record
+		return &record, false, nil
+	}
+
+	s.records[key] = &inMemoryRecord{
+		record:    Record{Fingerprint: fingerprint},
+		expiresAt: now.Add(lockTTL),
+	}
+
+	return nil, true, nil
+}
+
+func (s *InMemoryStore) Complete(ctx context.Context, key, fingerprint string, response *Response, retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	existing, ok := s.records[key]
+	if !ok || !existing.reservedFor(fingerprint, now) {
+		return ErrNotReserved
+	}
+
+	existing.record.Response = response
+	existing.expiresAt = now.Add(retention)
+	return nil
+}
+
+func (s *InMemoryStore) Release(ctx context.Context, key, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[key]; ok && existing.reservedFor(fingerprint, s.now()) {
+		delete(s.records, key)
+	}
+
+	return nil
+}
+
+// Whether the record is still the reservation made by the request with the given fingerprint.
+func (r *inMemoryRecord) reservedFor(fingerprint string, now time.Time) bool {
+	return r.record.InProgress() && r.record.Fingerprint == fingerprint && !now.After(r.expiresAt)
+}
+
+func (s *InMemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+
+	s.lastSweep = now
+	for key, r := range s.records {
+		if now.After(r.expiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
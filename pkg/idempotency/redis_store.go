@@ -0,0 +1,122 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// An implementation of the Store interface that keeps all records in Redis,
+// so a retry can be handled by any of the replicas of the server using the same Redis.
+//
+// Each record is a JSON-encoded Redis value, 'idempotency:{key}',
+// which expires after the retention period.
+//
+// Completing or releasing a key is done in a Lua script, which only changes the record
+// if it is still the reservation made by the same request. Otherwise, a request whose
+// reservation expired could overwrite, or delete, the record of the request that reserved the key next.
+type RedisStore struct {
+	Client redis.UniversalClient
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{Client: client}
+}
+
+func (s *RedisStore) Reserve(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (*Record, bool, error) {
+	value, err := reservation(fingerprint)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reserved, err := s.Client.SetNX(ctx, recordKey(key), value, lockTTL).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if reserved {
+		return nil, true, nil
+	}
+
+	existing, err := s.Client.Get(ctx, recordKey(key)).Bytes()
+
+	// The key expired between the SETNX and the GET.
+	// Unlikely, but there's nothing to replay, so we try again.
+	if errors.Is(err, redis.Nil) {
+		return s.Reserve(ctx, key, fingerprint, lockTTL)
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	record := Record{}
+	if err := json.Unmarshal(existing, &record); err != nil {
+		return nil, false, fmt.Errorf("invalid idempotency record for '%s': %v", key, err)
+	}
+
+	return &record, false, nil
+}
+
+var completeScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+  return 0
+end
+
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+func (s *RedisStore) Complete(ctx context.Context, key, fingerprint string, response *Response, retention time.Duration) error {
+	reserved, err := reservation(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(Record{Fingerprint: fingerprint, Response: response})
+	if err != nil {
+		return err
+	}
+
+	completed, err := completeScript.Run(ctx, s.Client, []string{recordKey(key)}, reserved, value, retention.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+
+	if completed == 0 {
+		return ErrNotReserved
+	}
+
+	return nil
+}
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  redis.call('DEL', KEYS[1])
+end
+
+return 0
+`)
+
+func (s *RedisStore) Release(ctx context.Context, key, fingerprint string) error {
+	reserved, err := reservation(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	return releaseScript.Run(ctx, s.Client, []string{recordKey(key)}, reserved).Err()
+}
+
+// The value stored while the request with the given fingerprint is in progress.
+// Encoding is deterministic, so the scripts can tell a reservation apart just by comparing it.
+func reservation(fingerprint string) ([]byte, error) {
+	return json.Marshal(Record{Fingerprint: fingerprint})
+}
+
+func recordKey(key string) string {
+	return fmt.Sprintf("idempotency:%s", key)
+}
@@ -0,0 +1,30 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+)
+
+type loggerContextKey struct{}
+
+// Creates a logger that writes one JSON object per line.
+func New(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, nil))
+}
+
+// Returns a copy of the context carrying the logger.
+// Everything called with the context, like the storage, logs through it,
+// so its logs carry the same attributes, like the request ID, as the ones of the caller.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// Returns the logger carried by the context, or the default one, if there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
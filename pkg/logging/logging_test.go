@@ -0,0 +1,24 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test__FromContext(t *testing.T) {
+	t.Run("context without logger -> default logger", func(t *testing.T) {
+		require.Equal(t, slog.Default(), FromContext(context.Background()))
+	})
+
+	t.Run("context with logger -> that logger", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		logger := New(output).With("request_id", "abc")
+		FromContext(WithLogger(context.Background(), logger)).Info("hello")
+		require.Contains(t, output.String(), `"request_id":"abc"`)
+		require.Contains(t, output.String(), `"msg":"hello"`)
+	})
+}
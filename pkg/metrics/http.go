@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+)
+
+// Records how many requests each route handled, and how long they took, by status.
+// Routes are identified by their path template, like '/api/v1/decks/{deck_id}',
+// so every deck doesn't end up with metrics of its own.
+// It needs to be used as a middleware of the router, so it knows which route matched.
+//
+// The response writer keeps the interfaces of the one it wraps,
+// so streaming routes can still flush their responses, and hijack their connections.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		captured := httpsnoop.CaptureMetrics(next, w, r)
+		labels := []string{r.Method, route, strconv.Itoa(captured.Code)}
+		m.requests.WithLabelValues(labels...).Inc()
+		m.requestDuration.WithLabelValues(labels...).Observe(captured.Duration.Seconds())
+	})
+}
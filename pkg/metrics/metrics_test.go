@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__InstrumentedStorage(t *testing.T) {
+	m := New()
+	store := NewInstrumentedStorage(storage.NewInMemoryStorage(), "in-memory", m)
+	list := []cards.Card{
+		{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+		{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+		{Suit: cards.CardSuitHearts, Rank: cards.CardRank(1)},
+	}
+
+	t.Run("creating decks and drawing cards is counted", func(t *testing.T) {
+		deck, err := store.Create(context.Background(), list, storage.CreateOptions{})
+		require.NoError(t, err)
+		_, err = store.Draw(context.Background(), deck.DeckID, 2, storage.AnyVersion)
+		require.NoError(t, err)
+
+		require.Equal(t, float64(1), testutil.ToFloat64(m.decksCreated.WithLabelValues("in-memory")))
+		require.Equal(t, float64(2), testutil.ToFloat64(m.cardsDrawn.WithLabelValues("in-memory")))
+		require.Equal(t, 2, testutil.CollectAndCount(m.storageDuration))
+	})
+
+	t.Run("live decks are counted by the storage", func(t *testing.T) {
+		_, err := store.Create(context.Background(), list, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		expected := `
+# HELP decks_live_decks Decks kept in the storage, by backend.
+# TYPE decks_live_decks gauge
+decks_live_decks{backend="in-memory"} 2
+`
+		require.NoError(t, testutil.GatherAndCompare(m.registry, strings.NewReader(expected), "decks_live_decks"))
+	})
+
+	t.Run("expected errors are not counted as failures", func(t *testing.T) {
+		ID := uuid.New()
+		_, err := store.Get(context.Background(), &ID)
+		require.ErrorIs(t, err, storage.ErrDeckNotFound)
+		require.Equal(t, 0, testutil.CollectAndCount(m.storageErrors))
+	})
+
+	t.Run("unexpected errors are counted as failures", func(t *testing.T) {
+		failing := NewInstrumentedStorage(&failingStorage{Storage: storage.NewInMemoryStorage()}, "failing", m)
+		_, err := failing.Create(context.Background(), list, storage.CreateOptions{})
+		require.Error(t, err)
+		require.Equal(t, float64(1), testutil.ToFloat64(m.storageErrors.WithLabelValues("failing", "create")))
+		require.Equal(t, float64(0), testutil.ToFloat64(m.decksCreated.WithLabelValues("failing")))
+	})
+}
+
+func Test__Middleware(t *testing.T) {
+	m := New()
+	router := mux.NewRouter()
+	router.HandleFunc("/decks/{deck_id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["deck_id"] == "missing" {
+			http.Error(w, "deck not found", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router.Use(m.Middleware)
+	for _, path := range []string{"/decks/a", "/decks/b", "/decks/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	t.Run("requests are counted by route template and status", func(t *testing.T) {
+		require.Equal(t, float64(2), testutil.ToFloat64(m.requests.WithLabelValues("GET", "/decks/{deck_id}", "200")))
+		require.Equal(t, float64(1), testutil.ToFloat64(m.requests.WithLabelValues("GET", "/decks/{deck_id}", "404")))
+		require.Equal(t, 2, testutil.CollectAndCount(m.requestDuration))
+	})
+
+	t.Run("metrics are served in the Prometheus format", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		m.Handler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Contains(t, response.Body.String(), `decks_http_requests_total{method="GET",route="/decks/{deck_id}",status="404"} 1`)
+	})
+}
+
+type failingStorage struct {
+	storage.Storage
+}
+
+func (s *failingStorage) Create(ctx context.Context, list []cards.Card, options storage.CreateOptions) (*storage.Deck, error) {
+	return nil, context.DeadlineExceeded
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// How long we wait for the storage to count its decks when metrics are scraped.
+const countTimeout = 5 * time.Second
+
+// Wraps any storage, recording how long its operations take, how many of them fail,
+// and how many decks are created and cards drawn through it.
+// The decks the storage has are counted when the metrics are scraped.
+type InstrumentedStorage struct {
+	storage storage.Storage
+	backend string
+	metrics *Metrics
+}
+
+// The backend names the storage in the metrics, so only one storage per backend should be instrumented.
+func NewInstrumentedStorage(s storage.Storage, backend string, m *Metrics) storage.Storage {
+	m.registry.MustRegister(&liveDecksCollector{
+		storage: s,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "live_decks"),
+			"Decks kept in the storage, by backend.",
+			nil,
+			prometheus.Labels{"backend": backend},
+		),
+	})
+
+	return &InstrumentedStorage{storage: s, backend: backend, metrics: m}
+}
+
+func (s *InstrumentedStorage) Create(ctx context.Context, list []cards.Card, options storage.CreateOptions) (deck *storage.Deck, err error) {
+	defer s.observe("create", time.Now(), &err)
+
+	deck, err = s.storage.Create(ctx, list, options)
+	if err == nil {
+		s.metrics.decksCreated.WithLabelValues(s.backend).Inc()
+	}
+
+	return deck, err
+}
+
+func (s *InstrumentedStorage) Get(ctx context.Context, deckID *uuid.UUID) (deck *storage.Deck, err error) {
+	defer s.observe("get", time.Now(), &err)
+	return s.storage.Get(ctx, deckID)
+}
+
+func (s *InstrumentedStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (result *storage.DrawResult, err error) {
+	defer s.observe("draw", time.Now(), &err)
+
+	result, err = s.storage.Draw(ctx, deckID, count, ifVersion)
+	if err == nil {
+		s.metrics.cardsDrawn.WithLabelValues(s.backend).Add(float64(len(result.Cards)))
+	}
+
+	return result, err
+}
+
+func (s *InstrumentedStorage) Shuffle(ctx context.Context, deckID *uuid.UUID, shuffle func([]cards.Card) []cards.Card, ifVersion int64) (deck *storage.Deck, err error) {
+	defer s.observe("shuffle", time.Now(), &err)
+	return s.storage.Shuffle(ctx, deckID, shuffle, ifVersion)
+}
+
+func (s *InstrumentedStorage) Events(ctx context.Context, deckID *uuid.UUID, afterVersion int64) (events []storage.Event, err error) {
+	defer s.observe("events", time.Now(), &err)
+	return s.storage.Events(ctx, deckID, afterVersion)
+}
+
+func (s *InstrumentedStorage) Undo(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (result *storage.UndoResult, err error) {
+	defer s.observe("undo", time.Now(), &err)
+	return s.storage.Undo(ctx, deckID, count, ifVersion)
+}
+
+// Only starting to watch is measured, not how long the watch lasts.
+func (s *InstrumentedStorage) Watch(ctx context.Context, deckID *uuid.UUID, afterVersion int64) (events <-chan storage.Event, err error) {
+	defer s.observe("watch", time.Now(), &err)
+	return s.storage.Watch(ctx, deckID, afterVersion)
+}
+
+func (s *InstrumentedStorage) Count(ctx context.Context) (count int64, err error) {
+	defer s.observe("count", time.Now(), &err)
+	return s.storage.Count(ctx)
+}
+
+// Health checks are not storage operations made by clients, so they are not recorded.
+func (s *InstrumentedStorage) Ping(ctx context.Context) error {
+	return storage.Ping(ctx, s.storage)
+}
+
+func (s *InstrumentedStorage) Close() error {
+	return s.storage.Close()
+}
+
+// Takes a pointer to the error, so it can be deferred before the operation runs.
+// Client errors, like a deck not existing, are not counted as failures.
+func (s *InstrumentedStorage) observe(operation string, start time.Time, err *error) {
+	s.metrics.storageDuration.WithLabelValues(s.backend, operation).Observe(time.Since(start).Seconds())
+	if *err != nil && !storage.IsClientError(*err) {
+		s.metrics.storageErrors.WithLabelValues(s.backend, operation).Inc()
+	}
+}
+
+// Reports the number of decks in a storage, read when the metrics are scraped,
+// so it is right even if other replicas of the server are creating decks in the same storage.
+type liveDecksCollector struct {
+	storage storage.Storage
+	desc    *prometheus.Desc
+}
+
+func (c *liveDecksCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// If the decks can't be counted, the metric is left out, instead of failing the whole scrape.
+func (c *liveDecksCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+	defer cancel()
+
+	count, err := c.storage.Count(ctx)
+	if err != nil {
+		slog.Error("Error counting decks for metrics", "error", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count))
+}
@@ -0,0 +1,250 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: decks/v1alpha/decks.proto
+
+package decksv1alpha
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	DeckService_CreateDeck_FullMethodName = "/decks.v1alpha.DeckService/CreateDeck"
+	DeckService_OpenDeck_FullMethodName   = "/decks.v1alpha.DeckService/OpenDeck"
+	DeckService_DrawCards_FullMethodName  = "/decks.v1alpha.DeckService/DrawCards"
+	DeckService_WatchDeck_FullMethodName  = "/decks.v1alpha.DeckService/WatchDeck"
+)
+
+// DeckServiceClient is the client API for DeckService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DeckServiceClient interface {
+	CreateDeck(ctx context.Context, in *CreateDeckRequest, opts ...grpc.CallOption) (*CreateDeckResponse, error)
+	OpenDeck(ctx context.Context, in *OpenDeckRequest, opts ...grpc.CallOption) (*OpenDeckResponse, error)
+	DrawCards(ctx context.Context, in *DrawCardsRequest, opts ...grpc.CallOption) (*DrawCardsResponse, error)
+	// Streams the changes made to a deck, as they happen.
+	WatchDeck(ctx context.Context, in *WatchDeckRequest, opts ...grpc.CallOption) (DeckService_WatchDeckClient, error)
+}
+
+type deckServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDeckServiceClient(cc grpc.ClientConnInterface) DeckServiceClient {
+	return &deckServiceClient{cc}
+}
+
+func (c *deckServiceClient) CreateDeck(ctx context.Context, in *CreateDeckRequest, opts ...grpc.CallOption) (*CreateDeckResponse, error) {
+	out := new(CreateDeckResponse)
+	err := c.cc.Invoke(ctx, DeckService_CreateDeck_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deckServiceClient) OpenDeck(ctx context.Context, in *OpenDeckRequest, opts ...grpc.CallOption) (*OpenDeckResponse, error) {
+	out := new(OpenDeckResponse)
+	err := c.cc.Invoke(ctx, DeckService_OpenDeck_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deckServiceClient) DrawCards(ctx context.Context, in *DrawCardsRequest, opts ...grpc.CallOption) (*DrawCardsResponse, error) {
+	out := new(DrawCardsResponse)
+	err := c.cc.Invoke(ctx, DeckService_DrawCards_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *deckServiceClient) WatchDeck(ctx context.Context, in *WatchDeckRequest, opts ...grpc.CallOption) (DeckService_WatchDeckClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DeckService_ServiceDesc.Streams[0], DeckService_WatchDeck_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &deckServiceWatchDeckClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type DeckService_WatchDeckClient interface {
+	Recv() (*WatchDeckResponse, error)
+	grpc.ClientStream
+}
+
+type deckServiceWatchDeckClient struct {
+	grpc.ClientStream
+}
+
+func (x *deckServiceWatchDeckClient) Recv() (*WatchDeckResponse, error) {
+	m := new(WatchDeckResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DeckServiceServer is the server API for DeckService service.
+// All implementations must embed UnimplementedDeckServiceServer
+// for forward compatibility
+type DeckServiceServer interface {
+	CreateDeck(context.Context, *CreateDeckRequest) (*CreateDeckResponse, error)
+	OpenDeck(context.Context, *OpenDeckRequest) (*OpenDeckResponse, error)
+	DrawCards(context.Context, *DrawCardsRequest) (*DrawCardsResponse, error)
+	// Streams the changes made to a deck, as they happen.
+	WatchDeck(*WatchDeckRequest, DeckService_WatchDeckServer) error
+	mustEmbedUnimplementedDeckServiceServer()
+}
+
+// UnimplementedDeckServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedDeckServiceServer struct {
+}
+
+func (UnimplementedDeckServiceServer) CreateDeck(context.Context, *CreateDeckRequest) (*CreateDeckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateDeck not implemented")
+}
+func (UnimplementedDeckServiceServer) OpenDeck(context.Context, *OpenDeckRequest) (*OpenDeckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OpenDeck not implemented")
+}
+func (UnimplementedDeckServiceServer) DrawCards(context.Context, *DrawCardsRequest) (*DrawCardsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DrawCards not implemented")
+}
+func (UnimplementedDeckServiceServer) WatchDeck(*WatchDeckRequest, DeckService_WatchDeckServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDeck not implemented")
+}
+func (UnimplementedDeckServiceServer) mustEmbedUnimplementedDeckServiceServer() {}
+
+// UnsafeDeckServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DeckServiceServer will
+// result in compilation errors.
+type UnsafeDeckServiceServer interface {
+	mustEmbedUnimplementedDeckServiceServer()
+}
+
+func RegisterDeckServiceServer(s grpc.ServiceRegistrar, srv DeckServiceServer) {
+	s.RegisterService(&DeckService_ServiceDesc, srv)
+}
+
+func _DeckService_CreateDeck_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateDeckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeckServiceServer).CreateDeck(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeckService_CreateDeck_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeckServiceServer).CreateDeck(ctx, req.(*CreateDeckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeckService_OpenDeck_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OpenDeckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeckServiceServer).OpenDeck(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeckService_OpenDeck_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeckServiceServer).OpenDeck(ctx, req.(*OpenDeckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeckService_DrawCards_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrawCardsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeckServiceServer).DrawCards(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DeckService_DrawCards_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeckServiceServer).DrawCards(ctx, req.(*DrawCardsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DeckService_WatchDeck_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchDeckRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DeckServiceServer).WatchDeck(m, &deckServiceWatchDeckServer{stream})
+}
+
+type DeckService_WatchDeckServer interface {
+	Send(*WatchDeckResponse) error
+	grpc.ServerStream
+}
+
+type deckServiceWatchDeckServer struct {
+	grpc.ServerStream
+}
+
+func (x *deckServiceWatchDeckServer) Send(m *WatchDeckResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// DeckService_ServiceDesc is the grpc.ServiceDesc for DeckService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DeckService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "decks.v1alpha.DeckService",
+	HandlerType: (*DeckServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateDeck",
+			Handler:    _DeckService_CreateDeck_Handler,
+		},
+		{
+			MethodName: "OpenDeck",
+			Handler:    _DeckService_OpenDeck_Handler,
+		},
+		{
+			MethodName: "DrawCards",
+			Handler:    _DeckService_DrawCards_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchDeck",
+			Handler:       _DeckService_WatchDeck_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "decks/v1alpha/decks.proto",
+}
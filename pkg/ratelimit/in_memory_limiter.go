@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// An implementation of the Limiter interface that keeps all counters in memory.
+// The limits are only enforced per server, so if multiple replicas
+// of the server are running, use the Redis implementation instead.
+type InMemoryLimiter struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	lastSweep time.Time
+	buckets   map[string]*bucket
+	quotas    map[string]*quota
+}
+
+// Buckets not used for this long are removed from memory.
+// By then, they are full again anyway, unless the limits are very strict.
+const idleBucketTTL = 10 * time.Minute
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+type quota struct {
+	window string
+	count  int
+}
+
+func NewInMemoryLimiter() *InMemoryLimiter {
+	return newInMemoryLimiterWithClock(time.Now)
+}
+
+func newInMemoryLimiterWithClock(now func() time.Time) *InMemoryLimiter {
+	return &InMemoryLimiter{
+		now:       now,
+		lastSweep: now(),
+		buckets:   map[string]*bucket{},
+		quotas:    map[string]*quota{},
+	}
+}
+
+func (l *InMemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), lastSeen: now}
+		l.buckets[key] = b
+	}
+
+	// Refill the bucket with the tokens accumulated since we last saw it.
+	elapsed := now.Sub(b.lastSeen).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.lastSeen = now
+	}
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return bucketResult(limit, b.tokens, allowed), nil
+}
+
+func (l *InMemoryLimiter) AllowQuota(ctx context.Context, key string, limit int) (*Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	window := quotaWindow(now)
+	q, ok := l.quotas[key]
+
+	// A new day started, so the quota resets.
+	if !ok || q.window != window {
+		q = &quota{window: window}
+		l.quotas[key] = q
+	}
+
+	q.count++
+	return quotaResult(limit, q.count, now), nil
+}
+
+func (l *InMemoryLimiter) RefundQuota(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Requests from a previous day were already forgotten when the quota reset.
+	q, ok := l.quotas[key]
+	if ok && q.window == quotaWindow(l.now()) && q.count > 0 {
+		q.count--
+	}
+
+	return nil
+}
+
+// Removes idle buckets and quotas from previous days,
+// so clients we don't see anymore don't keep using memory forever.
+func (l *InMemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleBucketTTL {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > idleBucketTTL {
+			delete(l.buckets, key)
+		}
+	}
+
+	window := quotaWindow(now)
+	for key, q := range l.quotas {
+		if q.window != window {
+			delete(l.quotas, key)
+		}
+	}
+
+	l.lastSweep = now
+}
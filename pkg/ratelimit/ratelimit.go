@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// A token bucket limit.
+// The bucket holds up to Burst tokens, and is refilled at Rate tokens per second.
+// Every request takes one token from the bucket, and is rejected if there is none left.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// The outcome of taking a token from a bucket, or of counting a request against a quota.
+// Besides saying if the request is allowed, it carries what is needed
+// to tell the client about its current limits.
+type Result struct {
+	Allowed bool
+
+	// The size of the bucket, or the total quota.
+	Limit int
+
+	// How many requests can still be made right now.
+	Remaining int
+
+	// How long the client should wait before trying again.
+	// Only set when the request is not allowed.
+	RetryAfter time.Duration
+
+	// How long until the bucket is full again, or until the quota resets.
+	ResetAfter time.Duration
+}
+
+// The limits of each client, shared by every API the server has, so clients can't go around them by switching APIs.
+type Config struct {
+	// Limit for creating decks, per client.
+	Create Limit
+
+	// Limit for drawing cards, per client.
+	Draw Limit
+
+	// How many decks a client can create per day. Zero means no quota.
+	DailyCreateQuota int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Create:           Limit{Rate: 5, Burst: 20},
+		Draw:             Limit{Rate: 20, Burst: 50},
+		DailyCreateQuota: 10000,
+	}
+}
+
+type Limiter interface {
+	// Takes a token from the bucket identified by key.
+	Allow(ctx context.Context, key string, limit Limit) (*Result, error)
+
+	// Counts a request against the daily quota identified by key.
+	// Quotas reset at midnight UTC.
+	AllowQuota(ctx context.Context, key string, quota int) (*Result, error)
+
+	// Gives back a request counted against the daily quota identified by key,
+	// for requests that ended up not doing what the quota limits.
+	RefundQuota(ctx context.Context, key string) error
+}
+
+// Takes a token from the bucket identified by key, and, if quota is set, counts the request against its daily quota.
+// The result is the one rejecting the request, if any, or the one from the bucket.
+// If the limits can't be checked, no result is returned, and nothing was counted against the quota.
+func AllowWithQuota(ctx context.Context, limiter Limiter, key string, limit Limit, quota int) (*Result, error) {
+	result, err := limiter.Allow(ctx, key, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.Allowed || quota <= 0 {
+		return result, nil
+	}
+
+	quotaResult, err := limiter.AllowQuota(ctx, key, quota)
+	if err != nil {
+		return nil, err
+	}
+
+	if !quotaResult.Allowed {
+		return quotaResult, nil
+	}
+
+	return result, nil
+}
+
+// Computes the result for a bucket with the given amount of tokens,
+// after a token was taken from it (or not, if there were not enough).
+func bucketResult(limit Limit, tokens float64, allowed bool) *Result {
+	result := &Result{
+		Allowed:    allowed,
+		Limit:      limit.Burst,
+		Remaining:  int(tokens),
+		ResetAfter: secondsToDuration((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / limit.Rate)
+	}
+
+	return result
+}
+
+// Computes the result for a daily quota that has been used count times.
+func quotaResult(quota, count int, now time.Time) *Result {
+	result := &Result{
+		Allowed:    count <= quota,
+		Limit:      quota,
+		Remaining:  quota - count,
+		ResetAfter: nextQuotaReset(now).Sub(now),
+	}
+
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+
+	if !result.Allowed {
+		result.RetryAfter = result.ResetAfter
+	}
+
+	return result
+}
+
+func nextQuotaReset(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+func quotaWindow(now time.Time) string {
+	return now.UTC().Format("2006-01-02")
+}
+
+// Rounds up durations sent to clients, like RetryAfter, to whole seconds,
+// so clients are never told to retry before they are allowed to.
+func CeilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
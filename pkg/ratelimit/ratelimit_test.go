@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/lucaspin/decks-api/pkg/redistest"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__Limiter(t *testing.T) {
+	runTestForAllImplementations(t, func(name string, newLimiter func(clock *fakeClock) Limiter) {
+		t.Run(fmt.Sprintf("%s - requests within burst are allowed", name), func(t *testing.T) {
+			limiter := newLimiter(newFakeClock())
+			limit := Limit{Rate: 1, Burst: 3}
+
+			for i := 2; i >= 0; i-- {
+				result, err := limiter.Allow(context.Background(), "burst", limit)
+				require.NoError(t, err)
+				require.True(t, result.Allowed)
+				require.Equal(t, 3, result.Limit)
+				require.Equal(t, i, result.Remaining)
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s - requests over burst are rejected", name), func(t *testing.T) {
+			limiter := newLimiter(newFakeClock())
+			limit := Limit{Rate: 0.5, Burst: 1}
+
+			result, err := limiter.Allow(context.Background(), "over", limit)
+			require.NoError(t, err)
+			require.True(t, result.Allowed)
+
+			result, err = limiter.Allow(context.Background(), "over", limit)
+			require.NoError(t, err)
+			require.False(t, result.Allowed)
+			require.Equal(t, 0, result.Remaining)
+			require.Equal(t, 2*time.Second, result.RetryAfter)
+		})
+
+		t.Run(fmt.Sprintf("%s - bucket is refilled over time", name), func(t *testing.T) {
+			clock := newFakeClock()
+			limiter := newLimiter(clock)
+			limit := Limit{Rate: 1, Burst: 1}
+
+			result, err := limiter.Allow(context.Background(), "refill", limit)
+			require.NoError(t, err)
+			require.True(t, result.Allowed)
+
+			result, err = limiter.Allow(context.Background(), "refill", limit)
+			require.NoError(t, err)
+			require.False(t, result.Allowed)
+
+			clock.Advance(time.Second)
+			result, err = limiter.Allow(context.Background(), "refill", limit)
+			require.NoError(t, err)
+			require.True(t, result.Allowed)
+		})
+
+		t.Run(fmt.Sprintf("%s - buckets are independent per key", name), func(t *testing.T) {
+			limiter := newLimiter(newFakeClock())
+			limit := Limit{Rate: 1, Burst: 1}
+
+			result, err := limiter.Allow(context.Background(), "client-a", limit)
+			require.NoError(t, err)
+			require.True(t, result.Allowed)
+
+			result, err = limiter.Allow(context.Background(), "client-b", limit)
+			require.NoError(t, err)
+			require.True(t, result.Allowed)
+		})
+
+		t.Run(fmt.Sprintf("%s - quota is enforced and resets on the next day", name), func(t *testing.T) {
+			clock := newFakeClock()
+			limiter := newLimiter(clock)
+
+			for i := 1; i >= 0; i-- {
+				result, err := limiter.AllowQuota(context.Background(), "quota", 2)
+				require.NoError(t, err)
+				require.True(t, result.Allowed)
+				require.Equal(t, i, result.Remaining)
+			}
+
+			result, err := limiter.AllowQuota(context.Background(), "quota", 2)
+			require.NoError(t, err)
+			require.False(t, result.Allowed)
+			require.Equal(t, 12*time.Hour, result.RetryAfter)
+
+			clock.Advance(12 * time.Hour)
+			result, err = limiter.AllowQuota(context.Background(), "quota", 2)
+			require.NoError(t, err)
+			require.True(t, result.Allowed)
+		})
+
+		t.Run(fmt.Sprintf("%s - refunded requests don't count against the quota", name), func(t *testing.T) {
+			limiter := newLimiter(newFakeClock())
+
+			result, err := limiter.AllowQuota(context.Background(), "refund", 1)
+			require.NoError(t, err)
+			require.True(t, result.Allowed)
+			require.NoError(t, limiter.RefundQuota(context.Background(), "refund"))
+
+			result, err = limiter.AllowQuota(context.Background(), "refund", 1)
+			require.NoError(t, err)
+			require.True(t, result.Allowed)
+			require.Equal(t, 0, result.Remaining)
+		})
+
+		t.Run(fmt.Sprintf("%s - refunds never go below zero", name), func(t *testing.T) {
+			limiter := newLimiter(newFakeClock())
+			require.NoError(t, limiter.RefundQuota(context.Background(), "unused"))
+			require.NoError(t, limiter.RefundQuota(context.Background(), "unused"))
+
+			result, err := limiter.AllowQuota(context.Background(), "unused", 1)
+			require.NoError(t, err)
+			require.True(t, result.Allowed)
+			require.Equal(t, 0, result.Remaining)
+		})
+	})
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+// Starts at noon, so quotas reset in exactly 12 hours.
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func runTestForAllImplementations(t *testing.T, test func(string, func(*fakeClock) Limiter)) {
+	test("in-memory", func(clock *fakeClock) Limiter {
+		return newInMemoryLimiterWithClock(clock.Now)
+	})
+
+	server := miniredis.RunT(t)
+	test("redis", func(clock *fakeClock) Limiter {
+		server.FlushAll()
+		server.SetTime(clock.Now())
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		redistest.CheckSlots(t, client)
+		limiter := NewRedisLimiter(client)
+		limiter.now = clock.Now
+		return limiter
+	})
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// An implementation of the Limiter interface that keeps all counters in Redis,
+// so the limits hold across all the replicas of the server using the same Redis.
+//
+// A bucket is a Redis hash, 'ratelimit:buckets:{key}', with two fields:
+// 'tokens' - the amount of tokens in the bucket the last time it was used.
+// 'ts'     - the time, in milliseconds, the bucket was last used.
+//
+// The bucket is refilled and a token is taken from it in a Lua script,
+// so concurrent requests from the same client can't take the same token.
+//
+// A quota is a Redis counter, 'ratelimit:quotas:{key}:{day}',
+// which expires after the day is over. Refunds only decrement counters that
+// still exist and are positive, which a Lua script checks atomically.
+type RedisLimiter struct {
+	Client redis.UniversalClient
+	now    func() time.Time
+}
+
+func NewRedisLimiter(client redis.UniversalClient) *RedisLimiter {
+	return &RedisLimiter{Client: client, now: time.Now}
+}
+
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+  tokens = burst
+  ts = now
+end
+
+if now > ts then
+  tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+  ts = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+
+-- Lua numbers are converted to integers when returned to the client,
+-- so we return the tokens as a string to keep the fractional part.
+return {allowed, tostring(tokens)}
+`)
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	now := l.now().UnixMilli()
+	reply, err := takeTokenScript.Run(ctx, l.Client, []string{bucketKey(key)}, limit.Rate, limit.Burst, now).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reply) != 2 {
+		return nil, fmt.Errorf("unexpected reply from rate limit script: %v", reply)
+	}
+
+	allowed, _ := reply[0].(int64)
+	tokensAsString, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(tokensAsString, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token count '%s' from rate limit script: %v", tokensAsString, err)
+	}
+
+	return bucketResult(limit, math.Max(tokens, 0), allowed == 1), nil
+}
+
+func (l *RedisLimiter) AllowQuota(ctx context.Context, key string, quota int) (*Result, error) {
+	now := l.now()
+	key = quotaKey(key, now)
+
+	var count *redis.IntCmd
+	_, err := l.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(ctx, key)
+
+		// We keep the key around for a little while after the day is over,
+		// to account for clock differences between the servers.
+		pipe.ExpireAt(ctx, key, nextQuotaReset(now).Add(time.Hour))
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return quotaResult(quota, int(count.Val()), now), nil
+}
+
+var refundQuotaScript = redis.NewScript(`
+local count = tonumber(redis.call('GET', KEYS[1]))
+if count == nil or count <= 0 then
+  return 0
+end
+
+return redis.call('DECR', KEYS[1])
+`)
+
+func (l *RedisLimiter) RefundQuota(ctx context.Context, key string) error {
+	return refundQuotaScript.Run(ctx, l.Client, []string{quotaKey(key, l.now())}).Err()
+}
+
+func quotaKey(key string, now time.Time) string {
+	return fmt.Sprintf("ratelimit:quotas:%s:%s", key, quotaWindow(now))
+}
+
+func bucketKey(key string) string {
+	return fmt.Sprintf("ratelimit:buckets:%s", key)
+}
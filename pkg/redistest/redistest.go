@@ -0,0 +1,147 @@
+package redistest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const slotCount = 16384
+
+// The slot of a key in Redis Cluster, from its hash tag, if it has one, or from the whole key.
+// miniredis acts as a cluster with a single node, with all the slots,
+// so it accepts keys from different slots in the same command, and this is used to check them instead.
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16([]byte(key)) % slotCount)
+}
+
+// CRC16-CCITT (XMODEM), the one Redis Cluster uses.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// Fails the test when a command, script or transaction sent through the client uses keys from more than one slot.
+// Redis Cluster rejects those commands and scripts with CROSSSLOT,
+// and splits those transactions into one for each slot, so they are not atomic anymore.
+func CheckSlots(t testing.TB, client redis.UniversalClient) {
+	client.AddHook(&slotChecker{t: t})
+}
+
+type slotChecker struct {
+	t testing.TB
+}
+
+func (c *slotChecker) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	c.check(cmd.Name(), commandKeys(cmd))
+	return ctx, nil
+}
+
+func (c *slotChecker) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+// Commands in a pipeline are sent separately, unless they are in a transaction, between a MULTI and an EXEC.
+func (c *slotChecker) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	if len(cmds) == 0 || strings.ToLower(cmds[0].Name()) != "multi" {
+		for _, cmd := range cmds {
+			c.check(cmd.Name(), commandKeys(cmd))
+		}
+
+		return ctx, nil
+	}
+
+	keys := []string{}
+	names := []string{}
+	for _, cmd := range cmds {
+		keys = append(keys, commandKeys(cmd)...)
+		names = append(names, cmd.Name())
+	}
+
+	c.check("transaction with "+strings.Join(names, ", "), keys)
+	return ctx, nil
+}
+
+func (c *slotChecker) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func (c *slotChecker) check(description string, keys []string) {
+	if len(keys) < 2 {
+		return
+	}
+
+	slot := Slot(keys[0])
+	for _, key := range keys[1:] {
+		if Slot(key) != slot {
+			c.t.Errorf("keys of %s are in different slots: %q is in %d, %q is in %d", description, keys[0], slot, key, Slot(key))
+			return
+		}
+	}
+}
+
+// The keys of the commands used by the Redis implementations in this repository.
+// Commands not listed here have their key, if any, as their first argument.
+func commandKeys(cmd redis.Cmder) []string {
+	args := cmd.Args()
+	switch strings.ToLower(cmd.Name()) {
+	case "multi", "exec", "discard", "unwatch", "ping", "publish", "script", "scan", "cluster", "hello", "select", "auth", "client", "info":
+		return nil
+	case "eval", "evalsha":
+		if len(args) < 3 {
+			return nil
+		}
+
+		count, err := strconv.Atoi(fmt.Sprint(args[2]))
+		if err != nil || len(args) < 3+count {
+			return nil
+		}
+
+		return stringArgs(args[3 : 3+count])
+	case "del", "unlink", "exists", "touch", "mget", "watch":
+		return stringArgs(args[1:])
+	case "mset", "msetnx":
+		keys := []string{}
+		for i := 1; i < len(args); i += 2 {
+			keys = append(keys, fmt.Sprint(args[i]))
+		}
+
+		return keys
+	default:
+		if len(args) < 2 {
+			return nil
+		}
+
+		return []string{fmt.Sprint(args[1])}
+	}
+}
+
+func stringArgs(args []interface{}) []string {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = fmt.Sprint(arg)
+	}
+
+	return keys
+}
@@ -0,0 +1,27 @@
+package redistest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test__Slot(t *testing.T) {
+	t.Run("keys without hash tags -> slot of the whole key", func(t *testing.T) {
+		// From the Redis Cluster specification, and CLUSTER KEYSLOT.
+		require.Equal(t, 12739, Slot("123456789"))
+		require.Equal(t, 12182, Slot("foo"))
+	})
+
+	t.Run("keys with hash tags -> slot of the tag", func(t *testing.T) {
+		require.Equal(t, Slot("user1000"), Slot("{user1000}.following"))
+		require.Equal(t, Slot("{user1000}.following"), Slot("{user1000}.followers"))
+		require.Equal(t, Slot("bar"), Slot("foo{bar}{zap}"))
+		require.Equal(t, Slot("{bar"), Slot("foo{{bar}}zap"))
+	})
+
+	t.Run("empty hash tags -> slot of the whole key", func(t *testing.T) {
+		require.NotEqual(t, Slot("foo{}{bar}"), Slot("bar"))
+		require.Equal(t, int(crc16([]byte("foo{}{bar}"))%slotCount), Slot("foo{}{bar}"))
+	})
+}
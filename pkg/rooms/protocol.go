@@ -0,0 +1,157 @@
+package rooms
+
+import (
+	"github.com/lucaspin/decks-api/pkg/cards"
+)
+
+// The commands players can send to a room.
+const (
+	CommandJoin    = "join"
+	CommandDraw    = "draw"
+	CommandDeal    = "deal"
+	CommandShuffle = "shuffle"
+	CommandPass    = "pass"
+	CommandChat    = "chat"
+)
+
+// The messages a room sends to players.
+const (
+	MessageWelcome = "welcome"
+	MessageDiff    = "diff"
+	MessageChat    = "chat"
+	MessageError   = "error"
+)
+
+// The kinds of changes a diff can carry.
+const (
+	ChangePlayerJoined       = "player_joined"
+	ChangePlayerConnected    = "player_connected"
+	ChangePlayerDisconnected = "player_disconnected"
+	ChangeHand               = "hand"
+	ChangeDeck               = "deck"
+)
+
+// A command sent by a player. Which fields are used depends on the type:
+// - join:    name, to join as a new player, or resume_token, to rejoin as an existing one.
+// - draw:    count, how many cards to draw from the deck into the player's hand. Default: 1.
+// - deal:    count, how many cards to deal to each player in the room. Default: 1.
+// - shuffle: no fields, shuffles the cards remaining in the deck.
+// - pass:    card, the code of a card in the player's hand, and to, the ID of the player to pass it to.
+// - chat:    text, sent to everyone in the room.
+//
+// If a request_id is given, it is included in the error sent back if the command fails.
+type Command struct {
+	RequestID   string `json:"request_id,omitempty"`
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	ResumeToken string `json:"resume_token,omitempty"`
+	Count       int    `json:"count,omitempty"`
+	Card        string `json:"card,omitempty"`
+	To          string `json:"to,omitempty"`
+	Text        string `json:"text,omitempty"`
+}
+
+// A message sent to a player. Which fields are set depends on the type:
+// - welcome: player_id, resume_token and state, sent after joining or rejoining.
+// - diff:    seq and changes, sent to everyone after the room changes.
+// - chat:    from and text.
+// - error:   request_id and error, sent only to the player whose command failed.
+type Message struct {
+	Type        string    `json:"type"`
+	RequestID   string    `json:"request_id,omitempty"`
+	PlayerID    string    `json:"player_id,omitempty"`
+	ResumeToken string    `json:"resume_token,omitempty"`
+	State       *Snapshot `json:"state,omitempty"`
+	Seq         int64     `json:"seq,omitempty"`
+	Changes     []Change  `json:"changes,omitempty"`
+	From        string    `json:"from,omitempty"`
+	Text        string    `json:"text,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// The whole state of a room, as seen by one of its players.
+// The seq is the one of the last diff applied to it, so following diffs can be applied on top.
+type Snapshot struct {
+	Room    string       `json:"room"`
+	DeckID  string       `json:"deck_id"`
+	Seq     int64        `json:"seq"`
+	Deck    DeckView     `json:"deck"`
+	Players []PlayerView `json:"players"`
+}
+
+type DeckView struct {
+	Remaining int  `json:"remaining"`
+	Shuffled  bool `json:"shuffled"`
+}
+
+// A player, as seen by another player.
+// Only players see the cards in their own hands. For everyone else, only the hand size is visible.
+type PlayerView struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Connected bool     `json:"connected"`
+	HandSize  int      `json:"hand_size"`
+	Hand      []string `json:"hand,omitempty"`
+}
+
+// A single change to a room. Which fields are set depends on the kind:
+// - player_joined:       player.
+// - player_connected:    player_id.
+// - player_disconnected: player_id.
+// - hand:                player_id, hand_size, and the cards added to and removed from the hand.
+// - deck:                deck.
+//
+// Only the players holding a hand see which cards were added to it or removed from it.
+// Everyone else only sees how many.
+type Change struct {
+	Kind         string      `json:"kind"`
+	PlayerID     string      `json:"player_id,omitempty"`
+	Player       *PlayerView `json:"player,omitempty"`
+	Added        []string    `json:"added,omitempty"`
+	Removed      []string    `json:"removed,omitempty"`
+	AddedCount   int         `json:"added_count,omitempty"`
+	RemovedCount int         `json:"removed_count,omitempty"`
+	HandSize     *int        `json:"hand_size,omitempty"`
+	Deck         *DeckView   `json:"deck,omitempty"`
+}
+
+// A change, with everything in it, before deciding what each player can see of it.
+type change struct {
+	kind    string
+	player  *Player
+	added   []cards.Card
+	removed []cards.Card
+	deck    *DeckView
+}
+
+func (c *change) viewFor(viewer *Player) Change {
+	switch c.kind {
+	case ChangePlayerJoined:
+		view := c.player.viewFor(viewer)
+		return Change{Kind: c.kind, Player: &view}
+
+	case ChangeHand:
+		handSize := len(c.player.hand)
+		view := Change{
+			Kind:         c.kind,
+			PlayerID:     c.player.ID,
+			AddedCount:   len(c.added),
+			RemovedCount: len(c.removed),
+			HandSize:     &handSize,
+		}
+
+		if viewer == c.player {
+			view.Added = cards.CardListToCodes(c.added)
+			view.Removed = cards.CardListToCodes(c.removed)
+		}
+
+		return view
+
+	case ChangeDeck:
+		deck := *c.deck
+		return Change{Kind: c.kind, Deck: &deck}
+
+	default:
+		return Change{Kind: c.kind, PlayerID: c.player.ID}
+	}
+}
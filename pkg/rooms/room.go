@@ -0,0 +1,616 @@
+package rooms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/logging"
+	"github.com/lucaspin/decks-api/pkg/storage"
+)
+
+const (
+	maxNameLength = 64
+	maxChatLength = 1024
+)
+
+// How long a room is kept around after everyone disconnects,
+// so players can still resume their sessions if they lose their connection.
+const DefaultIdleTimeout = 5 * time.Minute
+
+var (
+	ErrNotJoined          = errors.New("join the room first")
+	ErrAlreadyJoined      = errors.New("already joined the room")
+	ErrInvalidName        = fmt.Errorf("name must have between 1 and %d characters", maxNameLength)
+	ErrInvalidResumeToken = errors.New("invalid resume token")
+	ErrInvalidCount       = errors.New("count must be a positive number")
+	ErrInvalidCard        = errors.New("invalid card")
+	ErrCardNotInHand      = errors.New("card is not in hand")
+	ErrPlayerNotFound     = errors.New("player not found")
+	ErrInvalidChat        = fmt.Errorf("text must have between 1 and %d characters", maxChatLength)
+	ErrUnknownCommand     = errors.New("unknown command")
+	ErrRateLimited        = errors.New("rate limit exceeded")
+)
+
+// Rooms create decks and draw cards from them, like the API does,
+// so they are subject to the same limits.
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionDraw   Action = "draw"
+)
+
+// Checks whether the player behind the context, the one of its connection, can take an action.
+// An error stops the action, and is sent back to the player if it is ErrRateLimited.
+type LimitFunc func(ctx context.Context, action Action) error
+
+// Gives back what a LimitFunc took for an action that was allowed, but then failed.
+type RefundFunc func(ctx context.Context, action Action)
+
+// The connection a player uses to talk to a room.
+// Send must not block: clients that can't keep up should drop the connection,
+// and resume their session once they reconnect.
+type Client interface {
+	Send(message *Message)
+	Close()
+}
+
+type Player struct {
+	ID          string
+	Name        string
+	resumeToken string
+	hand        []cards.Card
+	client      Client
+}
+
+func (p *Player) viewFor(viewer *Player) PlayerView {
+	view := PlayerView{
+		ID:        p.ID,
+		Name:      p.Name,
+		Connected: p.client != nil,
+		HandSize:  len(p.hand),
+	}
+
+	if viewer == p {
+		view.Hand = cards.CardListToCodes(p.hand)
+	}
+
+	return view
+}
+
+// A room is a group of players sharing a deck.
+// The deck lives in storage, like any other deck, but the players' hands live only in the room.
+type Room struct {
+	name   string
+	hub    *Hub
+	mu     sync.Mutex
+	deckID *uuid.UUID
+	deck   DeckView
+	seq    int64
+
+	// Players are kept in the order they joined, which is also the order cards are dealt in.
+	players []*Player
+
+	// Rooms with no connected players are removed after a while.
+	idleTimer *time.Timer
+	closed    bool
+}
+
+// Rooms are created when the first player joins them,
+// and removed once nobody is connected to them for a while.
+// They only live in the memory of this process, so, with multiple replicas,
+// every player of a room has to be routed to the same one.
+type Hub struct {
+	storage     storage.Storage
+	generator   *cards.CardGenerator
+	limit       LimitFunc
+	refund      RefundFunc
+	idleTimeout time.Duration
+	mu          sync.Mutex
+	rooms       map[string]*Room
+}
+
+type HubOption func(*Hub)
+
+// Without it, rooms are not limited.
+func WithLimit(limit LimitFunc, refund RefundFunc) HubOption {
+	return func(h *Hub) {
+		h.limit = limit
+		h.refund = refund
+	}
+}
+
+func NewHub(storage storage.Storage, generator *cards.CardGenerator, options ...HubOption) *Hub {
+	hub := &Hub{
+		storage:     storage,
+		generator:   generator,
+		limit:       func(context.Context, Action) error { return nil },
+		refund:      func(context.Context, Action) {},
+		idleTimeout: DefaultIdleTimeout,
+		rooms:       map[string]*Room{},
+	}
+
+	for _, option := range options {
+		option(hub)
+	}
+
+	return hub
+}
+
+// The connection of a player to a room.
+type Session struct {
+	room   *Room
+	player *Player
+	client Client
+}
+
+// Joins a room with a join command, either as a new player, or resuming the session of an existing one.
+// If the player being resumed is still connected somewhere else, that older connection is closed.
+// The client gets a welcome message with the state of the room, and everyone else gets a diff.
+func (h *Hub) Join(ctx context.Context, name string, command *Command, client Client) (*Session, error) {
+	if command.Type != CommandJoin {
+		return nil, ErrNotJoined
+	}
+
+	for {
+		room := h.room(name)
+		room.mu.Lock()
+
+		// The room might have been removed between us finding it and locking it.
+		if room.closed {
+			room.mu.Unlock()
+			continue
+		}
+
+		session, err := room.join(ctx, command, client)
+
+		// Nobody might have ever joined the room, if this was the first try.
+		if err != nil && room.connected() == 0 {
+			room.startIdleTimer()
+		}
+
+		room.mu.Unlock()
+		return session, err
+	}
+}
+
+func (h *Hub) room(name string) *Room {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room, ok := h.rooms[name]
+	if !ok {
+		room = &Room{name: name, hub: h}
+		h.rooms[name] = room
+	}
+
+	return room
+}
+
+func (h *Hub) removeIfIdle(room *Room) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+
+	if room.closed || room.connected() > 0 {
+		return
+	}
+
+	room.closed = true
+	if h.rooms[room.name] == room {
+		delete(h.rooms, room.name)
+	}
+}
+
+func (r *Room) join(ctx context.Context, command *Command, client Client) (*Session, error) {
+	if command.ResumeToken != "" {
+		return r.resume(command.ResumeToken, client)
+	}
+
+	if len(command.Name) == 0 || len(command.Name) > maxNameLength {
+		return nil, ErrInvalidName
+	}
+
+	// Rooms get a full shuffled deck the first time someone joins them.
+	if r.deckID == nil {
+		if err := r.hub.limit(ctx, ActionCreate); err != nil {
+			return nil, err
+		}
+
+		deck, err := r.hub.storage.Create(ctx, r.hub.generator.Shuffle(r.hub.generator.FullCardList()), storage.CreateOptions{
+			Shuffled: true,
+			Owner:    "room:" + r.name,
+			Type:     storage.DeckTypeFull,
+		})
+		if err != nil {
+			r.hub.refund(ctx, ActionCreate)
+			return nil, err
+		}
+
+		r.deckID = deck.DeckID
+		r.deck = DeckView{Remaining: len(deck.Cards), Shuffled: deck.Shuffled}
+	}
+
+	token, err := newResumeToken()
+	if err != nil {
+		return nil, err
+	}
+
+	player := &Player{
+		ID:          uuid.New().String(),
+		Name:        command.Name,
+		resumeToken: token,
+		hand:        []cards.Card{},
+		client:      client,
+	}
+
+	r.players = append(r.players, player)
+	r.stopIdleTimer()
+	r.broadcastExcept(player, &change{kind: ChangePlayerJoined, player: player})
+	r.welcome(player)
+
+	return &Session{room: r, player: player, client: client}, nil
+}
+
+func (r *Room) resume(token string, client Client) (*Session, error) {
+	player := r.playerWithToken(token)
+	if player == nil {
+		return nil, ErrInvalidResumeToken
+	}
+
+	if player.client != nil {
+		player.client.Close()
+	}
+
+	player.client = client
+	r.stopIdleTimer()
+	r.broadcastExcept(player, &change{kind: ChangePlayerConnected, player: player})
+	r.welcome(player)
+
+	return &Session{room: r, player: player, client: client}, nil
+}
+
+func (r *Room) welcome(player *Player) {
+	player.client.Send(&Message{
+		Type:        MessageWelcome,
+		PlayerID:    player.ID,
+		ResumeToken: player.resumeToken,
+		State:       r.snapshotFor(player),
+	})
+}
+
+// Handles a command sent by the player after joining.
+// Commands that fail only get an error back to the player who sent them.
+func (s *Session) Handle(ctx context.Context, command *Command) {
+	r := s.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// This session was replaced by a newer one.
+	if s.player.client != s.client {
+		return
+	}
+
+	if err := r.handle(ctx, s.player, command); err != nil {
+		s.client.Send(ErrorMessage(ctx, command, err, "room", r.name))
+	}
+}
+
+// The error message sent back to the player for a command that failed.
+// Errors not caused by the command itself, like storage errors, are logged,
+// and only an unknown error is sent, so their details don't reach players.
+func ErrorMessage(ctx context.Context, command *Command, err error, attrs ...any) *Message {
+	if !isCommandError(err) {
+		logging.FromContext(ctx).Error("Error handling command", append(attrs, "command", command.Type, "error", err)...)
+		err = errors.New("unknown error")
+	}
+
+	return &Message{Type: MessageError, RequestID: command.RequestID, Error: err.Error()}
+}
+
+// Disconnects the player from the room.
+// The player is kept in the room, so the session can be resumed later.
+func (s *Session) Leave() {
+	r := s.room
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s.player.client != s.client {
+		return
+	}
+
+	s.player.client = nil
+	r.broadcast(&change{kind: ChangePlayerDisconnected, player: s.player})
+
+	if r.connected() == 0 {
+		r.startIdleTimer()
+	}
+}
+
+func (s *Session) PlayerID() string {
+	return s.player.ID
+}
+
+func (r *Room) handle(ctx context.Context, player *Player, command *Command) error {
+	switch command.Type {
+	case CommandJoin:
+		return ErrAlreadyJoined
+	case CommandDraw:
+		return r.draw(ctx, player, command.Count)
+	case CommandDeal:
+		return r.deal(ctx, command.Count)
+	case CommandShuffle:
+		return r.shuffle(ctx)
+	case CommandPass:
+		return r.pass(player, command.Card, command.To)
+	case CommandChat:
+		return r.chat(player, command.Text)
+	default:
+		return ErrUnknownCommand
+	}
+}
+
+func (r *Room) draw(ctx context.Context, player *Player, count int) error {
+	count, err := countOrDefault(count)
+	if err != nil {
+		return err
+	}
+
+	if err := r.hub.limit(ctx, ActionDraw); err != nil {
+		return err
+	}
+
+	result, err := r.hub.storage.Draw(ctx, r.deckID, count, storage.AnyVersion)
+	if err != nil {
+		return err
+	}
+
+	player.hand = append(player.hand, result.Cards...)
+	r.deck.Remaining = result.Remaining
+	r.broadcast(
+		&change{kind: ChangeHand, player: player, added: result.Cards},
+		&change{kind: ChangeDeck, deck: &r.deck},
+	)
+
+	return nil
+}
+
+// Deals count cards to each connected player, one card at a time, in the order they joined.
+// If the deck runs out, the last players get fewer cards.
+func (r *Room) deal(ctx context.Context, count int) error {
+	count, err := countOrDefault(count)
+	if err != nil {
+		return err
+	}
+
+	players := []*Player{}
+	for _, player := range r.players {
+		if player.client != nil {
+			players = append(players, player)
+		}
+	}
+
+	if err := r.hub.limit(ctx, ActionDraw); err != nil {
+		return err
+	}
+
+	result, err := r.hub.storage.Draw(ctx, r.deckID, count*len(players), storage.AnyVersion)
+	if err != nil {
+		return err
+	}
+
+	dealt := make([][]cards.Card, len(players))
+	for i, card := range result.Cards {
+		dealt[i%len(players)] = append(dealt[i%len(players)], card)
+	}
+
+	changes := []*change{}
+	for i, player := range players {
+		if len(dealt[i]) == 0 {
+			continue
+		}
+
+		player.hand = append(player.hand, dealt[i]...)
+		changes = append(changes, &change{kind: ChangeHand, player: player, added: dealt[i]})
+	}
+
+	r.deck.Remaining = result.Remaining
+	r.broadcast(append(changes, &change{kind: ChangeDeck, deck: &r.deck})...)
+	return nil
+}
+
+func (r *Room) shuffle(ctx context.Context) error {
+	deck, err := r.hub.storage.Shuffle(ctx, r.deckID, r.hub.generator.Shuffle, storage.AnyVersion)
+	if err != nil {
+		return err
+	}
+
+	r.deck = DeckView{Remaining: len(deck.Cards), Shuffled: deck.Shuffled}
+	r.broadcast(&change{kind: ChangeDeck, deck: &r.deck})
+	return nil
+}
+
+func (r *Room) pass(player *Player, code, to string) error {
+	if code == "" {
+		return ErrInvalidCard
+	}
+
+	card, err := cards.NewCardFromCode(code)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCard, err)
+	}
+
+	target := r.playerWithID(to)
+	if target == nil {
+		return ErrPlayerNotFound
+	}
+
+	index := -1
+	for i, c := range player.hand {
+		if c == *card {
+			index = i
+			break
+		}
+	}
+
+	if index == -1 {
+		return ErrCardNotInHand
+	}
+
+	player.hand = append(player.hand[:index:index], player.hand[index+1:]...)
+	target.hand = append(target.hand, *card)
+	r.broadcast(
+		&change{kind: ChangeHand, player: player, removed: []cards.Card{*card}},
+		&change{kind: ChangeHand, player: target, added: []cards.Card{*card}},
+	)
+
+	return nil
+}
+
+func (r *Room) chat(player *Player, text string) error {
+	if len(text) == 0 || len(text) > maxChatLength {
+		return ErrInvalidChat
+	}
+
+	for _, p := range r.players {
+		if p.client != nil {
+			p.client.Send(&Message{Type: MessageChat, From: player.ID, Text: text})
+		}
+	}
+
+	return nil
+}
+
+// Sends a diff with the changes to every connected player,
+// each one seeing only what they are allowed to see.
+func (r *Room) broadcast(changes ...*change) {
+	r.broadcastExcept(nil, changes...)
+}
+
+// Players joining get a snapshot that already includes the changes, instead of a diff.
+func (r *Room) broadcastExcept(except *Player, changes ...*change) {
+	r.seq++
+	for _, viewer := range r.players {
+		if viewer.client == nil || viewer == except {
+			continue
+		}
+
+		views := make([]Change, len(changes))
+		for i, c := range changes {
+			views[i] = c.viewFor(viewer)
+		}
+
+		viewer.client.Send(&Message{Type: MessageDiff, Seq: r.seq, Changes: views})
+	}
+}
+
+func (r *Room) snapshotFor(viewer *Player) *Snapshot {
+	players := make([]PlayerView, len(r.players))
+	for i, player := range r.players {
+		players[i] = player.viewFor(viewer)
+	}
+
+	return &Snapshot{
+		Room:    r.name,
+		DeckID:  r.deckID.String(),
+		Seq:     r.seq,
+		Deck:    r.deck,
+		Players: players,
+	}
+}
+
+func (r *Room) connected() int {
+	count := 0
+	for _, player := range r.players {
+		if player.client != nil {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (r *Room) startIdleTimer() {
+	r.stopIdleTimer()
+	r.idleTimer = time.AfterFunc(r.hub.idleTimeout, func() {
+		r.hub.removeIfIdle(r)
+	})
+}
+
+func (r *Room) stopIdleTimer() {
+	if r.idleTimer != nil {
+		r.idleTimer.Stop()
+		r.idleTimer = nil
+	}
+}
+
+func (r *Room) playerWithID(ID string) *Player {
+	for _, player := range r.players {
+		if player.ID == ID {
+			return player
+		}
+	}
+
+	return nil
+}
+
+func (r *Room) playerWithToken(token string) *Player {
+	for _, player := range r.players {
+		if player.resumeToken == token {
+			return player
+		}
+	}
+
+	return nil
+}
+
+func countOrDefault(count int) (int, error) {
+	if count < 0 {
+		return 0, ErrInvalidCount
+	}
+
+	if count == 0 {
+		return 1, nil
+	}
+
+	return count, nil
+}
+
+// Errors caused by the command itself, which are safe to send back to the player.
+func isCommandError(err error) bool {
+	switch {
+	case errors.Is(err, storage.ErrEmptyDeck),
+		errors.Is(err, ErrNotJoined),
+		errors.Is(err, ErrAlreadyJoined),
+		errors.Is(err, ErrInvalidName),
+		errors.Is(err, ErrInvalidResumeToken),
+		errors.Is(err, ErrInvalidCount),
+		errors.Is(err, ErrInvalidCard),
+		errors.Is(err, ErrCardNotInHand),
+		errors.Is(err, ErrPlayerNotFound),
+		errors.Is(err, ErrInvalidChat),
+		errors.Is(err, ErrUnknownCommand),
+		errors.Is(err, ErrRateLimited):
+		return true
+	default:
+		return false
+	}
+}
+
+func newResumeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,420 @@
+package rooms
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__Join(t *testing.T) {
+	hub := NewHub(storage.NewInMemoryStorage(), cards.NewCardGenerator())
+
+	t.Run("first command must be a join", func(t *testing.T) {
+		_, err := hub.Join(context.Background(), "room", &Command{Type: CommandDraw}, &fakeClient{})
+		require.ErrorIs(t, err, ErrNotJoined)
+	})
+
+	t.Run("name is required", func(t *testing.T) {
+		_, err := hub.Join(context.Background(), "room", &Command{Type: CommandJoin}, &fakeClient{})
+		require.ErrorIs(t, err, ErrInvalidName)
+	})
+
+	t.Run("storage errors are not sent to the player", func(t *testing.T) {
+		hub := NewHub(&failingCreateStorage{Storage: storage.NewInMemoryStorage()}, cards.NewCardGenerator())
+		command := &Command{Type: CommandJoin, Name: "alice", RequestID: "1"}
+		_, err := hub.Join(context.Background(), "failing", command, &fakeClient{})
+		require.ErrorIs(t, err, errCreateFailed)
+
+		message := ErrorMessage(context.Background(), command, err)
+		require.Equal(t, MessageError, message.Type)
+		require.Equal(t, "1", message.RequestID)
+		require.Equal(t, "unknown error", message.Error)
+
+		// errors caused by the command are
+		require.Equal(t, ErrInvalidName.Error(), ErrorMessage(context.Background(), command, ErrInvalidName).Error)
+	})
+
+	t.Run("first player gets a full shuffled deck", func(t *testing.T) {
+		client := &fakeClient{}
+		session, err := hub.Join(context.Background(), "first", &Command{Type: CommandJoin, Name: "alice"}, client)
+		require.NoError(t, err)
+
+		welcome := client.last()
+		require.Equal(t, MessageWelcome, welcome.Type)
+		require.Equal(t, session.PlayerID(), welcome.PlayerID)
+		require.NotEmpty(t, welcome.ResumeToken)
+		require.Equal(t, "first", welcome.State.Room)
+		require.Equal(t, DeckView{Remaining: 52, Shuffled: true}, welcome.State.Deck)
+		require.Len(t, welcome.State.Players, 1)
+
+		deckID := uuid.MustParse(welcome.State.DeckID)
+		deck, err := hub.storage.Get(context.Background(), &deckID)
+		require.NoError(t, err)
+		require.Len(t, deck.Cards, 52)
+	})
+
+	t.Run("other players are told about new players", func(t *testing.T) {
+		alice, bob := &fakeClient{}, &fakeClient{}
+		aliceSession := join(t, hub, "others", "alice", alice)
+		bobSession := join(t, hub, "others", "bob", bob)
+
+		diff := alice.last()
+		require.Equal(t, MessageDiff, diff.Type)
+		require.Equal(t, []Change{{
+			Kind:   ChangePlayerJoined,
+			Player: &PlayerView{ID: bobSession.PlayerID(), Name: "bob", Connected: true},
+		}}, diff.Changes)
+
+		welcome := bob.last()
+		require.Equal(t, MessageWelcome, welcome.Type)
+		require.Equal(t, diff.Seq, welcome.State.Seq)
+		require.Equal(t, []string{aliceSession.PlayerID(), bobSession.PlayerID()}, playerIDs(welcome.State))
+	})
+}
+
+func Test__Resume(t *testing.T) {
+	hub := NewHub(storage.NewInMemoryStorage(), cards.NewCardGenerator())
+
+	t.Run("invalid resume token", func(t *testing.T) {
+		join(t, hub, "invalid-token", "alice", &fakeClient{})
+		_, err := hub.Join(context.Background(), "invalid-token", &Command{Type: CommandJoin, ResumeToken: "nope"}, &fakeClient{})
+		require.ErrorIs(t, err, ErrInvalidResumeToken)
+	})
+
+	t.Run("player gets the same hand back after reconnecting", func(t *testing.T) {
+		alice, bob := &fakeClient{}, &fakeClient{}
+		aliceSession := join(t, hub, "reconnect", "alice", alice)
+		join(t, hub, "reconnect", "bob", bob)
+		token := alice.welcome().ResumeToken
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandDraw, Count: 3})
+		hand := alice.last().Changes[0].Added
+		require.Len(t, hand, 3)
+
+		aliceSession.Leave()
+		require.Equal(t, ChangePlayerDisconnected, bob.last().Changes[0].Kind)
+
+		reconnected := &fakeClient{}
+		session, err := hub.Join(context.Background(), "reconnect", &Command{Type: CommandJoin, ResumeToken: token}, reconnected)
+		require.NoError(t, err)
+		require.Equal(t, aliceSession.PlayerID(), session.PlayerID())
+		require.Equal(t, ChangePlayerConnected, bob.last().Changes[0].Kind)
+
+		welcome := reconnected.last()
+		require.Equal(t, MessageWelcome, welcome.Type)
+		require.Equal(t, token, welcome.ResumeToken)
+		require.Equal(t, hand, welcome.State.Players[0].Hand)
+		require.Equal(t, 49, welcome.State.Deck.Remaining)
+	})
+
+	t.Run("resuming closes the older connection", func(t *testing.T) {
+		old := &fakeClient{}
+		oldSession := join(t, hub, "replace", "alice", old)
+
+		newer := &fakeClient{}
+		_, err := hub.Join(context.Background(), "replace", &Command{Type: CommandJoin, ResumeToken: old.welcome().ResumeToken}, newer)
+		require.NoError(t, err)
+		require.True(t, old.isClosed())
+
+		// the old session can't do anything anymore
+		sent := len(newer.all())
+		oldSession.Handle(context.Background(), &Command{Type: CommandDraw})
+		oldSession.Leave()
+		require.Len(t, newer.all(), sent)
+	})
+
+	t.Run("rooms nobody is connected to are removed after a while", func(t *testing.T) {
+		hub := NewHub(storage.NewInMemoryStorage(), cards.NewCardGenerator())
+		hub.idleTimeout = 10 * time.Millisecond
+
+		client := &fakeClient{}
+		session := join(t, hub, "idle", "alice", client)
+		session.Leave()
+
+		require.Eventually(t, func() bool {
+			hub.mu.Lock()
+			defer hub.mu.Unlock()
+			return len(hub.rooms) == 0
+		}, time.Second, 10*time.Millisecond)
+
+		_, err := hub.Join(context.Background(), "idle", &Command{Type: CommandJoin, ResumeToken: client.welcome().ResumeToken}, &fakeClient{})
+		require.ErrorIs(t, err, ErrInvalidResumeToken)
+	})
+}
+
+func Test__Commands(t *testing.T) {
+	hub := NewHub(storage.NewInMemoryStorage(), cards.NewCardGenerator())
+
+	t.Run("draw shows cards only to the player drawing them", func(t *testing.T) {
+		alice, bob := &fakeClient{}, &fakeClient{}
+		aliceSession := join(t, hub, "draw", "alice", alice)
+		join(t, hub, "draw", "bob", bob)
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandDraw, Count: 2})
+
+		forAlice := alice.last()
+		require.Equal(t, MessageDiff, forAlice.Type)
+		require.Len(t, forAlice.Changes, 2)
+		require.Len(t, forAlice.Changes[0].Added, 2)
+		require.Equal(t, 2, *forAlice.Changes[0].HandSize)
+		require.Equal(t, &DeckView{Remaining: 50, Shuffled: true}, forAlice.Changes[1].Deck)
+
+		forBob := bob.last()
+		require.Equal(t, forAlice.Seq, forBob.Seq)
+		require.Empty(t, forBob.Changes[0].Added)
+		require.Equal(t, 2, forBob.Changes[0].AddedCount)
+		require.Equal(t, 2, *forBob.Changes[0].HandSize)
+		require.Equal(t, forAlice.Changes[1], forBob.Changes[1])
+	})
+
+	t.Run("snapshot hides other players' hands", func(t *testing.T) {
+		alice := &fakeClient{}
+		aliceSession := join(t, hub, "snapshot", "alice", alice)
+		aliceSession.Handle(context.Background(), &Command{Type: CommandDraw, Count: 5})
+
+		bob := &fakeClient{}
+		join(t, hub, "snapshot", "bob", bob)
+		players := bob.welcome().State.Players
+		require.Equal(t, 5, players[0].HandSize)
+		require.Empty(t, players[0].Hand)
+		require.Equal(t, []string{}, players[1].Hand)
+	})
+
+	t.Run("draw from empty deck", func(t *testing.T) {
+		client := &fakeClient{}
+		session := join(t, hub, "empty", "alice", client)
+		session.Handle(context.Background(), &Command{Type: CommandDraw, Count: 52})
+		session.Handle(context.Background(), &Command{RequestID: "1", Type: CommandDraw})
+		require.Equal(t, &Message{Type: MessageError, RequestID: "1", Error: storage.ErrEmptyDeck.Error()}, client.last())
+	})
+
+	t.Run("deal gives cards to every connected player", func(t *testing.T) {
+		alice, bob, carol := &fakeClient{}, &fakeClient{}, &fakeClient{}
+		aliceSession := join(t, hub, "deal", "alice", alice)
+		join(t, hub, "deal", "bob", bob)
+		join(t, hub, "deal", "carol", carol).Leave()
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandDeal, Count: 3})
+		changes := alice.last().Changes
+		require.Len(t, changes, 3)
+		require.Len(t, changes[0].Added, 3)
+		require.Empty(t, changes[1].Added)
+		require.Equal(t, 3, changes[1].AddedCount)
+		require.Equal(t, 46, changes[2].Deck.Remaining)
+		require.Len(t, bob.last().Changes[1].Added, 3)
+	})
+
+	t.Run("shuffle", func(t *testing.T) {
+		client := &fakeClient{}
+		session := join(t, hub, "shuffle", "alice", client)
+		session.Handle(context.Background(), &Command{Type: CommandDraw, Count: 10})
+		session.Handle(context.Background(), &Command{Type: CommandShuffle})
+		require.Equal(t, []Change{{Kind: ChangeDeck, Deck: &DeckView{Remaining: 42, Shuffled: true}}}, client.last().Changes)
+
+		deckID := uuid.MustParse(client.welcome().State.DeckID)
+		events, err := hub.storage.Events(context.Background(), &deckID, 0)
+		require.NoError(t, err)
+		require.Equal(t, storage.EventTypeShuffled, events[len(events)-1].Type)
+	})
+
+	t.Run("pass a card to another player", func(t *testing.T) {
+		alice, bob := &fakeClient{}, &fakeClient{}
+		aliceSession := join(t, hub, "pass", "alice", alice)
+		bobSession := join(t, hub, "pass", "bob", bob)
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandDraw})
+		card := alice.last().Changes[0].Added[0]
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandPass, Card: card, To: bobSession.PlayerID()})
+		changes := alice.last().Changes
+		require.Equal(t, []string{card}, changes[0].Removed)
+		require.Equal(t, 0, *changes[0].HandSize)
+		require.Empty(t, changes[1].Added)
+		require.Equal(t, 1, changes[1].AddedCount)
+
+		changes = bob.last().Changes
+		require.Empty(t, changes[0].Removed)
+		require.Equal(t, 1, changes[0].RemovedCount)
+		require.Equal(t, []string{card}, changes[1].Added)
+	})
+
+	t.Run("pass errors", func(t *testing.T) {
+		alice, bob := &fakeClient{}, &fakeClient{}
+		aliceSession := join(t, hub, "pass-errors", "alice", alice)
+		bobSession := join(t, hub, "pass-errors", "bob", bob)
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandPass, Card: "AS", To: bobSession.PlayerID()})
+		require.Equal(t, ErrCardNotInHand.Error(), alice.last().Error)
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandPass, Card: "", To: bobSession.PlayerID()})
+		require.Equal(t, ErrInvalidCard.Error(), alice.last().Error)
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandPass, Card: "AL", To: bobSession.PlayerID()})
+		require.Contains(t, alice.last().Error, "invalid suit code 'L'")
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandPass, Card: "AS", To: "nobody"})
+		require.Equal(t, ErrPlayerNotFound.Error(), alice.last().Error)
+	})
+
+	t.Run("chat", func(t *testing.T) {
+		alice, bob := &fakeClient{}, &fakeClient{}
+		aliceSession := join(t, hub, "chat", "alice", alice)
+		join(t, hub, "chat", "bob", bob)
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandChat, Text: "hi"})
+		require.Equal(t, &Message{Type: MessageChat, From: aliceSession.PlayerID(), Text: "hi"}, alice.last())
+		require.Equal(t, &Message{Type: MessageChat, From: aliceSession.PlayerID(), Text: "hi"}, bob.last())
+
+		aliceSession.Handle(context.Background(), &Command{Type: CommandChat})
+		require.Equal(t, ErrInvalidChat.Error(), alice.last().Error)
+	})
+
+	t.Run("invalid commands", func(t *testing.T) {
+		client := &fakeClient{}
+		session := join(t, hub, "invalid", "alice", client)
+
+		session.Handle(context.Background(), &Command{Type: CommandJoin, Name: "alice"})
+		require.Equal(t, ErrAlreadyJoined.Error(), client.last().Error)
+
+		session.Handle(context.Background(), &Command{Type: CommandDraw, Count: -1})
+		require.Equal(t, ErrInvalidCount.Error(), client.last().Error)
+
+		session.Handle(context.Background(), &Command{Type: "fold"})
+		require.Equal(t, ErrUnknownCommand.Error(), client.last().Error)
+	})
+}
+
+func Test__Limits(t *testing.T) {
+	actions := []Action{}
+	refunds := []Action{}
+	limited := map[Action]bool{}
+	limit := func(ctx context.Context, action Action) error {
+		actions = append(actions, action)
+		if limited[action] {
+			return ErrRateLimited
+		}
+
+		return nil
+	}
+
+	refund := func(ctx context.Context, action Action) {
+		refunds = append(refunds, action)
+	}
+
+	hub := NewHub(storage.NewInMemoryStorage(), cards.NewCardGenerator(), WithLimit(limit, refund))
+
+	t.Run("creating the deck of a room is limited", func(t *testing.T) {
+		limited[ActionCreate] = true
+		defer delete(limited, ActionCreate)
+
+		_, err := hub.Join(context.Background(), "create-limited", &Command{Type: CommandJoin, Name: "alice"}, &fakeClient{})
+		require.ErrorIs(t, err, ErrRateLimited)
+	})
+
+	t.Run("only the first player creates a deck", func(t *testing.T) {
+		actions = []Action{}
+		join(t, hub, "create", "alice", &fakeClient{})
+		join(t, hub, "create", "bob", &fakeClient{})
+		require.Equal(t, []Action{ActionCreate}, actions)
+	})
+
+	t.Run("draws and deals are limited", func(t *testing.T) {
+		client := &fakeClient{}
+		session := join(t, hub, "draw-limited", "alice", client)
+
+		limited[ActionDraw] = true
+		defer delete(limited, ActionDraw)
+
+		session.Handle(context.Background(), &Command{Type: CommandDraw, Count: 1})
+		require.Equal(t, ErrRateLimited.Error(), client.last().Error)
+
+		session.Handle(context.Background(), &Command{Type: CommandDeal, Count: 1})
+		require.Equal(t, ErrRateLimited.Error(), client.last().Error)
+		require.Empty(t, session.player.hand)
+		require.Empty(t, refunds)
+	})
+
+	t.Run("deck that fails to be created is refunded", func(t *testing.T) {
+		hub := NewHub(&failingCreateStorage{Storage: storage.NewInMemoryStorage()}, cards.NewCardGenerator(), WithLimit(limit, refund))
+		_, err := hub.Join(context.Background(), "failing", &Command{Type: CommandJoin, Name: "alice"}, &fakeClient{})
+		require.ErrorIs(t, err, errCreateFailed)
+		require.Equal(t, []Action{ActionCreate}, refunds)
+	})
+}
+
+type fakeClient struct {
+	mu       sync.Mutex
+	messages []*Message
+	closed   bool
+}
+
+func (c *fakeClient) Send(message *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, message)
+}
+
+func (c *fakeClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+func (c *fakeClient) all() []*Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Message{}, c.messages...)
+}
+
+func (c *fakeClient) last() *Message {
+	messages := c.all()
+	return messages[len(messages)-1]
+}
+
+func (c *fakeClient) welcome() *Message {
+	for _, message := range c.all() {
+		if message.Type == MessageWelcome {
+			return message
+		}
+	}
+
+	return nil
+}
+
+func (c *fakeClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func join(t *testing.T, hub *Hub, room, name string, client Client) *Session {
+	session, err := hub.Join(context.Background(), room, &Command{Type: CommandJoin, Name: name}, client)
+	require.NoError(t, err)
+	return session
+}
+
+func playerIDs(snapshot *Snapshot) []string {
+	IDs := []string{}
+	for _, player := range snapshot.Players {
+		IDs = append(IDs, player.ID)
+	}
+
+	return IDs
+}
+
+var errCreateFailed = errors.New("connection refused")
+
+type failingCreateStorage struct {
+	storage.Storage
+}
+
+func (s *failingCreateStorage) Create(ctx context.Context, list []cards.Card, options storage.CreateOptions) (*storage.Deck, error) {
+	return nil, errCreateFailed
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lucaspin/decks-api/pkg/cards"
+)
+
+// Decks and events are kept in bolt in a compact binary encoding, since most of what is kept are cards:
+// each card is a single byte, packed with cards.PackCard, numbers are varints, and strings and lists are prefixed by their length.
+//
+// A deck is its version, flags, creation time in Unix milliseconds, owner, type and cards.
+// Its ID is the key it is kept under, so it is not encoded.
+// An event is its type, flags, creation time, cards and the versions it reverts.
+// Its version is the key it is kept under, so it is not encoded either.
+//
+// Everything starts with the version of the encoding, so it can change without breaking existing files.
+const boltEncodingVersion = 1
+
+const flagShuffled = 1 << 0
+
+var errInvalidEncoding = errors.New("invalid encoding")
+
+func encodeDeck(deck *Deck) []byte {
+	data := []byte{boltEncodingVersion}
+	data = binary.AppendVarint(data, deck.Version)
+	data = appendFlags(data, deck.Shuffled)
+	data = binary.AppendVarint(data, deck.CreatedAt.UnixMilli())
+	data = appendString(data, deck.Owner)
+	data = appendString(data, string(deck.Type))
+	return appendCards(data, deck.Cards)
+}
+
+func decodeDeck(data []byte) (*Deck, error) {
+	d := newDecoder(data)
+	deck := &Deck{
+		Version:   d.varint(),
+		Shuffled:  d.flags()&flagShuffled != 0,
+		CreatedAt: time.UnixMilli(d.varint()),
+		Owner:     d.string(),
+		Type:      DeckType(d.string()),
+		Cards:     d.cards(),
+	}
+
+	if err := d.done(); err != nil {
+		return nil, fmt.Errorf("error decoding deck: %w", err)
+	}
+
+	return deck, nil
+}
+
+func encodeEvent(event *Event) []byte {
+	data := []byte{boltEncodingVersion}
+	data = appendString(data, string(event.Type))
+	data = appendFlags(data, event.Shuffled)
+	data = binary.AppendVarint(data, event.CreatedAt.UnixMilli())
+	data = appendCards(data, event.Cards)
+	data = binary.AppendUvarint(data, uint64(len(event.Reverts)))
+	for _, version := range event.Reverts {
+		data = binary.AppendVarint(data, version)
+	}
+
+	return data
+}
+
+func decodeEvent(version int64, data []byte) (*Event, error) {
+	d := newDecoder(data)
+	event := &Event{
+		Version:   version,
+		Type:      EventType(d.string()),
+		Shuffled:  d.flags()&flagShuffled != 0,
+		CreatedAt: time.UnixMilli(d.varint()),
+		Cards:     d.cards(),
+	}
+
+	for i := d.length(); i > 0; i-- {
+		event.Reverts = append(event.Reverts, d.varint())
+	}
+
+	if err := d.done(); err != nil {
+		return nil, fmt.Errorf("error decoding event %d: %w", version, err)
+	}
+
+	return event, nil
+}
+
+func appendFlags(data []byte, shuffled bool) []byte {
+	var flags byte
+	if shuffled {
+		flags |= flagShuffled
+	}
+
+	return append(data, flags)
+}
+
+func appendString(data []byte, s string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(s)))
+	return append(data, s...)
+}
+
+func appendCards(data []byte, list []cards.Card) []byte {
+	data = binary.AppendUvarint(data, uint64(len(list)))
+	return cards.AppendPacked(data, list)
+}
+
+// Reads the values in the order they were appended.
+// The first error is kept, and every read after it returns a zero value, so it is only checked at the end.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func newDecoder(data []byte) *decoder {
+	d := &decoder{data: data}
+	if len(data) == 0 || data[0] != boltEncodingVersion {
+		d.err = fmt.Errorf("%w: unknown encoding version", errInvalidEncoding)
+		return d
+	}
+
+	d.data = data[1:]
+	return d
+}
+
+func (d *decoder) done() error {
+	if d.err == nil && len(d.data) > 0 {
+		return fmt.Errorf("%w: %d bytes left", errInvalidEncoding, len(d.data))
+	}
+
+	return d.err
+}
+
+func (d *decoder) fail(what string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: invalid %s", errInvalidEncoding, what)
+	}
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	value, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail("number")
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return value
+}
+
+// The length of a string or list, which can't be longer than what is left to read.
+func (d *decoder) length() int {
+	if d.err != nil {
+		return 0
+	}
+
+	value, n := binary.Uvarint(d.data)
+	if n <= 0 || value > uint64(len(d.data)-n) {
+		d.fail("length")
+		return 0
+	}
+
+	d.data = d.data[n:]
+	return int(value)
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n > len(d.data) {
+		d.fail("data")
+		return nil
+	}
+
+	value := d.data[:n]
+	d.data = d.data[n:]
+	return value
+}
+
+func (d *decoder) flags() byte {
+	if value := d.bytes(1); value != nil {
+		return value[0]
+	}
+
+	return 0
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.length()))
+}
+
+func (d *decoder) cards() []cards.Card {
+	list, err := cards.UnpackCards(d.bytes(d.length()))
+	if err != nil {
+		d.fail("card")
+	}
+
+	return list
+}
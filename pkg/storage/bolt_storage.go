@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	bolt "go.etcd.io/bbolt"
+)
+
+// An implementation of the Storage interface that keeps decks in a single file, using bbolt,
+// so they survive restarts without running Redis. Only one process can open the file at a time,
+// so it is meant for installs with a single server.
+//
+// The file has two buckets:
+// 'decks' - the decks, keyed by their ID. See bolt_encoding.go for how they are encoded.
+// 'events' - a bucket for each deck, keyed by its ID, with its events keyed by their version, in big endian,
+// so they are sorted by version, and can be read from a specific version onwards with a cursor.
+//
+// Every change to a deck is written together with its event in a single read-write transaction,
+// and bbolt runs those one at a time, so draws, shuffles and undos are atomic.
+type BoltStorage struct {
+	db     *bolt.DB
+	broker *broker
+}
+
+type BoltConfig struct {
+	// The file decks are kept in. It is created if it doesn't exist.
+	Path string
+}
+
+var (
+	boltDecksBucket  = []byte("decks")
+	boltEventsBucket = []byte("events")
+)
+
+// How long to wait for another process using the file to close it.
+const boltOpenTimeout = 5 * time.Second
+
+func NewBoltStorage(config *BoltConfig) (Storage, error) {
+	db, err := bolt.Open(config.Path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", config.Path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltDecksBucket, boltEventsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	slog.Info("Opened bolt storage", "path", config.Path)
+	return &BoltStorage{db: db, broker: newBroker()}, nil
+}
+
+func (s *BoltStorage) Create(ctx context.Context, list []cards.Card, options CreateOptions) (*Deck, error) {
+	ID := uuid.New()
+	deck := Deck{
+		DeckID:   &ID,
+		Shuffled: options.Shuffled,
+		Cards:    list,
+		Version:  InitialVersion,
+
+		// Only milliseconds are kept in the file.
+		CreatedAt: time.UnixMilli(time.Now().UnixMilli()),
+		Owner:     options.Owner,
+		Type:      options.Type,
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.Bucket(boltEventsBucket).CreateBucket(ID[:]); err != nil {
+			return err
+		}
+
+		err := putEvent(tx, &ID, &Event{
+			Version:   InitialVersion,
+			Type:      EventTypeCreated,
+			Cards:     list,
+			Shuffled:  options.Shuffled,
+			CreatedAt: deck.CreatedAt,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltDecksBucket).Put(ID[:], encodeDeck(&deck))
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &deck, nil
+}
+
+func (s *BoltStorage) Get(ctx context.Context, deckID *uuid.UUID) (*Deck, error) {
+	var deck *Deck
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		deck, err = getDeck(tx, deckID)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deck, nil
+}
+
+func (s *BoltStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*DrawResult, error) {
+	deck, event, err := s.change(deckID, ifVersion, func(tx *bolt.Tx, deck *Deck) (*Event, error) {
+		if len(deck.Cards) == 0 {
+			return nil, ErrEmptyDeck
+		}
+
+		// We can only draw as many cards as there are in the deck.
+		if len(deck.Cards) < count {
+			count = len(deck.Cards)
+		}
+
+		// Drawing no cards doesn't change the deck.
+		if count <= 0 {
+			return nil, nil
+		}
+
+		drawn := deck.Cards[:count]
+		deck.Cards = deck.Cards[count:]
+		return &Event{Type: EventTypeDrawn, Cards: drawn}, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DrawResult{Cards: []cards.Card{}, Remaining: deck.Remaining(), Version: deck.Version}
+	if event != nil {
+		result.Cards = event.Cards
+	}
+
+	return result, nil
+}
+
+func (s *BoltStorage) Shuffle(ctx context.Context, deckID *uuid.UUID, shuffle func([]cards.Card) []cards.Card, ifVersion int64) (*Deck, error) {
+	deck, _, err := s.change(deckID, ifVersion, func(tx *bolt.Tx, deck *Deck) (*Event, error) {
+		// The deck was just decoded, so nothing else is using its cards, and they can be shuffled in place.
+		deck.Cards = shuffle(deck.Cards)
+		deck.Shuffled = true
+		return &Event{Type: EventTypeShuffled, Cards: deck.Cards}, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deck, nil
+}
+
+func (s *BoltStorage) Events(ctx context.Context, deckID *uuid.UUID, afterVersion int64) ([]Event, error) {
+	var events []Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		events, err = readEvents(tx, deckID, afterVersion)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (s *BoltStorage) Undo(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*UndoResult, error) {
+	deck, event, err := s.change(deckID, ifVersion, func(tx *bolt.Tx, deck *Deck) (*Event, error) {
+		events, err := readEvents(tx, deckID, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		list, reverts, err := planUndo(events, count)
+		if err != nil {
+			return nil, err
+		}
+
+		deck.Cards = append(append([]cards.Card{}, list...), deck.Cards...)
+		return &Event{Type: EventTypeUndone, Cards: list, Reverts: reverts}, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &UndoResult{
+		Cards:     event.Cards,
+		Remaining: deck.Remaining(),
+		Version:   deck.Version,
+	}, nil
+}
+
+// Runs fn with the deck in a read-write transaction, after checking it is at ifVersion.
+// If fn changes the deck, it returns the event for the change, and both are saved, at the next version of the deck.
+// If it returns no event, nothing is saved.
+func (s *BoltStorage) change(deckID *uuid.UUID, ifVersion int64, fn func(tx *bolt.Tx, deck *Deck) (*Event, error)) (*Deck, *Event, error) {
+	var deck *Deck
+	var event *Event
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		deck, err = getDeck(tx, deckID)
+		if err != nil {
+			return err
+		}
+
+		if ifVersion != AnyVersion && deck.Version != ifVersion {
+			return ErrVersionMismatch
+		}
+
+		event, err = fn(tx, deck)
+		if err != nil || event == nil {
+			return err
+		}
+
+		deck.Version++
+		event.Version = deck.Version
+		event.CreatedAt = time.UnixMilli(time.Now().UnixMilli())
+		if err := putEvent(tx, deckID, event); err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltDecksBucket).Put(deckID[:], encodeDeck(deck))
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Watchers are only notified once the change is committed, so they can read it.
+	if event != nil {
+		s.broker.publish(deckID.String())
+	}
+
+	return deck, event, nil
+}
+
+func (s *BoltStorage) Watch(ctx context.Context, deckID *uuid.UUID, afterVersion int64) (<-chan Event, error) {
+	return s.broker.watch(ctx, s, deckID, afterVersion)
+}
+
+func (s *BoltStorage) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		count = int64(tx.Bucket(boltDecksBucket).Stats().KeyN)
+		return nil
+	})
+
+	return count, err
+}
+
+// Watches still going on stop when their next read of the events fails.
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+func getDeck(tx *bolt.Tx, deckID *uuid.UUID) (*Deck, error) {
+	data := tx.Bucket(boltDecksBucket).Get(deckID[:])
+	if data == nil {
+		return nil, ErrDeckNotFound
+	}
+
+	deck, err := decodeDeck(data)
+	if err != nil {
+		return nil, err
+	}
+
+	deck.DeckID = deckID
+	return deck, nil
+}
+
+func putEvent(tx *bolt.Tx, deckID *uuid.UUID, event *Event) error {
+	events := tx.Bucket(boltEventsBucket).Bucket(deckID[:])
+	if events == nil {
+		return ErrDeckNotFound
+	}
+
+	return events.Put(versionKey(event.Version), encodeEvent(event))
+}
+
+func readEvents(tx *bolt.Tx, deckID *uuid.UUID, afterVersion int64) ([]Event, error) {
+	bucket := tx.Bucket(boltEventsBucket).Bucket(deckID[:])
+	if bucket == nil {
+		return nil, ErrDeckNotFound
+	}
+
+	events := []Event{}
+	cursor := bucket.Cursor()
+	for key, value := cursor.Seek(versionKey(afterVersion + 1)); key != nil; key, value = cursor.Next() {
+		event, err := decodeEvent(int64(binary.BigEndian.Uint64(key)), value)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, *event)
+	}
+
+	return events, nil
+}
+
+func versionKey(version int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(version))
+}
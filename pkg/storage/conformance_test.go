@@ -0,0 +1,16 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/lucaspin/decks-api/pkg/storage/storagetest"
+)
+
+func Test__StorageTest(t *testing.T) {
+	for name, implementation := range storage.StorageImplementations {
+		t.Run(name, func(t *testing.T) {
+			storagetest.Run(t, implementation.CreateFn)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lucaspin/decks-api/pkg/cards"
+)
+
+var ErrNothingToUndo = errors.New("not enough events to undo")
+
+type EventType string
+
+const (
+	EventTypeCreated  EventType = "created"
+	EventTypeDrawn    EventType = "drawn"
+	EventTypeShuffled EventType = "shuffled"
+	EventTypeUndone   EventType = "undone"
+)
+
+// A change made to a deck.
+// Every change bumps the deck version by one, so the version
+// the deck ended up at after the change also identifies the event.
+//
+// What the cards mean depends on the type of the event:
+// - created:  the cards the deck was created with.
+// - drawn:    the cards drawn from the top of the deck.
+// - shuffled: the cards remaining in the deck, in their new order.
+// - undone:   the cards put back on top of the deck.
+type Event struct {
+	Version   int64
+	Type      EventType
+	Cards     []cards.Card
+	Shuffled  bool
+	Reverts   []int64
+	CreatedAt time.Time
+}
+
+// The cards put back on a deck by an undo, and the state of the deck after it.
+type UndoResult struct {
+	Cards     []cards.Card
+	Remaining int
+	Version   int64
+}
+
+// Rebuilds a deck from its events.
+// The deck is expected to have been created by the first event.
+func Replay(events []Event) (*Deck, error) {
+	if len(events) == 0 || events[0].Type != EventTypeCreated {
+		return nil, fmt.Errorf("event log does not start with a %s event", EventTypeCreated)
+	}
+
+	deck := &Deck{}
+	for _, event := range events {
+		switch event.Type {
+		case EventTypeCreated:
+			deck.Shuffled = event.Shuffled
+			deck.Cards = append([]cards.Card{}, event.Cards...)
+		case EventTypeDrawn:
+			if len(deck.Cards) < len(event.Cards) {
+				return nil, fmt.Errorf("event %d draws %d cards, but deck has %d", event.Version, len(event.Cards), len(deck.Cards))
+			}
+
+			deck.Cards = deck.Cards[len(event.Cards):]
+		case EventTypeShuffled:
+			deck.Shuffled = true
+			deck.Cards = append([]cards.Card{}, event.Cards...)
+		case EventTypeUndone:
+			deck.Cards = append(append([]cards.Card{}, event.Cards...), deck.Cards...)
+		default:
+			return nil, fmt.Errorf("unknown event type '%s'", event.Type)
+		}
+
+		deck.Version = event.Version
+	}
+
+	return deck, nil
+}
+
+// Finds the last count events that can still be undone,
+// and returns the cards that need to be put back on top of the deck to undo them,
+// in the order they should be in, and the versions of the events being undone.
+//
+// Only draws can be undone. Undos themselves, and events already undone, are skipped.
+// Creating or shuffling the deck can't be undone, and draws before them can't be
+// put back on top of a deck they were never drawn from, so ErrNothingToUndo is returned
+// if there are not enough draws since the deck was created or last shuffled.
+func planUndo(events []Event, count int) ([]cards.Card, []int64, error) {
+	if count <= 0 {
+		return nil, nil, ErrNothingToUndo
+	}
+
+	reverted := map[int64]bool{}
+	for _, event := range events {
+		for _, version := range event.Reverts {
+			reverted[version] = true
+		}
+	}
+
+	undone := []Event{}
+	for i := len(events) - 1; i >= 0 && len(undone) < count; i-- {
+		event := events[i]
+		if event.Type == EventTypeShuffled {
+			break
+		}
+
+		if event.Type == EventTypeDrawn && !reverted[event.Version] {
+			undone = append(undone, event)
+		}
+	}
+
+	if len(undone) < count {
+		return nil, nil, ErrNothingToUndo
+	}
+
+	// The cards drawn first were on top of the ones drawn later,
+	// so we go through the events from oldest to newest.
+	list := []cards.Card{}
+	versions := []int64{}
+	for i := len(undone) - 1; i >= 0; i-- {
+		list = append(list, undone[i].Cards...)
+		versions = append(versions, undone[i].Version)
+	}
+
+	return list, versions, nil
+}
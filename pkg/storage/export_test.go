@@ -0,0 +1,5 @@
+package storage
+
+// The tests in storagetest run from package storage_test, since storagetest imports this package,
+// so the implementations they run against are exported to it here.
+var StorageImplementations = storageImplementations
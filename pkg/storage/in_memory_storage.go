@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lucaspin/decks-api/pkg/cards"
@@ -10,26 +12,51 @@ import (
 // An implementation of the Storage interface that keeps all decks in memory, good for local tests.
 // Note that all decks are lost when the server shuts down, so use appropriately.
 type InMemoryStorage struct {
-	decks map[string]Deck
+	mu     sync.Mutex
+	decks  map[string]Deck
+	events map[string][]Event
+	broker *broker
 }
 
 func NewInMemoryStorage() Storage {
-	return &InMemoryStorage{decks: map[string]Deck{}}
+	return &InMemoryStorage{
+		decks:  map[string]Deck{},
+		events: map[string][]Event{},
+		broker: newBroker(),
+	}
 }
 
-func (s *InMemoryStorage) Create(ctx context.Context, list []cards.Card, shuffled bool) (*Deck, error) {
+func (s *InMemoryStorage) Create(ctx context.Context, list []cards.Card, options CreateOptions) (*Deck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	ID := uuid.New()
 	deck := Deck{
-		DeckID:   &ID,
-		Shuffled: shuffled,
-		Cards:    list,
+		DeckID:    &ID,
+		Shuffled:  options.Shuffled,
+		Cards:     list,
+		Version:   InitialVersion,
+		CreatedAt: time.Now(),
+		Owner:     options.Owner,
+		Type:      options.Type,
 	}
 
 	s.decks[deck.DeckID.String()] = deck
+	s.events[deck.DeckID.String()] = []Event{{
+		Version:   InitialVersion,
+		Type:      EventTypeCreated,
+		Cards:     list,
+		Shuffled:  options.Shuffled,
+		CreatedAt: deck.CreatedAt,
+	}}
+
 	return &deck, nil
 }
 
 func (s *InMemoryStorage) Get(ctx context.Context, deckID *uuid.UUID) (*Deck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	deck, ok := s.decks[deckID.String()]
 	if !ok {
 		return nil, ErrDeckNotFound
@@ -38,12 +65,19 @@ func (s *InMemoryStorage) Get(ctx context.Context, deckID *uuid.UUID) (*Deck, er
 	return &deck, nil
 }
 
-func (s *InMemoryStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int) ([]cards.Card, error) {
+func (s *InMemoryStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*DrawResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	deck, ok := s.decks[deckID.String()]
 	if !ok {
 		return nil, ErrDeckNotFound
 	}
 
+	if ifVersion != AnyVersion && deck.Version != ifVersion {
+		return nil, ErrVersionMismatch
+	}
+
 	if len(deck.Cards) == 0 {
 		return nil, ErrEmptyDeck
 	}
@@ -53,18 +87,145 @@ func (s *InMemoryStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int
 		count = len(deck.Cards)
 	}
 
+	// Drawing no cards doesn't change the deck.
+	if count <= 0 {
+		return &DrawResult{Cards: []cards.Card{}, Remaining: len(deck.Cards), Version: deck.Version}, nil
+	}
+
 	// gather cards
 	cards := make([]cards.Card, count)
 	for i := 0; i < count; i++ {
 		cards[i] = deck.Cards[i]
 	}
 
-	// remove cards from deck
-	s.decks[deckID.String()] = Deck{
-		DeckID:   deckID,
-		Shuffled: deck.Shuffled,
-		Cards:    deck.Cards[count:],
+	// remove cards from deck, keeping the rest of it as it was
+	drawn := deck
+	drawn.DeckID = deckID
+	drawn.Cards = deck.Cards[count:]
+	drawn.Version = deck.Version + 1
+	s.decks[deckID.String()] = drawn
+
+	s.events[deckID.String()] = append(s.events[deckID.String()], Event{
+		Version:   deck.Version + 1,
+		Type:      EventTypeDrawn,
+		Cards:     cards,
+		CreatedAt: time.Now(),
+	})
+
+	s.broker.publish(deckID.String())
+
+	return &DrawResult{
+		Cards:     cards,
+		Remaining: len(deck.Cards) - count,
+		Version:   deck.Version + 1,
+	}, nil
+}
+
+func (s *InMemoryStorage) Shuffle(ctx context.Context, deckID *uuid.UUID, shuffle func([]cards.Card) []cards.Card, ifVersion int64) (*Deck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deck, ok := s.decks[deckID.String()]
+	if !ok {
+		return nil, ErrDeckNotFound
 	}
 
-	return cards, nil
+	if ifVersion != AnyVersion && deck.Version != ifVersion {
+		return nil, ErrVersionMismatch
+	}
+
+	// The shuffle function might shuffle the list in place,
+	// and other decks returned before might still be using it.
+	shuffled := deck
+	shuffled.DeckID = deckID
+	shuffled.Shuffled = true
+	shuffled.Cards = shuffle(append([]cards.Card{}, deck.Cards...))
+	shuffled.Version = deck.Version + 1
+
+	s.decks[deckID.String()] = shuffled
+	s.events[deckID.String()] = append(s.events[deckID.String()], Event{
+		Version:   shuffled.Version,
+		Type:      EventTypeShuffled,
+		Cards:     shuffled.Cards,
+		CreatedAt: time.Now(),
+	})
+
+	s.broker.publish(deckID.String())
+	return &shuffled, nil
+}
+
+func (s *InMemoryStorage) Events(ctx context.Context, deckID *uuid.UUID, afterVersion int64) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events, ok := s.events[deckID.String()]
+	if !ok {
+		return nil, ErrDeckNotFound
+	}
+
+	result := []Event{}
+	for _, event := range events {
+		if event.Version > afterVersion {
+			result = append(result, event)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *InMemoryStorage) Undo(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*UndoResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deck, ok := s.decks[deckID.String()]
+	if !ok {
+		return nil, ErrDeckNotFound
+	}
+
+	if ifVersion != AnyVersion && deck.Version != ifVersion {
+		return nil, ErrVersionMismatch
+	}
+
+	list, reverts, err := planUndo(s.events[deckID.String()], count)
+	if err != nil {
+		return nil, err
+	}
+
+	undone := deck
+	undone.DeckID = deckID
+	undone.Cards = append(append([]cards.Card{}, list...), deck.Cards...)
+	undone.Version = deck.Version + 1
+	s.decks[deckID.String()] = undone
+
+	s.events[deckID.String()] = append(s.events[deckID.String()], Event{
+		Version:   deck.Version + 1,
+		Type:      EventTypeUndone,
+		Cards:     list,
+		Reverts:   reverts,
+		CreatedAt: time.Now(),
+	})
+
+	s.broker.publish(deckID.String())
+
+	return &UndoResult{
+		Cards:     list,
+		Remaining: len(list) + len(deck.Cards),
+		Version:   deck.Version + 1,
+	}, nil
+}
+
+func (s *InMemoryStorage) Count(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.decks)), nil
+}
+
+// There's nothing to release, so closing the storage doesn't do anything.
+func (s *InMemoryStorage) Close() error {
+	return nil
+}
+
+func (s *InMemoryStorage) Watch(ctx context.Context, deckID *uuid.UUID, afterVersion int64) (<-chan Event, error) {
+	return s.broker.watch(ctx, s, deckID, afterVersion)
 }
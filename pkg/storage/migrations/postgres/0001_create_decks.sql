@@ -0,0 +1,28 @@
+CREATE TABLE decks (
+	id UUID PRIMARY KEY,
+	shuffled BOOLEAN NOT NULL,
+	version BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	owner TEXT NOT NULL,
+	type TEXT NOT NULL
+);
+
+-- The cards remaining in each deck. The one on top of the deck has the lowest position.
+CREATE TABLE deck_cards (
+	deck_id UUID NOT NULL REFERENCES decks (id),
+	position INTEGER NOT NULL,
+	code TEXT NOT NULL,
+	PRIMARY KEY (deck_id, position)
+);
+
+-- The cards and reverted versions are comma-separated, like 'AS,KH' and '2,3'.
+CREATE TABLE deck_events (
+	deck_id UUID NOT NULL REFERENCES decks (id),
+	version BIGINT NOT NULL,
+	type TEXT NOT NULL,
+	cards TEXT NOT NULL,
+	shuffled BOOLEAN NOT NULL,
+	reverts TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (deck_id, version)
+);
@@ -0,0 +1,28 @@
+CREATE TABLE decks (
+	id TEXT PRIMARY KEY,
+	shuffled BOOLEAN NOT NULL,
+	version INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	owner TEXT NOT NULL,
+	type TEXT NOT NULL
+);
+
+-- The cards remaining in each deck. The one on top of the deck has the lowest position.
+CREATE TABLE deck_cards (
+	deck_id TEXT NOT NULL REFERENCES decks (id),
+	position INTEGER NOT NULL,
+	code TEXT NOT NULL,
+	PRIMARY KEY (deck_id, position)
+);
+
+-- The cards and reverted versions are comma-separated, like 'AS,KH' and '2,3'.
+CREATE TABLE deck_events (
+	deck_id TEXT NOT NULL REFERENCES decks (id),
+	version INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	cards TEXT NOT NULL,
+	shuffled BOOLEAN NOT NULL,
+	reverts TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (deck_id, version)
+);
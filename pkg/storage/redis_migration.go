@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+)
+
+// How many decks MigrateRedisKeys moved, and how many of the ones found in older keys were already moved.
+type MigrationResult struct {
+	Migrated int
+	Skipped  int
+}
+
+// Moves the decks kept by older versions of RedisStorage to the keys used now, described in redis_storage.go.
+// Three older layouts are moved:
+// - 'decks:<deckID>:shuffled', ':version', ':cards' and ':events', without hash tags.
+// - 'decks:{<deckID>}:shuffled', ':version' and ':cards', with the events already in their current key.
+// - 'decks:{<deckID>}:meta' and ':cards', with the cards in a list of codes, instead of packed.
+//
+// Each deck is moved in a transaction, watching its old keys, so decks still being used by older servers are not lost.
+// Decks already moved are skipped, so it is safe to run it again, like after it fails halfway.
+// Keys without hash tags are in different slots in Redis Cluster, so those decks can't be moved there,
+// but older versions of RedisStorage didn't support Redis Cluster anyway.
+func MigrateRedisKeys(ctx context.Context, client redis.UniversalClient) (*MigrationResult, error) {
+	result := &MigrationResult{}
+	count := func(deckID *uuid.UUID, migrated bool, err error) error {
+		if err != nil {
+			return fmt.Errorf("error migrating deck %s: %v", deckID, err)
+		}
+
+		if migrated {
+			result.Migrated++
+		} else {
+			result.Skipped++
+		}
+
+		return nil
+	}
+
+	err := scanKeys(ctx, client, "decks:*:shuffled", func(key string) error {
+		prefix := strings.TrimSuffix(key, ":shuffled")
+		deckID, err := uuid.Parse(strings.Trim(strings.TrimPrefix(prefix, "decks:"), "{}"))
+		if err != nil {
+			// Not a key of ours.
+			return nil
+		}
+
+		migrated, err := migrateDeck(ctx, client, prefix, &deckID)
+		return count(&deckID, migrated, err)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Runs after the older layouts are moved, since those are moved with their cards already packed.
+	// The hash is scanned, and not the list, since decks with every card drawn have no list.
+	err = scanKeys(ctx, client, "decks:*:meta", func(key string) error {
+		deckID, err := uuid.Parse(strings.Trim(strings.TrimSuffix(strings.TrimPrefix(key, "decks:"), ":meta"), "{}"))
+		if err != nil || key != keyForAttribute(&deckID, "meta") {
+			// Not a key of ours.
+			return nil
+		}
+
+		migrated, err := packCardList(ctx, client, &deckID)
+
+		// Decks in the current keys are not counted as skipped, since they were never in older ones.
+		if err == nil && !migrated {
+			return nil
+		}
+
+		return count(&deckID, migrated, err)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// The old keys of the deck are the prefix followed by the name of the attribute.
+func migrateDeck(ctx context.Context, client redis.UniversalClient, prefix string, deckID *uuid.UUID) (bool, error) {
+	oldKey := func(attribute string) string {
+		return prefix + ":" + attribute
+	}
+
+	// With hash tags, the events are already where they need to be.
+	tagged := oldKey("events") == keyForAttribute(deckID, "events")
+
+	migrated := false
+	migrate := func(tx *redis.Tx) error {
+		// Another run already moved the deck, after it was found.
+		oldExists, err := tx.Exists(ctx, oldKey("shuffled")).Result()
+		if err != nil || oldExists == 0 {
+			return err
+		}
+
+		// The deck is already in the current keys, so the old ones are left alone.
+		newExists, err := tx.Exists(ctx, keyForAttribute(deckID, "meta")).Result()
+		if err != nil || newExists == 1 {
+			return err
+		}
+
+		deck, codes, events, err := readOldDeck(ctx, tx, oldKey)
+		if err != nil {
+			return err
+		}
+
+		list, err := cards.CodesToCardList(codes)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, keyForAttribute(deckID, "packed"), cards.Pack(list).Data, 0)
+			if !tagged {
+				for _, event := range events {
+					pipe.XAdd(ctx, &redis.XAddArgs{
+						Stream: keyForAttribute(deckID, "events"),
+						ID:     event.ID,
+						Values: event.Values,
+					})
+				}
+
+				pipe.Del(ctx, oldKey("events"))
+			}
+
+			pipe.HSet(ctx, keyForAttribute(deckID, "meta"), metaValues(deck))
+			pipe.Del(ctx, oldKey("shuffled"), oldKey("version"), oldKey("cards"))
+			return nil
+		})
+
+		migrated = err == nil
+		return err
+	}
+
+	err := watchWhileMigrating(ctx, client, migrate, oldKey("shuffled"), oldKey("version"), oldKey("cards"), oldKey("events"))
+	return migrated, err
+}
+
+// Replaces the list of card codes of a deck, already with its metadata in the hash, with its packed cards.
+// Returns false if the deck already has packed cards.
+func packCardList(ctx context.Context, client redis.UniversalClient, deckID *uuid.UUID) (bool, error) {
+	metaKey := keyForAttribute(deckID, "meta")
+	cardsKey := keyForAttribute(deckID, "cards")
+	packedKey := keyForAttribute(deckID, "packed")
+
+	migrated := false
+	migrate := func(tx *redis.Tx) error {
+		packed, err := tx.Exists(ctx, packedKey).Result()
+		if err != nil || packed == 1 {
+			return err
+		}
+
+		codes, err := tx.LRange(ctx, cardsKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		list, err := cards.CodesToCardList(codes)
+		if err != nil {
+			return err
+		}
+
+		// The cards drawn were popped from the list, so none are drawn from the packed cards.
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, packedKey, cards.Pack(list).Data, 0)
+			pipe.HSet(ctx, metaKey, "drawn", 0)
+			pipe.Del(ctx, cardsKey)
+			return nil
+		})
+
+		migrated = err == nil
+		return err
+	}
+
+	err := watchWhileMigrating(ctx, client, migrate, metaKey, cardsKey, packedKey)
+	return migrated, err
+}
+
+// Runs the migration of a deck watching its keys, and tries again if they change while it runs.
+func watchWhileMigrating(ctx context.Context, client redis.UniversalClient, migrate func(tx *redis.Tx) error, keys ...string) error {
+	for attempt := 0; attempt < maxTransactionAttempts; attempt++ {
+		err := client.Watch(ctx, migrate, keys...)
+
+		// The deck changed while we were moving it, so we try again.
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+
+		return err
+	}
+
+	return fmt.Errorf("deck changed too many times while trying to move it")
+}
+
+// Returns the metadata of the deck, its card codes, and the entries of its events stream.
+// The old keys have no owner nor type, and the creation time is only known if the deck has events.
+func readOldDeck(ctx context.Context, tx *redis.Tx, oldKey func(string) string) (*Deck, []string, []redis.XMessage, error) {
+	var shuffled, version *redis.StringCmd
+	var list *redis.StringSliceCmd
+	var events *redis.XMessageSliceCmd
+	_, err := tx.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		shuffled = pipe.Get(ctx, oldKey("shuffled"))
+		version = pipe.Get(ctx, oldKey("version"))
+		list = pipe.LRange(ctx, oldKey("cards"), 0, -1)
+		events = pipe.XRange(ctx, oldKey("events"), "-", "+")
+		return nil
+	})
+
+	// Decks created before versions existed have no version key.
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, nil, nil, err
+	}
+
+	// go-redis used to write the shuffled flag as 1 or 0.
+	isShuffled, _ := strconv.ParseBool(shuffled.Val())
+	deck := &Deck{
+		Shuffled: isShuffled,
+		Version:  parseVersion(version.Val()),
+	}
+
+	if len(events.Val()) > 0 {
+		created, err := parseEvent(events.Val()[0])
+		if err == nil && created.Type == EventTypeCreated {
+			deck.CreatedAt = created.CreatedAt
+		}
+	}
+
+	return deck, list.Val(), events.Val(), nil
+}
+
+// Calls fn for every key matching the pattern. In Redis Cluster, every master is scanned,
+// all at the same time, so the calls to fn are made one at a time.
+func scanKeys(ctx context.Context, client redis.UniversalClient, pattern string, fn func(key string) error) error {
+	var mu sync.Mutex
+	scan := func(ctx context.Context, client redis.UniversalClient) error {
+		iterator := client.Scan(ctx, 0, pattern, 100).Iterator()
+		for iterator.Next(ctx) {
+			mu.Lock()
+			err := fn(iterator.Val())
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+
+		return iterator.Err()
+	}
+
+	if cluster, ok := client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return scan(ctx, master)
+		})
+	}
+
+	return scan(ctx, client)
+}
@@ -2,202 +2,767 @@ package storage
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/certs"
+	"github.com/lucaspin/decks-api/pkg/logging"
 )
 
 // A naive implementation of a deck storage using Redis.
-// The operations done here are not atomic, so this implementation is not safe
-// to be used if the decks API are supposed to serve multiple requests for the same deck at the same time.
+// Creating a deck and drawing cards from it are atomic, but reading a deck is not:
+// its attributes are read with separate commands, so a deck read
+// while cards are being drawn from it might be inconsistent.
 //
-// To make if safe, we'd need to use distributed locks or lua scripts.
+// To make it safe, we'd need to read the deck in a lua script too.
 // See: https://lucaspin.github.io/redis/databases/2021/07/21/atomicity-in-redis-operations.html.
 //
-// In Redis, a deck is composed of two keys:
-// 'decks:{deckID}:cards' - a Redis list that holds the current list of card codes for the deck.
-// 'decks:{deckID}:shuffled' - a Redis value indicating if the deck is shuffled or not.
+// In Redis, a deck is composed of three keys:
+// 'decks:{<deckID>}:meta' - a Redis hash with the 'shuffled', 'version', 'drawn', 'created_at', 'owner' and 'type' of the deck.
+//   The version is bumped every time the deck changes, and created_at is in Unix milliseconds.
+// 'decks:{<deckID>}:packed' - a Redis string with the cards of the deck, packed with cards.Pack, a byte each.
+//   Cards are not removed from it when they are drawn: 'drawn' in the hash says how many were drawn from the top.
+// 'decks:{<deckID>}:events' - a Redis stream with all the changes made to the deck.
+//
+// The deck ID is a hash tag, between braces, so in Redis Cluster all the keys of a deck are in the same slot,
+// and the scripts and transactions using several of them keep working.
+//
+// Decks used to keep their cards in a 'decks:{<deckID>}:cards' list of card codes, before that,
+// in separate 'shuffled' and 'version' keys instead of the hash, and, before that, in keys without hash tags,
+// like 'decks:<deckID>:cards'. Those are not found, or can't be read, until they are moved to the current keys with MigrateRedisKeys.
 //
 // This makes it easy to draw cards from the deck:
-// just use the LPOP operation on the cards key.
+// just use GETRANGE on the packed cards, HINCRBY 'drawn' and the version in the hash, and XADD the event,
+// which is done in a Lua script, so the version check, the draw and the event are atomic.
+// Reading a deck needs the hash and the packed cards, which are read in a single pipeline.
+//
+// The ID of each entry in the events stream is '0-{version}',
+// so events can be read from a specific version onwards with XRANGE.
+//
+// The number of decks is kept in the 'decks:count' counter, bumped when a deck is created,
+// so it can be read without scanning all the keys. Decks created before the counter existed are not counted.
+// In Redis Cluster, the counter is in a different slot than the deck, so it is bumped in a transaction of its own.
+//
+// Every change to a deck is also published to the 'decks:<deckID>:changes' channel,
+// so the servers with clients watching the deck know they need to read new events from the stream.
+// Each server uses a single Redis connection for all those subscriptions.
 
 type RedisStorage struct {
-	Client *redis.Client
+	// A *redis.Client in standalone and sentinel modes, and a *redis.ClusterClient in cluster mode.
+	Client redis.UniversalClient
+	broker *broker
+	pubsub *redis.PubSub
 }
 
+// How RedisStorage connects to Redis.
+const (
+	// To a single Redis server, at Host and Port.
+	RedisModeStandalone = "standalone"
+
+	// To the master of SentinelMasterName, as told by the Sentinels at SentinelAddrs,
+	// following it when Sentinel fails over to another server.
+	RedisModeSentinel = "sentinel"
+
+	// To a Redis Cluster, whose nodes are discovered from the ones at ClusterAddrs.
+	RedisModeCluster = "cluster"
+)
+
 type RedisConfig struct {
-	Host     string
-	Port     string
+	// One of the Redis modes. Standalone, if not given.
+	Mode string
+
+	// Only used in standalone mode.
+	Host string
+	Port string
+
+	// Only used in sentinel mode.
+	SentinelMasterName string
+	SentinelAddrs      []string
+	SentinelPassword   string
+
+	// Only used in cluster mode.
+	ClusterAddrs []string
+
 	Username string
 	Password string
+
+	// Redis Cluster only has database 0.
+	DB int
+
+	// How many connections are kept open, for each Redis server. Zero means the defaults of go-redis.
+	PoolSize     int
+	MinIdleConns int
+
+	// If given, the connection to Redis uses TLS, which most managed Redis services require.
+	TLS *RedisTLSConfig
 }
 
-func NewRedisStorage(config *RedisConfig) (Storage, error) {
-	// If no config is passed,
-	// we try to create it from environment variables.
-	if config == nil {
-		c, err := NewRedisConfigFromEnvironment()
-		if err != nil {
-			return nil, err
-		}
+type RedisTLSConfig struct {
+	// The CAs the certificate of the Redis server is verified with, instead of the ones of the system.
+	CAFile string
 
-		config = c
-	}
+	// The certificate presented to the Redis server, for the ones that require one, and its key.
+	CertFile string
+	KeyFile  string
 
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", config.Host, config.Port),
-		Username: config.Username,
-		Password: config.Password,
-		DB:       0,
-	})
+	// The name the certificate of the Redis server is verified for, if it is not the host.
+	ServerName string
+}
+
+const deckCountKey = "decks:count"
+
+// How many times an optimistic transaction is retried
+// when the deck changes while the transaction is being prepared.
+const maxTransactionAttempts = 10
+
+func NewRedisStorage(config *RedisConfig) (Storage, error) {
+	rdb, err := newRedisClient(config)
+	if err != nil {
+		return nil, err
+	}
 
 	// Make sure we have a valid connection before proceeding.
 	ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancelFunc()
-	_, err := rdb.Ping(ctx).Result()
+	_, err = rdb.Ping(ctx).Result()
 	if err != nil {
+		rdb.Close()
 		return nil, err
 	}
 
-	log.Printf("Successfully connected to Redis")
-	return &RedisStorage{Client: rdb}, nil
+	slog.Info("Successfully connected to Redis", "mode", config.mode())
+	storage := &RedisStorage{Client: rdb, broker: newBroker()}
+	storage.broker.onFirstWatcher = storage.subscribe
+	storage.broker.onLastWatcher = storage.unsubscribe
+	return storage, nil
 }
 
-func NewRedisConfigFromEnvironment() (*RedisConfig, error) {
-	host := os.Getenv("REDIS_HOST")
-	if host == "" {
-		return nil, fmt.Errorf("no REDIS_HOST set")
+func newRedisClient(config *RedisConfig) (redis.UniversalClient, error) {
+	var tlsConfig *tls.Config
+	if config.TLS != nil {
+		c, err := config.TLS.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig = c
 	}
 
-	port := os.Getenv("REDIS_PORT")
-	if port == "" {
-		port = "6379"
+	switch config.mode() {
+	case RedisModeStandalone:
+		return redis.NewClient(&redis.Options{
+			Addr:         fmt.Sprintf("%s:%s", config.Host, config.Port),
+			Username:     config.Username,
+			Password:     config.Password,
+			DB:           config.DB,
+			PoolSize:     config.PoolSize,
+			MinIdleConns: config.MinIdleConns,
+			TLSConfig:    tlsConfig,
+		}), nil
+	case RedisModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       config.SentinelMasterName,
+			SentinelAddrs:    config.SentinelAddrs,
+			SentinelPassword: config.SentinelPassword,
+			Username:         config.Username,
+			Password:         config.Password,
+			DB:               config.DB,
+			PoolSize:         config.PoolSize,
+			MinIdleConns:     config.MinIdleConns,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case RedisModeCluster:
+		if config.DB != 0 {
+			return nil, fmt.Errorf("redis cluster only has database 0, not %d", config.DB)
+		}
+
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        config.ClusterAddrs,
+			Username:     config.Username,
+			Password:     config.Password,
+			PoolSize:     config.PoolSize,
+			MinIdleConns: config.MinIdleConns,
+			TLSConfig:    tlsConfig,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode '%s'", config.Mode)
 	}
+}
 
-	return &RedisConfig{
-		Host:     host,
-		Port:     port,
-		Username: os.Getenv("REDIS_USERNAME"),
-		Password: os.Getenv("REDIS_PASSWORD"),
-	}, nil
+func (c *RedisConfig) mode() string {
+	if c.Mode == "" {
+		return RedisModeStandalone
+	}
+
+	return c.Mode
+}
+
+// The server name is only set if given, so the certificate of each server,
+// like every node of a cluster, is verified for its own host.
+func (c *RedisTLSConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.CAFile != "" {
+		pool, err := certs.LoadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading Redis client certificate: %v", err)
+		}
+
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
 }
 
-func (s *RedisStorage) Create(ctx context.Context, list []cards.Card, shuffled bool) (*Deck, error) {
+func (s *RedisStorage) Create(ctx context.Context, list []cards.Card, options CreateOptions) (*Deck, error) {
 	ID := uuid.New()
 	deck := Deck{
 		DeckID:   &ID,
-		Shuffled: shuffled,
+		Shuffled: options.Shuffled,
 		Cards:    list,
+		Version:  InitialVersion,
+
+		// Only milliseconds are kept in Redis.
+		CreatedAt: time.UnixMilli(time.Now().UnixMilli()),
+		Owner:     options.Owner,
+		Type:      options.Type,
 	}
 
-	cardsKey := keyForAttribute(&ID, "cards")
-	shuffledKey := keyForAttribute(&ID, "shuffled")
+	// All the keys for the deck are created in a transaction,
+	// so we never end up with a partially created deck.
+	_, err := s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, keyForAttribute(&ID, "packed"), cards.Pack(list).Data, 0)
+		pipe.HSet(ctx, keyForAttribute(&ID, "meta"), metaValues(&deck))
+		pipe.XAdd(ctx, newEventArgs(&ID, &Event{
+			Version:   InitialVersion,
+			Type:      EventTypeCreated,
+			Cards:     list,
+			Shuffled:  options.Shuffled,
+			CreatedAt: deck.CreatedAt,
+		}))
+
+		return nil
+	})
 
-	// Push the cards
-	_, err := s.Client.RPush(ctx, cardsKey, cards.CardListToCodes(list)).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	// Add shuffled attribute.
-	// If this fails, we make a small effort
-	// to delete the key we added previously for the cards.
-	_, err = s.Client.Set(ctx, shuffledKey, shuffled, 0).Result()
-	if err != nil {
-		if _, err := s.Client.Del(ctx, cardsKey).Result(); err != nil {
-			log.Printf("Error rolling back key: %v", err)
-		}
-
-		return nil, err
+	// The deck count is in another slot than the keys of the deck, so, in Redis Cluster, it can't be in the same transaction.
+	// If bumping it fails, the deck is still created, and the count is one short.
+	if err := s.Client.Incr(ctx, deckCountKey).Err(); err != nil {
+		logging.FromContext(ctx).Error("Error counting deck", "deck", ID.String(), "error", err)
 	}
 
 	return &deck, nil
 }
 
+func (s *RedisStorage) Count(ctx context.Context) (int64, error) {
+	count, err := s.Client.Get(ctx, deckCountKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+
+	return count, err
+}
+
+// The metadata and the cards are read in a single round trip.
+// If the metadata is not there, the deck doesn't exist.
 func (s *RedisStorage) Get(ctx context.Context, deckID *uuid.UUID) (*Deck, error) {
-	shuffled, err := s.getShuffledAttribute(ctx, deckID)
-	if errors.Is(err, ErrDeckNotFound) {
+	var meta *redis.StringStringMapCmd
+	var packed *redis.StringCmd
+	_, err := s.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		meta = pipe.HGetAll(ctx, keyForAttribute(deckID, "meta"))
+		packed = pipe.Get(ctx, keyForAttribute(deckID, "packed"))
+		return nil
+	})
+
+	// Unknown error
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	if len(meta.Val()) == 0 {
 		return nil, ErrDeckNotFound
 	}
 
-	// Unknown error
+	packedDeck, err := unpackDeck(deckID, packed, meta.Val()["drawn"])
 	if err != nil {
 		return nil, err
 	}
 
-	// We know the deck exists, so let's grab all cards for it.
-	cardsKey := keyForAttribute(deckID, "cards")
-	list, err := s.Client.LRange(ctx, cardsKey, 0, -1).Result()
+	deck := parseMeta(meta.Val())
+	deck.DeckID = deckID
+	deck.Cards = packedDeck.Cards()
+	return deck, nil
+}
+
+// Checks the deck exists and is at the expected version, moves the drawn pointer past the cards drawn,
+// bumps the version, and records the event. The drawn cards are returned packed.
+var drawScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return {'not_found'}
+end
+
+local version = tonumber(redis.call('HGET', KEYS[1], 'version'))
+local ifVersion = tonumber(ARGV[2])
+if ifVersion ~= 0 and ifVersion ~= version then
+  return {'version_mismatch'}
+end
+
+local size = redis.call('STRLEN', KEYS[2])
+if size == 0 then
+  return {'not_migrated'}
+end
+
+if string.byte(redis.call('GETRANGE', KEYS[2], 0, 0)) ~= tonumber(ARGV[5]) then
+  return {'unknown_encoding'}
+end
+
+local drawn = tonumber(redis.call('HGET', KEYS[1], 'drawn')) or 0
+local remaining = size - 1 - drawn
+if remaining <= 0 then
+  return {'empty'}
+end
+
+local count = tonumber(ARGV[1])
+if count <= 0 then
+  return {'ok', tostring(version), remaining, ''}
+end
+
+if count > remaining then
+  count = remaining
+end
+
+local packed = redis.call('GETRANGE', KEYS[2], 1 + drawn, drawn + count)
+redis.call('HINCRBY', KEYS[1], 'drawn', count)
+version = redis.call('HINCRBY', KEYS[1], 'version', 1)
+
+-- The events keep the codes of the cards, same as the API.
+local ranks = {'A', '2', '3', '4', '5', '6', '7', '8', '9', '10', 'J', 'Q', 'K'}
+local suits = {'C', 'D', 'H', 'S'}
+local codes = {}
+for i = 1, count do
+  local b = string.byte(packed, i)
+  codes[i] = ranks[b % 16] .. suits[math.floor(b / 16) + 1]
+end
+
+redis.call('XADD', KEYS[3], '0-' .. version,
+  'type', 'drawn',
+  'cards', table.concat(codes, ','),
+  'created_at', ARGV[3])
+redis.call('PUBLISH', ARGV[4], version)
+
+return {'ok', tostring(version), remaining - count, packed}
+`)
+
+func (s *RedisStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*DrawResult, error) {
+	keys := []string{
+		keyForAttribute(deckID, "meta"),
+		keyForAttribute(deckID, "packed"),
+		keyForAttribute(deckID, "events"),
+	}
+
+	now := time.Now().UnixMilli()
+	args := []interface{}{count, ifVersion, now, changesChannel(deckID.String()), int(cards.PackedVersion)}
+	reply, err := drawScript.Run(ctx, s.Client, keys, args...).Slice()
+
+	// Unknown error
 	if err != nil {
 		return nil, err
 	}
 
-	// We know this is valid because we validate it before inserting.
-	cardList, _ := cards.CodesToCardList(list)
+	status, _ := reply[0].(string)
+	switch status {
+	case "not_found":
+		return nil, ErrDeckNotFound
+	case "version_mismatch":
+		return nil, ErrVersionMismatch
+	case "empty":
+		return nil, ErrEmptyDeck
+	case "not_migrated":
+		return nil, notMigratedError(deckID)
+	case "unknown_encoding":
+		return nil, fmt.Errorf("%w: deck %s has an unknown version", cards.ErrInvalidPackedDeck, deckID)
+	case "ok":
+		// The happy path, handled below.
+	default:
+		return nil, fmt.Errorf("unexpected reply from draw script: %v", reply)
+	}
 
-	return &Deck{
-		DeckID:   deckID,
-		Shuffled: shuffled,
-		Cards:    cardList,
+	version, _ := reply[1].(string)
+	remaining, _ := reply[2].(int64)
+	packed, _ := reply[3].(string)
+	cardList, err := cards.UnpackCards([]byte(packed))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DrawResult{
+		Cards:     cardList,
+		Remaining: int(remaining),
+		Version:   parseVersion(version),
 	}, nil
 }
 
-func (s *RedisStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int) ([]cards.Card, error) {
-	// We don't really need the shuffled attribute here,
-	// but LPOP returns redis.Nil when the deck does not exist,
-	// and when the deck is empty, so we use this key to check for existence.
-	_, err := s.getShuffledAttribute(ctx, deckID)
-	if errors.Is(err, ErrDeckNotFound) {
+// Same as Get, checking the deck exists and reading its events take a single round trip.
+func (s *RedisStorage) Events(ctx context.Context, deckID *uuid.UUID, afterVersion int64) ([]Event, error) {
+	var exists *redis.IntCmd
+	var entries *redis.XMessageSliceCmd
+	_, err := s.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		exists = pipe.Exists(ctx, keyForAttribute(deckID, "meta"))
+
+		// Decks created before events existed have no stream, so no events are returned for them.
+		entries = pipe.XRange(ctx, keyForAttribute(deckID, "events"), fmt.Sprintf("0-%d", afterVersion+1), "+")
+		return nil
+	})
+
+	if err != nil {
 		return nil, err
 	}
 
-	// Unknown error
+	if exists.Val() == 0 {
+		return nil, ErrDeckNotFound
+	}
+
+	events := make([]Event, len(entries.Val()))
+	for i, entry := range entries.Val() {
+		event, err := parseEvent(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		events[i] = *event
+	}
+
+	return events, nil
+}
+
+// Undoing needs to look at the events to know what to undo,
+// which is not easy to do in a Lua script, so we use an optimistic transaction instead.
+func (s *RedisStorage) Undo(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*UndoResult, error) {
+	var result *UndoResult
+	err := s.optimisticTransaction(ctx, deckID, func(tx *redis.Tx) error {
+		deck, err := s.Get(ctx, deckID)
+		if err != nil {
+			return err
+		}
+
+		if ifVersion != AnyVersion && deck.Version != ifVersion {
+			return ErrVersionMismatch
+		}
+
+		events, err := s.Events(ctx, deckID, 0)
+		if err != nil {
+			return err
+		}
+
+		list, reverts, err := planUndo(events, count)
+		if err != nil {
+			return err
+		}
+
+		event := &Event{
+			Version:   deck.Version + 1,
+			Type:      EventTypeUndone,
+			Cards:     list,
+			Reverts:   reverts,
+			CreatedAt: time.Now(),
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			remaining := append(append([]cards.Card{}, list...), deck.Cards...)
+			pipe.Set(ctx, keyForAttribute(deckID, "packed"), cards.Pack(remaining).Data, 0)
+			pipe.HSet(ctx, keyForAttribute(deckID, "meta"), "version", event.Version, "drawn", 0)
+			pipe.XAdd(ctx, newEventArgs(deckID, event))
+			pipe.Publish(ctx, changesChannel(deckID.String()), event.Version)
+			return nil
+		})
+
+		result = &UndoResult{
+			Cards:     list,
+			Remaining: len(list) + deck.Remaining(),
+			Version:   event.Version,
+		}
+
+		return err
+	})
+
 	if err != nil {
 		return nil, err
 	}
 
-	cardsKey := keyForAttribute(deckID, "cards")
-	list, err := s.Client.LPopCount(ctx, cardsKey, count).Result()
+	return result, nil
+}
 
-	// If we receive a redis.Nil, we know that means an empty deck,
-	// because we checked for deck existence above.
-	if errors.Is(err, redis.Nil) {
-		return nil, ErrEmptyDeck
-	}
+// Redis can't shuffle the cards for us, so we read them, shuffle them, and write them back,
+// in an optimistic transaction, same as Undo.
+func (s *RedisStorage) Shuffle(ctx context.Context, deckID *uuid.UUID, shuffle func([]cards.Card) []cards.Card, ifVersion int64) (*Deck, error) {
+	var result *Deck
+	err := s.optimisticTransaction(ctx, deckID, func(tx *redis.Tx) error {
+		deck, err := s.Get(ctx, deckID)
+		if err != nil {
+			return err
+		}
+
+		if ifVersion != AnyVersion && deck.Version != ifVersion {
+			return ErrVersionMismatch
+		}
+
+		deck.Cards = shuffle(deck.Cards)
+		deck.Shuffled = true
+		deck.Version++
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, keyForAttribute(deckID, "packed"), cards.Pack(deck.Cards).Data, 0)
+			pipe.HSet(ctx, keyForAttribute(deckID, "meta"), "shuffled", strconv.FormatBool(true), "version", deck.Version, "drawn", 0)
+			pipe.XAdd(ctx, newEventArgs(deckID, &Event{
+				Version:   deck.Version,
+				Type:      EventTypeShuffled,
+				Cards:     deck.Cards,
+				CreatedAt: time.Now(),
+			}))
+
+			pipe.Publish(ctx, changesChannel(deckID.String()), deck.Version)
+			return nil
+		})
+
+		result = deck
+		return err
+	})
 
-	// Unknown error
 	if err != nil {
 		return nil, err
 	}
 
-	// We know this is valid because we validate it before inserting.
-	cardList, _ := cards.CodesToCardList(list)
-	return cardList, nil
+	return result, nil
+}
+
+// Runs fn with the metadata of the deck, where its version is, being watched.
+// If the deck changes before fn is done, the transaction fails, and fn is tried again.
+func (s *RedisStorage) optimisticTransaction(ctx context.Context, deckID *uuid.UUID, fn func(tx *redis.Tx) error) error {
+	for attempt := 0; attempt < maxTransactionAttempts; attempt++ {
+		err := s.Client.Watch(ctx, fn, keyForAttribute(deckID, "meta"))
+
+		// The deck changed while we were preparing the transaction, so we try again.
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+
+		return err
+	}
+
+	return fmt.Errorf("deck changed too many times while trying to update it")
+}
+
+func (s *RedisStorage) Watch(ctx context.Context, deckID *uuid.UUID, afterVersion int64) (<-chan Event, error) {
+	return s.broker.watch(ctx, s, deckID, afterVersion)
+}
+
+func (s *RedisStorage) Ping(ctx context.Context) error {
+	return s.Client.Ping(ctx).Err()
+}
+
+// Closes the subscription to changes, if there is one, and then the client.
+// Other users of the client, like the rate limiter, can't use it after this either.
+func (s *RedisStorage) Close() error {
+	s.broker.subscriptionsMu.Lock()
+	pubsub := s.pubsub
+	s.broker.subscriptionsMu.Unlock()
+
+	if pubsub != nil {
+		if err := pubsub.Close(); err != nil {
+			return err
+		}
+	}
+
+	return s.Client.Close()
 }
 
+// Called by the broker, when a deck gets its first watcher on this server.
+// The subscription outlives the watcher, so it is not canceled with its context.
+// If it fails, the watchers still see the changes, when the broker polls for them.
+func (s *RedisStorage) subscribe(ctx context.Context, deckID string) {
+	if s.pubsub == nil {
+		s.pubsub = s.Client.Subscribe(context.WithoutCancel(ctx), changesChannel(deckID))
+		go s.receiveChanges(s.pubsub)
+		return
+	}
+
+	if err := s.pubsub.Subscribe(context.WithoutCancel(ctx), changesChannel(deckID)); err != nil {
+		logging.FromContext(ctx).Error("Error subscribing to deck changes", "deck_id", deckID, "error", err)
+	}
+}
+
+// Called by the broker, when the last watcher for a deck on this server goes away,
+// which is usually because its context is done, so it is not canceled with it either.
+func (s *RedisStorage) unsubscribe(ctx context.Context, deckID string) {
+	if err := s.pubsub.Unsubscribe(context.WithoutCancel(ctx), changesChannel(deckID)); err != nil {
+		logging.FromContext(ctx).Error("Error unsubscribing from deck changes", "deck_id", deckID, "error", err)
+	}
+}
+
+func (s *RedisStorage) receiveChanges(pubsub *redis.PubSub) {
+	for message := range pubsub.Channel() {
+		deckID := strings.TrimSuffix(strings.TrimPrefix(message.Channel, "decks:"), ":changes")
+		s.broker.publish(deckID)
+	}
+}
+
+// Channels are not keys, and are not kept in slots, so they have no hash tags.
+func changesChannel(deckID string) string {
+	return fmt.Sprintf("decks:%s:changes", deckID)
+}
+
+// The deck ID is a hash tag, so every key of a deck is in the same Redis Cluster slot.
 func keyForAttribute(deckID *uuid.UUID, attrName string) string {
-	return fmt.Sprintf("decks:%s:%s", deckID.String(), attrName)
+	return fmt.Sprintf("decks:{%s}:%s", deckID.String(), attrName)
 }
 
-func (s *RedisStorage) getShuffledAttribute(ctx context.Context, deckID *uuid.UUID) (bool, error) {
-	shuffledKey := keyForAttribute(deckID, "shuffled")
-	_, err := s.Client.Get(ctx, shuffledKey).Result()
+// The fields of the metadata hash of a deck, with its cards packed again, so none drawn.
+// The creation time is left out if it is not known, like for some migrated decks.
+func metaValues(deck *Deck) []string {
+	values := []string{
+		"shuffled", strconv.FormatBool(deck.Shuffled),
+		"version", strconv.FormatInt(deck.Version, 10),
+		"drawn", "0",
+		"owner", deck.Owner,
+		"type", string(deck.Type),
+	}
 
-	// When a key does not exist, Redis gives us a Nil reply
-	if errors.Is(err, redis.Nil) {
-		return false, ErrDeckNotFound
+	if !deck.CreatedAt.IsZero() {
+		values = append(values, "created_at", strconv.FormatInt(deck.CreatedAt.UnixMilli(), 10))
+	}
+
+	return values
+}
+
+// Decks still keeping their cards in a list have no packed cards,
+// so they can't be read until MigrateRedisKeys moves them.
+func unpackDeck(deckID *uuid.UUID, packed *redis.StringCmd, drawn string) (*cards.PackedDeck, error) {
+	if errors.Is(packed.Err(), redis.Nil) {
+		return nil, notMigratedError(deckID)
+	}
+
+	count, _ := strconv.Atoi(drawn)
+	return cards.Unpack([]byte(packed.Val()), count)
+}
+
+func notMigratedError(deckID *uuid.UUID) error {
+	return fmt.Errorf("deck %s is kept in an older layout, and needs to be moved with MigrateRedisKeys", deckID)
+}
+
+// Decks migrated without a creation time get a zero CreatedAt.
+// Shuffles used to write the shuffled flag as 1, so anything strconv.ParseBool accepts is read.
+func parseMeta(meta map[string]string) *Deck {
+	shuffled, _ := strconv.ParseBool(meta["shuffled"])
+	deck := &Deck{
+		Shuffled: shuffled,
+		Version:  parseVersion(meta["version"]),
+		Owner:    meta["owner"],
+		Type:     DeckType(meta["type"]),
 	}
 
-	// Some other unknown error.
+	if createdAt, err := strconv.ParseInt(meta["created_at"], 10, 64); err == nil {
+		deck.CreatedAt = time.UnixMilli(createdAt)
+	}
+
+	return deck
+}
+
+// Decks created before versions existed have no version,
+// so they are considered to be at the initial version.
+func parseVersion(value string) int64 {
+	version, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
-		return false, err
+		return InitialVersion
 	}
 
-	return shuffledKey == "true", nil
+	return version
+}
+
+func newEventArgs(deckID *uuid.UUID, event *Event) *redis.XAddArgs {
+	values := []string{
+		"type", string(event.Type),
+		"cards", strings.Join(cards.CardListToCodes(event.Cards), ","),
+		"created_at", strconv.FormatInt(event.CreatedAt.UnixMilli(), 10),
+	}
+
+	if event.Type == EventTypeCreated {
+		values = append(values, "shuffled", strconv.FormatBool(event.Shuffled))
+	}
+
+	if len(event.Reverts) > 0 {
+		reverts := make([]string, len(event.Reverts))
+		for i, version := range event.Reverts {
+			reverts[i] = strconv.FormatInt(version, 10)
+		}
+
+		values = append(values, "reverts", strings.Join(reverts, ","))
+	}
+
+	return &redis.XAddArgs{
+		Stream: keyForAttribute(deckID, "events"),
+		ID:     fmt.Sprintf("0-%d", event.Version),
+		Values: values,
+	}
+}
+
+func parseEvent(message redis.XMessage) (*Event, error) {
+	var version int64
+	if _, err := fmt.Sscanf(message.ID, "0-%d", &version); err != nil {
+		return nil, fmt.Errorf("invalid event ID '%s'", message.ID)
+	}
+
+	event := &Event{
+		Version: version,
+		Type:    EventType(fieldAsString(message, "type")),
+		Cards:   []cards.Card{},
+	}
+
+	if codes := fieldAsString(message, "cards"); codes != "" {
+		list, err := cards.CodesToCardList(strings.Split(codes, ","))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cards in event '%s': %v", message.ID, err)
+		}
+
+		event.Cards = list
+	}
+
+	event.Shuffled = fieldAsString(message, "shuffled") == "true"
+
+	if reverts := fieldAsString(message, "reverts"); reverts != "" {
+		for _, v := range strings.Split(reverts, ",") {
+			event.Reverts = append(event.Reverts, parseVersion(v))
+		}
+	}
+
+	createdAt, _ := strconv.ParseInt(fieldAsString(message, "created_at"), 10, 64)
+	event.CreatedAt = time.UnixMilli(createdAt)
+	return event, nil
+}
+
+func fieldAsString(message redis.XMessage, name string) string {
+	value, _ := message.Values[name].(string)
+	return value
 }
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The migrations for each database are in a directory named after it, like migrations/sqlite,
+// in files named after the version they take the schema to, like 0001_create_decks.sql.
+// They are applied in order, and the ones applied are recorded in the schema_migrations table,
+// so each one is only applied once. Migrations already released must never change: add a new one instead.
+//
+//go:embed migrations
+var sqlMigrations embed.FS
+
+type sqlMigration struct {
+	version int
+	name    string
+	path    string
+}
+
+// Applies the migrations that were not applied yet, each in its own transaction.
+func (s *SQLStorage) migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations: %v", err)
+	}
+
+	migrations, err := listSQLMigrations(s.dialect.name)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if err := s.applyMigration(ctx, migration); err != nil {
+			return fmt.Errorf("error applying migration %s: %v", migration.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLStorage) applyMigration(ctx context.Context, migration sqlMigration) error {
+	script, err := sqlMigrations.ReadFile(migration.path)
+	if err != nil {
+		return err
+	}
+
+	applied := false
+	err = s.transaction(ctx, nil, func(tx *sql.Tx) error {
+		if s.dialect.lockMigrations != "" {
+			if _, err := tx.ExecContext(ctx, s.dialect.lockMigrations); err != nil {
+				return err
+			}
+		}
+
+		// Checked after the lock is taken, in case another server applied it in the meantime.
+		var count int
+		err := tx.QueryRowContext(ctx, s.dialect.query("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), migration.version).Scan(&count)
+		if err != nil || count > 0 {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			s.dialect.query("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+			migration.version, migration.name, time.Now().UTC(),
+		)
+
+		applied = err == nil
+		return err
+	})
+
+	if err == nil && applied {
+		slog.Info("Applied migration", "migration", migration.name)
+	}
+
+	return err
+}
+
+// Lists the migrations of the database, sorted by version.
+func listSQLMigrations(database string) ([]sqlMigration, error) {
+	dir := path.Join("migrations", database)
+	entries, err := fs.ReadDir(sqlMigrations, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The entries are sorted by name, and the versions are zero-padded, so they are sorted by version too.
+	migrations := []sqlMigration{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || !strings.HasSuffix(entry.Name(), ".sql") {
+			return nil, fmt.Errorf("invalid migration name '%s'", entry.Name())
+		}
+
+		migrations = append(migrations, sqlMigration{version: version, name: name, path: path.Join(dir, entry.Name())})
+	}
+
+	return migrations, nil
+}
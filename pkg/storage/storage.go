@@ -3,38 +3,158 @@ package storage
 import (
 	"context"
 	"errors"
-	"log"
-	"os"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/deckerrors"
 )
 
-var ErrDeckNotFound = errors.New("deck not found")
-var ErrEmptyDeck = errors.New("deck has no more cards")
+var ErrDeckNotFound = deckerrors.ErrDeckNotFound
+var ErrEmptyDeck = deckerrors.ErrEmptyDeck
+var ErrVersionMismatch = deckerrors.ErrVersionMismatch
 
+// These errors are answers to what the client asked for, not failures of the storage.
+var clientErrors = []error{
+	ErrDeckNotFound,
+	ErrEmptyDeck,
+	ErrVersionMismatch,
+	ErrNothingToUndo,
+
+	// The client went away before the operation was done.
+	context.Canceled,
+}
+
+func IsClientError(err error) bool {
+	for _, clientErr := range clientErrors {
+		if errors.Is(err, clientErr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Used with conditional operations, when any version of the deck is accepted.
+const AnyVersion int64 = 0
+
+// The version of a newly created deck.
+const InitialVersion int64 = 1
+
+// The version is bumped on every change to the deck,
+// so clients can tell if the deck changed since they last saw it.
 type Deck struct {
 	DeckID   *uuid.UUID
 	Shuffled bool
 	Cards    []cards.Card
+	Version  int64
+
+	// Decks migrated from the Redis keys used before these existed don't have them.
+	CreatedAt time.Time
+	Owner     string
+	Type      DeckType
+}
+
+// Whether a deck was created with all the cards, or only some of them.
+type DeckType string
+
+const (
+	DeckTypeFull    DeckType = "full"
+	DeckTypePartial DeckType = "partial"
+)
+
+// What a deck is created with, besides its cards.
+type CreateOptions struct {
+	Shuffled bool
+
+	// Who is creating the deck, like the client of the HTTP API. Empty if not known.
+	Owner string
+
+	Type DeckType
 }
 
 func (d *Deck) Remaining() int {
 	return len(d.Cards)
 }
 
+// The cards drawn from a deck, and the state of the deck after drawing them.
+type DrawResult struct {
+	Cards     []cards.Card
+	Remaining int
+	Version   int64
+}
+
 type Storage interface {
-	Create(ctx context.Context, cards []cards.Card, shuffled bool) (*Deck, error)
+	Create(ctx context.Context, cards []cards.Card, options CreateOptions) (*Deck, error)
 	Get(ctx context.Context, deckID *uuid.UUID) (*Deck, error)
-	Draw(ctx context.Context, deckID *uuid.UUID, count int) ([]cards.Card, error)
+
+	// Draws cards from the top of the deck.
+	// If ifVersion is not AnyVersion, the cards are only drawn
+	// if the deck is still at that version. Otherwise, ErrVersionMismatch is returned.
+	Draw(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*DrawResult, error)
+
+	// Shuffles the cards remaining in the deck, in the order given by the shuffle function.
+	// Same as Draw, ifVersion can be used to only shuffle if the deck didn't change.
+	Shuffle(ctx context.Context, deckID *uuid.UUID, shuffle func([]cards.Card) []cards.Card, ifVersion int64) (*Deck, error)
+
+	// Lists the changes made to the deck, oldest first,
+	// skipping the ones made up to afterVersion.
+	Events(ctx context.Context, deckID *uuid.UUID, afterVersion int64) ([]Event, error)
+
+	// Reverts the last count draws from the deck, putting the cards back on top of it.
+	// Same as Draw, ifVersion can be used to only undo if the deck didn't change.
+	Undo(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (*UndoResult, error)
+
+	// Streams the changes made to the deck after afterVersion, as they happen.
+	// The changes that already happened are streamed first.
+	// The channel is closed when the context is done.
+	Watch(ctx context.Context, deckID *uuid.UUID, afterVersion int64) (<-chan Event, error)
+
+	// Counts the decks kept in the storage.
+	Count(ctx context.Context) (int64, error)
+
+	// Releases the connections used by the storage.
+	// Watches still going on are stopped, and the storage can't be used after it.
+	Close() error
 }
 
-func NewStorage() (Storage, error) {
-	switch os.Getenv("DECK_STORAGE_TYPE") {
-	case "redis":
-		return NewRedisStorage(nil)
-	default:
-		log.Printf("No DECK_STORAGE_TYPE set, using in-memory default\n")
+// Implemented by storages that depend on something that can be unavailable, like a Redis server.
+type HealthChecker interface {
+	// Returns an error if the storage can't be used right now.
+	Ping(ctx context.Context) error
+}
+
+// Checks the storage can be used, if it knows how to.
+// Storages that don't implement HealthChecker are always considered healthy.
+func Ping(ctx context.Context, s Storage) error {
+	if checker, ok := s.(HealthChecker); ok {
+		return checker.Ping(ctx)
+	}
+
+	return nil
+}
+
+// The types of storage NewStorage can create.
+const (
+	TypeInMemory = "in-memory"
+	TypeRedis    = "redis"
+	TypeBolt     = "bolt"
+	TypeSQL      = "sql"
+)
+
+// Creates a storage of the given type. Each config is only used by the type it is for.
+func NewStorage(storageType string, redisConfig *RedisConfig, boltConfig *BoltConfig, sqlConfig *SQLConfig) (Storage, error) {
+	switch storageType {
+	case TypeRedis:
+		return NewRedisStorage(redisConfig)
+	case TypeBolt:
+		return NewBoltStorage(boltConfig)
+	case TypeSQL:
+		return NewSQLStorage(sqlConfig)
+	case TypeInMemory:
 		return NewInMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage type '%s'", storageType)
 	}
 }
@@ -2,110 +2,617 @@ package storage
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
 	"github.com/google/uuid"
 	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/certs/certstest"
+	"github.com/lucaspin/decks-api/pkg/redistest"
 	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
 )
 
-func Test__StorageTest(t *testing.T) {
-	runTestForAllImplementations(t, func(storageName string, storage Storage) {
-		t.Run(fmt.Sprintf("%s - get with deck that does not exist -> ErrDeckNotFound error", storageName), func(t *testing.T) {
-			ID := uuid.New()
-			_, err := storage.Get(context.Background(), &ID)
-			require.ErrorIs(t, err, ErrDeckNotFound)
-		})
+type StorageImplementation struct {
+	CreateFn func(t *testing.T) (Storage, error)
+}
+
+// The implementations the tests in storagetest run against, from conformance_test.go.
+// Each test creates its own storage, so the ones needing a server skip when there is none.
+var storageImplementations = map[string]StorageImplementation{
+	"redis": {
+		CreateFn: func(t *testing.T) (Storage, error) {
+			return NewRedisStorage(testRedisConfig(t))
+		},
+	},
+	"redis-cluster": {
+		CreateFn: func(t *testing.T) (Storage, error) {
+			if os.Getenv("TEST_REDIS_ADDR") != "" {
+				t.Skip("the Redis server at TEST_REDIS_ADDR is not a cluster")
+			}
+
+			// miniredis acts as a cluster with a single node, with all the slots,
+			// so it accepts keys from different slots in the same command. Those are checked here instead.
+			server := miniredis.RunT(t)
+			s, err := NewRedisStorage(&RedisConfig{Mode: RedisModeCluster, ClusterAddrs: []string{server.Addr()}})
+			if err != nil {
+				return nil, err
+			}
 
-		t.Run(fmt.Sprintf("%s - get with existing deck -> returns deck", storageName), func(t *testing.T) {
-			cards := []cards.Card{
-				{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
-				{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+			redistest.CheckSlots(t, s.(*RedisStorage).Client)
+			return s, nil
+		},
+	},
+	"in-memory": {
+		CreateFn: func(t *testing.T) (Storage, error) {
+			return NewInMemoryStorage(), nil
+		},
+	},
+	"bolt": {
+		CreateFn: func(t *testing.T) (Storage, error) {
+			return NewBoltStorage(&BoltConfig{Path: filepath.Join(t.TempDir(), "decks.db")})
+		},
+	},
+	"sqlite": {
+		CreateFn: func(t *testing.T) (Storage, error) {
+			return NewSQLStorage(&SQLConfig{Driver: SQLDriverSQLite, DSN: filepath.Join(t.TempDir(), "decks.sqlite")})
+		},
+	},
+	"postgres": {
+		CreateFn: func(t *testing.T) (Storage, error) {
+			// Like the PostgreSQL server created by docker compose. See the docker-compose.yml file.
+			dsn := os.Getenv("TEST_POSTGRES_DSN")
+			if dsn == "" {
+				t.Skip("TEST_POSTGRES_DSN is not set")
 			}
 
-			d1, err := storage.Create(context.Background(), cards, false)
-			require.NoError(t, err)
+			return NewSQLStorage(&SQLConfig{Driver: SQLDriverPostgres, DSN: dsn})
+		},
+	},
+}
+
+// The Redis server at TEST_REDIS_ADDR, like the one created by docker compose,
+// or, if it is not set, miniredis, running in the test process, so no server is needed.
+func testRedisConfig(t *testing.T) *RedisConfig {
+	if addr := os.Getenv("TEST_REDIS_ADDR"); addr != "" {
+		host, port, err := net.SplitHostPort(addr)
+		require.NoError(t, err)
+		return &RedisConfig{Host: host, Port: port}
+	}
+
+	server := miniredis.RunT(t)
+	return &RedisConfig{Host: server.Host(), Port: server.Port()}
+}
+
+func Test__RedisStorageTLS(t *testing.T) {
+	ca := certstest.NewCA(t)
+	serverCert := ca.Issue(t, t.TempDir(), "localhost")
+	clientCert := ca.Issue(t, t.TempDir(), "decks-api")
+	server, err := miniredis.RunTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert.Load(t)},
+		ClientCAs:    ca.Pool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})
+
+	require.NoError(t, err)
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Addr())
+	require.NoError(t, err)
 
-			d2, err := storage.Get(context.Background(), d1.DeckID)
-			require.NoError(t, err)
-			require.Equal(t, d1, d2)
+	t.Run("server CA and client certificate -> connected", func(t *testing.T) {
+		storage, err := NewRedisStorage(&RedisConfig{
+			Host: host,
+			Port: port,
+			TLS: &RedisTLSConfig{
+				CAFile:     ca.CertFile,
+				CertFile:   clientCert.CertFile,
+				KeyFile:    clientCert.KeyFile,
+				ServerName: "localhost",
+			},
 		})
 
-		t.Run(fmt.Sprintf("%s - drawing from empty deck -> error", storageName), func(t *testing.T) {
-			initial := []cards.Card{{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)}}
-			deck, err := storage.Create(context.Background(), initial, false)
-			require.NoError(t, err)
+		require.NoError(t, err)
+		defer storage.Close()
+
+		_, err = storage.Create(context.Background(), []cards.Card{}, CreateOptions{})
+		require.NoError(t, err)
+	})
+
+	t.Run("server certificate not trusted -> error", func(t *testing.T) {
+		_, err := NewRedisStorage(&RedisConfig{Host: host, Port: port, TLS: &RedisTLSConfig{ServerName: "localhost"}})
+		require.Error(t, err)
+	})
+
+	t.Run("no TLS -> error", func(t *testing.T) {
+		_, err := NewRedisStorage(&RedisConfig{Host: host, Port: port})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid CA file -> error", func(t *testing.T) {
+		_, err := NewRedisStorage(&RedisConfig{Host: host, Port: port, TLS: &RedisTLSConfig{CAFile: serverCert.KeyFile}})
+		require.ErrorContains(t, err, "no certificates found")
+	})
+}
 
-			// draw all the cards
-			_, err = storage.Draw(context.Background(), deck.DeckID, 1)
-			require.NoError(t, err)
+func Test__RedisStorageSentinel(t *testing.T) {
+	master := miniredis.RunT(t)
+	sentinel := newFakeSentinel(t, "decks", master.Host(), master.Port())
 
-			// deck is empty
-			_, err = storage.Draw(context.Background(), deck.DeckID, 1)
-			require.ErrorIs(t, err, ErrEmptyDeck)
+	t.Run("connects to the master given by the sentinels", func(t *testing.T) {
+		storage, err := NewRedisStorage(&RedisConfig{
+			Mode:               RedisModeSentinel,
+			SentinelMasterName: "decks",
+			SentinelAddrs:      []string{"127.0.0.1:1", sentinel},
 		})
 
-		t.Run(fmt.Sprintf("%s - drawing more cards than deck has -> error", storageName), func(t *testing.T) {
-			initial := []cards.Card{
-				{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
-				{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
-			}
+		require.NoError(t, err)
+		defer storage.Close()
 
-			deck, err := storage.Create(context.Background(), initial, false)
-			require.NoError(t, err)
+		deck, err := storage.Create(context.Background(), []cards.Card{}, CreateOptions{})
+		require.NoError(t, err)
+		require.True(t, master.Exists(keyForAttribute(deck.DeckID, "meta")))
+	})
 
-			cards, err := storage.Draw(context.Background(), deck.DeckID, 3)
-			require.NoError(t, err)
-			require.Len(t, cards, 2)
+	t.Run("unknown master -> error", func(t *testing.T) {
+		_, err := NewRedisStorage(&RedisConfig{
+			Mode:               RedisModeSentinel,
+			SentinelMasterName: "other",
+			SentinelAddrs:      []string{sentinel},
 		})
 
-		t.Run(fmt.Sprintf("%s - drawing removes cards from deck", storageName), func(t *testing.T) {
-			initial := []cards.Card{
-				{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
-				{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
-			}
+		require.Error(t, err)
+	})
+}
 
-			deck, err := storage.Create(context.Background(), initial, false)
-			require.NoError(t, err)
+func Test__RedisConfig(t *testing.T) {
+	t.Run("cluster with a database other than 0 -> error", func(t *testing.T) {
+		_, err := NewRedisStorage(&RedisConfig{Mode: RedisModeCluster, ClusterAddrs: []string{"127.0.0.1:1"}, DB: 1})
+		require.ErrorContains(t, err, "redis cluster only has database 0, not 1")
+	})
 
-			drawn, err := storage.Draw(context.Background(), deck.DeckID, 1)
-			require.NoError(t, err)
-			require.Equal(t, []cards.Card{{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)}}, drawn)
+	t.Run("unknown mode -> error", func(t *testing.T) {
+		_, err := NewRedisStorage(&RedisConfig{Mode: "replicated"})
+		require.ErrorContains(t, err, "unknown redis mode 'replicated'")
+	})
 
-			deck, err = storage.Get(context.Background(), deck.DeckID)
-			require.NoError(t, err)
-			require.Len(t, deck.Cards, 1)
-		})
+	t.Run("every key of a deck has the deck ID as hash tag", func(t *testing.T) {
+		deckID := uuid.New()
+		for _, attribute := range []string{"meta", "packed", "events"} {
+			key := keyForAttribute(&deckID, attribute)
+			start := strings.Index(key, "{")
+			end := strings.Index(key, "}")
+			require.Equal(t, deckID.String(), key[start+1:end], key)
+		}
 	})
 }
 
-type StorageImplementation struct {
-	CreateFn func() (Storage, error)
+func Test__RedisStoragePackedCards(t *testing.T) {
+	server := miniredis.RunT(t)
+	s, err := NewRedisStorage(&RedisConfig{Host: server.Host(), Port: server.Port()})
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx := context.Background()
+	list := cards.NewCardGenerator().FullCardList()
+	deck, err := s.Create(ctx, list, CreateOptions{Type: DeckTypeFull})
+	require.NoError(t, err)
+
+	t.Run("cards are packed, a byte each", func(t *testing.T) {
+		packed, err := server.Get(keyForAttribute(deck.DeckID, "packed"))
+		require.NoError(t, err)
+		require.Equal(t, string(cards.Pack(list).Data), packed)
+	})
+
+	t.Run("drawing only moves the pointer", func(t *testing.T) {
+		result, err := s.Draw(ctx, deck.DeckID, 3, AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, list[:3], result.Cards)
+
+		packed, err := server.Get(keyForAttribute(deck.DeckID, "packed"))
+		require.NoError(t, err)
+		require.Len(t, packed, 53)
+		require.Equal(t, "3", server.HGet(keyForAttribute(deck.DeckID, "meta"), "drawn"))
+
+		events, err := s.Events(ctx, deck.DeckID, InitialVersion)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, list[:3], events[0].Cards)
+	})
+
+	t.Run("shuffling packs the remaining cards again", func(t *testing.T) {
+		_, err := s.Shuffle(ctx, deck.DeckID, cards.NewCardGenerator().Shuffle, AnyVersion)
+		require.NoError(t, err)
+
+		packed, err := server.Get(keyForAttribute(deck.DeckID, "packed"))
+		require.NoError(t, err)
+		require.Len(t, packed, 50)
+		require.Equal(t, "0", server.HGet(keyForAttribute(deck.DeckID, "meta"), "drawn"))
+		require.Equal(t, "true", server.HGet(keyForAttribute(deck.DeckID, "meta"), "shuffled"))
+	})
+
+	t.Run("shuffled flag written as 1 by older shuffles -> read as shuffled", func(t *testing.T) {
+		other, err := s.Create(ctx, list, CreateOptions{Type: DeckTypeFull})
+		require.NoError(t, err)
+		server.HSet(keyForAttribute(other.DeckID, "meta"), "shuffled", "1")
+
+		other, err = s.Get(ctx, other.DeckID)
+		require.NoError(t, err)
+		require.True(t, other.Shuffled)
+	})
+
+	t.Run("unknown encoding version -> error", func(t *testing.T) {
+		other, err := s.Create(ctx, list, CreateOptions{Type: DeckTypeFull})
+		require.NoError(t, err)
+		require.NoError(t, server.Set(keyForAttribute(other.DeckID, "packed"), "\x09\x01"))
+
+		_, err = s.Get(ctx, other.DeckID)
+		require.ErrorIs(t, err, cards.ErrInvalidPackedDeck)
+
+		_, err = s.Draw(ctx, other.DeckID, 1, AnyVersion)
+		require.ErrorIs(t, err, cards.ErrInvalidPackedDeck)
+	})
 }
 
-// Currenly, we only these two implementations.
-var storageImplementations = map[string]StorageImplementation{
-	"redis": {
-		CreateFn: func() (Storage, error) {
-			// This requires a redis server to be available in this address.
-			// This Redis server is created by docker compose.
-			// See the docker-compose.yml file.
-			return NewRedisStorage(&RedisConfig{Host: "redis", Port: "6379"})
-		},
-	},
-	"in-memory": {
-		CreateFn: func() (Storage, error) {
-			return NewInMemoryStorage(), nil
-		},
-	},
+// Answers the commands go-redis sends to Sentinel, with the address of a single master.
+func newFakeSentinel(t *testing.T, masterName, masterHost, masterPort string) string {
+	sentinel, err := server.NewServer("127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(sentinel.Close)
+
+	sentinel.Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		switch {
+		case len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name") && args[1] == masterName:
+			c.WriteStrings([]string{masterHost, masterPort})
+		case len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name"):
+			c.WriteNull()
+		default:
+			// No other sentinels, and no replicas.
+			c.WriteLen(0)
+		}
+	})
+
+	// Failovers are announced through pub/sub, but there are none here.
+	sentinel.Register("SUBSCRIBE", func(c *server.Peer, cmd string, args []string) {
+		for i, channel := range args {
+			c.WriteLen(3)
+			c.WriteBulk("subscribe")
+			c.WriteBulk(channel)
+			c.WriteInt(i + 1)
+		}
+	})
+
+	sentinel.Register("PING", func(c *server.Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+
+	return sentinel.Addr().String()
 }
 
-// Easy way to run a bunch of tests for all available storage implementations.
-func runTestForAllImplementations(t *testing.T, test func(string, Storage)) {
-	for name, implementation := range storageImplementations {
-		storage, err := implementation.CreateFn()
-		require.Nil(t, err)
-		test(name, storage)
-	}
+func Test__MigrateRedisKeys(t *testing.T) {
+	server := miniredis.RunT(t)
+	s, err := NewRedisStorage(&RedisConfig{Host: server.Host(), Port: server.Port()})
+	require.NoError(t, err)
+	defer s.Close()
+
+	client := s.(*RedisStorage).Client
+	ctx := context.Background()
+	createdAt := time.UnixMilli(time.Now().Add(-time.Hour).UnixMilli())
+
+	// Before hash tags, with two cards drawn.
+	untagged := uuid.New()
+	server.Set(fmt.Sprintf("decks:%s:shuffled", untagged), "1")
+	server.Set(fmt.Sprintf("decks:%s:version", untagged), "2")
+	_, err = server.Push(fmt.Sprintf("decks:%s:cards", untagged), "KH", "QD")
+	require.NoError(t, err)
+	require.NoError(t, client.XAdd(ctx, newEventArgs(&untagged, &Event{
+		Version:   1,
+		Type:      EventTypeCreated,
+		Cards:     []cards.Card{{Suit: cards.CardSuitSpades, Rank: cards.CardRank(1)}},
+		Shuffled:  true,
+		CreatedAt: createdAt,
+	})).Err())
+
+	require.NoError(t, client.Rename(ctx, keyForAttribute(&untagged, "events"), fmt.Sprintf("decks:%s:events", untagged)).Err())
+
+	// With hash tags, but with separate shuffled and version keys.
+	tagged := uuid.New()
+	server.Set(keyForAttribute(&tagged, "shuffled"), "0")
+	server.Set(keyForAttribute(&tagged, "version"), "1")
+	_, err = server.Push(keyForAttribute(&tagged, "cards"), "AS")
+	require.NoError(t, err)
+
+	// Before versions and events existed.
+	unversioned := uuid.New()
+	server.Set(fmt.Sprintf("decks:%s:shuffled", unversioned), "0")
+
+	// With the metadata in the hash, but the cards in a list of codes.
+	listed := uuid.New()
+	server.HSet(keyForAttribute(&listed, "meta"), "shuffled", "true", "version", "3", "owner", "key:abc", "type", "partial")
+	_, err = server.Push(keyForAttribute(&listed, "cards"), "2C", "10H")
+	require.NoError(t, err)
+
+	// Same, with every card drawn, so there is no list.
+	drawn := uuid.New()
+	server.HSet(keyForAttribute(&drawn, "meta"), "shuffled", "false", "version", "2")
+
+	// Already in the current keys.
+	current, err := s.Create(ctx, []cards.Card{}, CreateOptions{Type: DeckTypeFull})
+	require.NoError(t, err)
+
+	t.Run("decks with a list of cards can't be read before they are moved", func(t *testing.T) {
+		_, err := s.Get(ctx, &listed)
+		require.ErrorContains(t, err, "needs to be moved with MigrateRedisKeys")
+
+		_, err = s.Draw(ctx, &listed, 1, AnyVersion)
+		require.ErrorContains(t, err, "needs to be moved with MigrateRedisKeys")
+	})
+
+	result, err := MigrateRedisKeys(ctx, client)
+	require.NoError(t, err)
+	require.Equal(t, &MigrationResult{Migrated: 5}, result)
+
+	t.Run("decks without hash tags are moved", func(t *testing.T) {
+		deck, err := s.Get(ctx, &untagged)
+		require.NoError(t, err)
+		require.True(t, deck.Shuffled)
+		require.Equal(t, int64(2), deck.Version)
+		require.Equal(t, []string{"KH", "QD"}, cards.CardListToCodes(deck.Cards))
+		require.True(t, createdAt.Equal(deck.CreatedAt))
+
+		events, err := s.Events(ctx, &untagged, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, EventTypeCreated, events[0].Type)
+
+		for _, attribute := range []string{"shuffled", "version", "cards", "events"} {
+			require.False(t, server.Exists(fmt.Sprintf("decks:%s:%s", untagged, attribute)), attribute)
+		}
+	})
+
+	t.Run("decks with hash tags are moved", func(t *testing.T) {
+		deck, err := s.Get(ctx, &tagged)
+		require.NoError(t, err)
+		require.False(t, deck.Shuffled)
+		require.Equal(t, InitialVersion, deck.Version)
+		require.Equal(t, []string{"AS"}, cards.CardListToCodes(deck.Cards))
+		require.True(t, deck.CreatedAt.IsZero())
+		require.False(t, server.Exists(keyForAttribute(&tagged, "shuffled")))
+		require.False(t, server.Exists(keyForAttribute(&tagged, "version")))
+	})
+
+	t.Run("decks without versions are moved", func(t *testing.T) {
+		deck, err := s.Get(ctx, &unversioned)
+		require.NoError(t, err)
+		require.Equal(t, InitialVersion, deck.Version)
+		require.Empty(t, deck.Cards)
+	})
+
+	t.Run("decks with a list of cards are packed", func(t *testing.T) {
+		deck, err := s.Get(ctx, &listed)
+		require.NoError(t, err)
+		require.True(t, deck.Shuffled)
+		require.Equal(t, int64(3), deck.Version)
+		require.Equal(t, "key:abc", deck.Owner)
+		require.Equal(t, []string{"2C", "10H"}, cards.CardListToCodes(deck.Cards))
+		require.False(t, server.Exists(keyForAttribute(&listed, "cards")))
+
+		result, err := s.Draw(ctx, &listed, 1, AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, []string{"2C"}, cards.CardListToCodes(result.Cards))
+		require.Equal(t, 1, result.Remaining)
+	})
+
+	t.Run("decks with every card drawn are packed", func(t *testing.T) {
+		deck, err := s.Get(ctx, &drawn)
+		require.NoError(t, err)
+		require.Empty(t, deck.Cards)
+
+		_, err = s.Draw(ctx, &drawn, 1, AnyVersion)
+		require.ErrorIs(t, err, ErrEmptyDeck)
+	})
+
+	t.Run("decks in the current keys are left alone", func(t *testing.T) {
+		deck, err := s.Get(ctx, current.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, current, deck)
+	})
+
+	t.Run("running again moves nothing", func(t *testing.T) {
+		result, err := MigrateRedisKeys(ctx, client)
+		require.NoError(t, err)
+		require.Equal(t, &MigrationResult{}, result)
+	})
+}
+
+func Test__BoltStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decks.db")
+
+	t.Run("decks survive reopening the file", func(t *testing.T) {
+		storage, err := NewBoltStorage(&BoltConfig{Path: path})
+		require.NoError(t, err)
+
+		generator := cards.NewCardGenerator()
+		created, err := storage.Create(context.Background(), generator.FullCardList(), CreateOptions{Owner: "key:abc", Type: DeckTypeFull})
+		require.NoError(t, err)
+		_, err = storage.Draw(context.Background(), created.DeckID, 3, AnyVersion)
+		require.NoError(t, err)
+		require.NoError(t, storage.Close())
+
+		storage, err = NewBoltStorage(&BoltConfig{Path: path})
+		require.NoError(t, err)
+		defer storage.Close()
+
+		deck, err := storage.Get(context.Background(), created.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, created.Cards[3:], deck.Cards)
+		require.Equal(t, int64(2), deck.Version)
+		require.Equal(t, "key:abc", deck.Owner)
+
+		events, err := storage.Events(context.Background(), created.DeckID, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, created.Cards[:3], events[1].Cards)
+
+		count, err := storage.Count(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, int64(1), count)
+	})
+
+	t.Run("file already in use -> error", func(t *testing.T) {
+		storage, err := NewBoltStorage(&BoltConfig{Path: path})
+		require.NoError(t, err)
+		defer storage.Close()
+
+		// The lock on the file keeps it from being opened again until it is closed.
+		_, err = bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Millisecond})
+		require.Error(t, err)
+	})
+}
+
+func Test__BoltEncoding(t *testing.T) {
+	t.Run("events are decoded as they were encoded", func(t *testing.T) {
+		event := &Event{
+			Version:   7,
+			Type:      EventTypeUndone,
+			Cards:     []cards.Card{{Suit: cards.CardSuitSpades, Rank: 13}, {Suit: cards.CardSuitClubs, Rank: 1}},
+			Reverts:   []int64{3, 5},
+			CreatedAt: time.UnixMilli(time.Now().UnixMilli()),
+		}
+
+		decoded, err := decodeEvent(7, encodeEvent(event))
+		require.NoError(t, err)
+		require.Equal(t, event, decoded)
+	})
+
+	t.Run("each card takes a single byte", func(t *testing.T) {
+		list := cards.NewCardGenerator().FullCardList()
+		withCards := encodeDeck(&Deck{Cards: list})
+		withoutCards := encodeDeck(&Deck{Cards: []cards.Card{}})
+		require.Equal(t, len(list), len(withCards)-len(withoutCards))
+	})
+
+	t.Run("invalid data -> error", func(t *testing.T) {
+		valid := encodeDeck(&Deck{Version: 3, Cards: []cards.Card{{Suit: cards.CardSuitHearts, Rank: 2}}})
+		invalidCard := append([]byte{}, valid...)
+		invalidCard[len(invalidCard)-1] = 0xff
+
+		for name, data := range map[string][]byte{
+			"empty":           {},
+			"unknown version": append([]byte{9}, valid[1:]...),
+			"truncated":       valid[:len(valid)-1],
+			"trailing bytes":  append(append([]byte{}, valid...), 0),
+			"invalid card":    invalidCard,
+		} {
+			_, err := decodeDeck(data)
+			require.ErrorIs(t, err, errInvalidEncoding, name)
+		}
+	})
+}
+
+func Test__SQLStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decks.sqlite")
+
+	t.Run("migrations are only applied once", func(t *testing.T) {
+		migrations, err := listSQLMigrations(SQLDriverSQLite)
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+
+		storage, err := NewSQLStorage(&SQLConfig{Driver: SQLDriverSQLite, DSN: path})
+		require.NoError(t, err)
+		created, err := storage.Create(context.Background(), []cards.Card{{Suit: cards.CardSuitHearts, Rank: 5}}, CreateOptions{})
+		require.NoError(t, err)
+		require.NoError(t, storage.Close())
+
+		storage, err = NewSQLStorage(&SQLConfig{Driver: SQLDriverSQLite, DSN: path})
+		require.NoError(t, err)
+		defer storage.Close()
+
+		var applied int
+		require.NoError(t, storage.(*SQLStorage).db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied))
+		require.Equal(t, len(migrations), applied)
+
+		deck, err := storage.Get(context.Background(), created.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, created, deck)
+	})
+
+	t.Run("every database has the same migrations", func(t *testing.T) {
+		sqlite, err := listSQLMigrations(SQLDriverSQLite)
+		require.NoError(t, err)
+		postgres, err := listSQLMigrations(SQLDriverPostgres)
+		require.NoError(t, err)
+		require.Len(t, postgres, len(sqlite))
+		for i := range sqlite {
+			require.Equal(t, sqlite[i].name, postgres[i].name)
+		}
+	})
+
+	t.Run("placeholders are numbered for PostgreSQL", func(t *testing.T) {
+		query := "SELECT * FROM decks WHERE id = ? AND version > ?"
+		require.Equal(t, query, sqlDialects[SQLDriverSQLite].query(query))
+		require.Equal(t, "SELECT * FROM decks WHERE id = $1 AND version > $2", sqlDialects[SQLDriverPostgres].query(query))
+	})
+
+	t.Run("unknown driver -> error", func(t *testing.T) {
+		_, err := NewSQLStorage(&SQLConfig{Driver: "oracle"})
+		require.ErrorContains(t, err, "unknown SQL driver 'oracle'")
+	})
+}
+
+func Test__Broker(t *testing.T) {
+	t.Run("notifications are not held up by a slow subscription", func(t *testing.T) {
+		b := newBroker()
+		release := make(chan struct{})
+		b.onLastWatcher = func(context.Context, string) {}
+		b.onFirstWatcher = func(ctx context.Context, deckID string) {
+			if deckID == "slow" {
+				<-release
+			}
+		}
+
+		w := b.subscribe(context.Background(), "fast")
+		subscribed := make(chan struct{})
+		go func() {
+			b.subscribe(context.Background(), "slow")
+			close(subscribed)
+		}()
+
+		// the slow subscription is in progress, but the other decks are still notified, and can still be watched
+		require.Eventually(t, func() bool {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			return len(b.watchers["slow"]) == 1
+		}, time.Second, time.Millisecond)
+
+		b.publish("fast")
+		require.Len(t, w.notify, 1)
+		b.subscribe(context.Background(), "fast")
+
+		close(release)
+		<-subscribed
+	})
+
+	t.Run("subscriptions end up matching the watchers", func(t *testing.T) {
+		b := newBroker()
+		calls := []string{}
+		b.onFirstWatcher = func(ctx context.Context, deckID string) { calls = append(calls, "subscribe") }
+		b.onLastWatcher = func(ctx context.Context, deckID string) { calls = append(calls, "unsubscribe") }
+
+		first := b.subscribe(context.Background(), "deck")
+		second := b.subscribe(context.Background(), "deck")
+		b.unsubscribe(context.Background(), "deck", first)
+		require.Equal(t, []string{"subscribe"}, calls)
+
+		b.unsubscribe(context.Background(), "deck", second)
+		require.Equal(t, []string{"subscribe", "unsubscribe"}, calls)
+		require.Empty(t, b.subscribed)
+	})
 }
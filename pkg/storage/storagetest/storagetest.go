@@ -0,0 +1,777 @@
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// Creates the storage a test runs against. Every test gets its own, closed when the test is done,
+// so storages that need a server can call t.Skip when there is none.
+type NewStorageFunc func(t *testing.T) (storage.Storage, error)
+
+var twoCards = []cards.Card{
+	{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+	{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+}
+
+// Runs the tests every Storage implementation must pass, as subtests of t.
+func Run(t *testing.T, newStorage NewStorageFunc) {
+	// Checked once first, so if there is no server, all the tests are skipped, or fail, together.
+	s, err := newStorage(t)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	open := func(t *testing.T) storage.Storage {
+		s, err := newStorage(t)
+		require.NoError(t, err)
+
+		// Some tests close the storage themselves, so closing it again may fail.
+		t.Cleanup(func() { _ = s.Close() })
+		return s
+	}
+
+	t.Run("get with deck that does not exist -> ErrDeckNotFound error", func(t *testing.T) {
+		s := open(t)
+		ID := uuid.New()
+		_, err := s.Get(context.Background(), &ID)
+		require.ErrorIs(t, err, storage.ErrDeckNotFound)
+	})
+
+	t.Run("get with existing deck -> returns deck", func(t *testing.T) {
+		s := open(t)
+		cards := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+		}
+
+		d1, err := s.Create(context.Background(), cards, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		d2, err := s.Get(context.Background(), d1.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, d1, d2)
+	})
+
+	t.Run("concurrent draws never draw the same card", func(t *testing.T) {
+		s := open(t)
+		generator := cards.NewCardGenerator()
+		deck, err := s.Create(context.Background(), generator.FullCardList(), storage.CreateOptions{})
+		require.NoError(t, err)
+
+		results, errs := drawConcurrently(s, deck.DeckID, 13, 4, storage.AnyVersion)
+		drawn := map[string]bool{}
+		for i, result := range results {
+			require.NoError(t, errs[i])
+			for _, code := range cards.CardListToCodes(result.Cards) {
+				require.False(t, drawn[code], code)
+				drawn[code] = true
+			}
+		}
+
+		require.Len(t, drawn, 52)
+		deck, err = s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Empty(t, deck.Cards)
+		require.Equal(t, int64(14), deck.Version)
+	})
+
+	t.Run("get keeps what the deck was created with", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)}}
+		created, err := s.Create(context.Background(), initial, storage.CreateOptions{
+			Shuffled: true,
+			Owner:    "key:abc",
+			Type:     storage.DeckTypePartial,
+		})
+
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now(), created.CreatedAt, time.Second)
+
+		deck, err := s.Get(context.Background(), created.DeckID)
+		require.NoError(t, err)
+		require.True(t, deck.Shuffled)
+		require.Equal(t, "key:abc", deck.Owner)
+		require.Equal(t, storage.DeckTypePartial, deck.Type)
+		require.True(t, created.CreatedAt.Equal(deck.CreatedAt))
+
+		// Changing the deck keeps them.
+		_, err = s.Draw(context.Background(), created.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		deck, err = s.Get(context.Background(), created.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, "key:abc", deck.Owner)
+		require.Equal(t, storage.DeckTypePartial, deck.Type)
+		require.True(t, created.CreatedAt.Equal(deck.CreatedAt))
+	})
+
+	t.Run("drawing from empty deck -> error", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)}}
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		// draw all the cards
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+
+		// deck is empty
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrEmptyDeck)
+	})
+
+	t.Run("drawing more cards than deck has -> error", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		result, err := s.Draw(context.Background(), deck.DeckID, 3, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Len(t, result.Cards, 2)
+		require.Equal(t, 0, result.Remaining)
+	})
+
+	t.Run("drawing removes cards from deck", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		result, err := s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, []cards.Card{{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)}}, result.Cards)
+		require.Equal(t, 1, result.Remaining)
+
+		deck, err = s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Len(t, deck.Cards, 1)
+	})
+
+	t.Run("drawing bumps deck version", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+		require.Equal(t, storage.InitialVersion, deck.Version)
+
+		result, err := s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, storage.InitialVersion+1, result.Version)
+
+		deck, err = s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, storage.InitialVersion+1, deck.Version)
+	})
+
+	t.Run("drawing with matching version -> cards are drawn", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)}}
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		result, err := s.Draw(context.Background(), deck.DeckID, 1, deck.Version)
+		require.NoError(t, err)
+		require.Len(t, result.Cards, 1)
+	})
+
+	t.Run("drawing with stale version -> ErrVersionMismatch", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, deck.Version)
+		require.NoError(t, err)
+
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, deck.Version)
+		require.ErrorIs(t, err, storage.ErrVersionMismatch)
+
+		// nothing was drawn
+		deck, err = s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Len(t, deck.Cards, 1)
+	})
+
+	t.Run("events for deck that does not exist -> ErrDeckNotFound error", func(t *testing.T) {
+		s := open(t)
+		ID := uuid.New()
+		_, err := s.Events(context.Background(), &ID, 0)
+		require.ErrorIs(t, err, storage.ErrDeckNotFound)
+	})
+
+	t.Run("changes are recorded as events", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+			{Suit: cards.CardSuitHearts, Rank: cards.CardRank(1)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{Shuffled: true})
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 2, storage.AnyVersion)
+		require.NoError(t, err)
+
+		events, err := s.Events(context.Background(), deck.DeckID, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+
+		require.Equal(t, int64(1), events[0].Version)
+		require.Equal(t, storage.EventTypeCreated, events[0].Type)
+		require.Equal(t, initial, events[0].Cards)
+		require.True(t, events[0].Shuffled)
+		require.False(t, events[0].CreatedAt.IsZero())
+
+		require.Equal(t, int64(2), events[1].Version)
+		require.Equal(t, storage.EventTypeDrawn, events[1].Type)
+		require.Equal(t, initial[:2], events[1].Cards)
+
+		// events after a version
+		events, err = s.Events(context.Background(), deck.DeckID, 1)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, int64(2), events[0].Version)
+	})
+
+	t.Run("undo puts drawn cards back on top of the deck", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+			{Suit: cards.CardSuitHearts, Rank: cards.CardRank(1)},
+			{Suit: cards.CardSuitSpades, Rank: cards.CardRank(13)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 2, storage.AnyVersion)
+		require.NoError(t, err)
+
+		result, err := s.Undo(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, initial[1:3], result.Cards)
+		require.Equal(t, 3, result.Remaining)
+		require.Equal(t, int64(4), result.Version)
+
+		deck, err = s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, initial[1:], deck.Cards)
+		require.Equal(t, int64(4), deck.Version)
+
+		// the next undo reverts the draw before that one
+		result, err = s.Undo(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, initial[:1], result.Cards)
+
+		deck, err = s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, initial, deck.Cards)
+
+		// deck creation can't be undone
+		_, err = s.Undo(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrNothingToUndo)
+	})
+
+	t.Run("undo multiple events at once", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+			{Suit: cards.CardSuitHearts, Rank: cards.CardRank(1)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+			require.NoError(t, err)
+		}
+
+		// more events than there are to undo
+		_, err = s.Undo(context.Background(), deck.DeckID, 4, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrNothingToUndo)
+
+		result, err := s.Undo(context.Background(), deck.DeckID, 2, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, initial[1:], result.Cards)
+		require.Equal(t, 2, result.Remaining)
+	})
+
+	t.Run("undo with stale version -> ErrVersionMismatch", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)}}
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+
+		_, err = s.Undo(context.Background(), deck.DeckID, 1, deck.Version)
+		require.ErrorIs(t, err, storage.ErrVersionMismatch)
+	})
+
+	t.Run("shuffle changes order of remaining cards", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+			{Suit: cards.CardSuitHearts, Rank: cards.CardRank(1)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+
+		reverse := func(list []cards.Card) []cards.Card {
+			return []cards.Card{list[1], list[0]}
+		}
+
+		shuffled, err := s.Shuffle(context.Background(), deck.DeckID, reverse, storage.AnyVersion)
+		require.NoError(t, err)
+		require.True(t, shuffled.Shuffled)
+		require.Equal(t, int64(3), shuffled.Version)
+		require.Equal(t, []cards.Card{initial[2], initial[1]}, shuffled.Cards)
+
+		deck, err = s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.True(t, deck.Shuffled)
+		require.Equal(t, []cards.Card{initial[2], initial[1]}, deck.Cards)
+
+		events, err := s.Events(context.Background(), deck.DeckID, 2)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, storage.EventTypeShuffled, events[0].Type)
+		require.Equal(t, []cards.Card{initial[2], initial[1]}, events[0].Cards)
+	})
+
+	t.Run("shuffle with stale version -> ErrVersionMismatch", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)}}
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		_, err = s.Shuffle(context.Background(), deck.DeckID, cards.NewCardGenerator().Shuffle, deck.Version+1)
+		require.ErrorIs(t, err, storage.ErrVersionMismatch)
+	})
+
+	t.Run("undo stops at the last shuffle", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+			{Suit: cards.CardSuitHearts, Rank: cards.CardRank(1)},
+			{Suit: cards.CardSuitSpades, Rank: cards.CardRank(5)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+
+		reverse := func(list []cards.Card) []cards.Card {
+			return []cards.Card{list[2], list[1], list[0]}
+		}
+
+		_, err = s.Shuffle(context.Background(), deck.DeckID, reverse, storage.AnyVersion)
+		require.NoError(t, err)
+
+		// the draw before the shuffle can't be undone
+		_, err = s.Undo(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrNothingToUndo)
+
+		// draws after it can
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		_, err = s.Undo(context.Background(), deck.DeckID, 2, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrNothingToUndo)
+
+		result, err := s.Undo(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, []cards.Card{initial[3]}, result.Cards)
+
+		deck, err = s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, []cards.Card{initial[3], initial[2], initial[1]}, deck.Cards)
+	})
+
+	t.Run("shuffle deck that does not exist -> ErrDeckNotFound", func(t *testing.T) {
+		s := open(t)
+		ID := uuid.New()
+		_, err := s.Shuffle(context.Background(), &ID, cards.NewCardGenerator().Shuffle, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrDeckNotFound)
+	})
+
+	t.Run("replaying the event log rebuilds the deck", func(t *testing.T) {
+		s := open(t)
+		generator := cards.NewCardGenerator()
+		deck, err := s.Create(context.Background(), generator.Shuffle(generator.FullCardList()), storage.CreateOptions{Shuffled: true})
+		require.NoError(t, err)
+
+		for _, count := range []int{3, 1, 5} {
+			_, err = s.Draw(context.Background(), deck.DeckID, count, storage.AnyVersion)
+			require.NoError(t, err)
+		}
+
+		_, err = s.Undo(context.Background(), deck.DeckID, 2, storage.AnyVersion)
+		require.NoError(t, err)
+		_, err = s.Shuffle(context.Background(), deck.DeckID, generator.Shuffle, storage.AnyVersion)
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 2, storage.AnyVersion)
+		require.NoError(t, err)
+		_, err = s.Undo(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+
+		events, err := s.Events(context.Background(), deck.DeckID, 0)
+		require.NoError(t, err)
+		replayed, err := storage.Replay(events)
+		require.NoError(t, err)
+
+		current, err := s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Equal(t, current.Cards, replayed.Cards)
+		require.Equal(t, current.Version, replayed.Version)
+		require.True(t, replayed.Shuffled)
+	})
+
+	t.Run("watch deck that does not exist -> ErrDeckNotFound error", func(t *testing.T) {
+		s := open(t)
+		ID := uuid.New()
+		_, err := s.Watch(context.Background(), &ID, 0)
+		require.ErrorIs(t, err, storage.ErrDeckNotFound)
+	})
+
+	t.Run("watch streams past and new events", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		events, err := s.Watch(ctx, deck.DeckID, 0)
+		require.NoError(t, err)
+
+		event := <-events
+		require.Equal(t, storage.EventTypeCreated, event.Type)
+
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		event = <-events
+		require.Equal(t, storage.EventTypeDrawn, event.Type)
+		require.Equal(t, int64(2), event.Version)
+
+		_, err = s.Undo(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		event = <-events
+		require.Equal(t, storage.EventTypeUndone, event.Type)
+		require.Equal(t, int64(3), event.Version)
+
+		// channel is closed when context is done
+		cancel()
+		for range events {
+		}
+	})
+
+	t.Run("watch resumes after version", func(t *testing.T) {
+		s := open(t)
+		initial := []cards.Card{
+			{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+			{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+		}
+
+		deck, err := s.Create(context.Background(), initial, storage.CreateOptions{})
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		events, err := s.Watch(ctx, deck.DeckID, 1)
+		require.NoError(t, err)
+		event := <-events
+		require.Equal(t, storage.EventTypeDrawn, event.Type)
+		require.Equal(t, int64(2), event.Version)
+	})
+
+	t.Run("creating a deck increases the count", func(t *testing.T) {
+		s := open(t)
+		before, err := s.Count(context.Background())
+		require.NoError(t, err)
+
+		_, err = s.Create(context.Background(), []cards.Card{}, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		after, err := s.Count(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, before+1, after)
+	})
+
+	t.Run("drawing zero cards -> nothing is drawn, and the deck doesn't change", func(t *testing.T) {
+		s := open(t)
+		deck, err := s.Create(context.Background(), twoCards, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		result, err := s.Draw(context.Background(), deck.DeckID, 0, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Empty(t, result.Cards)
+		require.Equal(t, 2, result.Remaining)
+		require.Equal(t, storage.InitialVersion, result.Version)
+
+		requireUnchanged(t, s, deck)
+	})
+
+	t.Run("drawing a negative count -> same as drawing zero cards", func(t *testing.T) {
+		s := open(t)
+		deck, err := s.Create(context.Background(), twoCards, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		result, err := s.Draw(context.Background(), deck.DeckID, -3, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Empty(t, result.Cards)
+		require.Equal(t, 2, result.Remaining)
+		require.Equal(t, storage.InitialVersion, result.Version)
+
+		requireUnchanged(t, s, deck)
+	})
+
+	t.Run("drawing zero cards from empty deck -> ErrEmptyDeck", func(t *testing.T) {
+		s := open(t)
+		deck, err := s.Create(context.Background(), []cards.Card{}, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		_, err = s.Draw(context.Background(), deck.DeckID, 0, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrEmptyDeck)
+	})
+
+	t.Run("drawing from deck that does not exist -> ErrDeckNotFound", func(t *testing.T) {
+		s := open(t)
+		ID := uuid.New()
+		_, err := s.Draw(context.Background(), &ID, 1, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrDeckNotFound)
+	})
+
+	t.Run("creating an empty deck -> deck with no cards", func(t *testing.T) {
+		s := open(t)
+		created, err := s.Create(context.Background(), []cards.Card{}, storage.CreateOptions{})
+		require.NoError(t, err)
+		require.Equal(t, storage.InitialVersion, created.Version)
+
+		deck, err := s.Get(context.Background(), created.DeckID)
+		require.NoError(t, err)
+		require.Empty(t, deck.Cards)
+		require.Equal(t, 0, deck.Remaining())
+
+		_, err = s.Draw(context.Background(), created.DeckID, 1, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrEmptyDeck)
+	})
+
+	t.Run("drawing the whole deck -> deck is exhausted", func(t *testing.T) {
+		s := open(t)
+		list := cards.NewCardGenerator().FullCardList()
+		deck, err := s.Create(context.Background(), list, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		result, err := s.Draw(context.Background(), deck.DeckID, 52, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, list, result.Cards)
+		require.Equal(t, 0, result.Remaining)
+
+		exhausted, err := s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Empty(t, exhausted.Cards)
+
+		// Drawing again fails, without changing the deck.
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrEmptyDeck)
+		requireUnchanged(t, s, exhausted)
+	})
+
+	t.Run("undo on exhausted deck -> cards can be drawn again", func(t *testing.T) {
+		s := open(t)
+		deck, err := s.Create(context.Background(), twoCards, storage.CreateOptions{})
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 2, storage.AnyVersion)
+		require.NoError(t, err)
+
+		result, err := s.Undo(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, twoCards, result.Cards)
+		require.Equal(t, 2, result.Remaining)
+
+		drawn, err := s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Equal(t, twoCards[:1], drawn.Cards)
+	})
+
+	t.Run("shuffle exhausted deck -> deck is still empty", func(t *testing.T) {
+		s := open(t)
+		deck, err := s.Create(context.Background(), twoCards, storage.CreateOptions{})
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 2, storage.AnyVersion)
+		require.NoError(t, err)
+
+		shuffled, err := s.Shuffle(context.Background(), deck.DeckID, cards.NewCardGenerator().Shuffle, storage.AnyVersion)
+		require.NoError(t, err)
+		require.Empty(t, shuffled.Cards)
+		require.True(t, shuffled.Shuffled)
+
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrEmptyDeck)
+	})
+
+	t.Run("undo with zero or negative count -> ErrNothingToUndo", func(t *testing.T) {
+		s := open(t)
+		deck, err := s.Create(context.Background(), twoCards, storage.CreateOptions{})
+		require.NoError(t, err)
+		_, err = s.Draw(context.Background(), deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+
+		for _, count := range []int{0, -1} {
+			_, err = s.Undo(context.Background(), deck.DeckID, count, storage.AnyVersion)
+			require.ErrorIs(t, err, storage.ErrNothingToUndo)
+		}
+	})
+
+	t.Run("undo deck that does not exist -> ErrDeckNotFound", func(t *testing.T) {
+		s := open(t)
+		ID := uuid.New()
+		_, err := s.Undo(context.Background(), &ID, 1, storage.AnyVersion)
+		require.ErrorIs(t, err, storage.ErrDeckNotFound)
+	})
+
+	t.Run("concurrent draws past the end of the deck -> every card is drawn once", func(t *testing.T) {
+		s := open(t)
+		list := cards.NewCardGenerator().FullCardList()[:10]
+		deck, err := s.Create(context.Background(), list, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		results, errs := drawConcurrently(s, deck.DeckID, 8, 2, storage.AnyVersion)
+		drawn := []cards.Card{}
+		for i, result := range results {
+			// Draws made after the deck is exhausted fail.
+			if errs[i] != nil {
+				require.ErrorIs(t, errs[i], storage.ErrEmptyDeck)
+				continue
+			}
+
+			drawn = append(drawn, result.Cards...)
+		}
+
+		require.ElementsMatch(t, list, drawn)
+	})
+
+	t.Run("concurrent draws at the same version -> only one is made", func(t *testing.T) {
+		s := open(t)
+		deck, err := s.Create(context.Background(), cards.NewCardGenerator().FullCardList(), storage.CreateOptions{})
+		require.NoError(t, err)
+
+		_, errs := drawConcurrently(s, deck.DeckID, 8, 1, deck.Version)
+		made := 0
+		for _, err := range errs {
+			if err == nil {
+				made++
+				continue
+			}
+
+			require.ErrorIs(t, err, storage.ErrVersionMismatch)
+		}
+
+		require.Equal(t, 1, made)
+		deck, err = s.Get(context.Background(), deck.DeckID)
+		require.NoError(t, err)
+		require.Len(t, deck.Cards, 51)
+		require.Equal(t, storage.InitialVersion+1, deck.Version)
+	})
+
+	t.Run("closing while decks are watched -> no error", func(t *testing.T) {
+		s := open(t)
+		deck, err := s.Create(context.Background(), []cards.Card{}, storage.CreateOptions{})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events, err := s.Watch(ctx, deck.DeckID, 0)
+		require.NoError(t, err)
+		<-events
+
+		require.NoError(t, s.Close())
+	})
+
+	t.Run("storage is reachable -> no error", func(t *testing.T) {
+		s := open(t)
+		require.NoError(t, storage.Ping(context.Background(), s))
+	})
+
+	t.Run("storage is closed -> error only if it checks its health", func(t *testing.T) {
+		s := open(t)
+		require.NoError(t, s.Close())
+
+		err := storage.Ping(context.Background(), s)
+		if _, ok := s.(storage.HealthChecker); ok {
+			require.Error(t, err)
+		} else {
+			require.NoError(t, err)
+		}
+	})
+}
+
+// Checks the deck is still at the same version, with the same cards, and no events after it.
+func requireUnchanged(t *testing.T, s storage.Storage, deck *storage.Deck) {
+	current, err := s.Get(context.Background(), deck.DeckID)
+	require.NoError(t, err)
+	require.Equal(t, deck.Version, current.Version)
+	require.Equal(t, deck.Cards, current.Cards)
+
+	events, err := s.Events(context.Background(), deck.DeckID, deck.Version)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+// Makes draws of count cards, all at the same time, returning the result and error of each one.
+func drawConcurrently(s storage.Storage, deckID *uuid.UUID, draws, count int, ifVersion int64) ([]*storage.DrawResult, []error) {
+	var wg sync.WaitGroup
+	results := make([]*storage.DrawResult, draws)
+	errs := make([]error, draws)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = s.Draw(context.Background(), deckID, count, ifVersion)
+		}(i)
+	}
+
+	wg.Wait()
+	return results, errs
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/logging"
+)
+
+// Even if we are not notified about changes to a deck,
+// its events are checked this often, in case a notification was lost.
+const watchPollInterval = 15 * time.Second
+
+// Keeps track of who is watching which deck, and lets them know when a deck changes.
+// Notifications carry no data: watchers read the new events from the storage,
+// so a watcher that is notified multiple times before it gets to read the events
+// only reads them once, and a slow watcher never holds up the others.
+type broker struct {
+	mu       sync.Mutex
+	watchers map[string]map[*watcher]struct{}
+
+	// Called when a deck gets its first watcher, and when it loses its last one.
+	// Used by storages that need to subscribe to changes made by other servers.
+	// The context is the one of the first, or last, watcher, and is only used for logging.
+	//
+	// They may make network calls, so they are not called while holding mu,
+	// which would hold up every notification while the network is slow.
+	// Instead, they are called while holding subscriptionsMu, one at a time,
+	// and only when the deck being watched or not doesn't match what we are subscribed to.
+	onFirstWatcher  func(ctx context.Context, deckID string)
+	onLastWatcher   func(ctx context.Context, deckID string)
+	subscriptionsMu sync.Mutex
+	subscribed      map[string]bool
+}
+
+type watcher struct {
+	notify chan struct{}
+}
+
+func newBroker() *broker {
+	return &broker{
+		watchers:   map[string]map[*watcher]struct{}{},
+		subscribed: map[string]bool{},
+	}
+}
+
+func (b *broker) subscribe(ctx context.Context, deckID string) *watcher {
+	b.mu.Lock()
+	w := &watcher{notify: make(chan struct{}, 1)}
+	_, watched := b.watchers[deckID]
+	if !watched {
+		b.watchers[deckID] = map[*watcher]struct{}{}
+	}
+
+	b.watchers[deckID][w] = struct{}{}
+	b.mu.Unlock()
+
+	if !watched {
+		b.syncSubscription(ctx, deckID)
+	}
+
+	return w
+}
+
+func (b *broker) unsubscribe(ctx context.Context, deckID string, w *watcher) {
+	b.mu.Lock()
+	delete(b.watchers[deckID], w)
+	last := len(b.watchers[deckID]) == 0
+	if last {
+		delete(b.watchers, deckID)
+	}
+
+	b.mu.Unlock()
+
+	if last {
+		b.syncSubscription(ctx, deckID)
+	}
+}
+
+// Subscribes to, or unsubscribes from, the changes of a deck, depending on whether it is being watched now.
+// Watchers can come and go while we wait for subscriptionsMu, so the deck is checked again once we hold it,
+// and whichever call runs last leaves the subscription matching the watchers.
+func (b *broker) syncSubscription(ctx context.Context, deckID string) {
+	if b.onFirstWatcher == nil || b.onLastWatcher == nil {
+		return
+	}
+
+	b.subscriptionsMu.Lock()
+	defer b.subscriptionsMu.Unlock()
+
+	b.mu.Lock()
+	_, watched := b.watchers[deckID]
+	b.mu.Unlock()
+
+	switch {
+	case watched && !b.subscribed[deckID]:
+		b.onFirstWatcher(ctx, deckID)
+		b.subscribed[deckID] = true
+	case !watched && b.subscribed[deckID]:
+		b.onLastWatcher(ctx, deckID)
+		delete(b.subscribed, deckID)
+	}
+}
+
+func (b *broker) publish(deckID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for w := range b.watchers[deckID] {
+		// If the watcher already has a notification pending, there's no need for another one.
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Streams the events of a deck after afterVersion into a channel,
+// starting with the ones that already happened, until the context is done.
+// The storage only needs to be able to list events, and to publish to the broker when a deck changes.
+func (b *broker) watch(ctx context.Context, storage Storage, deckID *uuid.UUID, afterVersion int64) (<-chan Event, error) {
+	// We subscribe before reading the events that already happened,
+	// so we don't miss anything that happens in between.
+	w := b.subscribe(ctx, deckID.String())
+	events, err := storage.Events(ctx, deckID, afterVersion)
+	if err != nil {
+		b.unsubscribe(ctx, deckID.String(), w)
+		return nil, err
+	}
+
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		defer b.unsubscribe(ctx, deckID.String(), w)
+
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+
+		for {
+			for _, event := range events {
+				select {
+				case ch <- event:
+					afterVersion = event.Version
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.notify:
+			case <-ticker.C:
+			}
+
+			events, err = storage.Events(ctx, deckID, afterVersion)
+			if err != nil {
+				if ctx.Err() == nil {
+					logging.FromContext(ctx).Error("Error reading events", "deck_id", deckID.String(), "error", err)
+				}
+
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Wraps any storage, creating a span for each of its operations.
+// The spans are children of the span in the context given to the operation,
+// and the spans created by the backend, like the ones for Redis commands, are children of them.
+type TracedStorage struct {
+	storage storage.Storage
+	backend string
+	tracer  trace.Tracer
+}
+
+func NewTracedStorage(s storage.Storage, backend string, provider trace.TracerProvider) storage.Storage {
+	return &TracedStorage{
+		storage: s,
+		backend: backend,
+		tracer:  provider.Tracer(instrumentationName),
+	}
+}
+
+func (s *TracedStorage) Create(ctx context.Context, list []cards.Card, options storage.CreateOptions) (deck *storage.Deck, err error) {
+	ctx, span := s.start(ctx, "create",
+		attribute.Int("deck.cards", len(list)),
+		attribute.Bool("deck.shuffled", options.Shuffled),
+		attribute.String("deck.type", string(options.Type)),
+	)
+
+	defer end(span, &err)
+
+	deck, err = s.storage.Create(ctx, list, options)
+	if err == nil {
+		span.SetAttributes(attribute.String("deck.id", deck.DeckID.String()))
+	}
+
+	return deck, err
+}
+
+func (s *TracedStorage) Get(ctx context.Context, deckID *uuid.UUID) (deck *storage.Deck, err error) {
+	ctx, span := s.start(ctx, "get", deckAttribute(deckID))
+	defer end(span, &err)
+
+	return s.storage.Get(ctx, deckID)
+}
+
+func (s *TracedStorage) Draw(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (result *storage.DrawResult, err error) {
+	ctx, span := s.start(ctx, "draw", deckAttribute(deckID), attribute.Int("deck.count", count))
+	defer end(span, &err)
+
+	return s.storage.Draw(ctx, deckID, count, ifVersion)
+}
+
+func (s *TracedStorage) Shuffle(ctx context.Context, deckID *uuid.UUID, shuffle func([]cards.Card) []cards.Card, ifVersion int64) (deck *storage.Deck, err error) {
+	ctx, span := s.start(ctx, "shuffle", deckAttribute(deckID))
+	defer end(span, &err)
+
+	return s.storage.Shuffle(ctx, deckID, shuffle, ifVersion)
+}
+
+func (s *TracedStorage) Events(ctx context.Context, deckID *uuid.UUID, afterVersion int64) (events []storage.Event, err error) {
+	ctx, span := s.start(ctx, "events", deckAttribute(deckID))
+	defer end(span, &err)
+
+	return s.storage.Events(ctx, deckID, afterVersion)
+}
+
+func (s *TracedStorage) Undo(ctx context.Context, deckID *uuid.UUID, count int, ifVersion int64) (result *storage.UndoResult, err error) {
+	ctx, span := s.start(ctx, "undo", deckAttribute(deckID), attribute.Int("deck.count", count))
+	defer end(span, &err)
+
+	return s.storage.Undo(ctx, deckID, count, ifVersion)
+}
+
+// The span only covers starting to watch, not the whole watch.
+// The watch keeps reading events long after the span is done,
+// so the storage gets the original context, and its reads are not children of the span.
+func (s *TracedStorage) Watch(ctx context.Context, deckID *uuid.UUID, afterVersion int64) (events <-chan storage.Event, err error) {
+	_, span := s.start(ctx, "watch", deckAttribute(deckID))
+	defer end(span, &err)
+
+	return s.storage.Watch(ctx, deckID, afterVersion)
+}
+
+func (s *TracedStorage) Count(ctx context.Context) (count int64, err error) {
+	ctx, span := s.start(ctx, "count")
+	defer end(span, &err)
+
+	return s.storage.Count(ctx)
+}
+
+// Health checks run every few seconds, so they are not traced, to keep them from drowning everything else.
+func (s *TracedStorage) Ping(ctx context.Context) error {
+	return storage.Ping(ctx, s.storage)
+}
+
+func (s *TracedStorage) Close() error {
+	return s.storage.Close()
+}
+
+func (s *TracedStorage) start(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	attributes = append(attributes, attribute.String("storage.backend", s.backend))
+	return s.tracer.Start(ctx, "storage."+operation, trace.WithAttributes(attributes...))
+}
+
+// Takes a pointer to the error, so it can be deferred before the operation runs.
+// Client errors, like a deck not existing, are recorded, but don't mark the span as failed.
+func end(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		if !storage.IsClientError(*err) {
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+	}
+
+	span.End()
+}
+
+func deckAttribute(deckID *uuid.UUID) attribute.KeyValue {
+	return attribute.String("deck.id", deckID.String())
+}
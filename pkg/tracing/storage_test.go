@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/cards"
+	"github.com/lucaspin/decks-api/pkg/storage"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test__TracedStorage(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	server := miniredis.RunT(t)
+	redisStorage, err := storage.NewRedisStorage(&storage.RedisConfig{Host: server.Host(), Port: server.Port()})
+	require.NoError(t, err)
+	TraceRedis(redisStorage.(*storage.RedisStorage).Client, provider)
+	store := NewTracedStorage(redisStorage, "redis", provider)
+
+	list := []cards.Card{
+		{Suit: cards.CardSuitClubs, Rank: cards.CardRank(3)},
+		{Suit: cards.CardSuitDiamonds, Rank: cards.CardRank(8)},
+	}
+
+	deck, err := store.Create(context.Background(), list, storage.CreateOptions{})
+	require.NoError(t, err)
+
+	t.Run("storage spans are children of the caller span, and Redis spans are children of them", func(t *testing.T) {
+		exporter.Reset()
+		ctx, root := provider.Tracer("test").Start(context.Background(), "root")
+		_, err := store.Draw(ctx, deck.DeckID, 1, storage.AnyVersion)
+		require.NoError(t, err)
+		root.End()
+
+		spans := exporter.GetSpans()
+		draw := findSpan(t, spans, "storage.draw")
+		require.Equal(t, root.SpanContext().SpanID(), draw.Parent.SpanID())
+		require.Equal(t, root.SpanContext().TraceID(), draw.SpanContext.TraceID())
+		require.Contains(t, draw.Attributes, deckAttribute(deck.DeckID))
+
+		// Cards are drawn with a Lua script.
+		commands := []string{}
+		for _, span := range spans {
+			if span.Parent.SpanID() == draw.SpanContext.SpanID() {
+				commands = append(commands, span.Name)
+			}
+		}
+
+		require.Contains(t, commands, "evalsha")
+	})
+
+	t.Run("client errors don't mark the span as failed", func(t *testing.T) {
+		exporter.Reset()
+		ID := uuid.New()
+		_, err := store.Get(context.Background(), &ID)
+		require.ErrorIs(t, err, storage.ErrDeckNotFound)
+
+		get := findSpan(t, exporter.GetSpans(), "storage.get")
+		require.Equal(t, codes.Unset, get.Status.Code)
+		require.Len(t, get.Events, 1)
+	})
+
+	t.Run("other errors mark the span as failed", func(t *testing.T) {
+		exporter.Reset()
+		server.Close()
+		_, err := store.Get(context.Background(), deck.DeckID)
+		require.Error(t, err)
+
+		get := findSpan(t, exporter.GetSpans(), "storage.get")
+		require.Equal(t, codes.Error, get.Status.Code)
+	})
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+
+	require.FailNow(t, "span not found", name)
+	return tracetest.SpanStub{}
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-redis/redis/extra/redisotel/v8"
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// The name of the tracer used for the spans we create ourselves.
+const instrumentationName = "github.com/lucaspin/decks-api"
+
+const serviceName = "decks-api"
+
+// Trace context is read from, and written to, W3C traceparent and tracestate headers.
+var Propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
+// Flushes the spans not exported yet, and stops the exporter.
+type ShutdownFunc func(ctx context.Context) error
+
+// Where spans are sent to.
+const (
+	// Sends spans to an OpenTelemetry collector over gRPC, at OTEL_EXPORTER_OTLP_ENDPOINT, or localhost:4317.
+	ExporterOTLP = "otlp"
+
+	// Writes spans to stdout, good for local debugging.
+	ExporterStdout = "stdout"
+
+	// Nothing is traced.
+	ExporterNone = "none"
+)
+
+// Creates a tracer provider sending spans to the given exporter.
+func NewTracerProvider(ctx context.Context, exporterName string) (trace.TracerProvider, ShutdownFunc, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch exporterName {
+	case ExporterOTLP:
+		exporter, err = otlptracegrpc.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterNone:
+		slog.Info("No traces exporter set, tracing is disabled")
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown traces exporter '%s'", exporterName)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+
+	return provider, provider.Shutdown, nil
+}
+
+// Creates a span for every command sent to Redis,
+// as a child of the span in the context the command was sent with.
+func TraceRedis(client redis.UniversalClient, provider trace.TracerProvider) {
+	client.AddHook(redisotel.NewTracingHook(redisotel.WithTracerProvider(provider)))
+}
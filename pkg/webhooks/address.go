@@ -0,0 +1,86 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+)
+
+// Webhooks are sent from inside the network the server runs in, to URLs chosen by its clients,
+// so, unless that is allowed with Config.AllowPrivateAddresses, they can't be sent to addresses
+// only reachable from inside it, like other services or the metadata endpoint of cloud providers, at 169.254.169.254.
+//
+// The host of a URL is checked when a subscription is created, and the address it resolves to is checked again
+// every time a delivery connects to it, since the host could resolve to a different address by then.
+var ErrForbiddenAddress = errors.New("webhooks can't be sent to loopback, private or link-local addresses")
+
+// Shared by carrier-grade NATs, and used as private addresses by some cloud providers.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func forbiddenAddress(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// Checks every address the host of the URL resolves to can receive webhooks.
+func (d *Dispatcher) CheckURL(ctx context.Context, rawURL string) error {
+	if d.config.AllowPrivateAddresses {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %v", u.Hostname(), err)
+	}
+
+	for _, address := range addresses {
+		if forbiddenAddress(address.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, u.Hostname(), address.IP)
+		}
+	}
+
+	return nil
+}
+
+// Connections are checked after the host is resolved, right before connecting, so a host can't
+// resolve to a public address when its subscription is created, and to a private one when it is delivered to.
+// Redirects connect through the same dialer, so they are checked too.
+func newHTTPClient(config Config) *http.Client {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivateAddresses {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || forbiddenAddress(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+
+	// Through a proxy, the address checked would be the one of the proxy, not the one of the receiver.
+	transport.Proxy = nil
+	return &http.Client{Timeout: config.Timeout, Transport: transport}
+}
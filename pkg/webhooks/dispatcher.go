@@ -0,0 +1,286 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Headers sent with every delivery, besides the signature.
+const (
+	EventHeader    = "X-Webhook-Event"
+	EventIDHeader  = "X-Webhook-Event-ID"
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// How much of the response of a receiver we read, so the connection can be reused.
+const maxResponseSize = 64 * 1024
+
+type Config struct {
+	// How many times a delivery is attempted before it is marked as failed.
+	MaxAttempts int
+
+	// How long to wait before retrying a delivery for the first time.
+	// Every retry after that waits twice as long as the previous one, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// How long to wait for a receiver to respond.
+	Timeout time.Duration
+
+	// Whether webhooks can be sent to loopback, private and link-local addresses. See ErrForbiddenAddress.
+	AllowPrivateAddresses bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Timeout:        10 * time.Second,
+	}
+}
+
+// Sends events to the subscriptions interested in them.
+// Deliveries are recorded in the store, and sent in the background.
+type Dispatcher struct {
+	store  Store
+	config Config
+	client *http.Client
+	now    func() time.Time
+	wg     sync.WaitGroup
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewDispatcher(store Store, config Config) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		config: config,
+		client: newHTTPClient(config),
+		now:    time.Now,
+		done:   make(chan struct{}),
+	}
+}
+
+func (d *Dispatcher) Store() Store {
+	return d.store
+}
+
+// Sends an event, caused by the owner, to all the subscriptions of that owner interested in it.
+// Only recording the deliveries happens before returning. Sending them happens in the background.
+func (d *Dispatcher) Dispatch(ctx context.Context, owner string, event EventType, data interface{}) error {
+	subscriptions, err := d.store.ListSubscriptions(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	now := d.now()
+	payload := Payload{ID: uuid.New().String(), Type: event, CreatedAt: now, Data: data}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		if !subscription.Wants(event) {
+			continue
+		}
+
+		delivery := &Delivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			Owner:          owner,
+			EventID:        payload.ID,
+			Event:          event,
+			URL:            subscription.URL,
+			Payload:        body,
+			Status:         DeliveryPending,
+			NextAttemptAt:  &now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+
+		if err := d.store.AddDelivery(ctx, delivery); err != nil {
+			return err
+		}
+
+		d.start(delivery)
+	}
+
+	return nil
+}
+
+// Gives a failed delivery a new round of attempts.
+func (d *Dispatcher) Replay(ctx context.Context, owner, ID string) (*Delivery, error) {
+	delivery, err := d.store.GetDelivery(ctx, owner, ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if delivery.Status != DeliveryFailed {
+		return nil, ErrNotReplayable
+	}
+
+	now := d.now()
+	delivery.Status = DeliveryPending
+	delivery.NextAttemptAt = &now
+	delivery.UpdatedAt = now
+	if err := d.store.UpdateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+
+	d.start(delivery)
+	return delivery, nil
+}
+
+// Replays all the failed deliveries of an owner.
+func (d *Dispatcher) ReplayFailed(ctx context.Context, owner string) ([]Delivery, error) {
+	failed, err := d.store.ListDeliveries(ctx, owner, DeliveryFailed)
+	if err != nil {
+		return nil, err
+	}
+
+	replayed := []Delivery{}
+	for _, delivery := range failed {
+		r, err := d.Replay(ctx, owner, delivery.ID)
+		if err != nil {
+			return replayed, err
+		}
+
+		replayed = append(replayed, *r)
+	}
+
+	return replayed, nil
+}
+
+// Stops retrying deliveries, and waits for the attempts in flight to finish.
+// Nothing resumes pending deliveries when the server starts again,
+// so the ones that still had retries left are marked as failed, and can be replayed.
+func (d *Dispatcher) Close() {
+	d.once.Do(func() {
+		close(d.done)
+	})
+
+	d.wg.Wait()
+}
+
+// The delivery is copied, since the caller might still be using it.
+func (d *Dispatcher) start(delivery *Delivery) {
+	copied := *delivery
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(&copied)
+	}()
+}
+
+func (d *Dispatcher) deliver(delivery *Delivery) {
+	for attempt := 1; ; attempt++ {
+		statusCode, err := d.attempt(delivery)
+
+		now := d.now()
+		delivery.Attempts++
+		delivery.LastStatusCode = statusCode
+		delivery.UpdatedAt = now
+		delivery.NextAttemptAt = nil
+
+		switch {
+		case err == nil:
+			delivery.Status = DeliverySucceeded
+			delivery.LastError = ""
+		// Retrying won't bring back a subscription that was deleted.
+		case attempt >= d.config.MaxAttempts, errors.Is(err, ErrSubscriptionNotFound):
+			delivery.Status = DeliveryFailed
+			delivery.LastError = err.Error()
+		default:
+			next := now.Add(d.backoff(attempt))
+			delivery.NextAttemptAt = &next
+			delivery.LastError = err.Error()
+		}
+
+		// The background context is used, since deliveries outlive the requests causing them.
+		if err := d.store.UpdateDelivery(context.Background(), delivery); err != nil {
+			slog.Error("Error updating webhook delivery", "delivery_id", delivery.ID, "error", err)
+			return
+		}
+
+		if delivery.Status != DeliveryPending {
+			return
+		}
+
+		select {
+		case <-time.After(delivery.NextAttemptAt.Sub(now)):
+		case <-d.done:
+			d.abandon(delivery)
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) abandon(delivery *Delivery) {
+	delivery.Status = DeliveryFailed
+	delivery.NextAttemptAt = nil
+	delivery.UpdatedAt = d.now()
+	delivery.LastError = fmt.Sprintf("%s, and the server shut down before retrying", delivery.LastError)
+	if err := d.store.UpdateDelivery(context.Background(), delivery); err != nil {
+		slog.Error("Error updating webhook delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// Sends the delivery once, returning the status code the receiver responded with, if any.
+// Anything but a 2xx is a failure.
+func (d *Dispatcher) attempt(delivery *Delivery) (int, error) {
+	subscription, err := d.store.GetSubscription(context.Background(), delivery.Owner, delivery.SubscriptionID)
+	if err != nil {
+		return 0, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "decks-api-webhooks")
+	request.Header.Set(EventHeader, string(delivery.Event))
+	request.Header.Set(EventIDHeader, delivery.EventID)
+	request.Header.Set(DeliveryHeader, delivery.ID)
+	request.Header.Set(SignatureHeader, Sign(subscription.Secret, d.now(), delivery.Payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseSize))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("receiver responded with %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := d.config.InitialBackoff
+	for i := 1; i < attempt && backoff < d.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > d.config.MaxBackoff {
+		return d.config.MaxBackoff
+	}
+
+	return backoff
+}
@@ -0,0 +1,139 @@
+package webhooks
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// An implementation of the Store interface that keeps everything in memory.
+// Subscriptions and deliveries are lost when the server shuts down,
+// and are not shared between replicas, so if multiple replicas are running, use the Redis implementation.
+type InMemoryStore struct {
+	mu            sync.Mutex
+	now           func() time.Time
+	subscriptions map[string][]Subscription
+
+	// Deliveries of each owner, oldest first.
+	deliveries map[string][]Delivery
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		now:           time.Now,
+		subscriptions: map[string][]Subscription{},
+		deliveries:    map[string][]Delivery{},
+	}
+}
+
+func (s *InMemoryStore) CreateSubscription(ctx context.Context, subscription *Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscriptions[subscription.Owner] = append(s.subscriptions[subscription.Owner], *subscription)
+	return nil
+}
+
+func (s *InMemoryStore) GetSubscription(ctx context.Context, owner, ID string) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, subscription := range s.subscriptions[owner] {
+		if subscription.ID == ID {
+			return &subscription, nil
+		}
+	}
+
+	return nil, ErrSubscriptionNotFound
+}
+
+func (s *InMemoryStore) ListSubscriptions(ctx context.Context, owner string) ([]Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Subscription{}, s.subscriptions[owner]...), nil
+}
+
+func (s *InMemoryStore) DeleteSubscription(ctx context.Context, owner, ID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscriptions := s.subscriptions[owner]
+	for i, subscription := range subscriptions {
+		if subscription.ID == ID {
+			s.subscriptions[owner] = append(subscriptions[:i:i], subscriptions[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrSubscriptionNotFound
+}
+
+func (s *InMemoryStore) AddDelivery(ctx context.Context, delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := append(s.retained(delivery.Owner), *delivery)
+	if len(deliveries) > maxDeliveriesPerOwner {
+		deliveries = deliveries[len(deliveries)-maxDeliveriesPerOwner:]
+	}
+
+	s.deliveries[delivery.Owner] = deliveries
+	return nil
+}
+
+func (s *InMemoryStore) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := s.retained(delivery.Owner)
+	for i := range deliveries {
+		if deliveries[i].ID == delivery.ID {
+			deliveries[i] = *delivery
+			return nil
+		}
+	}
+
+	return ErrDeliveryNotFound
+}
+
+func (s *InMemoryStore) GetDelivery(ctx context.Context, owner, ID string) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, delivery := range s.retained(owner) {
+		if delivery.ID == ID {
+			return &delivery, nil
+		}
+	}
+
+	return nil, ErrDeliveryNotFound
+}
+
+func (s *InMemoryStore) ListDeliveries(ctx context.Context, owner string, status DeliveryStatus) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := s.retained(owner)
+	result := []Delivery{}
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		if status == "" || deliveries[i].Status == status {
+			result = append(result, deliveries[i])
+		}
+	}
+
+	return result, nil
+}
+
+// Drops deliveries older than the retention period.
+// Deliveries are kept in the order they were created, so the old ones are all at the start.
+func (s *InMemoryStore) retained(owner string) []Delivery {
+	deliveries := s.deliveries[owner]
+	cutoff := s.now().Add(-deliveryRetention)
+	for len(deliveries) > 0 && deliveries[0].CreatedAt.Before(cutoff) {
+		deliveries = deliveries[1:]
+	}
+
+	s.deliveries[owner] = deliveries
+	return deliveries
+}
@@ -0,0 +1,204 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// An implementation of the Store interface that keeps everything in Redis,
+// so all the replicas of the server using the same Redis share subscriptions and deliveries.
+//
+// The subscriptions of each owner are a Redis hash, 'webhooks:subscriptions:<owner>',
+// with JSON-encoded subscriptions keyed by their IDs.
+//
+// Each delivery is a JSON-encoded Redis value, 'webhooks:{<owner>}:deliveries:<ID>', which expires after the retention period.
+// The IDs of the most recent deliveries of each owner are kept in a Redis list, 'webhooks:{<owner>}:deliveries',
+// newest first. The owner is the hash tag of both, so, in Redis Cluster, the deliveries of an owner are all in the same slot,
+// where they can be added in a single transaction, and listed in a single MGET.
+// Deliveries kept by older versions, without hash tags, are not listed anymore.
+type RedisStore struct {
+	Client redis.UniversalClient
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{Client: client}
+}
+
+func (s *RedisStore) CreateSubscription(ctx context.Context, subscription *Subscription) error {
+	value, err := json.Marshal(subscription)
+	if err != nil {
+		return err
+	}
+
+	return s.Client.HSet(ctx, subscriptionsKey(subscription.Owner), subscription.ID, value).Err()
+}
+
+func (s *RedisStore) GetSubscription(ctx context.Context, owner, ID string) (*Subscription, error) {
+	value, err := s.Client.HGet(ctx, subscriptionsKey(owner), ID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := Subscription{}
+	if err := json.Unmarshal(value, &subscription); err != nil {
+		return nil, fmt.Errorf("invalid subscription '%s': %v", ID, err)
+	}
+
+	return &subscription, nil
+}
+
+func (s *RedisStore) ListSubscriptions(ctx context.Context, owner string) ([]Subscription, error) {
+	values, err := s.Client.HGetAll(ctx, subscriptionsKey(owner)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []Subscription{}
+	for ID, value := range values {
+		subscription := Subscription{}
+		if err := json.Unmarshal([]byte(value), &subscription); err != nil {
+			return nil, fmt.Errorf("invalid subscription '%s': %v", ID, err)
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	// Hashes have no order.
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+	})
+
+	return subscriptions, nil
+}
+
+func (s *RedisStore) DeleteSubscription(ctx context.Context, owner, ID string) error {
+	deleted, err := s.Client.HDel(ctx, subscriptionsKey(owner), ID).Result()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+func (s *RedisStore) AddDelivery(ctx context.Context, delivery *Delivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, deliveryKey(delivery.Owner, delivery.ID), value, deliveryRetention)
+		pipe.LPush(ctx, ownerDeliveriesKey(delivery.Owner), delivery.ID)
+		pipe.LTrim(ctx, ownerDeliveriesKey(delivery.Owner), 0, maxDeliveriesPerOwner-1)
+		pipe.Expire(ctx, ownerDeliveriesKey(delivery.Owner), deliveryRetention)
+		return nil
+	})
+
+	return err
+}
+
+func (s *RedisStore) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	updated, err := s.Client.SetXX(ctx, deliveryKey(delivery.Owner, delivery.ID), value, redis.KeepTTL).Result()
+	if err != nil {
+		return err
+	}
+
+	if !updated {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+func (s *RedisStore) GetDelivery(ctx context.Context, owner, ID string) (*Delivery, error) {
+	value, err := s.Client.Get(ctx, deliveryKey(owner, ID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrDeliveryNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := Delivery{}
+	if err := json.Unmarshal(value, &delivery); err != nil {
+		return nil, fmt.Errorf("invalid delivery '%s': %v", ID, err)
+	}
+
+	if delivery.Owner != owner {
+		return nil, ErrDeliveryNotFound
+	}
+
+	return &delivery, nil
+}
+
+func (s *RedisStore) ListDeliveries(ctx context.Context, owner string, status DeliveryStatus) ([]Delivery, error) {
+	IDs, err := s.Client.LRange(ctx, ownerDeliveriesKey(owner), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := []Delivery{}
+	if len(IDs) == 0 {
+		return deliveries, nil
+	}
+
+	keys := make([]string, len(IDs))
+	for i, ID := range IDs {
+		keys[i] = deliveryKey(owner, ID)
+	}
+
+	values, err := s.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		// The delivery expired, but its ID is still on the list.
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		delivery := Delivery{}
+		if err := json.Unmarshal([]byte(s), &delivery); err != nil {
+			return nil, fmt.Errorf("invalid delivery '%s': %v", IDs[i], err)
+		}
+
+		if status == "" || delivery.Status == status {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	return deliveries, nil
+}
+
+func subscriptionsKey(owner string) string {
+	return fmt.Sprintf("webhooks:subscriptions:%s", owner)
+}
+
+func deliveryKey(owner, ID string) string {
+	return fmt.Sprintf("webhooks:{%s}:deliveries:%s", owner, ID)
+}
+
+func ownerDeliveriesKey(owner string) string {
+	return fmt.Sprintf("webhooks:{%s}:deliveries", owner)
+}
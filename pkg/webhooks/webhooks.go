@@ -0,0 +1,141 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrDeliveryNotFound     = errors.New("delivery not found")
+	ErrNotReplayable        = errors.New("only failed deliveries can be replayed")
+)
+
+type EventType string
+
+const (
+	// A deck was created.
+	EventDeckCreated EventType = "deck.created"
+
+	// The last cards of a deck were drawn, so the next draw will fail.
+	EventDeckEmptied EventType = "deck.emptied"
+)
+
+// What is sent as the data of deck events, by both the REST and the gRPC APIs.
+type DeckData struct {
+	DeckID    *uuid.UUID `json:"deck_id"`
+	Shuffled  *bool      `json:"shuffled,omitempty"`
+	Remaining int        `json:"remaining"`
+}
+
+func AllEventTypes() []EventType {
+	return []EventType{EventDeckCreated, EventDeckEmptied}
+}
+
+func (t EventType) Valid() bool {
+	for _, eventType := range AllEventTypes() {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Where to send events to, and which ones.
+// The owner is the client that created the subscription,
+// and only events caused by that same client are sent to it.
+type Subscription struct {
+	ID        string      `json:"id"`
+	Owner     string      `json:"owner"`
+	URL       string      `json:"url"`
+	Events    []EventType `json:"events"`
+	Secret    string      `json:"secret"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+func (s *Subscription) Wants(event EventType) bool {
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// An event being sent to a subscription.
+// Deliveries are retried until they succeed, or run out of attempts.
+// Failed deliveries can be replayed, which gives them a new round of attempts.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	Owner          string          `json:"owner"`
+	EventID        string          `json:"event_id"`
+	Event          EventType       `json:"event"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// What is sent to subscriptions.
+// The ID identifies the event, and is the same for every delivery of it,
+// so receivers can use it to ignore events they already handled.
+type Payload struct {
+	ID        string      `json:"id"`
+	Type      EventType   `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Deliveries are kept for a while, so failed ones can be inspected and replayed.
+// Only the most recent deliveries of each owner are kept.
+const (
+	deliveryRetention     = 7 * 24 * time.Hour
+	maxDeliveriesPerOwner = 1000
+)
+
+type Store interface {
+	CreateSubscription(ctx context.Context, subscription *Subscription) error
+
+	// Returns ErrSubscriptionNotFound if the subscription does not exist, or belongs to someone else.
+	GetSubscription(ctx context.Context, owner, ID string) (*Subscription, error)
+
+	// Lists the subscriptions of an owner, oldest first.
+	ListSubscriptions(ctx context.Context, owner string) ([]Subscription, error)
+
+	// Returns ErrSubscriptionNotFound if the subscription does not exist, or belongs to someone else.
+	DeleteSubscription(ctx context.Context, owner, ID string) error
+
+	// Records a new delivery in the log of its owner.
+	AddDelivery(ctx context.Context, delivery *Delivery) error
+
+	// Updates a delivery already in the log.
+	// Returns ErrDeliveryNotFound if it was already removed from it.
+	UpdateDelivery(ctx context.Context, delivery *Delivery) error
+
+	// Returns ErrDeliveryNotFound if the delivery does not exist, or belongs to someone else.
+	GetDelivery(ctx context.Context, owner, ID string) (*Delivery, error)
+
+	// Lists the deliveries of an owner with the given status, newest first.
+	// An empty status lists all of them.
+	ListDeliveries(ctx context.Context, owner string, status DeliveryStatus) ([]Delivery, error)
+}
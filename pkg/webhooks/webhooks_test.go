@@ -0,0 +1,408 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lucaspin/decks-api/pkg/redistest"
+	"github.com/stretchr/testify/require"
+)
+
+func Test__Store(t *testing.T) {
+	runTestForAllImplementations(t, func(name string, store Store) {
+		t.Run(fmt.Sprintf("%s - subscriptions are listed per owner, oldest first", name), func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			first := newSubscription("list", "http://localhost/1", now)
+			second := newSubscription("list", "http://localhost/2", now.Add(time.Second))
+			other := newSubscription("someone-else", "http://localhost/3", now)
+			require.NoError(t, store.CreateSubscription(context.Background(), first))
+			require.NoError(t, store.CreateSubscription(context.Background(), second))
+			require.NoError(t, store.CreateSubscription(context.Background(), other))
+
+			subscriptions, err := store.ListSubscriptions(context.Background(), "list")
+			require.NoError(t, err)
+			require.Equal(t, []Subscription{*first, *second}, subscriptions)
+
+			subscription, err := store.GetSubscription(context.Background(), "list", first.ID)
+			require.NoError(t, err)
+			require.Equal(t, first, subscription)
+
+			_, err = store.GetSubscription(context.Background(), "list", other.ID)
+			require.ErrorIs(t, err, ErrSubscriptionNotFound)
+		})
+
+		t.Run(fmt.Sprintf("%s - subscriptions can only be deleted by their owners", name), func(t *testing.T) {
+			subscription := newSubscription("delete", "http://localhost", time.Now())
+			require.NoError(t, store.CreateSubscription(context.Background(), subscription))
+
+			require.ErrorIs(t, store.DeleteSubscription(context.Background(), "someone-else", subscription.ID), ErrSubscriptionNotFound)
+			require.NoError(t, store.DeleteSubscription(context.Background(), "delete", subscription.ID))
+			require.ErrorIs(t, store.DeleteSubscription(context.Background(), "delete", subscription.ID), ErrSubscriptionNotFound)
+
+			subscriptions, err := store.ListSubscriptions(context.Background(), "delete")
+			require.NoError(t, err)
+			require.Empty(t, subscriptions)
+		})
+
+		t.Run(fmt.Sprintf("%s - deliveries are listed newest first, and filtered by status", name), func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			first := newDelivery("deliveries", now)
+			second := newDelivery("deliveries", now.Add(time.Second))
+			require.NoError(t, store.AddDelivery(context.Background(), first))
+			require.NoError(t, store.AddDelivery(context.Background(), second))
+
+			second.Status = DeliveryFailed
+			second.Attempts = 5
+			require.NoError(t, store.UpdateDelivery(context.Background(), second))
+
+			deliveries, err := store.ListDeliveries(context.Background(), "deliveries", "")
+			require.NoError(t, err)
+			require.Equal(t, []Delivery{*second, *first}, deliveries)
+
+			deliveries, err = store.ListDeliveries(context.Background(), "deliveries", DeliveryFailed)
+			require.NoError(t, err)
+			require.Equal(t, []Delivery{*second}, deliveries)
+
+			delivery, err := store.GetDelivery(context.Background(), "deliveries", first.ID)
+			require.NoError(t, err)
+			require.Equal(t, first, delivery)
+
+			_, err = store.GetDelivery(context.Background(), "someone-else", first.ID)
+			require.ErrorIs(t, err, ErrDeliveryNotFound)
+		})
+
+		t.Run(fmt.Sprintf("%s - updating delivery not added -> error", name), func(t *testing.T) {
+			err := store.UpdateDelivery(context.Background(), newDelivery("not-added", time.Now()))
+			require.ErrorIs(t, err, ErrDeliveryNotFound)
+		})
+	})
+}
+
+func Test__Signature(t *testing.T) {
+	payload := []byte(`{"type":"deck.created"}`)
+
+	t.Run("valid signature", func(t *testing.T) {
+		require.NoError(t, Verify("secret", Sign("secret", time.Now(), payload), payload, time.Minute))
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		require.ErrorIs(t, Verify("another", Sign("secret", time.Now(), payload), payload, time.Minute), ErrInvalidSignature)
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		require.ErrorIs(t, Verify("secret", Sign("secret", time.Now(), payload), []byte(`{}`), time.Minute), ErrInvalidSignature)
+	})
+
+	t.Run("old signature", func(t *testing.T) {
+		header := Sign("secret", time.Now().Add(-time.Hour), payload)
+		require.ErrorIs(t, Verify("secret", header, payload, time.Minute), ErrInvalidSignature)
+		require.NoError(t, Verify("secret", header, payload, 0))
+	})
+
+	t.Run("malformed header", func(t *testing.T) {
+		require.ErrorIs(t, Verify("secret", "nope", payload, time.Minute), ErrInvalidSignature)
+		require.ErrorIs(t, Verify("secret", "t=abc,v1=def", payload, time.Minute), ErrInvalidSignature)
+	})
+}
+
+func Test__Dispatcher(t *testing.T) {
+	// The receivers run on loopback addresses.
+	config := Config{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond, Timeout: time.Second, AllowPrivateAddresses: true}
+
+	t.Run("signed events are sent to subscriptions interested in them", func(t *testing.T) {
+		receiver := newReceiver(http.StatusOK)
+		defer receiver.Close()
+
+		store := NewInMemoryStore()
+		dispatcher := NewDispatcher(store, config)
+		defer dispatcher.Close()
+
+		interested := newSubscription("owner", receiver.URL, time.Now())
+		notInterested := newSubscription("owner", receiver.URL, time.Now())
+		notInterested.Events = []EventType{EventDeckEmptied}
+		require.NoError(t, store.CreateSubscription(context.Background(), interested))
+		require.NoError(t, store.CreateSubscription(context.Background(), notInterested))
+
+		require.NoError(t, dispatcher.Dispatch(context.Background(), "owner", EventDeckCreated, map[string]int{"remaining": 52}))
+		require.NoError(t, dispatcher.Dispatch(context.Background(), "someone-else", EventDeckCreated, map[string]int{"remaining": 52}))
+
+		requests := receiver.waitFor(t, 1)
+		require.Equal(t, string(EventDeckCreated), requests[0].header.Get(EventHeader))
+		require.NoError(t, Verify(interested.Secret, requests[0].header.Get(SignatureHeader), requests[0].body, time.Minute))
+
+		payload := Payload{}
+		require.NoError(t, json.Unmarshal(requests[0].body, &payload))
+		require.Equal(t, EventDeckCreated, payload.Type)
+		require.Equal(t, requests[0].header.Get(EventIDHeader), payload.ID)
+		require.Equal(t, map[string]interface{}{"remaining": float64(52)}, payload.Data)
+
+		require.Eventually(t, func() bool {
+			deliveries, err := store.ListDeliveries(context.Background(), "owner", DeliverySucceeded)
+			return err == nil && len(deliveries) == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("deliveries are retried, and marked as failed after running out of attempts", func(t *testing.T) {
+		receiver := newReceiver(http.StatusInternalServerError)
+		defer receiver.Close()
+
+		store := NewInMemoryStore()
+		dispatcher := NewDispatcher(store, config)
+		defer dispatcher.Close()
+
+		require.NoError(t, store.CreateSubscription(context.Background(), newSubscription("owner", receiver.URL, time.Now())))
+		require.NoError(t, dispatcher.Dispatch(context.Background(), "owner", EventDeckCreated, nil))
+
+		requests := receiver.waitFor(t, 3)
+		require.Equal(t, requests[0].header.Get(DeliveryHeader), requests[2].header.Get(DeliveryHeader))
+
+		delivery := waitForStatus(t, store, "owner", DeliveryFailed)
+		require.Equal(t, 3, delivery.Attempts)
+		require.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+		require.Equal(t, "receiver responded with 500", delivery.LastError)
+		require.Nil(t, delivery.NextAttemptAt)
+	})
+
+	t.Run("failed deliveries can be replayed", func(t *testing.T) {
+		receiver := newReceiver(http.StatusServiceUnavailable)
+		defer receiver.Close()
+
+		store := NewInMemoryStore()
+		dispatcher := NewDispatcher(store, config)
+		defer dispatcher.Close()
+
+		require.NoError(t, store.CreateSubscription(context.Background(), newSubscription("owner", receiver.URL, time.Now())))
+		require.NoError(t, dispatcher.Dispatch(context.Background(), "owner", EventDeckCreated, nil))
+		failed := waitForStatus(t, store, "owner", DeliveryFailed)
+
+		receiver.setStatus(http.StatusOK)
+		replayed, err := dispatcher.ReplayFailed(context.Background(), "owner")
+		require.NoError(t, err)
+		require.Len(t, replayed, 1)
+		require.Equal(t, failed.ID, replayed[0].ID)
+
+		delivery := waitForStatus(t, store, "owner", DeliverySucceeded)
+		require.Equal(t, 4, delivery.Attempts)
+		require.Empty(t, delivery.LastError)
+
+		// only failed deliveries can be replayed
+		_, err = dispatcher.Replay(context.Background(), "owner", delivery.ID)
+		require.ErrorIs(t, err, ErrNotReplayable)
+
+		_, err = dispatcher.Replay(context.Background(), "someone-else", delivery.ID)
+		require.ErrorIs(t, err, ErrDeliveryNotFound)
+	})
+
+	t.Run("closing marks deliveries waiting for a retry as failed, so they can be replayed", func(t *testing.T) {
+		receiver := newReceiver(http.StatusInternalServerError)
+		defer receiver.Close()
+
+		store := NewInMemoryStore()
+		dispatcher := NewDispatcher(store, Config{MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Minute, Timeout: time.Second, AllowPrivateAddresses: true})
+
+		require.NoError(t, store.CreateSubscription(context.Background(), newSubscription("owner", receiver.URL, time.Now())))
+		require.NoError(t, dispatcher.Dispatch(context.Background(), "owner", EventDeckCreated, nil))
+		receiver.waitFor(t, 1)
+		waitForAttempts(t, store, "owner", 1)
+		dispatcher.Close()
+
+		deliveries, err := store.ListDeliveries(context.Background(), "owner", DeliveryFailed)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		require.Equal(t, 1, deliveries[0].Attempts)
+		require.Nil(t, deliveries[0].NextAttemptAt)
+		require.Equal(t, "receiver responded with 500, and the server shut down before retrying", deliveries[0].LastError)
+
+		receiver.setStatus(http.StatusOK)
+		restarted := NewDispatcher(store, config)
+		defer restarted.Close()
+		_, err = restarted.Replay(context.Background(), "owner", deliveries[0].ID)
+		require.NoError(t, err)
+		waitForStatus(t, store, "owner", DeliverySucceeded)
+	})
+
+	t.Run("deliveries to deleted subscriptions fail right away", func(t *testing.T) {
+		receiver := newReceiver(http.StatusInternalServerError)
+		defer receiver.Close()
+
+		// long enough for the subscription to be deleted before the retry
+		store := NewInMemoryStore()
+		dispatcher := NewDispatcher(store, Config{MaxAttempts: 3, InitialBackoff: 200 * time.Millisecond, MaxBackoff: time.Second, Timeout: time.Second, AllowPrivateAddresses: true})
+		defer dispatcher.Close()
+
+		subscription := newSubscription("owner", receiver.URL, time.Now())
+		require.NoError(t, store.CreateSubscription(context.Background(), subscription))
+		require.NoError(t, dispatcher.Dispatch(context.Background(), "owner", EventDeckCreated, nil))
+		receiver.waitFor(t, 1)
+		require.NoError(t, store.DeleteSubscription(context.Background(), "owner", subscription.ID))
+
+		delivery := waitForStatus(t, store, "owner", DeliveryFailed)
+		require.Equal(t, 2, delivery.Attempts)
+		require.Equal(t, ErrSubscriptionNotFound.Error(), delivery.LastError)
+	})
+
+	t.Run("deliveries to private addresses are not sent", func(t *testing.T) {
+		receiver := newReceiver(http.StatusOK)
+		defer receiver.Close()
+
+		store := NewInMemoryStore()
+		dispatcher := NewDispatcher(store, Config{MaxAttempts: 1, Timeout: time.Second})
+		defer dispatcher.Close()
+
+		require.NoError(t, store.CreateSubscription(context.Background(), newSubscription("owner", receiver.URL, time.Now())))
+		require.NoError(t, dispatcher.Dispatch(context.Background(), "owner", EventDeckCreated, nil))
+
+		delivery := waitForStatus(t, store, "owner", DeliveryFailed)
+		require.Contains(t, delivery.LastError, ErrForbiddenAddress.Error())
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		require.Empty(t, receiver.requests)
+	})
+
+	t.Run("backoff doubles up to the maximum", func(t *testing.T) {
+		dispatcher := NewDispatcher(NewInMemoryStore(), Config{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+		require.Equal(t, time.Second, dispatcher.backoff(1))
+		require.Equal(t, 2*time.Second, dispatcher.backoff(2))
+		require.Equal(t, 4*time.Second, dispatcher.backoff(3))
+		require.Equal(t, 5*time.Second, dispatcher.backoff(4))
+		require.Equal(t, 5*time.Second, dispatcher.backoff(50))
+	})
+}
+
+func Test__CheckURL(t *testing.T) {
+	dispatcher := NewDispatcher(NewInMemoryStore(), DefaultConfig())
+
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hooks",
+		"http://localhost/hooks",
+		"http://10.1.2.3/hooks",
+		"http://172.16.0.1/hooks",
+		"http://192.168.1.1/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hooks",
+		"http://0.0.0.0/hooks",
+		"http://[::1]/hooks",
+		"http://[fd00::1]/hooks",
+		"http://[fe80::1]/hooks",
+		"http://[::ffff:127.0.0.1]/hooks",
+	} {
+		require.ErrorIs(t, dispatcher.CheckURL(context.Background(), u), ErrForbiddenAddress, u)
+	}
+
+	require.NoError(t, dispatcher.CheckURL(context.Background(), "https://93.184.216.34/hooks"))
+	require.NoError(t, dispatcher.CheckURL(context.Background(), "https://[2606:2800:220:1::1]/hooks"))
+
+	allowed := NewDispatcher(NewInMemoryStore(), Config{AllowPrivateAddresses: true})
+	require.NoError(t, allowed.CheckURL(context.Background(), "http://127.0.0.1:8080/hooks"))
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []receivedRequest
+}
+
+func newReceiver(status int) *receiver {
+	r := &receiver{status: status}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, receivedRequest{header: req.Header, body: body})
+		w.WriteHeader(r.status)
+	}))
+
+	return r
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *receiver) waitFor(t *testing.T, count int) []receivedRequest {
+	var requests []receivedRequest
+	require.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		requests = append([]receivedRequest{}, r.requests...)
+		return len(requests) >= count
+	}, 2*time.Second, 5*time.Millisecond)
+
+	return requests
+}
+
+func waitForStatus(t *testing.T, store Store, owner string, status DeliveryStatus) *Delivery {
+	var delivery *Delivery
+	require.Eventually(t, func() bool {
+		deliveries, err := store.ListDeliveries(context.Background(), owner, status)
+		if err != nil || len(deliveries) == 0 {
+			return false
+		}
+
+		delivery = &deliveries[0]
+		return true
+	}, 2*time.Second, 5*time.Millisecond)
+
+	return delivery
+}
+
+func waitForAttempts(t *testing.T, store Store, owner string, attempts int) {
+	require.Eventually(t, func() bool {
+		deliveries, err := store.ListDeliveries(context.Background(), owner, "")
+		return err == nil && len(deliveries) == 1 && deliveries[0].Attempts == attempts
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+func newSubscription(owner, url string, createdAt time.Time) *Subscription {
+	return &Subscription{
+		ID:        uuid.New().String(),
+		Owner:     owner,
+		URL:       url,
+		Events:    []EventType{EventDeckCreated},
+		Secret:    "secret",
+		CreatedAt: createdAt.UTC(),
+	}
+}
+
+func newDelivery(owner string, createdAt time.Time) *Delivery {
+	return &Delivery{
+		ID:             uuid.New().String(),
+		SubscriptionID: "subscription",
+		Owner:          owner,
+		EventID:        "event",
+		Event:          EventDeckCreated,
+		URL:            "http://localhost",
+		Payload:        json.RawMessage(`{"type":"deck.created"}`),
+		Status:         DeliveryPending,
+		CreatedAt:      createdAt.UTC(),
+		UpdatedAt:      createdAt.UTC(),
+	}
+}
+
+func runTestForAllImplementations(t *testing.T, test func(string, Store)) {
+	test("in-memory", NewInMemoryStore())
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	redistest.CheckSlots(t, client)
+	test("redis", NewRedisStore(client))
+}